@@ -0,0 +1,146 @@
+package api
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"kcl-lang.io/kpm/pkg/constants"
+	"kcl-lang.io/kpm/pkg/opt"
+	"kcl-lang.io/kpm/pkg/reporter"
+)
+
+// fileModuleName is the kcl system module which reads the files in the kcl programs.
+const fileModuleName = "file"
+
+// checkFileAccess will check that the files read by the compilation are all in the file access root of the compile options.
+// The entries, the work directory and the modules imported by relative paths must be in the root after resolving symlinks,
+// and the 'file' module is rejected because the files it reads at runtime can not be restricted by the kcl runtime.
+// The dependencies resolved by kpm are not restricted.
+func checkFileAccess(opts *opt.CompileOptions) error {
+	if len(opts.FileAccessRoot()) == 0 {
+		return nil
+	}
+
+	root, err := realPath(opts.FileAccessRoot())
+	if err != nil {
+		return reporter.NewErrorEvent(reporter.FileAccessDenied, err, fmt.Sprintf("invalid file access root '%s'", opts.FileAccessRoot()))
+	}
+
+	paths := append([]string{opts.PkgPath(), opts.WorkDir}, opts.KFilenameList...)
+	for _, path := range paths {
+		if len(path) == 0 {
+			continue
+		}
+		if err := checkPathInRoot(root, path); err != nil {
+			return err
+		}
+	}
+
+	for _, path := range paths {
+		if len(path) == 0 {
+			continue
+		}
+		err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if p != path && d.Name() == "vendor" {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.Type()&fs.ModeSymlink != 0 {
+				// The symlinks to the directories are not walked, so check where they point to.
+				if err := checkPathInRoot(root, p); err != nil {
+					return err
+				}
+			}
+			if filepath.Ext(p) != constants.KFilePathSuffix {
+				return nil
+			}
+			if err := checkPathInRoot(root, p); err != nil {
+				return err
+			}
+			return checkImportsInRoot(root, p)
+		})
+		if err != nil {
+			if _, ok := err.(*reporter.KpmEvent); ok {
+				return err
+			}
+			return reporter.NewErrorEvent(reporter.FileAccessDenied, err, fmt.Sprintf("failed to check the file access of '%s'", path))
+		}
+	}
+
+	return nil
+}
+
+// checkImportsInRoot will check the import statements in the kcl file 'path'.
+func checkImportsInRoot(root, path string) error {
+	modules, err := importedModules(path)
+	if err != nil {
+		return err
+	}
+
+	for _, module := range modules {
+		if module == fileModuleName {
+			return reporter.NewErrorEvent(
+				reporter.FileAccessDenied,
+				fmt.Errorf("'%s' imports the '%s' module", path, fileModuleName),
+				"the files read by the 'file' module can not be restricted in the file access root",
+			)
+		}
+		if !strings.HasPrefix(module, ".") {
+			continue
+		}
+		if err := checkPathInRoot(root, relativeImportPath(path, module)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkPathInRoot will return an error if 'path' is out of 'root' after resolving symlinks.
+func checkPathInRoot(root, path string) error {
+	resolved, err := realPath(path)
+	if err != nil {
+		return reporter.NewErrorEvent(reporter.FileAccessDenied, err, fmt.Sprintf("failed to access '%s'", path))
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return reporter.NewErrorEvent(
+			reporter.FileAccessDenied,
+			fmt.Errorf("'%s' is out of the file access root '%s'", path, root),
+			"failed to access the files out of the file access root",
+		)
+	}
+	return nil
+}
+
+// realPath returns the absolute path of 'path' with the symlinks resolved.
+// If 'path' does not exist, the symlinks of its nearest existing parent are resolved.
+func realPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err == nil {
+		return resolved, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+	parent := filepath.Dir(abs)
+	if parent == abs {
+		return abs, nil
+	}
+	realParent, err := realPath(parent)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(realParent, filepath.Base(abs)), nil
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"kcl-lang.io/kpm/pkg/opt"
+	pkg "kcl-lang.io/kpm/pkg/package"
+	"kcl-lang.io/kpm/pkg/reporter"
+)
+
+// builtinNamePattern matches the names of the builtins which can be disabled, e.g. 'print' and 'file.read'.
+var builtinNamePattern = regexp.MustCompile(`^[A-Za-z_]\w*(\.[A-Za-z_]\w*)*$`)
+
+// importAliasPattern matches the kcl import statements with the optional alias, e.g. 'import file as f'.
+var importAliasPattern = regexp.MustCompile(`^\s*import\s+([\w.]+)(?:\s+as\s+(\w+))?`)
+
+// checkDisabledBuiltins will fail if the entries in the compile options, or the kcl files of the package imported by them,
+// use one of the builtins disabled by 'opt.WithDisabledBuiltins'.
+// The uses are found statically, where the builtin functions, e.g. 'print', are used by calling them,
+// and the functions of the system modules, e.g. 'file.read', are used by referencing them through the imported modules.
+// The comments and the string literals are skipped, but the interpolations in the strings are checked.
+func checkDisabledBuiltins(kclPkg *pkg.KclPkg, opts *opt.CompileOptions) error {
+	if len(opts.DisabledBuiltins()) == 0 {
+		return nil
+	}
+	for _, name := range opts.DisabledBuiltins() {
+		if !builtinNamePattern.MatchString(name) {
+			return reporter.NewErrorEvent(
+				reporter.DisabledBuiltin,
+				fmt.Errorf("'%s' is not the name of a function, e.g. 'print' or 'file.read'", name),
+				"invalid disabled builtin",
+			)
+		}
+	}
+
+	var files []string
+	for _, entry := range opts.KFilenameList {
+		files = append(files, kclFiles(entry)...)
+	}
+	err := walkImports(kclPkg, opts, func(file, module, path, dep string) error {
+		if len(path) != 0 {
+			files = append(files, kclFiles(path)...)
+		}
+		return nil
+	})
+	if err != nil {
+		return reporter.NewErrorEvent(reporter.FailedAccessPkgPath, err, "failed to find the kcl files to check the disabled builtins")
+	}
+
+	checked := make(map[string]bool)
+	for _, file := range files {
+		if checked[file] {
+			continue
+		}
+		checked[file] = true
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return reporter.NewErrorEvent(reporter.FailedAccessPkgPath, err, fmt.Sprintf("failed to read '%s'", file))
+		}
+		if err := findDisabledBuiltin(file, string(content), opts.DisabledBuiltins()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findDisabledBuiltin returns the error of the first use of the builtins 'names' in the kcl file 'file' with the content 'src'.
+func findDisabledBuiltin(file, src string, names []string) error {
+	lines := strings.Split(maskKclSource(src), "\n")
+
+	// The modules keyed by the names they are imported by in the file.
+	modules := make(map[string]string)
+	for _, line := range lines {
+		matches := importAliasPattern.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+		alias := matches[2]
+		if len(alias) == 0 {
+			alias = matches[1][strings.LastIndex(matches[1], ".")+1:]
+		}
+		modules[alias] = matches[1]
+	}
+
+	var patterns []*regexp.Regexp
+	var patternNames []string
+	for _, name := range names {
+		dot := strings.LastIndex(name, ".")
+		if dot < 0 {
+			patterns = append(patterns, regexp.MustCompile(`(?:^|[^\w.])(`+regexp.QuoteMeta(name)+`)\s*\(`))
+			patternNames = append(patternNames, name)
+			continue
+		}
+		for alias, module := range modules {
+			if module == name[:dot] {
+				patterns = append(patterns, regexp.MustCompile(`(?:^|[^\w.])(`+regexp.QuoteMeta(alias)+`\s*\.\s*`+regexp.QuoteMeta(name[dot+1:])+`)\b`))
+				patternNames = append(patternNames, name)
+			}
+		}
+	}
+
+	for i, line := range lines {
+		if importAliasPattern.MatchString(line) {
+			continue
+		}
+		for j, pattern := range patterns {
+			loc := pattern.FindStringSubmatchIndex(line)
+			if loc == nil {
+				continue
+			}
+			return reporter.NewErrorEvent(
+				reporter.DisabledBuiltin,
+				fmt.Errorf("'%s' is used in '%s'\n --> %s:%d:%d", patternNames[j], file, file, i+1, loc[2]+1),
+				fmt.Sprintf("the builtin '%s' is disabled", patternNames[j]),
+			)
+		}
+	}
+	return nil
+}
+
+// maskKclSource returns the kcl source 'src' with the comments and the contents of the string literals replaced by spaces,
+// so that the code can be matched line by line at the same positions. The interpolations '${...}' in the strings are kept.
+func maskKclSource(src string) string {
+	out := []byte(src)
+	mask := func(i int) {
+		if out[i] != '\n' {
+			out[i] = ' '
+		}
+	}
+	isIdent := func(c byte) bool {
+		return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+	}
+
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		if c == '#' {
+			for ; i < len(src) && src[i] != '\n'; i++ {
+				mask(i)
+			}
+			continue
+		}
+		if c != '"' && c != '\'' {
+			continue
+		}
+
+		quote := string(c)
+		if strings.HasPrefix(src[i:], strings.Repeat(quote, 3)) {
+			quote = strings.Repeat(quote, 3)
+		}
+		raw := i > 0 && (src[i-1] == 'r' || src[i-1] == 'R') && (i < 2 || !isIdent(src[i-2]))
+		i += len(quote)
+		for i < len(src) {
+			if strings.HasPrefix(src[i:], quote) {
+				i += len(quote) - 1
+				break
+			}
+			if len(quote) == 1 && src[i] == '\n' {
+				break
+			}
+			if !raw && src[i] == '\\' && i+1 < len(src) {
+				mask(i)
+				mask(i + 1)
+				i += 2
+				continue
+			}
+			if strings.HasPrefix(src[i:], "${") {
+				depth := 0
+				for ; i < len(src); i++ {
+					if src[i] == '{' {
+						depth++
+					} else if src[i] == '}' {
+						depth--
+						if depth == 0 {
+							break
+						}
+					}
+				}
+				i++
+				continue
+			}
+			mask(i)
+			i++
+		}
+	}
+	return string(out)
+}
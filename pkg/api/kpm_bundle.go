@@ -0,0 +1,268 @@
+package api
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/otiai10/copy"
+	"kcl-lang.io/kpm/pkg/client"
+	pkg "kcl-lang.io/kpm/pkg/package"
+	"kcl-lang.io/kpm/pkg/reporter"
+	"kcl-lang.io/kpm/pkg/utils"
+)
+
+// localDepsDir is the directory in the package where the local dependencies are bundled by 'PackageOptions.IncludeLocalDeps'.
+const localDepsDir = "local_deps"
+
+// stageWithLocalDeps will copy the kcl package into 'stagingPath' with its local dependencies bundled in the 'local_deps' directory,
+// and rewrite the paths of the local dependencies in 'kcl.mod' and 'kcl.mod.lock' to the bundled ones.
+func stageWithLocalDeps(kclPkg *pkg.KclPkg, stagingPath string) (*pkg.KclPkg, error) {
+	err := copy.Copy(kclPkg.HomePath, stagingPath)
+	if err != nil {
+		return nil, reporter.NewErrorEvent(reporter.FailedPackage, err, fmt.Sprintf("failed to copy '%s' to package", kclPkg.HomePath))
+	}
+
+	err = bundleLocalDeps(kclPkg.HomePath, stagingPath, filepath.Join(stagingPath, localDepsDir), make(map[string]string))
+	if err != nil {
+		return nil, err
+	}
+	return pkg.LoadKclPkg(stagingPath)
+}
+
+// stageWithAllDeps will copy the kcl package into 'stagingPath' with all its resolved dependencies bundled in the 'local_deps' directory,
+// and rewrite the dependencies of the package and the bundled dependencies to the bundled ones,
+// so that no dependency is downloaded to compile the package.
+func stageWithAllDeps(kpmcli *client.KpmClient, kclPkg *pkg.KclPkg, stagingPath string) (*pkg.KclPkg, error) {
+	stagedPkg, err := stageWithLocalDeps(kclPkg, stagingPath)
+	if err != nil {
+		return nil, err
+	}
+	err = kpmcli.ResolvePkgDepsMetadata(stagedPkg, true)
+	if err != nil {
+		return nil, err
+	}
+
+	bundlePath := filepath.Join(stagingPath, localDepsDir)
+	names := make([]string, 0, len(stagedPkg.Dependencies.Deps))
+	for name, dep := range stagedPkg.Dependencies.Deps {
+		if !dep.IsFromLocal() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		dep := stagedPkg.Dependencies.Deps[name]
+		depDstPath := filepath.Join(bundlePath, name)
+		if utils.DirExists(depDstPath) {
+			return nil, reporter.NewErrorEvent(
+				reporter.ConflictPkgName,
+				fmt.Errorf("the dependency '%s' conflicts with '%s' in the package", name, depDstPath),
+				"failed to bundle the dependencies",
+			)
+		}
+		if !utils.DirExists(dep.LocalFullPath) {
+			return nil, reporter.NewErrorEvent(reporter.DependencyNotFound, fmt.Errorf("dependency '%s' not found in '%s'", name, dep.LocalFullPath))
+		}
+		err = copy.Copy(dep.LocalFullPath, depDstPath)
+		if err != nil {
+			return nil, reporter.NewErrorEvent(reporter.FailedPackage, err, fmt.Sprintf("failed to bundle the dependency '%s'", name))
+		}
+	}
+
+	err = rewriteRemoteDeps(stagingPath, bundlePath, make(map[string]bool))
+	if err != nil {
+		return nil, err
+	}
+	return pkg.LoadKclPkg(stagingPath)
+}
+
+// rewriteRemoteDeps will rewrite the git and oci dependencies of the kcl package in 'pkgPath' to the ones bundled in 'bundlePath',
+// and the dependencies of its dependencies in turn, 'visited' is the paths of the rewritten packages.
+// The checksums in 'kcl.mod.lock' are updated to the rewritten dependencies.
+func rewriteRemoteDeps(pkgPath, bundlePath string, visited map[string]bool) error {
+	if visited[pkgPath] {
+		return nil
+	}
+	visited[pkgPath] = true
+
+	kclPkg, err := pkg.LoadKclPkg(pkgPath)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(kclPkg.ModFile.Dependencies.Deps)+len(kclPkg.Dependencies.Deps))
+	for name := range kclPkg.ModFile.Dependencies.Deps {
+		names = append(names, name)
+	}
+	for name := range kclPkg.Dependencies.Deps {
+		if _, ok := kclPkg.ModFile.Dependencies.Deps[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		modDep, inMod := kclPkg.ModFile.Dependencies.Deps[name]
+		lockDep, inLock := kclPkg.Dependencies.Deps[name]
+		dep := modDep
+		if !inMod {
+			dep = lockDep
+		}
+
+		depPath := filepath.Clean(dep.GetLocalFullPath(pkgPath))
+		if !dep.IsFromLocal() {
+			depPath = filepath.Join(bundlePath, name)
+			if !utils.DirExists(depPath) {
+				return reporter.NewErrorEvent(
+					reporter.DependencyNotFound,
+					fmt.Errorf("the dependency '%s' of '%s' is not resolved", name, pkgPath),
+					"failed to bundle the dependencies",
+				)
+			}
+		}
+		err = rewriteRemoteDeps(depPath, bundlePath, visited)
+		if err != nil {
+			return err
+		}
+		if dep.IsFromLocal() {
+			continue
+		}
+
+		relPath, err := filepath.Rel(pkgPath, depPath)
+		if err != nil {
+			return reporter.NewErrorEvent(reporter.Bug, err, "internal bugs, please contact us to fix it.")
+		}
+		source := pkg.Source{Local: &pkg.Local{Path: filepath.ToSlash(relPath)}}
+		if inMod {
+			modDep.Source = source
+			kclPkg.ModFile.Dependencies.Deps[name] = modDep
+		}
+		if inLock {
+			sum, err := utils.HashDir(depPath)
+			if err != nil {
+				return reporter.NewErrorEvent(reporter.CalSumFailed, err, fmt.Sprintf("failed to calculate checksum for '%s' in '%s'", name, depPath))
+			}
+			lockDep.Source = source
+			lockDep.Sum = sum
+			kclPkg.Dependencies.Deps[name] = lockDep
+		}
+	}
+
+	err = kclPkg.ModFile.StoreModFile()
+	if err != nil {
+		return err
+	}
+	if utils.DirExists(kclPkg.GetLockFilePath()) {
+		return kclPkg.LockDepsVersion()
+	}
+	return nil
+}
+
+// bundleLocalDeps will copy the local dependencies of the kcl package in 'srcPath' into 'bundlePath',
+// and rewrite their paths in the copy of the package in 'dstPath'.
+// The local dependencies of the bundled dependencies are bundled in turn, 'bundled' is the source paths of the bundled dependencies.
+// The local dependencies already in the package are kept as they are.
+func bundleLocalDeps(srcPath, dstPath, bundlePath string, bundled map[string]string) error {
+	kclPkg, err := pkg.LoadKclPkg(dstPath)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(kclPkg.ModFile.Dependencies.Deps))
+	for name, dep := range kclPkg.ModFile.Dependencies.Deps {
+		if dep.IsFromLocal() {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		dep := kclPkg.ModFile.Dependencies.Deps[name]
+		depSrcPath, err := filepath.Abs(dep.GetLocalFullPath(srcPath))
+		if err != nil {
+			return reporter.NewErrorEvent(reporter.Bug, err, "internal bugs, please contact us to fix it.")
+		}
+		if relPath, err := filepath.Rel(srcPath, depSrcPath); err == nil && !strings.HasPrefix(relPath, "..") {
+			continue
+		}
+
+		depDstPath := filepath.Join(bundlePath, name)
+		if src, ok := bundled[name]; ok {
+			if src != depSrcPath {
+				return reporter.NewErrorEvent(
+					reporter.ConflictPkgName,
+					fmt.Errorf("the local dependency '%s' comes from both '%s' and '%s'", name, src, depSrcPath),
+					"failed to bundle the local dependencies",
+				)
+			}
+		} else {
+			if !utils.DirExists(depSrcPath) {
+				return reporter.NewErrorEvent(reporter.DependencyNotFound, fmt.Errorf("dependency '%s' not found in '%s'", name, depSrcPath))
+			}
+			bundled[name] = depSrcPath
+			err = copy.Copy(depSrcPath, depDstPath)
+			if err != nil {
+				return reporter.NewErrorEvent(reporter.FailedPackage, err, fmt.Sprintf("failed to bundle the local dependency '%s'", name))
+			}
+			err = bundleLocalDeps(depSrcPath, depDstPath, bundlePath, bundled)
+			if err != nil {
+				return err
+			}
+		}
+
+		relPath, err := filepath.Rel(dstPath, depDstPath)
+		if err != nil {
+			return reporter.NewErrorEvent(reporter.Bug, err, "internal bugs, please contact us to fix it.")
+		}
+		dep.Source.Local = &pkg.Local{Path: filepath.ToSlash(relPath)}
+		kclPkg.ModFile.Dependencies.Deps[name] = dep
+		if lockDep, ok := kclPkg.Dependencies.Deps[name]; ok && lockDep.IsFromLocal() {
+			lockDep.Source.Local = &pkg.Local{Path: filepath.ToSlash(relPath)}
+			kclPkg.Dependencies.Deps[name] = lockDep
+		}
+	}
+
+	err = kclPkg.ModFile.StoreModFile()
+	if err != nil {
+		return err
+	}
+	if utils.DirExists(kclPkg.GetLockFilePath()) {
+		return kclPkg.LockDepsVersion()
+	}
+	return nil
+}
+
+// checkTarLocalDeps will return an error if the local dependencies of the kcl package in 'pkgPath' extracted from 'tarPath'
+// are neither in the package nor vendored.
+func checkTarLocalDeps(pkgPath, tarPath string) error {
+	kclPkg, err := pkg.LoadKclPkg(pkgPath)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(kclPkg.ModFile.Dependencies.Deps))
+	for name := range kclPkg.ModFile.Dependencies.Deps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		dep := kclPkg.ModFile.Dependencies.Deps[name]
+		if !dep.IsFromLocal() || utils.DirExists(dep.GetLocalFullPath(pkgPath)) ||
+			utils.DirExists(filepath.Join(kclPkg.LocalVendorPath(), dep.FullName)) {
+			continue
+		}
+		return reporter.NewErrorEvent(
+			reporter.DependencyNotFound,
+			fmt.Errorf("the local dependency '%s' in '%s' is not in the tar '%s'", name, dep.Source.Local.Path, tarPath),
+			"package the tar with 'PackageOptions.IncludeLocalDeps' to bundle the local dependencies",
+		)
+	}
+	return nil
+}
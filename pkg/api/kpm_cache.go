@@ -0,0 +1,313 @@
+package api
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"kcl-lang.io/kpm/pkg/client"
+	"kcl-lang.io/kpm/pkg/env"
+	pkg "kcl-lang.io/kpm/pkg/package"
+	"kcl-lang.io/kpm/pkg/reporter"
+	"kcl-lang.io/kpm/pkg/utils"
+)
+
+// cacheManifestName is the name of the manifest of the entries in the exported cache.
+// It is hidden, so it never collides with the directories of the dependencies.
+const cacheManifestName = ".kpm-cache.json"
+
+// cacheManifest is the manifest of the entries in the exported cache.
+type cacheManifest struct {
+	// Entries is the sorted names of the entries in the exported cache.
+	Entries []string `json:"entries"`
+	// Sums is the checksums of the entries locked in kcl.mod.lock, the entries without checksums are not in it.
+	Sums map[string]string `json:"sums,omitempty"`
+}
+
+// ExportCacheForPackage will write the entries of the cache in $KCL_PKG_PATH referenced by the kcl.mod.lock of the kcl package in 'pkgPath'
+// into 'w' as a tar, e.g. to persist the cache of the dependencies of a package between the runs of a CI.
+// The entries are the directories of the git and oci dependencies, which are named by the full names of the dependencies,
+// the local dependencies are not exported. The regular files and the directories in the entries are exported, and the other files, e.g. the symlinks, are skipped.
+// The names of the entries and their checksums in the kcl.mod.lock are written into the manifest of the export before them.
+// The export fails if a locked dependency is not in the cache.
+func ExportCacheForPackage(pkgPath string, w io.Writer) error {
+	kclPkg, err := pkg.LoadKclPkg(pkgPath)
+	if err != nil {
+		return err
+	}
+	globalPkgPath, err := env.GetAbsPkgPath()
+	if err != nil {
+		return err
+	}
+
+	var entries []string
+	sums := make(map[string]string)
+	for _, name := range sortedDepNames(kclPkg.Dependencies.Deps) {
+		dep := kclPkg.Dependencies.Deps[name]
+		if dep.IsFromLocal() {
+			continue
+		}
+		if len(dep.FullName) == 0 {
+			dep.FullName = dep.GenDepFullName()
+		}
+		if !utils.DirExists(filepath.Join(globalPkgPath, dep.FullName)) {
+			return reporter.NewErrorEvent(
+				reporter.DependencyNotFound,
+				fmt.Errorf("dependency '%s' not found in '%s'", name, filepath.Join(globalPkgPath, dep.FullName)),
+				"failed to export the cache, please resolve the dependencies first",
+			)
+		}
+		entries = append(entries, dep.FullName)
+		if len(dep.Sum) != 0 {
+			sums[dep.FullName] = dep.Sum
+		}
+	}
+	sort.Strings(entries)
+
+	manifest := cacheManifest{Sums: sums}
+	for i, entry := range entries {
+		if i == 0 || entries[i-1] != entry {
+			manifest.Entries = append(manifest.Entries, entry)
+		}
+	}
+
+	tw := tar.NewWriter(w)
+	err = writeCacheManifest(tw, manifest)
+	if err != nil {
+		return reporter.NewErrorEvent(reporter.FailedExportCache, err, "failed to export the manifest of the cache")
+	}
+	for _, entry := range manifest.Entries {
+		err = writeCacheEntry(tw, globalPkgPath, entry)
+		if err != nil {
+			return reporter.NewErrorEvent(reporter.FailedExportCache, err, fmt.Sprintf("failed to export '%s' in the cache", entry))
+		}
+	}
+	err = tw.Close()
+	if err != nil {
+		return reporter.NewErrorEvent(reporter.FailedExportCache, err, "failed to export the cache")
+	}
+	return nil
+}
+
+// writeCacheManifest will write the manifest 'manifest' into 'tw' as the file named 'cacheManifestName'.
+func writeCacheManifest(tw *tar.Writer, manifest cacheManifest) error {
+	content, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	err = tw.WriteHeader(&tar.Header{Name: cacheManifestName, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+	if err != nil {
+		return err
+	}
+	_, err = tw.Write(content)
+	return err
+}
+
+// writeCacheEntry will write the directory 'entry' in the cache 'cachePath' into 'tw',
+// the files are named by their paths relative to the cache.
+func writeCacheEntry(tw *tar.Writer, cachePath, entry string) error {
+	return filepath.Walk(filepath.Join(cachePath, entry), func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(cachePath, file)
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+}
+
+// ImportCache will write the entries of the cache exported by 'ExportCacheForPackage' from 'r' into the cache in $KCL_PKG_PATH,
+// with the package cache locked. The entries are extracted beside the cache first, and then replace the ones with the same names in the cache,
+// so the cache is not changed if the import fails. The files outside of the entries, e.g. '../x' or '/x', and the hidden entries are rejected.
+// If the export has the manifest, the entries not in the manifest are rejected, and the entries with the checksums are verified.
+func ImportCache(r io.Reader) (err error) {
+	globalPkgPath, err := env.GetAbsPkgPath()
+	if err != nil {
+		return err
+	}
+	kpmcli, err := client.NewKpmClient()
+	if err != nil {
+		return err
+	}
+	err = kpmcli.AcquirePackageCacheLock()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		releaseErr := kpmcli.ReleasePackageCacheLock()
+		if releaseErr != nil && err == nil {
+			err = releaseErr
+		}
+	}()
+
+	stagingPath, err := os.MkdirTemp(globalPkgPath, ".kpm-import-")
+	if err != nil {
+		return reporter.NewErrorEvent(reporter.FailedImportCache, err, fmt.Sprintf("failed to create the directory to import the cache in '%s'", globalPkgPath))
+	}
+	defer os.RemoveAll(stagingPath)
+
+	entries, manifest, err := extractCacheEntries(r, stagingPath)
+	if err == nil && manifest != nil {
+		err = checkCacheEntries(entries, manifest)
+	}
+	if err != nil {
+		return reporter.NewErrorEvent(reporter.FailedImportCache, err, "failed to import the cache")
+	}
+
+	if manifest != nil {
+		for _, entry := range entries {
+			sum, ok := manifest.Sums[entry]
+			if !ok {
+				continue
+			}
+			actual, err := utils.HashDir(filepath.Join(stagingPath, filepath.FromSlash(entry)))
+			if err != nil {
+				return reporter.NewErrorEvent(reporter.FailedImportCache, err, fmt.Sprintf("failed to verify '%s' in the exported cache", entry))
+			}
+			if actual != sum {
+				return reporter.NewErrorEvent(
+					reporter.CheckSumMismatch,
+					fmt.Errorf("the checksum of '%s' is '%s', but '%s' is expected", entry, actual, sum),
+					fmt.Sprintf("failed to import '%s' into the cache", entry),
+				)
+			}
+		}
+	}
+
+	for _, entry := range entries {
+		entryPath := filepath.Join(globalPkgPath, filepath.FromSlash(entry))
+		err = os.RemoveAll(entryPath)
+		if err == nil {
+			err = os.Rename(filepath.Join(stagingPath, filepath.FromSlash(entry)), entryPath)
+		}
+		if err != nil {
+			return reporter.NewErrorEvent(reporter.FailedImportCache, err, fmt.Sprintf("failed to import '%s' into the cache", entry))
+		}
+	}
+	return nil
+}
+
+// checkCacheEntries returns an error if the entries extracted 'entries' are not the same as the entries in the manifest 'manifest'.
+func checkCacheEntries(entries []string, manifest *cacheManifest) error {
+	known := make(map[string]bool, len(manifest.Entries))
+	for _, entry := range manifest.Entries {
+		known[entry] = true
+	}
+	extracted := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		if !known[entry] {
+			return fmt.Errorf("'%s' is not an entry in the manifest of the exported cache", entry)
+		}
+		extracted[entry] = true
+	}
+	for _, entry := range manifest.Entries {
+		if !extracted[entry] {
+			return fmt.Errorf("'%s' in the manifest is missing in the exported cache", entry)
+		}
+	}
+	return nil
+}
+
+// extractCacheEntries will extract the tar 'r' into 'destPath', and return the sorted names of the top-level directories extracted,
+// and the manifest of the exported cache, which is nil if there is no manifest.
+func extractCacheEntries(r io.Reader, destPath string) ([]string, *cacheManifest, error) {
+	tr := tar.NewReader(r)
+	entrySet := make(map[string]bool)
+	var manifest *cacheManifest
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		name := path.Clean(header.Name)
+		if path.IsAbs(name) || name == "." || name == ".." || strings.HasPrefix(name, "../") {
+			return nil, nil, fmt.Errorf("'%s' is outside of the cache", header.Name)
+		}
+		if name == cacheManifestName && header.Typeflag == tar.TypeReg {
+			manifest = &cacheManifest{}
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				return nil, nil, fmt.Errorf("failed to parse the manifest of the exported cache: %w", err)
+			}
+			continue
+		}
+		entry, _, isFile := strings.Cut(name, "/")
+		if strings.HasPrefix(entry, ".") {
+			return nil, nil, fmt.Errorf("'%s' is in the hidden directory '%s', which is not an entry of the cache", header.Name, entry)
+		}
+		target := filepath.Join(destPath, filepath.FromSlash(name))
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0755)
+		case tar.TypeReg:
+			if !isFile {
+				return nil, nil, fmt.Errorf("'%s' is not in a directory of a dependency", header.Name)
+			}
+			err = writeCacheFile(target, tr, os.FileMode(header.Mode).Perm())
+		default:
+			return nil, nil, fmt.Errorf("'%s' is not a regular file or a directory", header.Name)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		entrySet[entry] = true
+	}
+
+	entries := make([]string, 0, len(entrySet))
+	for entry := range entrySet {
+		entries = append(entries, entry)
+	}
+	sort.Strings(entries)
+	return entries, manifest, nil
+}
+
+// writeCacheFile will write the content of 'r' into the file 'file' with the permission 'perm'.
+func writeCacheFile(file string, r io.Reader, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
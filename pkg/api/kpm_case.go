@@ -0,0 +1,105 @@
+package api
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"kcl-lang.io/kpm/pkg/constants"
+	"kcl-lang.io/kpm/pkg/opt"
+	pkg "kcl-lang.io/kpm/pkg/package"
+	"kcl-lang.io/kpm/pkg/reporter"
+)
+
+// checkCaseSensitivePaths will return an error if the entries in the compile options, or the modules of the package imported
+// from them, do not match the case of the files and directories on the disk exactly, e.g. 'import .Base' for the file 'base.k'.
+// They work on the case-insensitive file systems, e.g. on macOS, but are not found on the case-sensitive ones.
+// The entries out of the package are checked by their last path elements, and the modules imported from the dependencies are not checked.
+func checkCaseSensitivePaths(kclPkg *pkg.KclPkg, opts *opt.CompileOptions) error {
+	if !opts.CaseSensitivePaths() {
+		return nil
+	}
+
+	for _, entry := range opts.KFilenameList {
+		if err := checkPathCase(caseCheckBase(kclPkg.HomePath, entry), entry); err != nil {
+			return reporter.NewErrorEvent(reporter.PathCaseMismatch, err, fmt.Sprintf("the case of the entry '%s' does not match the disk", entry))
+		}
+	}
+
+	err := walkImports(kclPkg, opts, func(file, module, path, dep string) error {
+		if len(dep) != 0 {
+			return nil
+		}
+		if err := checkModuleCase(caseCheckBase(kclPkg.HomePath, path), path); err != nil {
+			return reporter.NewErrorEvent(reporter.PathCaseMismatch, err, fmt.Sprintf("the case of the module '%s' imported by '%s' does not match the disk", module, file))
+		}
+		return nil
+	})
+	if err != nil {
+		if _, ok := err.(*reporter.KpmEvent); ok {
+			return err
+		}
+		return reporter.NewErrorEvent(reporter.FailedAccessPkgPath, err, "failed to find the modules imported by the entries")
+	}
+	return nil
+}
+
+// caseCheckBase returns the directory from which the case of 'path' is checked,
+// which is the package directory 'homePath' if 'path' is in it, or the parent directory of 'path' otherwise.
+func caseCheckBase(homePath, path string) string {
+	if rel, err := filepath.Rel(homePath, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return homePath
+	}
+	return filepath.Dir(path)
+}
+
+// checkModuleCase will check the case of the module in 'path', which is either the kcl file 'path.k' or the directory 'path'.
+func checkModuleCase(base, path string) error {
+	if strings.HasSuffix(path, constants.KFilePathSuffix) {
+		return checkPathCase(base, path)
+	}
+	if err := checkPathCase(base, path+constants.KFilePathSuffix); err != nil {
+		return err
+	}
+	return checkPathCase(base, path)
+}
+
+// checkPathCase will return an error if an element of 'path' under the directory 'base' is in a different case
+// from the file or directory on the disk. The elements which do not exist in any case are not reported.
+func checkPathCase(base, path string) error {
+	rel, err := filepath.Rel(base, path)
+	if err != nil || rel == "." {
+		return nil
+	}
+
+	dir := base
+	for _, elem := range strings.Split(rel, string(filepath.Separator)) {
+		if elem == "." || elem == ".." {
+			dir = filepath.Join(dir, elem)
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil
+		}
+		actual := ""
+		for _, entry := range entries {
+			if entry.Name() == elem {
+				actual = elem
+				break
+			}
+			if len(actual) == 0 && strings.EqualFold(entry.Name(), elem) {
+				actual = entry.Name()
+			}
+		}
+		if len(actual) == 0 {
+			return nil
+		}
+		if actual != elem {
+			return fmt.Errorf("'%s' is '%s' on the disk", filepath.Join(dir, elem), filepath.Join(dir, actual))
+		}
+		dir = filepath.Join(dir, elem)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+	pkg "kcl-lang.io/kpm/pkg/package"
+	"kcl-lang.io/kpm/pkg/reporter"
+)
+
+// kclGoModule is the module of the kcl compiler which kpm is built with.
+const kclGoModule = "kcl-lang.io/kcl-go"
+
+// unspecifiedEdition is the edition written into 'kcl.mod' by 'kpm init', which requires no kcl compiler version.
+const unspecifiedEdition = "0.0.1"
+
+// CompatReport is the verdict of whether a kcl package can be compiled by the kcl compiler which kpm is built with.
+type CompatReport struct {
+	// Edition is the kcl compiler edition declared in 'kcl.mod',
+	// which is the oldest compatible version, e.g. '0.7.0', or a version constraint, e.g. '>= 0.7.0, < 0.8.0'.
+	Edition string
+	// KclVersion is the version of the kcl compiler which kpm is built with, it is empty if unknown.
+	KclVersion string
+	// Compatible is whether the kcl package can be compiled by the kcl compiler.
+	Compatible bool
+	// Reasons is the reasons of the verdict.
+	Reasons []string
+}
+
+// CheckCompatibility will check whether the kcl package in 'pkgPath' can be compiled by the kcl compiler which kpm is built with,
+// by comparing the edition declared in its 'kcl.mod' with the version of the kcl compiler.
+// The package is regarded as compatible if the version of the kcl compiler is unknown.
+func CheckCompatibility(pkgPath string) (*CompatReport, error) {
+	absPkgPath, err := filepath.Abs(pkgPath)
+	if err != nil {
+		return nil, reporter.NewErrorEvent(reporter.Bug, err, "internal bugs, please contact us to fix it.")
+	}
+
+	kclPkg, err := pkg.LoadKclPkg(absPkgPath)
+	if err != nil {
+		return nil, err
+	}
+
+	report := checkEditionCompatibility(kclPkg.GetPkgEdition(), installedKclVersion())
+	return &report, nil
+}
+
+// checkEditionCompatibility returns the verdict of whether the edition 'edition' is compatible with the kcl compiler 'kclVersion'.
+func checkEditionCompatibility(edition, kclVersion string) CompatReport {
+	report := CompatReport{Edition: edition, KclVersion: kclVersion, Compatible: true}
+	edition = strings.TrimSpace(edition)
+	if len(edition) == 0 || edition == unspecifiedEdition {
+		report.Reasons = append(report.Reasons, "the package does not require a kcl compiler version")
+		return report
+	}
+
+	constraints, err := version.NewConstraint(edition)
+	if err != nil {
+		report.Compatible = false
+		report.Reasons = append(report.Reasons, fmt.Sprintf("the edition '%s' is neither a version nor a version constraint", edition))
+		return report
+	}
+	// The edition which is a version is the oldest compatible version.
+	if _, err := version.NewVersion(edition); err == nil {
+		constraints, _ = version.NewConstraint(">= " + edition)
+	}
+
+	kclVer, err := version.NewVersion(kclVersion)
+	if err != nil {
+		report.Reasons = append(report.Reasons, "the version of the kcl compiler is unknown, the edition is not checked")
+		return report
+	}
+	if !constraints.Check(kclVer) {
+		report.Compatible = false
+		report.Reasons = append(report.Reasons, fmt.Sprintf("the kcl compiler '%s' does not satisfy the edition '%s' of the package", kclVersion, constraints))
+		return report
+	}
+	report.Reasons = append(report.Reasons, fmt.Sprintf("the kcl compiler '%s' satisfies the edition '%s' of the package", kclVersion, constraints))
+	return report
+}
+
+// installedKclVersion returns the version of the kcl compiler which kpm is built with, empty if it is unknown.
+func installedKclVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	for _, dep := range info.Deps {
+		if dep.Path != kclGoModule {
+			continue
+		}
+		if dep.Replace != nil {
+			dep = dep.Replace
+		}
+		return strings.TrimPrefix(dep.Version, "v")
+	}
+	return ""
+}
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"path/filepath"
+
+	pkg "kcl-lang.io/kpm/pkg/package"
+	"kcl-lang.io/kpm/pkg/reporter"
+)
+
+// checkContract will validate the documents of the compile result against the contract declared in the kcl.mod of the package in 'pkgPath',
+// the relative contract is resolved by the package path, and nothing is validated if the package declares no contract.
+func checkContract(result *CompileResult, pkgPath string) error {
+	absPkgPath, err := filepath.Abs(pkgPath)
+	if err != nil {
+		return reporter.NewErrorEvent(reporter.Bug, err, "internal bugs, please contact us to fix it.")
+	}
+	modFile, err := pkg.LoadModFile(absPkgPath)
+	if err != nil {
+		return err
+	}
+
+	contract := modFile.Pkg.Contract
+	if len(contract) == 0 {
+		return nil
+	}
+	if !filepath.IsAbs(contract) {
+		contract = filepath.Join(absPkgPath, contract)
+	}
+	return result.ValidateWithSchema(contract)
+}
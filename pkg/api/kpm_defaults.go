@@ -0,0 +1,69 @@
+package api
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+	"kcl-lang.io/kpm/pkg/reporter"
+)
+
+// loadGlobalDefaults loads the defaults document in 'path', which must be a yaml or json object.
+func loadGlobalDefaults(path string) (map[string]interface{}, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, reporter.NewErrorEvent(reporter.FailedLoadDefaults, err, fmt.Sprintf("failed to read the global defaults '%s'", path))
+	}
+	var defaults map[string]interface{}
+	if err := yaml.Unmarshal(content, &defaults); err != nil {
+		return nil, reporter.NewErrorEvent(
+			reporter.FailedLoadDefaults,
+			err,
+			fmt.Sprintf("failed to parse the global defaults '%s', it must be a yaml or json object", path),
+		)
+	}
+	return defaults, nil
+}
+
+// mergeDefaults merges the fields of 'defaults' missing in 'value' into 'value' recursively,
+// and returns whether any field is added. The values in 'value', including the lists, are kept as they are.
+func mergeDefaults(value, defaults map[string]interface{}) bool {
+	merged := false
+	for key, defaultValue := range defaults {
+		current, ok := value[key]
+		if !ok {
+			value[key] = defaultValue
+			merged = true
+			continue
+		}
+		currentFields, ok := current.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		defaultFields, ok := defaultValue.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if mergeDefaults(currentFields, defaultFields) {
+			merged = true
+		}
+	}
+	return merged
+}
+
+// mergeGlobalDefaults will merge the defaults document in 'path' beneath each object document of the compile result.
+// The documents which are not objects or have all the default fields are kept as they are.
+func (r *CompileResult) mergeGlobalDefaults(path string) error {
+	defaults, err := loadGlobalDefaults(path)
+	if err != nil {
+		return err
+	}
+
+	return r.rewriteDocuments("merged", func(i int, value interface{}) (interface{}, bool, error) {
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			return value, false, nil
+		}
+		return fields, mergeDefaults(fields, defaults), nil
+	})
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"errors"
+
+	"kcl-lang.io/kpm/pkg/opt"
+	"kcl-lang.io/kpm/pkg/reporter"
+)
+
+// diagnosticHandler returns the diagnostic handler of the compile options,
+// which is called with the diagnostics translated by the locale, or nil if no handler is set.
+func diagnosticHandler(opts *opt.CompileOptions) opt.DiagnosticHandler {
+	handler := opts.DiagnosticHandler()
+	if handler == nil {
+		return nil
+	}
+	tag := opts.Locale()
+	return func(diagnostic reporter.Diagnostic) {
+		diagnostic.Message = reporter.Localize(diagnostic.Message, tag)
+		diagnostic.Detail = reporter.Localize(diagnostic.Detail, tag)
+		handler(diagnostic)
+	}
+}
+
+// formatError will call the diagnostic handler with the diagnostics of the error 'err' if it is set,
+// and return the error rendered by the error formatter and the locale in the compile options.
+func formatError(err error, opts *opt.CompileOptions) error {
+	var event *reporter.KpmEvent
+	if err == nil || (errors.As(err, &event) && event == nil) {
+		return err
+	}
+	if handler := diagnosticHandler(opts); handler != nil {
+		for _, diagnostic := range reporter.NewDiagnostics(err) {
+			handler(diagnostic)
+		}
+	}
+	return reporter.NewLocalizedFormattedError(err, opts.ErrorFormatter(), opts.Locale())
+}
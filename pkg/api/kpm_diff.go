@@ -0,0 +1,207 @@
+package api
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"kcl-lang.io/kpm/pkg/reporter"
+)
+
+// ChangeKind is the kind of a change between the diff base and the compile result.
+type ChangeKind string
+
+const (
+	// ChangeAdded means the value is in the compile result but not in the diff base.
+	ChangeAdded ChangeKind = "added"
+	// ChangeRemoved means the value is in the diff base but not in the compile result.
+	ChangeRemoved ChangeKind = "removed"
+	// ChangeModified means the value is in both of them but they are different.
+	ChangeModified ChangeKind = "modified"
+)
+
+// FieldChange is a change of a field between a document of the diff base and a document of the compile result.
+type FieldChange struct {
+	// Path is the path of the field, e.g. 'spec.containers[0].image', it is empty for the whole document.
+	Path string
+	Kind ChangeKind
+	// Base is the value in the diff base, nil if the field is added.
+	Base interface{}
+	// Result is the value in the compile result, nil if the field is removed.
+	Result interface{}
+}
+
+// String returns the change in the form of '+ path: result', '- path: base' or '~ path: base -> result'.
+func (c FieldChange) String() string {
+	path := c.Path
+	if len(path) == 0 {
+		path = "<document>"
+	}
+	switch c.Kind {
+	case ChangeAdded:
+		return fmt.Sprintf("+ %s: %v", path, c.Result)
+	case ChangeRemoved:
+		return fmt.Sprintf("- %s: %v", path, c.Base)
+	default:
+		return fmt.Sprintf("~ %s: %v -> %v", path, c.Base, c.Result)
+	}
+}
+
+// DocumentDiff is the changes between the document of the diff base and the document of the compile result at the same index.
+type DocumentDiff struct {
+	// Index is the index of the document in the yaml stream.
+	Index int
+	// Source is the entry which produces the document, it is empty if the document is removed.
+	Source  string
+	Changes []FieldChange
+}
+
+// Diff returns the changes of the documents of the compile result from the diff base set by 'opt.WithDiffBase',
+// only the documents with changes are returned, and it is empty if there is no diff base or no changes.
+func (r *CompileResult) Diff() []DocumentDiff {
+	return r.diff
+}
+
+// diffWithBase will diff the documents of the compile result against the yaml documents in the file 'basePath',
+// the documents are paired by their indexes and compared structurally, so the order of the keys and the format do not matter.
+func (r *CompileResult) diffWithBase(basePath string) error {
+	content, err := os.ReadFile(basePath)
+	if err != nil {
+		return reporter.NewErrorEvent(reporter.FailedLoadDiffBase, err, fmt.Sprintf("failed to read the diff base '%s'", basePath))
+	}
+	baseDocs := splitYamlDocuments(string(content))
+
+	bases := make([]interface{}, len(baseDocs))
+	for i, doc := range baseDocs {
+		if err := yaml.Unmarshal([]byte(doc), &bases[i]); err != nil {
+			return reporter.NewErrorEvent(reporter.FailedLoadDiffBase, err, fmt.Sprintf("failed to parse the document %d of the diff base '%s'", i, basePath))
+		}
+	}
+	results, err := r.documentValues()
+	if err != nil {
+		return err
+	}
+	r.diff = diffDocuments(bases, results, r.documents)
+	return nil
+}
+
+// documentValues returns the values of the documents of the compile result parsed from their yaml.
+func (r *CompileResult) documentValues() ([]interface{}, error) {
+	values := make([]interface{}, len(r.documents))
+	for i, doc := range r.documents {
+		if err := yaml.Unmarshal([]byte(doc.Yaml), &values[i]); err != nil {
+			return nil, reporter.NewErrorEvent(reporter.FailedConvertResult, err, fmt.Sprintf("failed to parse the document %d of the compile result", i))
+		}
+	}
+	return values, nil
+}
+
+// diffDocuments returns the changes from the documents 'bases' to the documents 'results' of 'documents',
+// the documents are paired by their indexes, and only the documents with changes are returned.
+func diffDocuments(bases, results []interface{}, documents []Document) []DocumentDiff {
+	var diffs []DocumentDiff
+	for i := 0; i < len(bases) || i < len(results); i++ {
+		var changes []FieldChange
+		var source string
+		switch {
+		case i >= len(bases):
+			changes = []FieldChange{{Kind: ChangeAdded, Result: results[i]}}
+		case i >= len(results):
+			changes = []FieldChange{{Kind: ChangeRemoved, Base: bases[i]}}
+		default:
+			changes = diffValues("", bases[i], results[i])
+		}
+		if i < len(documents) {
+			source = documents[i].Source
+		}
+		if len(changes) != 0 {
+			diffs = append(diffs, DocumentDiff{Index: i, Source: source, Changes: changes})
+		}
+	}
+	return diffs
+}
+
+// diffValues returns the changes from 'base' to 'result' in the field 'path',
+// the maps are compared by their keys in order, the lists by their indexes, and the other values as a whole.
+func diffValues(path string, base, result interface{}) []FieldChange {
+	switch b := base.(type) {
+	case map[string]interface{}:
+		r, ok := result.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(b)+len(r))
+		for key := range b {
+			keys = append(keys, key)
+		}
+		for key := range r {
+			if _, ok := b[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		var changes []FieldChange
+		for _, key := range keys {
+			fieldPath := key
+			if len(path) != 0 {
+				fieldPath = path + "." + key
+			}
+			bv, inBase := b[key]
+			rv, inResult := r[key]
+			switch {
+			case !inBase:
+				changes = append(changes, FieldChange{Path: fieldPath, Kind: ChangeAdded, Result: rv})
+			case !inResult:
+				changes = append(changes, FieldChange{Path: fieldPath, Kind: ChangeRemoved, Base: bv})
+			default:
+				changes = append(changes, diffValues(fieldPath, bv, rv)...)
+			}
+		}
+		return changes
+	case []interface{}:
+		r, ok := result.([]interface{})
+		if !ok {
+			break
+		}
+		var changes []FieldChange
+		for i := 0; i < len(b) || i < len(r); i++ {
+			itemPath := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(b):
+				changes = append(changes, FieldChange{Path: itemPath, Kind: ChangeAdded, Result: r[i]})
+			case i >= len(r):
+				changes = append(changes, FieldChange{Path: itemPath, Kind: ChangeRemoved, Base: b[i]})
+			default:
+				changes = append(changes, diffValues(itemPath, b[i], r[i])...)
+			}
+		}
+		return changes
+	}
+
+	if reflect.DeepEqual(base, result) {
+		return nil
+	}
+	return []FieldChange{{Path: path, Kind: ChangeModified, Base: base, Result: result}}
+}
+
+// checkDiff returns an error with the changes if the compile result drifts from the diff base 'basePath'.
+func checkDiff(diffs []DocumentDiff, basePath string) error {
+	if len(diffs) == 0 {
+		return nil
+	}
+	var lines []string
+	for _, diff := range diffs {
+		for _, change := range diff.Changes {
+			lines = append(lines, fmt.Sprintf("document %d: %s", diff.Index, change))
+		}
+	}
+	return reporter.NewErrorEvent(
+		reporter.InvalidOutput,
+		fmt.Errorf("%s", strings.Join(lines, "\n")),
+		fmt.Sprintf("the compile result drifts from the diff base '%s'", basePath),
+	)
+}
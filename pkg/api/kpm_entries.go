@@ -0,0 +1,162 @@
+package api
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"kcl-lang.io/kcl-go/pkg/kcl"
+	"kcl-lang.io/kpm/pkg/client"
+	"kcl-lang.io/kpm/pkg/opt"
+	"kcl-lang.io/kpm/pkg/reporter"
+	"kcl-lang.io/kpm/pkg/runner"
+)
+
+// RunEntries will compile each of the entries 'entries' of the kcl package in 'pkgPath' independently with the compile options,
+// and return the compile results keyed by the entries as they are passed, so that the output of each entry can be addressed.
+// The dependencies are resolved once and shared by the compilations of all the entries,
+// each entry is compiled in its own working directory if it is set by 'opt.WithEntryWorkDir',
+// and the entries are compiled concurrently if 'opt.WithEntryConcurrency' is set.
+// The documents of each entry are transformed, validated and counted as 'RunWithResult' does,
+// but they are not written into the split output directory.
+func RunEntries(pkgPath string, entries []string, opts *opt.CompileOptions) (map[string]*CompileResult, error) {
+	if opts == nil {
+		opts = opt.DefaultCompileOptions()
+	}
+	results, err := runEntries(pkgPath, entries, opts)
+	if err != nil {
+		return nil, formatError(err, opts)
+	}
+	return results, nil
+}
+
+// runEntries will compile the entries of the kcl package in 'pkgPath' with the dependencies resolved once.
+func runEntries(pkgPath string, entries []string, opts *opt.CompileOptions) (map[string]*CompileResult, error) {
+	results := make(map[string]*CompileResult, len(entries))
+	if len(entries) == 0 {
+		return results, nil
+	}
+
+	restoreEnvs, err := loadEnvFile(opts)
+	if err != nil {
+		return nil, err
+	}
+	defer restoreEnvs()
+
+	kpmcli, err := client.NewKpmClient()
+	if err != nil {
+		return nil, err
+	}
+	kpmcli.SetNoSumCheck(opts.NoSumCheck())
+
+	opts.SetPkgPath(pkgPath)
+	opts.SetEntries(entries)
+	prof := newProfiler(opts.Profile())
+	endLoad := prof.span("load")
+	kclPkg, err := loadPkgToRun(kpmcli, opts)
+	endLoad()
+	if err != nil {
+		return nil, err
+	}
+
+	endResolve := prof.span("resolve")
+	depsMap, err := kpmcli.ResolveDepsIntoMap(kclPkg)
+	endResolve()
+	if err != nil {
+		return nil, err
+	}
+
+	// The entries are appended after the kcl files already in the compile options.
+	offset := len(opts.KFilenameList) - len(entries)
+	entryOpts := make([]*opt.CompileOptions, len(entries))
+	for i, entry := range entries {
+		entryOpts[i] = entryCompileOptions(opts, offset+i)
+		entryOpts[i].WorkDir = entryWorkDir(opts, entry)
+	}
+	compileResults, err := compileEntries(kpmcli, depsMap, entries, entryOpts, opts.EntryConcurrency(), prof)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, entry := range entries {
+		source := entrySource(opts.PkgPath(), entryOpts[i].KFilenameList[0])
+		result := &CompileResult{separatorComment: opts.DocumentSeparatorComment()}
+		result.addDocuments(compileResults[i], source)
+		result.depOrigins = kpmcli.GetDependencyOrigins()
+		if opts.CaptureInput() {
+			result.resolvedInput = newResolvedInput(entryOpts[i])
+		}
+		err = finishDocuments(result, opts)
+		if err != nil {
+			return nil, err
+		}
+		err = checkMaxDocuments(len(result.documents), opts.MaxDocuments())
+		if err != nil {
+			return nil, err
+		}
+		results[entry] = result
+	}
+
+	err = prof.write()
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// compileEntries will compile the entries with their compile options 'entryOpts' and the resolved dependencies 'depsMap',
+// at most 'concurrency' of them at the same time, and return the compile results in the order of the entries.
+// No more entries are compiled after an entry fails, and the error of the first failed entry in the order is returned.
+func compileEntries(kpmcli *client.KpmClient, depsMap map[string]string, entries []string, entryOpts []*opt.CompileOptions, concurrency int, prof *profiler) ([]*kcl.KCLResultList, error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	results := make([]*kcl.KCLResultList, len(entries))
+	errs := make([]error, len(entries))
+	var failed atomic.Bool
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for i := range entries {
+		sem <- struct{}{}
+		if failed.Load() {
+			<-sem
+			break
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			source := entrySource(entryOpts[i].PkgPath(), entryOpts[i].KFilenameList[0])
+			endCompile := prof.span("compile", source)
+			results[i], errs[i] = kpmcli.CompileWithDepsMap(depsMap, runner.NewCompilerWithOpts(entryOpts[i]))
+			endCompile()
+			if errs[i] != nil {
+				failed.Store(true)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, reporter.NewErrorEvent(reporter.CompileFailed, err, fmt.Sprintf("failed to compile the entry '%s'", entries[i]))
+		}
+	}
+	return results, nil
+}
+
+// entryWorkDir returns the working directory to compile the entry 'entry' set by 'opt.WithEntryWorkDir',
+// the relative one is joined to the package path, and the working directory in the compile options is returned if it is not set.
+func entryWorkDir(opts *opt.CompileOptions, entry string) string {
+	dir, ok := opts.EntryWorkDirs()[entry]
+	if !ok {
+		return opts.WorkDir
+	}
+	if filepath.IsAbs(dir) {
+		return dir
+	}
+	return filepath.Join(opts.PkgPath(), dir)
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"kcl-lang.io/kcl-go/pkg/kcl"
+	"kcl-lang.io/kpm/pkg/client"
+	"kcl-lang.io/kpm/pkg/opt"
+	"kcl-lang.io/kpm/pkg/reporter"
+)
+
+// EquivCase is the comparison of the outputs of two kcl packages compiled with the same input.
+type EquivCase struct {
+	// Input is the top-level arguments which both of the packages are compiled with.
+	Input map[string]string
+	// Diffs is the changes from the documents of the first package to the documents of the second package,
+	// where 'Base' of the changes is the value of the first package and 'Result' is the value of the second package.
+	// It is empty if the outputs are equivalent.
+	Diffs []DocumentDiff
+}
+
+// EquivReport is the report of comparing the outputs of two kcl packages across the inputs.
+type EquivReport struct {
+	// Cases is the comparisons in the order of the inputs.
+	Cases []EquivCase
+}
+
+// Equivalent returns true if the two kcl packages produce the equivalent outputs with all the inputs.
+func (r *EquivReport) Equivalent() bool {
+	for _, c := range r.Cases {
+		if len(c.Diffs) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the divergences in the report line by line, in the form of 'input {a=1}: document 0: ~ path: a -> b'.
+func (r *EquivReport) String() string {
+	if r.Equivalent() {
+		return "the outputs are equivalent\n"
+	}
+	var sb strings.Builder
+	for _, c := range r.Cases {
+		for _, diff := range c.Diffs {
+			for _, change := range diff.Changes {
+				sb.WriteString(fmt.Sprintf("input %s: document %d: %s\n", formatInput(c.Input), diff.Index, change))
+			}
+		}
+	}
+	return sb.String()
+}
+
+// AssertEquivalent will compile the kcl packages in 'pkgA' and 'pkgB' with each of the inputs,
+// and compare their outputs structurally as 'opt.WithDiffBase' does, e.g. to prove that a rewritten package produces the same output.
+// The inputs are the top-level arguments as the '-D' arguments, and both of the packages are compiled once without arguments if there are no inputs.
+// Both of the packages are compiled with the other settings in the compile options, which are not changed.
+// An error is returned if a package fails to compile, and the divergences of the outputs are reported in the returned report.
+func AssertEquivalent(pkgA, pkgB string, inputs []map[string]string, opts *opt.CompileOptions) (*EquivReport, error) {
+	if opts == nil {
+		opts = opt.DefaultCompileOptions()
+	}
+	if len(inputs) == 0 {
+		inputs = []map[string]string{{}}
+	}
+
+	report := &EquivReport{}
+	for _, input := range inputs {
+		resultA, err := compileWithInput(pkgA, input, opts)
+		if err != nil {
+			return nil, err
+		}
+		resultB, err := compileWithInput(pkgB, input, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		valuesA, err := resultA.documentValues()
+		if err != nil {
+			return nil, formatError(err, opts)
+		}
+		valuesB, err := resultB.documentValues()
+		if err != nil {
+			return nil, formatError(err, opts)
+		}
+		report.Cases = append(report.Cases, EquivCase{Input: input, Diffs: diffDocuments(valuesA, valuesB, resultB.documents)})
+	}
+	return report, nil
+}
+
+// compileWithInput will compile the kcl package in 'pkgPath' with the top-level arguments 'input' and a copy of the compile options.
+func compileWithInput(pkgPath string, input map[string]string, opts *opt.CompileOptions) (*CompileResult, error) {
+	caseOpts := opts.Clone()
+	caseOpts.SetPkgPath(pkgPath)
+	for _, key := range sortedInputKeys(input) {
+		caseOpts.Merge(kcl.WithOptions(fmt.Sprintf("%s=%s", key, input[key])))
+	}
+
+	restoreEnvs, err := loadEnvFile(caseOpts)
+	if err != nil {
+		return nil, formatError(err, opts)
+	}
+	defer restoreEnvs()
+
+	kpmcli, err := client.NewKpmClient()
+	if err != nil {
+		return nil, formatError(err, opts)
+	}
+	kpmcli.SetNoSumCheck(caseOpts.NoSumCheck())
+
+	result, err := compilePkgToResult(kpmcli, caseOpts)
+	if err != nil {
+		err = reporter.NewErrorEvent(reporter.CompileFailed, err, fmt.Sprintf("failed to compile '%s' with the input %s", pkgPath, formatInput(input)))
+		return nil, formatError(err, opts)
+	}
+	return result, nil
+}
+
+// formatInput returns the top-level arguments 'input' in the form of '{a=1, b=2}' sorted by the names.
+func formatInput(input map[string]string) string {
+	args := make([]string, 0, len(input))
+	for _, key := range sortedInputKeys(input) {
+		args = append(args, fmt.Sprintf("%s=%s", key, input[key]))
+	}
+	return "{" + strings.Join(args, ", ") + "}"
+}
+
+// sortedInputKeys returns the names of the top-level arguments 'input' in order.
+func sortedInputKeys(input map[string]string) []string {
+	keys := make([]string, 0, len(input))
+	for key := range input {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
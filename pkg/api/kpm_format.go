@@ -0,0 +1,355 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"kcl-lang.io/kpm/pkg/opt"
+	"kcl-lang.io/kpm/pkg/reporter"
+)
+
+// orderedField is a field of a json object decoded in the order of the fields.
+type orderedField struct {
+	key   string
+	value interface{}
+}
+
+// orderedObject is a json object decoded with the fields in their order, so that the converted result keeps the order of the output.
+type orderedObject []orderedField
+
+// decodeOrderedJson decodes the json 'content' into the values which are 'orderedObject', '[]interface{}', 'string',
+// 'json.Number', 'bool' or nil, the numbers are kept as they are to tell the integers from the floats.
+func decodeOrderedJson(content string) (interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader(content))
+	decoder.UseNumber()
+	value, err := decodeOrderedValue(decoder)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected content after the json value")
+	}
+	return value, nil
+}
+
+// decodeOrderedValue decodes the next json value from 'decoder'.
+func decodeOrderedValue(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	delim, ok := token.(json.Delim)
+	if !ok {
+		return token, nil
+	}
+
+	switch delim {
+	case '{':
+		object := orderedObject{}
+		for decoder.More() {
+			keyToken, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			key, ok := keyToken.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid key '%v' in the json object", keyToken)
+			}
+			value, err := decodeOrderedValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			object = append(object, orderedField{key: key, value: value})
+		}
+		_, err = decoder.Token()
+		return object, err
+	case '[':
+		list := []interface{}{}
+		for decoder.More() {
+			value, err := decodeOrderedValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		_, err = decoder.Token()
+		return list, err
+	}
+	return nil, fmt.Errorf("unexpected delimiter '%s' in the json value", delim)
+}
+
+// decodedDocuments returns the documents of the compile result decoded by 'decodeOrderedJson'.
+func (r *CompileResult) decodedDocuments() ([]interface{}, error) {
+	docs := make([]interface{}, 0, len(r.documents))
+	for i, doc := range r.documents {
+		value, err := decodeOrderedJson(doc.Json)
+		if err != nil {
+			return nil, reporter.NewErrorEvent(reporter.FailedConvertResult, err, fmt.Sprintf("failed to decode the document %d of the compile result", i))
+		}
+		docs = append(docs, value)
+	}
+	return docs, nil
+}
+
+// convertResult converts the compile result into the output format of the compile options, nothing is done for yaml and json.
+// The formats other than the built-in ones are serialized by the serializers registered in the compile options.
+func convertResult(result *CompileResult, opts *opt.CompileOptions) error {
+	var err error
+	switch format := opts.OutputFormat(); format {
+	case opt.YAML, opt.JSON:
+	case opt.CUE:
+		_, err = result.GetCueResult()
+	case opt.HCL:
+		_, err = result.GetHclResult()
+	default:
+		err = result.serialize(string(format), opts.Serializer(string(format)))
+	}
+	return err
+}
+
+// serialize will serialize the documents of the compile result by the serializer 's' of the custom output format 'name',
+// and keep the output to be returned by 'SerializedResult'.
+func (r *CompileResult) serialize(name string, s opt.Serializer) error {
+	if s == nil {
+		return reporter.NewErrorEvent(
+			reporter.FailedConvertResult,
+			fmt.Errorf("no serializer is registered for the output format '%s'", name),
+			fmt.Sprintf("unknown output format '%s'", name),
+		)
+	}
+
+	docs := make([]interface{}, 0, len(r.documents))
+	for i, doc := range r.documents {
+		value, err := decodeDocument(doc)
+		if err != nil {
+			return reporter.NewErrorEvent(reporter.FailedConvertResult, err, fmt.Sprintf("failed to decode the document %d of the compile result", i))
+		}
+		docs = append(docs, value)
+	}
+	out, err := s(docs)
+	if err != nil {
+		return reporter.NewErrorEvent(reporter.FailedConvertResult, err, fmt.Sprintf("failed to serialize the compile result into '%s'", name))
+	}
+	r.serialized = out
+	return nil
+}
+
+// SerializedResult returns the compile result serialized by the custom serializer selected by 'opt.WithOutputFormat',
+// it is nil for the built-in formats.
+func (r *CompileResult) SerializedResult() []byte {
+	return r.serialized
+}
+
+// cueIdentPattern matches the labels which can be written without quotes in CUE,
+// the labels starting with '_' or '#' are the hidden fields and the definitions, so they are quoted.
+var cueIdentPattern = regexp.MustCompile(`^[a-zA-Z$][a-zA-Z0-9_$]*$`)
+
+// cueKeywords is the keywords of CUE, which are quoted when they are the labels.
+var cueKeywords = map[string]bool{
+	"package": true, "import": true, "for": true, "in": true, "if": true, "let": true,
+	"true": true, "false": true, "null": true,
+}
+
+// GetCueResult returns the compile result converted into CUE.
+// A single document is converted into the fields of the CUE file if it is an object, and multiple documents into a CUE list.
+// The key order of the objects is kept, and the integers and the floats are kept as they are.
+func (r *CompileResult) GetCueResult() (string, error) {
+	docs, err := r.decodedDocuments()
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if len(docs) == 1 {
+		if object, ok := docs[0].(orderedObject); ok {
+			for _, field := range object {
+				buf.WriteString(cueLabel(field.key) + ": ")
+				writeCueValue(&buf, field.value, 0)
+				buf.WriteString("\n")
+			}
+			return buf.String(), nil
+		}
+		writeCueValue(&buf, docs[0], 0)
+	} else if len(docs) > 1 {
+		writeCueValue(&buf, docs, 0)
+	}
+	if buf.Len() != 0 {
+		buf.WriteString("\n")
+	}
+	return buf.String(), nil
+}
+
+// cueLabel returns the label of the field 'key' in CUE.
+func cueLabel(key string) string {
+	if cueIdentPattern.MatchString(key) && !cueKeywords[key] {
+		return key
+	}
+	return jsonString(key)
+}
+
+// writeCueValue writes the value in CUE into 'buf', 'indent' is the number of tabs before the current line.
+func writeCueValue(buf *bytes.Buffer, value interface{}, indent int) {
+	switch v := value.(type) {
+	case orderedObject:
+		if len(v) == 0 {
+			buf.WriteString("{}")
+			return
+		}
+		buf.WriteString("{\n")
+		for _, field := range v {
+			buf.WriteString(strings.Repeat("\t", indent+1) + cueLabel(field.key) + ": ")
+			writeCueValue(buf, field.value, indent+1)
+			buf.WriteString("\n")
+		}
+		buf.WriteString(strings.Repeat("\t", indent) + "}")
+	case []interface{}:
+		if len(v) == 0 {
+			buf.WriteString("[]")
+			return
+		}
+		buf.WriteString("[\n")
+		for _, item := range v {
+			buf.WriteString(strings.Repeat("\t", indent+1))
+			writeCueValue(buf, item, indent+1)
+			buf.WriteString(",\n")
+		}
+		buf.WriteString(strings.Repeat("\t", indent) + "]")
+	case string:
+		buf.WriteString(jsonString(v))
+	case nil:
+		buf.WriteString("null")
+	default:
+		buf.WriteString(fmt.Sprint(v))
+	}
+}
+
+// jsonString returns the string 's' quoted as a json string, which is also a valid string literal in CUE.
+func jsonString(s string) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// hclIdentPattern matches the identifiers of HCL, which are the only names allowed for the top-level attributes.
+var hclIdentPattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_-]*$`)
+
+// GetHclResult returns the compile result converted into the native syntax of HCL, e.g. the variables of Terraform.
+// The document is converted into the top-level attributes, the key order of the objects is kept,
+// and the integers and the floats are kept as they are.
+// An error is returned if the result can not be represented in HCL, i.e. it has more than one document, the document is not an object,
+// or a top-level key is not a valid identifier of HCL.
+func (r *CompileResult) GetHclResult() (string, error) {
+	docs, err := r.decodedDocuments()
+	if err != nil {
+		return "", err
+	}
+	if len(docs) == 0 {
+		return "", nil
+	}
+	if len(docs) > 1 {
+		return "", reporter.NewErrorEvent(
+			reporter.FailedConvertResult,
+			fmt.Errorf("%d documents are compiled, but HCL has no multiple documents", len(docs)),
+			"failed to convert the compile result into HCL",
+		)
+	}
+	object, ok := docs[0].(orderedObject)
+	if !ok {
+		return "", reporter.NewErrorEvent(
+			reporter.FailedConvertResult,
+			fmt.Errorf("the document is not an object, but the body of HCL only has attributes"),
+			"failed to convert the compile result into HCL",
+		)
+	}
+
+	var buf bytes.Buffer
+	for _, field := range object {
+		if !hclIdentPattern.MatchString(field.key) {
+			return "", reporter.NewErrorEvent(
+				reporter.FailedConvertResult,
+				fmt.Errorf("the key '%s' is not a valid identifier of HCL", field.key),
+				"failed to convert the compile result into HCL",
+			)
+		}
+		buf.WriteString(field.key + " = ")
+		writeHclValue(&buf, field.value, 0)
+		buf.WriteString("\n")
+	}
+	return buf.String(), nil
+}
+
+// writeHclValue writes the value in HCL into 'buf', 'indent' is the number of the indents of two spaces before the current line.
+func writeHclValue(buf *bytes.Buffer, value interface{}, indent int) {
+	switch v := value.(type) {
+	case orderedObject:
+		if len(v) == 0 {
+			buf.WriteString("{}")
+			return
+		}
+		buf.WriteString("{\n")
+		for _, field := range v {
+			key := field.key
+			if !hclIdentPattern.MatchString(key) {
+				key = hclString(key)
+			}
+			buf.WriteString(strings.Repeat("  ", indent+1) + key + " = ")
+			writeHclValue(buf, field.value, indent+1)
+			buf.WriteString("\n")
+		}
+		buf.WriteString(strings.Repeat("  ", indent) + "}")
+	case []interface{}:
+		if len(v) == 0 {
+			buf.WriteString("[]")
+			return
+		}
+		buf.WriteString("[\n")
+		for _, item := range v {
+			buf.WriteString(strings.Repeat("  ", indent+1))
+			writeHclValue(buf, item, indent+1)
+			buf.WriteString(",\n")
+		}
+		buf.WriteString(strings.Repeat("  ", indent) + "]")
+	case string:
+		buf.WriteString(hclString(v))
+	case nil:
+		buf.WriteString("null")
+	default:
+		buf.WriteString(fmt.Sprint(v))
+	}
+}
+
+// hclString returns the string 's' quoted as a string literal of HCL,
+// the template sequences '${' and '%{' are escaped so that they are kept literally.
+func hclString(s string) string {
+	var sb strings.Builder
+	sb.WriteString(`"`)
+	for i, char := range s {
+		switch {
+		case char == '"':
+			sb.WriteString(`\"`)
+		case char == '\\':
+			sb.WriteString(`\\`)
+		case char == '\n':
+			sb.WriteString(`\n`)
+		case char == '\r':
+			sb.WriteString(`\r`)
+		case char == '\t':
+			sb.WriteString(`\t`)
+		case char < 0x20 || char == 0x7f:
+			sb.WriteString(fmt.Sprintf(`\u%04x`, char))
+		case (char == '$' || char == '%') && strings.HasPrefix(s[i+1:], "{"):
+			sb.WriteRune(char)
+			sb.WriteRune(char)
+		default:
+			sb.WriteRune(char)
+		}
+	}
+	sb.WriteString(`"`)
+	return sb.String()
+}
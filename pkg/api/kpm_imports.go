@@ -0,0 +1,176 @@
+package api
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"kcl-lang.io/kpm/pkg/constants"
+	"kcl-lang.io/kpm/pkg/opt"
+	pkg "kcl-lang.io/kpm/pkg/package"
+)
+
+// importPattern matches the kcl import statements, e.g. 'import ..base as b'.
+var importPattern = regexp.MustCompile(`^\s*import\s+(\.*[\w.]*)`)
+
+// importedModules returns the modules imported by the kcl file 'path', e.g. '..base' and 'k8s.api.core.v1'.
+func importedModules(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var modules []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		matches := importPattern.FindStringSubmatch(scanner.Text())
+		if matches != nil && len(matches[1]) != 0 {
+			modules = append(modules, matches[1])
+		}
+	}
+	return modules, scanner.Err()
+}
+
+// relativeImportPath returns the path of the module imported by the relative import 'module' in the kcl file 'path'.
+// The relative import '.a' is in the directory of the file, and each more '.' goes up one directory.
+func relativeImportPath(path, module string) string {
+	name := strings.TrimLeft(module, ".")
+	dir := filepath.Dir(path)
+	for i := 1; i < len(module)-len(name); i++ {
+		dir = filepath.Dir(dir)
+	}
+	return modulePath(dir, name)
+}
+
+// modulePath returns the path of the module 'name' in the directory 'dir',
+// which is the kcl file of the module if it exists, or the directory of the module.
+func modulePath(dir, name string) string {
+	path := filepath.Join(dir, filepath.FromSlash(strings.ReplaceAll(name, ".", "/")))
+	if _, err := os.Stat(path + constants.KFilePathSuffix); err == nil {
+		return path + constants.KFilePathSuffix
+	}
+	return path
+}
+
+// kclFiles returns the kcl file 'path', or the kcl files in the directory 'path'.
+func kclFiles(path string) []string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+	if !info.IsDir() {
+		if filepath.Ext(path) == constants.KFilePathSuffix {
+			return []string{path}
+		}
+		return nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil
+	}
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && filepath.Ext(entry.Name()) == constants.KFilePathSuffix {
+			files = append(files, filepath.Join(path, entry.Name()))
+		}
+	}
+	return files
+}
+
+// importedDepNames returns the names of the dependencies of 'kclPkg' keyed by the names they are imported by,
+// which are the alias names of the dependencies or the import aliases in the compile options.
+func importedDepNames(kclPkg *pkg.KclPkg, opts *opt.CompileOptions) map[string]string {
+	depNames := make(map[string]string)
+	for name, dep := range kclPkg.ModFile.Dependencies.Deps {
+		depNames[dep.GetAliasName()] = name
+	}
+	for from, to := range opts.ImportAliases() {
+		if name, ok := depNames[to]; ok {
+			depNames[from] = name
+		}
+	}
+	return depNames
+}
+
+// walkImports will call 'visit' with each module imported by the entries in the compile options, and by the kcl files of the package
+// imported by them in turn. 'path' is the path of the module in the package, and it is empty if the module is imported from the dependency 'dep'.
+// The kcl files of the modules in the package are walked after they are visited, and the ones of the dependencies are not.
+func walkImports(kclPkg *pkg.KclPkg, opts *opt.CompileOptions, visit func(file, module, path, dep string) error) error {
+	return walkImportsFrom(kclPkg, opts.KFilenameList, importedDepNames(kclPkg, opts), visit)
+}
+
+// walkImportsFrom will call 'visit' with each module imported by the kcl files and directories 'entries' as 'walkImports' does,
+// 'depNames' is the names of the dependencies keyed by the names they are imported by.
+func walkImportsFrom(kclPkg *pkg.KclPkg, entries []string, depNames map[string]string, visit func(file, module, path, dep string) error) error {
+	var files []string
+	for _, entry := range entries {
+		files = append(files, kclFiles(entry)...)
+	}
+	visited := make(map[string]bool)
+	for len(files) != 0 {
+		file := files[0]
+		files = files[1:]
+		if visited[file] {
+			continue
+		}
+		visited[file] = true
+
+		modules, err := importedModules(file)
+		if err != nil {
+			return err
+		}
+		for _, module := range modules {
+			var path, dep string
+			if strings.HasPrefix(module, ".") {
+				path = relativeImportPath(file, module)
+			} else if name, ok := depNames[strings.Split(module, ".")[0]]; ok {
+				dep = name
+			} else {
+				path = modulePath(kclPkg.HomePath, module)
+			}
+			if err := visit(file, module, path, dep); err != nil {
+				return err
+			}
+			if len(path) != 0 {
+				files = append(files, kclFiles(path)...)
+			}
+		}
+	}
+	return nil
+}
+
+// usedDeps returns the names of the dependencies of 'kclPkg' imported by the entries in the compile options.
+// The imports are found statically from the entries, and the kcl files of the package imported by them are checked in turn.
+// The dependencies whose outputs are included are always used.
+// nil is returned if there are no entries to find the imports from.
+func usedDeps(kclPkg *pkg.KclPkg, opts *opt.CompileOptions) ([]string, error) {
+	if len(opts.KFilenameList) == 0 {
+		return nil, nil
+	}
+
+	used := make(map[string]bool)
+	for _, name := range opts.IncludeDependencyOutput() {
+		used[name] = true
+	}
+	err := walkImports(kclPkg, opts, func(file, module, path, dep string) error {
+		if len(dep) != 0 {
+			used[dep] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(used))
+	for name := range used {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,225 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"kcl-lang.io/kpm/pkg/client"
+	"kcl-lang.io/kpm/pkg/opt"
+	pkg "kcl-lang.io/kpm/pkg/package"
+	"kcl-lang.io/kpm/pkg/reporter"
+	"kcl-lang.io/kpm/pkg/runner"
+)
+
+// cachedEntry is the input hash and the output of an entry cached for the incremental builds.
+type cachedEntry struct {
+	// Entry is the path of the entry.
+	Entry string `json:"entry"`
+	// Hash is the hash of the inputs of the entry.
+	Hash string `json:"hash"`
+	// Documents is the documents produced by the entry.
+	Documents []cachedDocument `json:"documents"`
+}
+
+// cachedDocument is a document produced by a cached entry.
+type cachedDocument struct {
+	Yaml string `json:"yaml"`
+	Json string `json:"json"`
+}
+
+// compileIncrementally will compile each entry of the compile options separately,
+// and return the cached output for the entries whose inputs are unchanged since the last run.
+func compileIncrementally(kpmcli *client.KpmClient, kclPkg *pkg.KclPkg, opts *opt.CompileOptions, prof *profiler) (*CompileResult, error) {
+	endResolve := prof.span("resolve")
+	depsMap, err := kpmcli.ResolveDepsIntoMap(kclPkg)
+	endResolve()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &CompileResult{
+		separatorComment: opts.DocumentSeparatorComment(),
+	}
+	for i, entry := range opts.KFilenameList {
+		entryOpts := entryCompileOptions(opts, i)
+		source := entrySource(opts.PkgPath(), entry)
+		hash, err := entryInputsHash(kclPkg, depsMap, entryOpts)
+		if err != nil {
+			return nil, reporter.NewErrorEvent(reporter.FailedAccessPkgPath, err, fmt.Sprintf("failed to hash the inputs of the entry '%s'", entry))
+		}
+
+		cachePath := entryCachePath(opts.IncrementalCacheDir(), entry)
+		if cached, ok := loadCachedEntry(cachePath); ok && cached.Entry == entry && cached.Hash == hash {
+			for _, doc := range cached.Documents {
+				result.documents = append(result.documents, Document{Source: source, Yaml: doc.Yaml, Json: doc.Json})
+			}
+			continue
+		}
+
+		endCompile := prof.span("compile", source)
+		compileResult, err := kpmcli.CompileWithDepsMap(depsMap, runner.NewCompilerWithOpts(entryOpts))
+		endCompile()
+		if err != nil {
+			return nil, reporter.NewErrorEvent(reporter.CompileFailed, err, fmt.Sprintf("failed to compile the entry '%s'", entry))
+		}
+		entryResult := &CompileResult{}
+		entryResult.addDocuments(compileResult, source)
+		result.documents = append(result.documents, entryResult.documents...)
+
+		err = storeCachedEntry(cachePath, entry, hash, entryResult.documents)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// entryInputsHash returns the hash of the inputs of the entry in 'entryOpts',
+// which are the compile options, the 'kcl.mod' and 'kcl.mod.lock' of 'kclPkg',
+// and the kcl files imported by the entry transitively, including the ones in the dependencies in 'depsMap'.
+func entryInputsHash(kclPkg *pkg.KclPkg, depsMap map[string]string, entryOpts *opt.CompileOptions) (string, error) {
+	hash := sha256.New()
+
+	args, err := json.Marshal(entryOpts.Option.ExecProgram_Args)
+	if err != nil {
+		return "", err
+	}
+	hash.Write(args)
+
+	for _, path := range []string{kclPkg.ModFile.GetModFilePath(), kclPkg.GetLockFilePath()} {
+		content, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		hash.Write([]byte(fmt.Sprintf("\n%s\n%d\n", path, len(content))))
+		hash.Write(content)
+	}
+
+	// The dependencies are imported by the names or the import aliases.
+	depRoots := make(map[string]string, len(depsMap))
+	for name, path := range depsMap {
+		depRoots[name] = path
+	}
+	for from, to := range entryOpts.ImportAliases() {
+		if path, ok := depsMap[to]; ok {
+			depRoots[from] = path
+		}
+	}
+
+	files, err := importedFiles(kclPkg.HomePath, entryOpts.KFilenameList[0], depRoots)
+	if err != nil {
+		return "", err
+	}
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		hash.Write([]byte(fmt.Sprintf("\n%s\n%d\n", file, len(content))))
+		hash.Write(content)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// importedFiles returns the sorted kcl files of the entry in the package 'pkgPath' and the kcl files imported by them transitively.
+// The absolute imports are resolved in the dependencies in 'depRoots' by the first part of the module,
+// or in the root of the package or the dependency which imports them.
+func importedFiles(pkgPath, entry string, depRoots map[string]string) ([]string, error) {
+	type file struct {
+		path string
+		root string
+	}
+	var queue []file
+	for _, path := range kclFiles(entry) {
+		queue = append(queue, file{path: path, root: pkgPath})
+	}
+
+	visited := make(map[string]bool)
+	for len(queue) != 0 {
+		f := queue[0]
+		queue = queue[1:]
+		if visited[f.path] {
+			continue
+		}
+		visited[f.path] = true
+
+		modules, err := importedModules(f.path)
+		if err != nil {
+			return nil, err
+		}
+		for _, module := range modules {
+			if strings.HasPrefix(module, ".") {
+				for _, path := range kclFiles(relativeImportPath(f.path, module)) {
+					queue = append(queue, file{path: path, root: f.root})
+				}
+				continue
+			}
+			root, name, _ := strings.Cut(module, ".")
+			if depRoot, ok := depRoots[root]; ok {
+				for _, path := range kclFiles(modulePath(depRoot, name)) {
+					queue = append(queue, file{path: path, root: depRoot})
+				}
+				continue
+			}
+			for _, path := range kclFiles(modulePath(f.root, module)) {
+				queue = append(queue, file{path: path, root: f.root})
+			}
+		}
+	}
+
+	files := make([]string, 0, len(visited))
+	for path := range visited {
+		files = append(files, path)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// entryCachePath returns the path of the cache of the entry in the cache directory 'cacheDir'.
+func entryCachePath(cacheDir, entry string) string {
+	sum := sha256.Sum256([]byte(entry))
+	return filepath.Join(cacheDir, hex.EncodeToString(sum[:])+".json")
+}
+
+// loadCachedEntry returns the cached entry in 'path', the cache which can not be loaded is taken as missing.
+func loadCachedEntry(path string) (*cachedEntry, bool) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	var cached cachedEntry
+	if err := json.Unmarshal(content, &cached); err != nil {
+		return nil, false
+	}
+	return &cached, true
+}
+
+// storeCachedEntry will store the input hash and the documents of the entry into the cache in 'path'.
+func storeCachedEntry(path, entry, hash string, documents []Document) error {
+	cached := cachedEntry{Entry: entry, Hash: hash, Documents: make([]cachedDocument, 0, len(documents))}
+	for _, doc := range documents {
+		cached.Documents = append(cached.Documents, cachedDocument{Yaml: doc.Yaml, Json: doc.Json})
+	}
+
+	content, err := json.Marshal(cached)
+	if err != nil {
+		return reporter.NewErrorEvent(reporter.Bug, err, "internal bug: failed to marshal the cached entry into json")
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return reporter.NewErrorEvent(reporter.FailedCreateFile, err, fmt.Sprintf("failed to create the cache directory '%s'", filepath.Dir(path)))
+	}
+	err = os.WriteFile(path, content, 0644)
+	if err != nil {
+		return reporter.NewErrorEvent(reporter.FailedCreateFile, err, fmt.Sprintf("failed to write the cache '%s'", path))
+	}
+	return nil
+}
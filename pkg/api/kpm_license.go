@@ -0,0 +1,165 @@
+package api
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	pkg "kcl-lang.io/kpm/pkg/package"
+	"kcl-lang.io/kpm/pkg/reporter"
+)
+
+// LicenseNoAssertion is the license of the dependencies whose license files are not recognized, as in SPDX.
+const LicenseNoAssertion = "NOASSERTION"
+
+// licenseFilePattern matches the names of the license files in the kcl packages, e.g. 'LICENSE', 'LICENSE.md' and 'COPYING'.
+var licenseFilePattern = regexp.MustCompile(`(?i)^(LICEN[CS]E|COPYING)([.-].*)?$`)
+
+// licenseSignatures is the texts identifying the common licenses in the license files, the first one matched wins,
+// so the more specific ones are before the ones they contain, e.g. the 'GNU LESSER' before the 'GNU GENERAL'.
+var licenseSignatures = []struct {
+	id    string
+	texts []string
+}{
+	{"Apache-2.0", []string{"apache license", "version 2.0"}},
+	{"MPL-2.0", []string{"mozilla public license", "version 2.0"}},
+	{"AGPL-3.0", []string{"gnu affero general public license", "version 3"}},
+	{"LGPL-3.0", []string{"gnu lesser general public license", "version 3"}},
+	{"LGPL-2.1", []string{"gnu lesser general public license", "version 2.1"}},
+	{"GPL-3.0", []string{"gnu general public license", "version 3"}},
+	{"GPL-2.0", []string{"gnu general public license", "version 2"}},
+	{"BSD-3-Clause", []string{"redistribution and use in source and binary forms", "neither the name"}},
+	{"BSD-2-Clause", []string{"redistribution and use in source and binary forms"}},
+	{"MIT", []string{"permission is hereby granted, free of charge"}},
+	{"ISC", []string{"permission to use, copy, modify, and/or distribute this software for any purpose"}},
+	{"Unlicense", []string{"this is free and unencumbered software released into the public domain"}},
+}
+
+// LicensePolicy is the policy of the licenses of the dependencies.
+type LicensePolicy struct {
+	// Allowed is the licenses allowed, all the licenses are allowed except the denied ones if it is empty.
+	Allowed []string
+	// Denied is the licenses denied.
+	Denied []string
+	// AllowMissing is true if the dependencies without license are allowed.
+	AllowMissing bool
+}
+
+// DependencyLicenses returns the licenses of the resolved dependencies of the kcl package in 'pkgPath',
+// the key is the name of the dependency. The license is the 'license' declared in the kcl.mod of the dependency,
+// or the license recognized from the license file in the dependency, e.g. 'LICENSE', which is 'NOASSERTION' if it is not recognized.
+// The license is empty if the dependency has neither.
+// The dependencies are downloaded into the cache if they are not vendored or cached.
+func DependencyLicenses(pkgPath string) (map[string]string, error) {
+	kpmcli, kclPkg, err := loadAndResolvePkg(pkgPath)
+	if err != nil {
+		return nil, err
+	}
+
+	depsMap, err := kpmcli.ResolveDepsIntoMap(kclPkg)
+	if err != nil {
+		return nil, err
+	}
+
+	licenses := make(map[string]string, len(kclPkg.Dependencies.Deps))
+	for name, dep := range kclPkg.Dependencies.Deps {
+		depPath, ok := depsMap[dep.GetAliasName()]
+		if !ok {
+			continue
+		}
+		license, err := pkgLicense(depPath)
+		if err != nil {
+			return nil, reporter.NewErrorEvent(reporter.FailedAccessPkgPath, err, fmt.Sprintf("failed to find the license of the dependency '%s'", name))
+		}
+		licenses[name] = license
+	}
+	return licenses, nil
+}
+
+// Check will return an error listing the dependencies whose licenses in 'licenses' are not allowed by the policy,
+// 'licenses' is the licenses returned by 'DependencyLicenses'.
+func (policy LicensePolicy) Check(licenses map[string]string) error {
+	names := make([]string, 0, len(licenses))
+	for name := range licenses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var violations []string
+	for _, name := range names {
+		license := licenses[name]
+		switch {
+		case len(license) == 0:
+			if !policy.AllowMissing {
+				violations = append(violations, fmt.Sprintf("'%s' has no license", name))
+			}
+		case containsLicense(policy.Denied, license):
+			violations = append(violations, fmt.Sprintf("the license '%s' of '%s' is denied", license, name))
+		case len(policy.Allowed) != 0 && !containsLicense(policy.Allowed, license):
+			violations = append(violations, fmt.Sprintf("the license '%s' of '%s' is not allowed", license, name))
+		}
+	}
+
+	if len(violations) != 0 {
+		return reporter.NewErrorEvent(
+			reporter.LicenseNotAllowed,
+			fmt.Errorf("%s", strings.Join(violations, "\n")),
+			"the licenses of the dependencies are not allowed by the license policy",
+		)
+	}
+	return nil
+}
+
+// containsLicense returns true if 'license' is in 'licenses', the SPDX license identifiers are case-insensitive.
+func containsLicense(licenses []string, license string) bool {
+	for _, l := range licenses {
+		if strings.EqualFold(l, license) {
+			return true
+		}
+	}
+	return false
+}
+
+// pkgLicense returns the license of the kcl package in 'pkgPath', which is declared in its kcl.mod or recognized from its license file.
+func pkgLicense(pkgPath string) (string, error) {
+	if modFile, err := pkg.LoadModFile(pkgPath); err == nil && len(modFile.Pkg.License) != 0 {
+		return modFile.Pkg.License, nil
+	}
+
+	entries, err := os.ReadDir(pkgPath)
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !licenseFilePattern.MatchString(entry.Name()) {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(pkgPath, entry.Name()))
+		if err != nil {
+			return "", err
+		}
+		return recognizeLicense(string(content)), nil
+	}
+	return "", nil
+}
+
+// recognizeLicense returns the SPDX identifier of the license in the license file 'content', or 'NOASSERTION' if it is not recognized.
+func recognizeLicense(content string) string {
+	text := strings.ToLower(strings.Join(strings.Fields(content), " "))
+	for _, signature := range licenseSignatures {
+		matched := true
+		for _, t := range signature.texts {
+			if !strings.Contains(text, t) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return signature.id
+		}
+	}
+	return LicenseNoAssertion
+}
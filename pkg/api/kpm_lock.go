@@ -0,0 +1,289 @@
+package api
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"kcl-lang.io/kpm/pkg/env"
+	pkg "kcl-lang.io/kpm/pkg/package"
+	"kcl-lang.io/kpm/pkg/reporter"
+	"kcl-lang.io/kpm/pkg/utils"
+)
+
+// PruneReport is the report of pruning the kcl.mod.lock of a kcl package.
+type PruneReport struct {
+	// Pruned is the sorted names of the dependencies removed from the kcl.mod.lock.
+	Pruned []string
+	// Kept is the sorted names of the dependencies kept in the kcl.mod.lock.
+	Kept []string
+}
+
+// PruneLock will remove the dependencies which are not reachable from the kcl.mod of the kcl package in 'pkgPath'
+// from its kcl.mod.lock, e.g. the ones left after their dependents are removed from the kcl.mod.
+// The reachable dependencies are found by the kcl.mod of the dependencies in the vendor directory, the local paths or the cache,
+// so nothing is downloaded, and the pruning is aborted if a reachable dependency is not found on the disk.
+// The kcl.mod.lock is not written if nothing is pruned.
+func PruneLock(pkgPath string) (*PruneReport, error) {
+	absPkgPath, err := filepath.Abs(pkgPath)
+	if err != nil {
+		return nil, reporter.NewErrorEvent(reporter.Bug, err, "internal bugs, please contact us to fix it.")
+	}
+	kclPkg, err := pkg.LoadKclPkg(absPkgPath)
+	if err != nil {
+		return nil, err
+	}
+	globalPkgPath, err := env.GetAbsPkgPath()
+	if err != nil {
+		return nil, err
+	}
+
+	reachable, err := reachableLockedDeps(kclPkg, globalPkgPath, false)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &PruneReport{}
+	for _, name := range sortedDepNames(kclPkg.Dependencies.Deps) {
+		if reachable[name] {
+			report.Kept = append(report.Kept, name)
+		} else {
+			report.Pruned = append(report.Pruned, name)
+			delete(kclPkg.Dependencies.Deps, name)
+		}
+	}
+	if len(report.Pruned) == 0 {
+		return report, nil
+	}
+
+	err = kclPkg.LockDepsVersion()
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// DriftKind is the kind of a drift between the kcl.mod and the kcl.mod.lock.
+type DriftKind string
+
+const (
+	// DriftUnlocked means the dependency is required in the kcl.mod but not locked in the kcl.mod.lock.
+	DriftUnlocked DriftKind = "unlocked"
+	// DriftRemoved means the dependency is locked in the kcl.mod.lock but no longer required.
+	DriftRemoved DriftKind = "removed"
+	// DriftMismatched means the dependency is locked with a different version or source from the one required in the kcl.mod.
+	DriftMismatched DriftKind = "mismatched"
+)
+
+// DependencyDrift is a drift of a dependency between the kcl.mod and the kcl.mod.lock.
+type DependencyDrift struct {
+	Name string
+	Kind DriftKind
+	// Required is the version required in the kcl.mod, it is empty if the dependency is removed.
+	Required string
+	// Locked is the version locked in the kcl.mod.lock, it is empty if the dependency is unlocked.
+	Locked string
+}
+
+// String returns the drift in the form of '+ name required (not locked)', '- name locked (not required)'
+// or '~ name: locked locked, required required'.
+func (d DependencyDrift) String() string {
+	switch d.Kind {
+	case DriftUnlocked:
+		return fmt.Sprintf("+ %s %s (not locked)", d.Name, d.Required)
+	case DriftRemoved:
+		return fmt.Sprintf("- %s %s (not required)", d.Name, d.Locked)
+	default:
+		return fmt.Sprintf("~ %s: locked %s, required %s", d.Name, d.Locked, d.Required)
+	}
+}
+
+// DriftReport is the report of how the kcl.mod.lock of a kcl package diverges from its kcl.mod.
+type DriftReport struct {
+	// Drifts is the drifts of the dependencies sorted by their names.
+	Drifts []DependencyDrift
+}
+
+// HasDrift returns true if the kcl.mod.lock diverges from the kcl.mod.
+func (r *DriftReport) HasDrift() bool {
+	return len(r.Drifts) != 0
+}
+
+// String returns the drifts one per line, e.g. to comment on a pull request.
+func (r *DriftReport) String() string {
+	if !r.HasDrift() {
+		return "kcl.mod.lock is in sync with kcl.mod\n"
+	}
+	var sb strings.Builder
+	for _, drift := range r.Drifts {
+		sb.WriteString(drift.String())
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// ModLockDrift will report how the kcl.mod.lock of the kcl package in 'pkgPath' diverges from its kcl.mod,
+// i.e. the dependencies required but not locked yet, the dependencies locked but no longer required,
+// and the dependencies locked with the versions or the sources different from the required ones.
+// The dependencies locked for the other dependencies are required if they are reachable by the kcl.mod of the dependencies
+// in the vendor directory, the local paths or the cache, so nothing is downloaded or changed,
+// and the dependencies of the ones not found on the disk are reported as removed.
+func ModLockDrift(pkgPath string) (*DriftReport, error) {
+	absPkgPath, err := filepath.Abs(pkgPath)
+	if err != nil {
+		return nil, reporter.NewErrorEvent(reporter.Bug, err, "internal bugs, please contact us to fix it.")
+	}
+	kclPkg, err := pkg.LoadKclPkg(absPkgPath)
+	if err != nil {
+		return nil, err
+	}
+	globalPkgPath, err := env.GetAbsPkgPath()
+	if err != nil {
+		return nil, err
+	}
+	reachable, err := reachableLockedDeps(kclPkg, globalPkgPath, true)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &DriftReport{}
+	names := sortedDepNames(kclPkg.ModFile.Dependencies.Deps)
+	for _, name := range sortedDepNames(kclPkg.Dependencies.Deps) {
+		if _, ok := kclPkg.ModFile.Dependencies.Deps[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		modDep, required := kclPkg.ModFile.Dependencies.Deps[name]
+		lockDep, locked := kclPkg.Dependencies.Deps[name]
+		switch {
+		case required && !locked:
+			report.Drifts = append(report.Drifts, DependencyDrift{Name: name, Kind: DriftUnlocked, Required: requiredVersion(absPkgPath, &modDep)})
+		case !required && !reachable[name]:
+			report.Drifts = append(report.Drifts, DependencyDrift{Name: name, Kind: DriftRemoved, Locked: lockDep.Version})
+		case required:
+			// The local dependencies have no version in kcl.mod, so the version in their own kcl.mod is required.
+			modDep.Version = requiredVersion(absPkgPath, &modDep)
+			if !lockDep.WithTheSameVersion(modDep) {
+				report.Drifts = append(report.Drifts, DependencyDrift{Name: name, Kind: DriftMismatched, Required: modDep.Version, Locked: lockDep.Version})
+			}
+		}
+	}
+	return report, nil
+}
+
+// reachableLockedDeps returns the names of the dependencies reachable from the kcl.mod of 'kclPkg',
+// which are found by the kcl.mod of the dependencies in the vendor directory, the local paths or the cache 'globalPkgPath'.
+// If 'allowMissing' is true, the dependencies not found on the disk are taken as having no dependencies,
+// otherwise an error is returned for them.
+func reachableLockedDeps(kclPkg *pkg.KclPkg, globalPkgPath string, allowMissing bool) (map[string]bool, error) {
+	reachable := make(map[string]bool)
+	var queue []pkg.Dependency
+	for _, name := range sortedDepNames(kclPkg.ModFile.Dependencies.Deps) {
+		queue = append(queue, kclPkg.ModFile.Dependencies.Deps[name])
+	}
+	for len(queue) != 0 {
+		dep := queue[0]
+		queue = queue[1:]
+		if reachable[dep.Name] {
+			continue
+		}
+		reachable[dep.Name] = true
+		if locked, ok := kclPkg.Dependencies.Deps[dep.Name]; ok {
+			dep = locked
+		}
+
+		depPath := lockedDepPath(kclPkg, &dep, globalPkgPath)
+		if len(depPath) == 0 {
+			if allowMissing {
+				continue
+			}
+			return nil, reporter.NewErrorEvent(
+				reporter.DependencyNotFound,
+				fmt.Errorf("dependency '%s' not found in the vendor directory, the local path or '%s'", dep.Name, globalPkgPath),
+				"failed to find the dependencies reachable from 'kcl.mod', please resolve the dependencies before pruning the 'kcl.mod.lock'",
+			)
+		}
+		modFile, err := pkg.LoadModFile(depPath)
+		if err != nil {
+			// The dependencies without kcl.mod have no dependencies.
+			continue
+		}
+		for _, name := range sortedDepNames(modFile.Dependencies.Deps) {
+			queue = append(queue, modFile.Dependencies.Deps[name])
+		}
+	}
+	return reachable, nil
+}
+
+// lockedDepPath returns the directory of the dependency 'dep' of 'kclPkg' on the disk without downloading it,
+// which is the local path, the vendor subdirectory or the cache 'globalPkgPath' in order, or an empty string if it is not found.
+func lockedDepPath(kclPkg *pkg.KclPkg, dep *pkg.Dependency, globalPkgPath string) string {
+	if dep.IsFromLocal() {
+		if path := dep.GetLocalFullPath(kclPkg.HomePath); utils.DirExists(path) {
+			return path
+		}
+		return ""
+	}
+	if len(dep.FullName) == 0 {
+		return ""
+	}
+	for _, dir := range []string{kclPkg.LocalVendorPath(), globalPkgPath} {
+		if path := filepath.Join(dir, dep.FullName); utils.DirExists(path) {
+			return path
+		}
+	}
+	return ""
+}
+
+// MigrateLock will upgrade the kcl.mod.lock in 'path', which is the kcl.mod.lock or the kcl package containing it,
+// from an older schema to the schema of 'pkg.LOCK_FILE_VERSION' in place.
+// The dependencies and their checksums are kept as they are, only the fields missing in the older schemas are filled,
+// so the dependencies are not resolved again and nothing is downloaded.
+// The kcl.mod.lock is not written if it is already in the current schema,
+// and an error is returned if it is in a schema newer than the one supported.
+func MigrateLock(path string) error {
+	lockPath := path
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		lockPath = filepath.Join(path, pkg.MOD_LOCK_FILE)
+	}
+	content, err := os.ReadFile(lockPath)
+	if err != nil {
+		return reporter.NewErrorEvent(reporter.FailedLoadKclModLock, err, fmt.Sprintf("failed to load '%s'", lockPath))
+	}
+
+	deps := &pkg.Dependencies{Deps: make(map[string]pkg.Dependency)}
+	err = deps.UnmarshalLockTOML(string(content))
+	if err != nil {
+		return err
+	}
+	version, err := pkg.LockVersion(string(content))
+	if err != nil {
+		return err
+	}
+	if version == pkg.LOCK_FILE_VERSION {
+		return nil
+	}
+
+	// The legacy kcl.mod.lock may have no 'full_name' of the dependencies.
+	for name, dep := range deps.Deps {
+		if len(dep.FullName) == 0 {
+			dep.GenDepFullName()
+			deps.Deps[name] = dep
+		}
+	}
+
+	lockToml, err := deps.MarshalLockTOML()
+	if err != nil {
+		return err
+	}
+	err = utils.StoreToFileAtomically(lockPath, lockToml)
+	if err != nil {
+		return reporter.NewErrorEvent(reporter.FailedLoadKclModLock, err, fmt.Sprintf("failed to write '%s'", lockPath))
+	}
+	return nil
+}
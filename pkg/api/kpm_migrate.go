@@ -0,0 +1,109 @@
+package api
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"kcl-lang.io/kpm/pkg/client"
+	pkg "kcl-lang.io/kpm/pkg/package"
+	"kcl-lang.io/kpm/pkg/reporter"
+)
+
+// MigrationReport is the report of migrating the oci dependencies of a kcl package from a registry to another.
+type MigrationReport struct {
+	// OldHost is the registry the dependencies are migrated from.
+	OldHost string
+	// NewHost is the registry the dependencies are migrated to.
+	NewHost string
+	// Migrated is the sorted names of the migrated dependencies.
+	Migrated []string
+	// Checksums is the checksums of the migrated dependencies pulled from the new registry, the key is the name of the dependency.
+	Checksums map[string]string
+}
+
+// MigrateRegistry will rewrite the oci dependencies in the 'kcl.mod' of the kcl package in 'pkgPath' from the registry 'oldHost' to 'newHost',
+// and re-resolve them from 'newHost' to update the 'kcl.mod.lock'.
+// The dependencies pulled from 'newHost' must have the same checksums as the ones locked in 'kcl.mod.lock',
+// otherwise the migration is aborted with the mismatched checksums, and nothing is changed.
+func MigrateRegistry(pkgPath, oldHost, newHost string) (*MigrationReport, error) {
+	kpmcli, err := client.NewKpmClient()
+	if err != nil {
+		return nil, err
+	}
+
+	absPkgPath, err := filepath.Abs(pkgPath)
+	if err != nil {
+		return nil, reporter.NewErrorEvent(reporter.Bug, err, "internal bugs, please contact us to fix it.")
+	}
+	kclPkg, err := pkg.LoadKclPkg(absPkgPath)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &MigrationReport{OldHost: oldHost, NewHost: newHost, Checksums: make(map[string]string)}
+	for name, d := range kclPkg.ModFile.Dependencies.Deps {
+		if d.Source.Oci != nil && d.Source.Oci.Reg == oldHost {
+			report.Migrated = append(report.Migrated, name)
+		}
+	}
+	if len(report.Migrated) == 0 {
+		return report, nil
+	}
+	sort.Strings(report.Migrated)
+
+	tmpDir, err := os.MkdirTemp("", "migrate")
+	if err != nil {
+		return nil, reporter.NewErrorEvent(reporter.FailedCreateFile, err, "failed to create the temp dir to pull the dependencies")
+	}
+	defer os.RemoveAll(tmpDir)
+
+	defaultReg := kpmcli.GetSettings().DefaultOciRegistry()
+	var mismatches []string
+	for _, name := range report.Migrated {
+		d := migratedDependency(kclPkg.ModFile.Dependencies.Deps[name], newHost, defaultReg)
+		pulled, err := kpmcli.Download(&d, filepath.Join(tmpDir, d.FullName))
+		if err != nil {
+			return nil, reporter.NewErrorEvent(reporter.FailedGetPkg, err, fmt.Sprintf("failed to pull '%s' from '%s'", name, newHost))
+		}
+		report.Checksums[name] = pulled.Sum
+
+		if locked, ok := kclPkg.Dependencies.Deps[name]; ok && len(locked.Sum) != 0 && locked.Sum != pulled.Sum {
+			mismatches = append(mismatches, fmt.Sprintf("'%s': expected '%s', got '%s'", name, locked.Sum, pulled.Sum))
+		}
+	}
+	if len(mismatches) != 0 {
+		return nil, reporter.NewErrorEvent(
+			reporter.CheckSumMismatch,
+			fmt.Errorf("%s", strings.Join(mismatches, "\n")),
+			fmt.Sprintf("the dependencies pulled from '%s' do not match the ones locked from '%s'", newHost, oldHost),
+		)
+	}
+
+	for _, name := range report.Migrated {
+		kclPkg.ModFile.Dependencies.Deps[name] = migratedDependency(kclPkg.ModFile.Dependencies.Deps[name], newHost, defaultReg)
+		if locked, ok := kclPkg.Dependencies.Deps[name]; ok && locked.Source.Oci != nil {
+			kclPkg.Dependencies.Deps[name] = migratedDependency(locked, newHost, defaultReg)
+		}
+	}
+	err = kpmcli.ResolvePkgDepsMetadata(kclPkg, true)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// migratedDependency returns the copy of the oci dependency 'd' from the registry 'host',
+// the registry is declared in kcl.mod if it is not the default registry 'defaultReg'.
+func migratedDependency(d pkg.Dependency, host, defaultReg string) pkg.Dependency {
+	oci := *d.Source.Oci
+	oci.Reg = host
+	oci.DeclaredReg = ""
+	if host != defaultReg {
+		oci.DeclaredReg = host
+	}
+	d.Source.Oci = &oci
+	return d
+}
@@ -2,6 +2,8 @@ package api
 
 import (
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 
@@ -10,7 +12,10 @@ import (
 	"kcl-lang.io/kpm/pkg/client"
 	"kcl-lang.io/kpm/pkg/constants"
 	"kcl-lang.io/kpm/pkg/errors"
+	"kcl-lang.io/kpm/pkg/opt"
 	pkg "kcl-lang.io/kpm/pkg/package"
+	"kcl-lang.io/kpm/pkg/reporter"
+	"kcl-lang.io/kpm/pkg/utils"
 )
 
 // The KCL Package
@@ -255,3 +260,203 @@ func IsSchemaInstance(kt *KclType) bool {
 func IsSchemaNamed(kt *KclType, name string) bool {
 	return IsSchema(kt) && kt.Name == name
 }
+
+// PackageToWriter will package the kcl package in 'pkgPath' into a tar and write the tar to 'w',
+// e.g. an HTTP upload body, without intermediate files.
+// The files matching the patterns in '.kpmignore' will not be included in the tar.
+func PackageToWriter(pkgPath string, w io.Writer, opts opt.PackageOptions) error {
+	kpmcli, err := client.NewKpmClient()
+	if err != nil {
+		return err
+	}
+
+	absPkgPath, err := filepath.Abs(pkgPath)
+	if err != nil {
+		return reporter.NewErrorEvent(reporter.Bug, err, "internal bugs, please contact us to fix it.")
+	}
+
+	kclPkg, err := pkg.LoadKclPkg(absPkgPath)
+	if err != nil {
+		return err
+	}
+
+	if opts.IncludeLocalDeps {
+		stagingDir, err := os.MkdirTemp("", "kpm-package")
+		if err != nil {
+			return reporter.NewErrorEvent(reporter.FailedCreateFile, err, "failed to create the temporary directory to package")
+		}
+		defer os.RemoveAll(stagingDir)
+
+		kclPkg, err = stageWithLocalDeps(kclPkg, filepath.Join(stagingDir, filepath.Base(absPkgPath)))
+		if err != nil {
+			return err
+		}
+	}
+
+	return kpmcli.PackageToWriter(kclPkg, w, opts.Vendor)
+}
+
+// PackageWithDependencies will package the kcl package in 'pkgPath' with all its resolved dependencies into a tar and write the tar to 'w',
+// e.g. for the offline distribution. The dependencies, including the transitive ones, are bundled in the 'local_deps' directory of the tar,
+// and 'kcl.mod' and 'kcl.mod.lock' of the package and the bundled dependencies are rewritten to them,
+// so that the tar is self-contained and can be compiled by 'RunTar' without downloading any dependency.
+// The dependencies are downloaded into the cache if they are not cached, and the original package is not changed.
+// The local dependencies are always bundled, so 'opts.IncludeLocalDeps' and 'opts.Vendor' make no difference.
+func PackageWithDependencies(pkgPath string, w io.Writer, opts opt.PackageOptions) error {
+	kpmcli, err := client.NewKpmClient()
+	if err != nil {
+		return err
+	}
+
+	absPkgPath, err := filepath.Abs(pkgPath)
+	if err != nil {
+		return reporter.NewErrorEvent(reporter.Bug, err, "internal bugs, please contact us to fix it.")
+	}
+
+	kclPkg, err := pkg.LoadKclPkg(absPkgPath)
+	if err != nil {
+		return err
+	}
+
+	stagingDir, err := os.MkdirTemp("", "kpm-package")
+	if err != nil {
+		return reporter.NewErrorEvent(reporter.FailedCreateFile, err, "failed to create the temporary directory to package")
+	}
+	defer os.RemoveAll(stagingDir)
+
+	kclPkg, err = stageWithAllDeps(kpmcli, kclPkg, filepath.Join(stagingDir, filepath.Base(absPkgPath)))
+	if err != nil {
+		return err
+	}
+
+	return kpmcli.PackageToWriter(kclPkg, w, false)
+}
+
+// FetchDependencySource returns the read-only filesystem of the source files of the dependency 'depName'
+// of the kcl package in 'pkgPath', e.g. to display the code of the dependency.
+// The dependency is downloaded into the cache if it is not vendored or cached.
+func FetchDependencySource(pkgPath, depName string) (fs.FS, error) {
+	kpmcli, kclPkg, err := loadAndResolvePkg(pkgPath)
+	if err != nil {
+		return nil, err
+	}
+
+	dep, ok := kclPkg.Dependencies.Deps[depName]
+	if !ok {
+		return nil, reporter.NewErrorEvent(
+			reporter.DependencyNotFound,
+			fmt.Errorf("dependency '%s' not found in '%s'", depName, kclPkg.ModFile.GetModFilePath()),
+		)
+	}
+
+	depsMap, err := kpmcli.ResolveDepsIntoMap(kclPkg)
+	if err != nil {
+		return nil, err
+	}
+	depPath, ok := depsMap[dep.GetAliasName()]
+	if !ok {
+		return nil, reporter.NewErrorEvent(
+			reporter.DependencyNotFound,
+			fmt.Errorf("the source of the dependency '%s' not found", depName),
+		)
+	}
+
+	return os.DirFS(depPath), nil
+}
+
+// DependencySizes returns the sizes in bytes of the resolved dependencies of the kcl package in 'pkgPath' extracted on disk,
+// the key is the name of the dependency, e.g. to find out the huge dependencies before vendoring them.
+// The dependencies are downloaded into the cache if they are not vendored or cached.
+func DependencySizes(pkgPath string) (map[string]int64, error) {
+	kpmcli, kclPkg, err := loadAndResolvePkg(pkgPath)
+	if err != nil {
+		return nil, err
+	}
+
+	depsMap, err := kpmcli.ResolveDepsIntoMap(kclPkg)
+	if err != nil {
+		return nil, err
+	}
+
+	sizes := make(map[string]int64, len(kclPkg.Dependencies.Deps))
+	for name, dep := range kclPkg.Dependencies.Deps {
+		depPath, ok := depsMap[dep.GetAliasName()]
+		if !ok {
+			continue
+		}
+		size, err := utils.DirSize(depPath)
+		if err != nil {
+			return nil, reporter.NewErrorEvent(reporter.FailedAccessPkgPath, err, fmt.Sprintf("failed to compute the size of the dependency '%s'", name))
+		}
+		sizes[name] = size
+	}
+	return sizes, nil
+}
+
+// TotalDependencySize returns the total size of the dependencies returned by 'DependencySizes'.
+func TotalDependencySize(sizes map[string]int64) int64 {
+	var total int64
+	for _, size := range sizes {
+		total += size
+	}
+	return total
+}
+
+// DefaultEntries returns the absolute paths of the entries which are compiled if no entries are provided,
+// for the kcl package in 'pkgPath', which are the entries in the profile of 'kcl.mod', the 'entry' in 'kcl.mod'
+// or 'main.k' if there is no 'entry' in 'kcl.mod', and an error is returned if there is neither the 'entry' nor 'main.k'.
+// The settings files in the entries of the profile are returned as they are, without the kcl files in them.
+func DefaultEntries(pkgPath string) ([]string, error) {
+	absPkgPath, err := filepath.Abs(pkgPath)
+	if err != nil {
+		return nil, reporter.NewErrorEvent(reporter.Bug, err, "internal bugs, please contact us to fix it.")
+	}
+
+	kclPkg, err := pkg.LoadKclPkg(absPkgPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if entries := kclPkg.GetEntryKclFilesFromModFile(); len(entries) != 0 {
+		absEntries := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			if !filepath.IsAbs(entry) {
+				entry = filepath.Join(absPkgPath, entry)
+			}
+			absEntries = append(absEntries, entry)
+		}
+		return absEntries, nil
+	}
+
+	fallbackEntry, err := kclPkg.GetFallbackEntry()
+	if err != nil {
+		return nil, err
+	}
+	return []string{fallbackEntry}, nil
+}
+
+// loadAndResolvePkg will load the kcl package from 'pkgPath' and resolve all its dependencies,
+// so that the dependencies of the returned package are exactly what will be compiled.
+func loadAndResolvePkg(pkgPath string) (*client.KpmClient, *pkg.KclPkg, error) {
+	kpmcli, err := client.NewKpmClient()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	absPkgPath, err := filepath.Abs(pkgPath)
+	if err != nil {
+		return nil, nil, reporter.NewErrorEvent(reporter.Bug, err, "internal bugs, please contact us to fix it.")
+	}
+
+	kclPkg, err := pkg.LoadKclPkg(absPkgPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = kpmcli.ResolvePkgDepsMetadata(kclPkg, true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return kpmcli, kclPkg, nil
+}
@@ -1,13 +1,29 @@
 package api
 
 import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
 
+	"github.com/otiai10/copy"
 	"gotest.tools/v3/assert"
 	"kcl-lang.io/kcl-go/pkg/kcl"
 	"kcl-lang.io/kpm/pkg/client"
 	"kcl-lang.io/kpm/pkg/opt"
+	pkg "kcl-lang.io/kpm/pkg/package"
+	"kcl-lang.io/kpm/pkg/reporter"
+	"kcl-lang.io/kpm/pkg/semver"
+	"kcl-lang.io/kpm/pkg/utils"
 )
 
 func TestPackageApi(t *testing.T) {
@@ -193,3 +209,861 @@ func TestGetEntries(t *testing.T) {
 	assert.Equal(t, res.GetRawYamlResult(), "sub: test in sub")
 	assert.Equal(t, res.GetRawJsonResult(), "[{\"sub\": \"test in sub\"}]")
 }
+
+func TestGenerateSBOM(t *testing.T) {
+	pkgPath := filepath.Join(getTestDir("test_sbom"), "kcl_pkg")
+
+	bom, err := GenerateSBOM(pkgPath, SBOMFormatCycloneDX)
+	assert.Equal(t, err, nil)
+	var cyclonedx map[string]interface{}
+	assert.Equal(t, json.Unmarshal(bom, &cyclonedx), nil)
+	assert.Equal(t, cyclonedx["bomFormat"], "CycloneDX")
+	components := cyclonedx["components"].([]interface{})
+	assert.Equal(t, len(components), 1)
+	component := components[0].(map[string]interface{})
+	assert.Equal(t, component["name"], "dep_pkg")
+	assert.Equal(t, component["version"], "0.0.2")
+	assert.Equal(t, len(component["hashes"].([]interface{})), 1)
+
+	spdx, err := GenerateSBOM(pkgPath, SBOMFormatSPDX)
+	assert.Equal(t, err, nil)
+	var spdxDoc map[string]interface{}
+	assert.Equal(t, json.Unmarshal(spdx, &spdxDoc), nil)
+	assert.Equal(t, spdxDoc["spdxVersion"], "SPDX-2.3")
+	assert.Equal(t, len(spdxDoc["packages"].([]interface{})), 2)
+	assert.Equal(t, len(spdxDoc["relationships"].([]interface{})), 2)
+
+	_, err = GenerateSBOM(pkgPath, SBOMFormat("invalid"))
+	assert.ErrorContains(t, err, "unsupported sbom format 'invalid'")
+}
+
+func TestPreflight(t *testing.T) {
+	testDir := getTestDir("test_preflight")
+
+	report, err := Preflight(filepath.Join(testDir, "not_exist"), nil)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, report.Passed(), false)
+	assert.Equal(t, report.GetCheck(PreflightCheckModFile).Passed, false)
+	assert.Equal(t, report.GetCheck(PreflightCheckEntries).Skipped, true)
+
+	opts := opt.DefaultCompileOptions()
+	opts.SetEntries([]string{"main.k", "not_exist.k"})
+	report, err = Preflight(filepath.Join(testDir, "kcl_pkg"), opts)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, report.Passed(), false)
+	assert.Equal(t, report.GetCheck(PreflightCheckModFile).Passed, true)
+	assert.DeepEqual(t, report.GetCheck(PreflightCheckDependencies).Problems, []string{
+		fmt.Sprintf("dependency 'missing_pkg' not found in '%s'", filepath.Join(testDir, "missing_pkg")),
+	})
+	assert.DeepEqual(t, report.GetCheck(PreflightCheckEntries).Problems, []string{"entry 'not_exist.k' not found"})
+	assert.DeepEqual(t, report.GetCheck(PreflightCheckLockFile).Problems, []string{
+		"dependency 'missing_pkg' is not locked",
+		"dependency 'removed_pkg' is locked, but not required",
+	})
+}
+
+func TestResolveOnly(t *testing.T) {
+	testDir := filepath.Join(t.TempDir(), "test_include_local_deps")
+	assert.NilError(t, copy.Copy(getTestDir("test_include_local_deps"), testDir))
+	pkgPath := filepath.Join(testDir, "kcl_pkg")
+
+	opts := opt.DefaultCompileOptions()
+	opt.WithLogWriter(nil)(opts)
+	assert.NilError(t, ResolveOnly(pkgPath, opts))
+	lockDeps, err := pkg.LoadLockDeps(pkgPath)
+	assert.NilError(t, err)
+	assert.Assert(t, len(lockDeps.Deps["common_pkg"].Sum) != 0)
+
+	assert.NilError(t, os.RemoveAll(filepath.Join(testDir, "common_pkg")))
+	opts = opt.DefaultCompileOptions()
+	opt.WithLogWriter(nil)(opts)
+	err = ResolveOnly(pkgPath, opts)
+	assert.ErrorContains(t, err, "dependency 'common_pkg' not found")
+}
+
+func TestUpdateDependencies(t *testing.T) {
+	pkgPath := filepath.Join(t.TempDir(), "test_update_dependencies")
+	err := copy.Copy(getTestDir("test_update_dependencies"), pkgPath)
+	assert.NilError(t, err)
+
+	_, err = UpdateDependencies(pkgPath, opt.UpdateOptions{Only: []string{"not_exist"}})
+	assert.ErrorContains(t, err, "dependency 'not_exist' not found")
+
+	report, err := UpdateDependencies(pkgPath, opt.UpdateOptions{Only: []string{"helloworld"}})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, report.Updates, []DependencyUpdate{
+		{Name: "helloworld", FromVersion: "0.1.0", ToVersion: "0.1.1", Kind: semver.PatchBump},
+	})
+
+	kclPkg, err := GetKclPackage(pkgPath)
+	assert.NilError(t, err)
+	assert.Equal(t, kclPkg.GetDependencies().Deps["helloworld"].Version, "0.1.1")
+}
+
+func TestOutdatedDependencies(t *testing.T) {
+	for _, tc := range []struct {
+		current  string
+		versions []string
+		latest   string
+		status   OutdatedStatus
+	}{
+		{"0.1.0", []string{"0.1.0"}, "0.1.0", UpToDate},
+		{"0.1.0", []string{"0.1.0", "0.1.2", "0.2.0-rc.1"}, "0.1.2", PatchBehind},
+		{"0.1.0", []string{"0.1.1", "0.2.0"}, "0.2.0", MinorBehind},
+		{"0.1.0", []string{"0.1.1", "1.0.0"}, "1.0.0", MajorBehind},
+	} {
+		outdatedDep, err := newOutdatedDep("helloworld", tc.current, tc.versions)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, outdatedDep, &OutdatedDep{Name: "helloworld", Current: tc.current, Latest: tc.latest, Status: tc.status})
+	}
+
+	pkgPath := getTestDir("test_update_dependencies")
+	outdated, err := OutdatedDependencies(pkgPath)
+	assert.NilError(t, err)
+	assert.Equal(t, len(outdated), 1)
+	assert.Equal(t, outdated[0].Current, "0.1.0")
+	assert.Assert(t, outdated[0].Status != UpToDate)
+	// The kcl.mod is not changed.
+	kclPkg, err := GetKclPackage(pkgPath)
+	assert.NilError(t, err)
+	assert.Equal(t, kclPkg.GetDependencies().Deps["helloworld"].Version, "0.1.0")
+}
+
+func TestExportedSymbols(t *testing.T) {
+	pkgPath := filepath.Join(getTestDir("test_exported_symbols"), "kcl_pkg")
+	table, err := ExportedSymbols(pkgPath, nil)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, table.Symbols, []Symbol{
+		{Name: "Person", Kind: SchemaSymbol, File: "main.k", Line: 3, Doc: "Person is a person with a name.\n\nAttributes\n----------\nname: str\n    The name of the person."},
+		{Name: "person", Kind: VariableSymbol, File: "main.k", Line: 15, Type: "Person", Doc: "The default person."},
+		{Name: "Base", Kind: SchemaSymbol, File: "main.k", Line: 20, Doc: "Base is the base schema."},
+		{Name: "greet", Kind: FunctionSymbol, File: "main.k", Line: 25, Doc: "Greet returns the greeting to 'name'."},
+		{Name: "HasName", Kind: RuleSymbol, File: "main.k", Line: 31},
+		{Name: "count", Kind: VariableSymbol, File: "main.k", Line: 34, Type: "int"},
+		{Name: "count", Kind: VariableSymbol, Module: "sub", File: "sub/sub.k", Line: 2, Doc: "The number of items."},
+		{Name: "Named", Kind: ProtocolSymbol, Module: "sub", File: "sub/sub.k", Line: 4},
+	})
+
+	opts := opt.DefaultCompileOptions()
+	opts.SetEntries([]string{"sub"})
+	table, err = ExportedSymbols(pkgPath, opts)
+	assert.NilError(t, err)
+	assert.Equal(t, len(table.Symbols), 2)
+	symbol, ok := table.Lookup("sub", "Named")
+	assert.Equal(t, ok, true)
+	assert.Equal(t, symbol.Kind, ProtocolSymbol)
+}
+
+func TestPackageWithLocalDeps(t *testing.T) {
+	testDir := filepath.Join(t.TempDir(), "test_include_local_deps")
+	assert.NilError(t, copy.Copy(getTestDir("test_include_local_deps"), testDir))
+	pkgPath := filepath.Join(testDir, "kcl_pkg")
+
+	packageTo := func(includeLocalDeps bool) string {
+		tarPath := filepath.Join(t.TempDir(), "kcl_pkg.tar")
+		tarFile, err := os.Create(tarPath)
+		assert.NilError(t, err)
+		defer tarFile.Close()
+		assert.NilError(t, PackageToWriter(pkgPath, tarFile, opt.PackageOptions{IncludeLocalDeps: includeLocalDeps}))
+
+		destDir := strings.TrimSuffix(tarPath, ".tar")
+		assert.NilError(t, utils.UnTarDir(tarPath, destDir))
+		return destDir
+	}
+
+	destDir := packageTo(false)
+	err := checkTarLocalDeps(destDir, destDir+".tar")
+	assert.ErrorContains(t, err, "the local dependency 'common_pkg' in '../common_pkg' is not in the tar")
+
+	destDir = packageTo(true)
+	assert.NilError(t, checkTarLocalDeps(destDir, destDir+".tar"))
+	modFile, err := pkg.LoadModFile(destDir)
+	assert.NilError(t, err)
+	assert.Equal(t, modFile.Dependencies.Deps["common_pkg"].Source.Local.Path, "local_deps/common_pkg")
+	assert.Equal(t, modFile.Dependencies.Deps["sub_pkg"].Source.Local.Path, "./sub_pkg")
+	commonModFile, err := pkg.LoadModFile(filepath.Join(destDir, "local_deps", "common_pkg"))
+	assert.NilError(t, err)
+	assert.Equal(t, commonModFile.Dependencies.Deps["base_pkg"].Source.Local.Path, "../base_pkg")
+
+	// The original package is not changed.
+	originalModFile, err := pkg.LoadModFile(pkgPath)
+	assert.NilError(t, err)
+	assert.Equal(t, originalModFile.Dependencies.Deps["common_pkg"].Source.Local.Path, "../common_pkg")
+
+	// The dependencies are resolved from the tar without the original local dependencies.
+	assert.NilError(t, os.RemoveAll(filepath.Join(testDir, "common_pkg")))
+	assert.NilError(t, os.RemoveAll(filepath.Join(testDir, "base_pkg")))
+	kpmcli, err := client.NewKpmClient()
+	assert.NilError(t, err)
+	kpmcli.SetLogWriter(nil)
+	kclPkg, err := pkg.LoadKclPkg(destDir)
+	assert.NilError(t, err)
+	depsMap, err := kpmcli.ResolveDepsIntoMap(kclPkg)
+	assert.NilError(t, err)
+	assert.Equal(t, depsMap["common_pkg"], filepath.Join(destDir, "local_deps", "common_pkg"))
+}
+
+func TestPackageWithDependencies(t *testing.T) {
+	cacheDir := t.TempDir()
+	t.Setenv("KCL_PKG_PATH", cacheDir)
+	testDir := t.TempDir()
+	writePkg := func(pkgPath, name, deps string) {
+		assert.NilError(t, os.MkdirAll(pkgPath, 0755))
+		modContent := fmt.Sprintf("[package]\nname = \"%s\"\nedition = \"0.0.1\"\nversion = \"0.0.1\"\n\n[dependencies]\n%s", name, deps)
+		assert.NilError(t, os.WriteFile(filepath.Join(pkgPath, "kcl.mod"), []byte(modContent), 0644))
+		assert.NilError(t, os.WriteFile(filepath.Join(pkgPath, "main.k"), []byte("a = 1\n"), 0644))
+	}
+	lockOciDep := func(pkgPath string) {
+		kclPkg, err := pkg.LoadKclPkg(pkgPath)
+		assert.NilError(t, err)
+		sum, err := utils.HashDir(filepath.Join(cacheDir, "helloworld_0.1.0"))
+		assert.NilError(t, err)
+		kclPkg.Dependencies.Deps["helloworld"] = pkg.Dependency{
+			Name:     "helloworld",
+			FullName: "helloworld_0.1.0",
+			Version:  "0.1.0",
+			Sum:      sum,
+			Source:   pkg.Source{Oci: &pkg.Oci{Reg: "ghcr.io", Repo: "kcl-lang/helloworld", Tag: "0.1.0"}},
+		}
+		assert.NilError(t, kclPkg.LockDepsVersion())
+	}
+
+	// The oci dependency is already in the cache, so nothing is downloaded.
+	writePkg(filepath.Join(cacheDir, "helloworld_0.1.0"), "helloworld", "")
+	writePkg(filepath.Join(testDir, "common_pkg"), "common_pkg", "helloworld = \"0.1.0\"\n")
+	lockOciDep(filepath.Join(testDir, "common_pkg"))
+	pkgPath := filepath.Join(testDir, "kcl_pkg")
+	writePkg(pkgPath, "kcl_pkg", "helloworld = \"0.1.0\"\ncommon_pkg = { path = \"../common_pkg\" }\n")
+	lockOciDep(pkgPath)
+
+	tarPath := filepath.Join(t.TempDir(), "kcl_pkg.tar")
+	tarFile, err := os.Create(tarPath)
+	assert.NilError(t, err)
+	assert.NilError(t, PackageWithDependencies(pkgPath, tarFile, opt.PackageOptions{}))
+	assert.NilError(t, tarFile.Close())
+	destDir := strings.TrimSuffix(tarPath, ".tar")
+	assert.NilError(t, utils.UnTarDir(tarPath, destDir))
+
+	modFile, err := pkg.LoadModFile(destDir)
+	assert.NilError(t, err)
+	assert.Equal(t, modFile.Dependencies.Deps["helloworld"].Source.Local.Path, "local_deps/helloworld")
+	assert.Equal(t, modFile.Dependencies.Deps["common_pkg"].Source.Local.Path, "local_deps/common_pkg")
+	commonModFile, err := pkg.LoadModFile(filepath.Join(destDir, "local_deps", "common_pkg"))
+	assert.NilError(t, err)
+	assert.Equal(t, commonModFile.Dependencies.Deps["helloworld"].Source.Local.Path, "../helloworld")
+	lockDeps, err := pkg.LoadLockDeps(destDir)
+	assert.NilError(t, err)
+	assert.Equal(t, lockDeps.Deps["helloworld"].Source.Local.Path, "local_deps/helloworld")
+
+	// The original package is not changed.
+	originalModFile, err := pkg.LoadModFile(pkgPath)
+	assert.NilError(t, err)
+	assert.Assert(t, originalModFile.Dependencies.Deps["helloworld"].Source.Oci != nil)
+
+	// The dependencies are resolved from the tar without the cache and the original local dependencies.
+	t.Setenv("KCL_PKG_PATH", t.TempDir())
+	assert.NilError(t, os.RemoveAll(filepath.Join(testDir, "common_pkg")))
+	kpmcli, err := client.NewKpmClient()
+	assert.NilError(t, err)
+	kpmcli.SetLogWriter(nil)
+	kclPkg, err := pkg.LoadKclPkg(destDir)
+	assert.NilError(t, err)
+	depsMap, err := kpmcli.ResolveDepsIntoMap(kclPkg)
+	assert.NilError(t, err)
+	assert.Equal(t, depsMap["helloworld"], filepath.Join(destDir, "local_deps", "helloworld"))
+	assert.Equal(t, depsMap["common_pkg"], filepath.Join(destDir, "local_deps", "common_pkg"))
+}
+
+func TestVerifyTar(t *testing.T) {
+	assert.NilError(t, VerifyTar(filepath.Join(getTestDir("test_run_tar_in_path"), "test.tar"), ""))
+
+	pkgPath := t.TempDir()
+	assert.NilError(t, os.WriteFile(filepath.Join(pkgPath, "kcl.mod"), []byte("[package]\nname = \"test_verify\"\nedition = \"0.0.1\"\nversion = \"0.0.1\"\n"), 0644))
+	assert.NilError(t, os.WriteFile(filepath.Join(pkgPath, "main.k"), []byte("a = 1\n"), 0644))
+	var buf bytes.Buffer
+	assert.NilError(t, PackageToWriter(pkgPath, &buf, opt.PackageOptions{}))
+	tarPath := filepath.Join(t.TempDir(), "test_verify.tar")
+	assert.NilError(t, os.WriteFile(tarPath, buf.Bytes(), 0644))
+	sum := sha256.Sum256(buf.Bytes())
+	digest := hex.EncodeToString(sum[:])
+
+	assert.NilError(t, VerifyTar(tarPath, ""))
+	assert.NilError(t, VerifyTar(tarPath, "sha256:"+digest))
+	assert.NilError(t, VerifyTar(tarPath, digest))
+	err := VerifyTar(tarPath, "sha256:"+strings.Repeat("0", 64))
+	assert.ErrorContains(t, err, fmt.Sprintf("the digest of the tar is 'sha256:%s'", digest))
+	err = VerifyTar(tarPath, "md5:"+digest)
+	assert.ErrorContains(t, err, "the algorithm 'md5' of the digest")
+
+	// The truncated tar.
+	truncatedPath := filepath.Join(t.TempDir(), "truncated.tar")
+	assert.NilError(t, os.WriteFile(truncatedPath, buf.Bytes()[:buf.Len()/2+100], 0644))
+	err = VerifyTar(truncatedPath, "")
+	assert.ErrorContains(t, err, "is not a valid kcl package, it may be truncated or tampered")
+
+	// The tar without kcl.mod.
+	assert.NilError(t, os.Remove(filepath.Join(pkgPath, "kcl.mod")))
+	buf.Reset()
+	assert.NilError(t, utils.TarDirToWriter(pkgPath, &buf, nil))
+	assert.NilError(t, os.WriteFile(tarPath, buf.Bytes(), 0644))
+	err = VerifyTar(tarPath, "")
+	assert.ErrorContains(t, err, "'kcl.mod' not found in the root of the tar")
+
+	err = VerifyTar(filepath.Join(t.TempDir(), "not_exist.tar"), "")
+	assert.ErrorContains(t, err, "could not access the tar")
+}
+
+func TestFetchDependencySource(t *testing.T) {
+	testDir := filepath.Join(t.TempDir(), "test_include_dependency_output")
+	assert.NilError(t, copy.Copy(getTestDir("test_include_dependency_output"), testDir))
+	pkgPath := filepath.Join(testDir, "kcl_pkg")
+
+	depFS, err := FetchDependencySource(pkgPath, "dep_pkg")
+	assert.NilError(t, err)
+	content, err := fs.ReadFile(depFS, "main.k")
+	assert.NilError(t, err)
+	expected, err := os.ReadFile(filepath.Join(testDir, "dep_pkg", "main.k"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), string(expected))
+
+	_, err = FetchDependencySource(pkgPath, "not_exist")
+	assert.ErrorContains(t, err, "dependency 'not_exist' not found")
+}
+
+func TestDependencySizes(t *testing.T) {
+	testDir := filepath.Join(t.TempDir(), "test_include_dependency_output")
+	assert.NilError(t, copy.Copy(getTestDir("test_include_dependency_output"), testDir))
+
+	sizes, err := DependencySizes(filepath.Join(testDir, "kcl_pkg"))
+	assert.NilError(t, err)
+	expected, err := utils.DirSize(filepath.Join(testDir, "dep_pkg"))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, sizes, map[string]int64{"dep_pkg": expected})
+	assert.Equal(t, TotalDependencySize(sizes), expected)
+	assert.Equal(t, TotalDependencySize(map[string]int64{"a": 1, "b": 2}), int64(3))
+}
+
+func TestMigrateRegistry(t *testing.T) {
+	pkgPath := t.TempDir()
+	modContent := `[package]
+name = "test_migrate_registry"
+edition = "0.0.1"
+version = "0.0.1"
+
+[dependencies]
+k8s = { version = "1.28", reg = "old.example.com" }
+`
+	modPath := filepath.Join(pkgPath, "kcl.mod")
+	assert.NilError(t, os.WriteFile(modPath, []byte(modContent), 0644))
+
+	report, err := MigrateRegistry(pkgPath, "other.example.com", "new.example.com")
+	assert.NilError(t, err)
+	assert.Equal(t, len(report.Migrated), 0)
+
+	// The new registry is unreachable, so the migration is aborted and nothing is changed.
+	_, err = MigrateRegistry(pkgPath, "old.example.com", "127.0.0.1:1")
+	assert.ErrorContains(t, err, "failed to pull 'k8s' from '127.0.0.1:1'")
+	content, err := os.ReadFile(modPath)
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), modContent)
+}
+
+func TestDefaultEntries(t *testing.T) {
+	pkgPath := t.TempDir()
+	modPath := filepath.Join(pkgPath, "kcl.mod")
+	assert.NilError(t, os.WriteFile(modPath, []byte("[package]\nname = \"test_default_entries\"\n"), 0644))
+
+	// There is neither the 'entry' nor 'main.k'.
+	_, err := DefaultEntries(pkgPath)
+	assert.ErrorContains(t, err, "failed to find the entry file of the package 'test_default_entries'")
+
+	// Fall back to 'main.k' if there is no 'entry'.
+	assert.NilError(t, os.WriteFile(filepath.Join(pkgPath, "main.k"), []byte("a = 1"), 0644))
+	entries, err := DefaultEntries(pkgPath)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, entries, []string{filepath.Join(pkgPath, "main.k")})
+
+	// The 'entry' does not exist, even though 'main.k' exists.
+	assert.NilError(t, os.WriteFile(modPath, []byte("[package]\nname = \"test_default_entries\"\nentry = \"app.k\"\n"), 0644))
+	_, err = DefaultEntries(pkgPath)
+	assert.ErrorContains(t, err, "failed to find the entry file of the package 'test_default_entries'")
+
+	assert.NilError(t, os.WriteFile(filepath.Join(pkgPath, "app.k"), []byte("a = 2"), 0644))
+	entries, err = DefaultEntries(pkgPath)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, entries, []string{filepath.Join(pkgPath, "app.k")})
+
+	assert.NilError(t, os.WriteFile(modPath, []byte("[package]\nname = \"test_default_entries\"\nentry = \"app.k\"\n\n[profile]\nentries = [\"main.k\", \"/abs/b.k\"]\n"), 0644))
+	entries, err = DefaultEntries(pkgPath)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, entries, []string{filepath.Join(pkgPath, "main.k"), "/abs/b.k"})
+}
+
+func TestCheckEditionCompatibility(t *testing.T) {
+	report := checkEditionCompatibility("0.0.1", "0.7.1")
+	assert.Equal(t, report.Compatible, true)
+	assert.DeepEqual(t, report.Reasons, []string{"the package does not require a kcl compiler version"})
+
+	report = checkEditionCompatibility("0.7.0", "0.7.1")
+	assert.Equal(t, report.Compatible, true)
+	assert.DeepEqual(t, report.Reasons, []string{"the kcl compiler '0.7.1' satisfies the edition '>= 0.7.0' of the package"})
+
+	report = checkEditionCompatibility("0.8.0", "0.7.1")
+	assert.Equal(t, report.Compatible, false)
+	assert.DeepEqual(t, report.Reasons, []string{"the kcl compiler '0.7.1' does not satisfy the edition '>= 0.8.0' of the package"})
+
+	report = checkEditionCompatibility(">= 0.6.0, < 0.7.0", "0.7.1")
+	assert.Equal(t, report.Compatible, false)
+
+	report = checkEditionCompatibility("latest", "0.7.1")
+	assert.Equal(t, report.Compatible, false)
+	assert.DeepEqual(t, report.Reasons, []string{"the edition 'latest' is neither a version nor a version constraint"})
+
+	report = checkEditionCompatibility("0.8.0", "")
+	assert.Equal(t, report.Compatible, true)
+	assert.DeepEqual(t, report.Reasons, []string{"the version of the kcl compiler is unknown, the edition is not checked"})
+}
+
+func TestCheckCompatibility(t *testing.T) {
+	pkgPath := t.TempDir()
+	assert.NilError(t, os.WriteFile(filepath.Join(pkgPath, "kcl.mod"), []byte("[package]\nname = \"test_compat\"\nedition = \"0.0.1\"\n"), 0644))
+
+	report, err := CheckCompatibility(pkgPath)
+	assert.NilError(t, err)
+	assert.Equal(t, report.Edition, "0.0.1")
+	assert.Equal(t, report.Compatible, true)
+}
+
+func TestWhyDependency(t *testing.T) {
+	testDir := t.TempDir()
+	writePkg := func(name, version, deps string) string {
+		pkgPath := filepath.Join(testDir, name)
+		assert.NilError(t, os.MkdirAll(pkgPath, 0755))
+		modContent := fmt.Sprintf("[package]\nname = \"%s\"\nedition = \"0.0.1\"\nversion = \"%s\"\n\n[dependencies]\n%s", name, version, deps)
+		assert.NilError(t, os.WriteFile(filepath.Join(pkgPath, "kcl.mod"), []byte(modContent), 0644))
+		assert.NilError(t, os.WriteFile(filepath.Join(pkgPath, "main.k"), []byte("a = 1"), 0644))
+		return pkgPath
+	}
+	localDep := func(name string) string {
+		return fmt.Sprintf("%s = { path = \"%s\" }\n", name, filepath.Join(testDir, name))
+	}
+
+	writePkg("helper", "0.0.2", "")
+	writePkg("dep_a", "0.0.1", localDep("helper"))
+	writePkg("dep_b", "0.0.1", localDep("helper"))
+	pkgPath := writePkg("kcl_pkg", "0.0.1", localDep("dep_a")+localDep("dep_b"))
+
+	report, err := WhyDependency(pkgPath, "dep_a")
+	assert.NilError(t, err)
+	assert.Equal(t, report.Direct, true)
+	assert.Equal(t, report.Version, "0.0.1")
+	assert.Equal(t, report.Reason, WhyDeclared)
+	assert.DeepEqual(t, report.Paths, [][]string{{"dep_a"}})
+
+	report, err = WhyDependency(pkgPath, "helper")
+	assert.NilError(t, err)
+	assert.Equal(t, report.Direct, false)
+	assert.Equal(t, report.Version, "0.0.2")
+	assert.Equal(t, report.Reason, WhyRequired)
+	assert.DeepEqual(t, report.Paths, [][]string{{"dep_a", "helper"}, {"dep_b", "helper"}})
+	assert.DeepEqual(t, report.Requirements, []WhyRequirement{{Dependent: "dep_a", Version: "0.0.2"}, {Dependent: "dep_b", Version: "0.0.2"}})
+	assert.Equal(t, report.Explanation, "the version '0.0.2' is required by 'dep_a', 'dep_b'")
+
+	// The version declared in the kcl.mod of the package overrides the ones required by the dependencies.
+	writePkg("helper_v3", "0.0.3", "")
+	pkgPath = writePkg("kcl_pkg_override", "0.0.1",
+		localDep("dep_a")+fmt.Sprintf("helper = { path = \"%s\" }\n", filepath.Join(testDir, "helper_v3")))
+	report, err = WhyDependency(pkgPath, "helper")
+	assert.NilError(t, err)
+	assert.Equal(t, report.Direct, true)
+	assert.Equal(t, report.Version, "0.0.3")
+	assert.Equal(t, report.Reason, WhyOverride)
+	assert.DeepEqual(t, report.Paths, [][]string{{"dep_a", "helper"}, {"helper"}})
+	assert.DeepEqual(t, report.Requirements, []WhyRequirement{{Dependent: "kcl_pkg_override", Version: "0.0.3"}, {Dependent: "dep_a", Version: "0.0.2"}})
+
+	_, err = WhyDependency(pkgPath, "not_exist")
+	assert.ErrorContains(t, err, "dependency 'not_exist' not found")
+}
+
+func TestDependencyLicenses(t *testing.T) {
+	testDir := t.TempDir()
+	writePkg := func(name, pkgSection, deps string) string {
+		pkgPath := filepath.Join(testDir, name)
+		assert.NilError(t, os.MkdirAll(pkgPath, 0755))
+		modContent := fmt.Sprintf("[package]\nname = \"%s\"\nedition = \"0.0.1\"\nversion = \"0.0.1\"\n%s\n[dependencies]\n%s", name, pkgSection, deps)
+		assert.NilError(t, os.WriteFile(filepath.Join(pkgPath, "kcl.mod"), []byte(modContent), 0644))
+		assert.NilError(t, os.WriteFile(filepath.Join(pkgPath, "main.k"), []byte("a = 1"), 0644))
+		return pkgPath
+	}
+	localDep := func(name string) string {
+		return fmt.Sprintf("%s = { path = \"%s\" }\n", name, filepath.Join(testDir, name))
+	}
+
+	writePkg("declared", "license = \"MIT\"\n", "")
+	apachePath := writePkg("apache", "", "")
+	assert.NilError(t, os.WriteFile(filepath.Join(apachePath, "LICENSE"), []byte("\n                                 Apache License\n                           Version 2.0, January 2004\n"), 0644))
+	unknownPath := writePkg("unknown", "", "")
+	assert.NilError(t, os.WriteFile(filepath.Join(unknownPath, "COPYING.txt"), []byte("All rights reserved.\n"), 0644))
+	writePkg("missing", "", "")
+	pkgPath := writePkg("kcl_pkg", "", localDep("declared")+localDep("apache")+localDep("unknown")+localDep("missing"))
+
+	licenses, err := DependencyLicenses(pkgPath)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, licenses, map[string]string{
+		"declared": "MIT",
+		"apache":   "Apache-2.0",
+		"unknown":  LicenseNoAssertion,
+		"missing":  "",
+	})
+
+	assert.NilError(t, LicensePolicy{AllowMissing: true}.Check(licenses))
+	err = LicensePolicy{Allowed: []string{"mit", "Apache-2.0"}, Denied: []string{"NOASSERTION"}}.Check(licenses)
+	assert.Error(t, err, "the licenses of the dependencies are not allowed by the license policy\n"+
+		"'missing' has no license\nthe license 'NOASSERTION' of 'unknown' is denied\n")
+	err = LicensePolicy{Allowed: []string{"MIT"}, AllowMissing: true}.Check(licenses)
+	assert.ErrorContains(t, err, "the license 'Apache-2.0' of 'apache' is not allowed")
+}
+
+func TestPruneLock(t *testing.T) {
+	t.Setenv("KCL_PKG_PATH", t.TempDir())
+	testDir := t.TempDir()
+	writePkg := func(name, deps string) string {
+		pkgPath := filepath.Join(testDir, name)
+		assert.NilError(t, os.MkdirAll(pkgPath, 0755))
+		modContent := fmt.Sprintf("[package]\nname = \"%s\"\nedition = \"0.0.1\"\nversion = \"0.0.1\"\n\n[dependencies]\n%s", name, deps)
+		assert.NilError(t, os.WriteFile(filepath.Join(pkgPath, "kcl.mod"), []byte(modContent), 0644))
+		return pkgPath
+	}
+	localDep := func(name string) pkg.Dependency {
+		return pkg.Dependency{Name: name, FullName: name + "_0.0.1", Source: pkg.Source{Local: &pkg.Local{Path: filepath.Join(testDir, name)}}}
+	}
+
+	writePkg("dep_b", "")
+	writePkg("dep_a", fmt.Sprintf("dep_b = { path = \"%s\" }\n", filepath.Join(testDir, "dep_b")))
+	pkgPath := writePkg("kcl_pkg", fmt.Sprintf("dep_a = { path = \"%s\" }\n", filepath.Join(testDir, "dep_a")))
+
+	kclPkg, err := pkg.LoadKclPkg(pkgPath)
+	assert.NilError(t, err)
+	kclPkg.Dependencies.Deps["dep_a"] = localDep("dep_a")
+	kclPkg.Dependencies.Deps["dep_b"] = localDep("dep_b")
+	kclPkg.Dependencies.Deps["orphan"] = pkg.Dependency{
+		Name:     "orphan",
+		FullName: "orphan_0.0.1",
+		Version:  "0.0.1",
+		Source:   pkg.Source{Oci: &pkg.Oci{Reg: "ghcr.io", Repo: "kcl-lang/orphan", Tag: "0.0.1"}},
+	}
+	assert.NilError(t, kclPkg.LockDepsVersion())
+
+	report, err := PruneLock(pkgPath)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, report, &PruneReport{Pruned: []string{"orphan"}, Kept: []string{"dep_a", "dep_b"}})
+	lockDeps, err := pkg.LoadLockDeps(pkgPath)
+	assert.NilError(t, err)
+	assert.Equal(t, len(lockDeps.Deps), 2)
+
+	report, err = PruneLock(pkgPath)
+	assert.NilError(t, err)
+	assert.Equal(t, len(report.Pruned), 0)
+
+	// The pruning is aborted if a reachable dependency is not on the disk.
+	assert.NilError(t, os.RemoveAll(filepath.Join(testDir, "dep_a")))
+	_, err = PruneLock(pkgPath)
+	assert.ErrorContains(t, err, "dependency 'dep_a' not found")
+}
+
+func TestMigrateLock(t *testing.T) {
+	pkgPath := t.TempDir()
+	lockPath := filepath.Join(pkgPath, "kcl.mod.lock")
+	legacyLock := "[dependencies]\n  [dependencies.k8s]\n    name = \"k8s\"\n    version = \"1.27\"\n    sum = \"xnYM1FWHAy3m+KcQMQb2rjZouTxumqYt6FGZpu2T4yM=\"\n    reg = \"ghcr.io\"\n    repo = \"kcl-lang/k8s\"\n    oci_tag = \"1.27\"\n"
+	assert.NilError(t, os.WriteFile(lockPath, []byte(legacyLock), 0644))
+
+	assert.NilError(t, MigrateLock(pkgPath))
+	content, err := os.ReadFile(lockPath)
+	assert.NilError(t, err)
+	version, err := pkg.LockVersion(string(content))
+	assert.NilError(t, err)
+	assert.Equal(t, version, pkg.LOCK_FILE_VERSION)
+	lockDeps, err := pkg.LoadLockDeps(pkgPath)
+	assert.NilError(t, err)
+	assert.Equal(t, lockDeps.Deps["k8s"].FullName, "k8s_1.27")
+	assert.Equal(t, lockDeps.Deps["k8s"].Sum, "xnYM1FWHAy3m+KcQMQb2rjZouTxumqYt6FGZpu2T4yM=")
+
+	// The kcl.mod.lock in the current schema is kept as it is.
+	assert.NilError(t, MigrateLock(lockPath))
+	migrated, err := os.ReadFile(lockPath)
+	assert.NilError(t, err)
+	assert.Equal(t, string(migrated), string(content))
+
+	// The kcl.mod.lock in a newer schema is rejected rather than misread.
+	assert.NilError(t, os.WriteFile(lockPath, []byte(fmt.Sprintf("version = %d\n\n%s", pkg.LOCK_FILE_VERSION+1, legacyLock)), 0644))
+	err = MigrateLock(lockPath)
+	assert.ErrorContains(t, err, "newer than the version")
+	assert.Equal(t, reporter.GetErrorKind(err), reporter.KindResolve)
+	_, err = pkg.LoadLockDeps(pkgPath)
+	assert.ErrorContains(t, err, "please upgrade kpm")
+}
+
+func TestModLockDrift(t *testing.T) {
+	t.Setenv("KCL_PKG_PATH", t.TempDir())
+	testDir := t.TempDir()
+	writePkg := func(name, deps string) string {
+		pkgPath := filepath.Join(testDir, name)
+		assert.NilError(t, os.MkdirAll(pkgPath, 0755))
+		modContent := fmt.Sprintf("[package]\nname = \"%s\"\nedition = \"0.0.1\"\nversion = \"0.0.1\"\n\n[dependencies]\n%s", name, deps)
+		assert.NilError(t, os.WriteFile(filepath.Join(pkgPath, "kcl.mod"), []byte(modContent), 0644))
+		return pkgPath
+	}
+	localDep := func(name, version string) pkg.Dependency {
+		return pkg.Dependency{Name: name, FullName: name + "_" + version, Version: version, Source: pkg.Source{Local: &pkg.Local{Path: filepath.Join(testDir, name)}}}
+	}
+
+	writePkg("dep_b", "")
+	writePkg("dep_c", "")
+	writePkg("dep_a", fmt.Sprintf("dep_b = { path = \"%s\" }\n", filepath.Join(testDir, "dep_b")))
+	pkgPath := writePkg("kcl_pkg", fmt.Sprintf("dep_a = { path = \"%s\" }\ndep_c = { path = \"%s\" }\nk8s = \"1.28\"\n",
+		filepath.Join(testDir, "dep_a"), filepath.Join(testDir, "dep_c")))
+
+	kclPkg, err := pkg.LoadKclPkg(pkgPath)
+	assert.NilError(t, err)
+	kclPkg.Dependencies.Deps["dep_a"] = localDep("dep_a", "0.0.1")
+	kclPkg.Dependencies.Deps["dep_b"] = localDep("dep_b", "0.0.1")
+	kclPkg.Dependencies.Deps["dep_c"] = localDep("dep_c", "0.0.0")
+	kclPkg.Dependencies.Deps["orphan"] = pkg.Dependency{
+		Name:     "orphan",
+		FullName: "orphan_0.0.1",
+		Version:  "0.0.1",
+		Source:   pkg.Source{Oci: &pkg.Oci{Reg: "ghcr.io", Repo: "kcl-lang/orphan", Tag: "0.0.1"}},
+	}
+	assert.NilError(t, kclPkg.LockDepsVersion())
+
+	report, err := ModLockDrift(pkgPath)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, report.Drifts, []DependencyDrift{
+		{Name: "dep_c", Kind: DriftMismatched, Required: "0.0.1", Locked: "0.0.0"},
+		{Name: "k8s", Kind: DriftUnlocked, Required: "1.28"},
+		{Name: "orphan", Kind: DriftRemoved, Locked: "0.0.1"},
+	})
+	assert.Equal(t, report.String(), "~ dep_c: locked 0.0.0, required 0.0.1\n+ k8s 1.28 (not locked)\n- orphan 0.0.1 (not required)\n")
+
+	writePkg("kcl_pkg", fmt.Sprintf("dep_a = { path = \"%s\" }\n", filepath.Join(testDir, "dep_a")))
+	delete(kclPkg.Dependencies.Deps, "dep_c")
+	delete(kclPkg.Dependencies.Deps, "orphan")
+	assert.NilError(t, kclPkg.LockDepsVersion())
+	report, err = ModLockDrift(pkgPath)
+	assert.NilError(t, err)
+	assert.Equal(t, report.HasDrift(), false)
+	assert.Equal(t, report.String(), "kcl.mod.lock is in sync with kcl.mod\n")
+}
+
+func TestReachableFiles(t *testing.T) {
+	pkgPath := t.TempDir()
+	files := map[string]string{
+		"kcl.mod":            "[package]\nname = \"test_reachable\"\nedition = \"0.0.1\"\nversion = \"0.0.1\"\n\n[dependencies]\nk8s = \"1.28\"\n",
+		"main.k":             "import k8s.api.core.v1\nimport app\nimport .base\n",
+		"base.k":             "base = 1\n",
+		"app/app.k":          "import ..lib.util\n",
+		"app/config.k":       "config = 1\n",
+		"lib/util.k":         "import json\n",
+		"lib/unused.k":       "unused = 1\n",
+		"other/main.k":       "import lib.unused\n",
+		"unreachable/main.k": "a = 1\n",
+	}
+	for name, content := range files {
+		assert.NilError(t, os.MkdirAll(filepath.Dir(filepath.Join(pkgPath, name)), 0755))
+		assert.NilError(t, os.WriteFile(filepath.Join(pkgPath, name), []byte(content), 0644))
+	}
+
+	reachable, err := ReachableFiles(pkgPath, nil, nil)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, reachable, []string{"app/app.k", "app/config.k", "base.k", "lib/util.k", "main.k"})
+
+	reachable, err = ReachableFiles(pkgPath, []string{"other/main.k", "base.k"}, nil)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, reachable, []string{"base.k", "lib/unused.k", "other/main.k"})
+
+	_, err = ReachableFiles(pkgPath, []string{"missing.k"}, nil)
+	assert.ErrorContains(t, err, "entry '"+filepath.Join(pkgPath, "missing.k")+"' not found")
+}
+
+func TestImportersOfDependency(t *testing.T) {
+	pkgPath := t.TempDir()
+	files := map[string]string{
+		"kcl.mod":          "[package]\nname = \"test_importers\"\nedition = \"0.0.1\"\nversion = \"0.0.1\"\n\n[dependencies]\nk8s = \"1.28\"\nhelloworld = \"0.1.0\"\n",
+		"main.k":           "import app\nimport .base\n",
+		"base.k":           "base = 1\n",
+		"app/app.k":        "import ..lib.util\n",
+		"lib/util.k":       "import k8s.api.core.v1 as core\n",
+		"other/main.k":     "# import k8s\nimport helloworld\n",
+		"vendor/dep/dep.k": "import k8s\n",
+	}
+	for name, content := range files {
+		assert.NilError(t, os.MkdirAll(filepath.Dir(filepath.Join(pkgPath, name)), 0755))
+		assert.NilError(t, os.WriteFile(filepath.Join(pkgPath, name), []byte(content), 0644))
+	}
+
+	importers, err := ImportersOfDependency(pkgPath, "k8s")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, importers, []string{"app/app.k", "lib/util.k", "main.k"})
+
+	importers, err = ImportersOfDependency(pkgPath, "helloworld")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, importers, []string{"other/main.k"})
+
+	_, err = ImportersOfDependency(pkgPath, "missing")
+	assert.ErrorContains(t, err, "'missing' is not a dependency of 'test_importers'")
+}
+
+func TestExportAndImportCache(t *testing.T) {
+	cachePath := t.TempDir()
+	t.Setenv("KCL_PKG_PATH", cachePath)
+	writeFile := func(path, content string) {
+		assert.NilError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NilError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	pkgPath := t.TempDir()
+	writeFile(filepath.Join(pkgPath, "kcl.mod"), "[package]\nname = \"kcl_pkg\"\nedition = \"0.0.1\"\nversion = \"0.0.1\"\n")
+	writeFile(filepath.Join(pkgPath, "dep_local", "kcl.mod"), "[package]\nname = \"dep_local\"\n")
+	kclPkg, err := pkg.LoadKclPkg(pkgPath)
+	assert.NilError(t, err)
+	kclPkg.Dependencies.Deps["k8s"] = pkg.Dependency{
+		Name:     "k8s",
+		FullName: "k8s_1.28",
+		Version:  "1.28",
+		Source:   pkg.Source{Oci: &pkg.Oci{Reg: "ghcr.io", Repo: "kcl-lang/k8s", Tag: "1.28"}},
+	}
+	kclPkg.Dependencies.Deps["flask"] = pkg.Dependency{
+		Name:     "flask",
+		FullName: "flask_v0.1.0",
+		Version:  "v0.1.0",
+		Source:   pkg.Source{Git: &pkg.Git{Url: "https://github.com/kcl-lang/flask-demo-kcl-manifests.git", Tag: "v0.1.0"}},
+	}
+	kclPkg.Dependencies.Deps["dep_local"] = pkg.Dependency{Name: "dep_local", FullName: "dep_local_0.0.1", Source: pkg.Source{Local: &pkg.Local{Path: "dep_local"}}}
+	assert.NilError(t, kclPkg.LockDepsVersion())
+
+	// The locked dependencies must be in the cache.
+	var archive bytes.Buffer
+	err = ExportCacheForPackage(pkgPath, &archive)
+	assert.ErrorContains(t, err, "dependency 'flask' not found in '"+filepath.Join(cachePath, "flask_v0.1.0")+"'")
+
+	writeFile(filepath.Join(cachePath, "k8s_1.28", "kcl.mod"), "[package]\nname = \"k8s\"\n")
+	writeFile(filepath.Join(cachePath, "k8s_1.28", "api", "core.k"), "schema Pod:\n    name: str\n")
+	writeFile(filepath.Join(cachePath, "flask_v0.1.0", "main.k"), "a = 1\n")
+	writeFile(filepath.Join(cachePath, "unrelated_0.0.1", "main.k"), "b = 1\n")
+	assert.NilError(t, ExportCacheForPackage(pkgPath, &archive))
+
+	// Only the entries referenced by the kcl.mod.lock are imported.
+	importPath := t.TempDir()
+	t.Setenv("KCL_PKG_PATH", importPath)
+	writeFile(filepath.Join(importPath, "k8s_1.28", "stale.k"), "c = 1\n")
+	assert.NilError(t, ImportCache(bytes.NewReader(archive.Bytes())))
+	var imported []string
+	err = filepath.WalkDir(importPath, func(path string, d fs.DirEntry, err error) error {
+		// The settings of kpm are in the hidden directory of the cache.
+		if err == nil && d.IsDir() && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if err == nil && !d.IsDir() {
+			rel, _ := filepath.Rel(importPath, path)
+			imported = append(imported, filepath.ToSlash(rel))
+		}
+		return err
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, imported, []string{"flask_v0.1.0/main.k", "k8s_1.28/api/core.k", "k8s_1.28/kcl.mod"})
+	content, err := os.ReadFile(filepath.Join(importPath, "k8s_1.28", "api", "core.k"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "schema Pod:\n    name: str\n")
+
+	// The files outside of the cache are rejected.
+	var malicious bytes.Buffer
+	tw := tar.NewWriter(&malicious)
+	assert.NilError(t, tw.WriteHeader(&tar.Header{Name: "../escaped.k", Mode: 0644, Size: 1, Typeflag: tar.TypeReg}))
+	_, err = tw.Write([]byte("x"))
+	assert.NilError(t, err)
+	assert.NilError(t, tw.Close())
+	err = ImportCache(&malicious)
+	assert.ErrorContains(t, err, "'../escaped.k' is outside of the cache")
+	assert.Equal(t, reporter.GetErrorKind(err), reporter.KindIO)
+	assert.Assert(t, !utils.DirExists(filepath.Join(filepath.Dir(importPath), "escaped.k")))
+
+	// The hidden entries, e.g. the settings of kpm, are rejected.
+	err = ImportCache(newCacheArchive(t, map[string]string{".kpm/config/kpm.json": "{}"}))
+	assert.ErrorContains(t, err, "'.kpm/config/kpm.json' is in the hidden directory '.kpm', which is not an entry of the cache")
+}
+
+// newCacheArchive returns the tar of the files 'files' in the order of their names, as the cache exported by 'ExportCacheForPackage'.
+func newCacheArchive(t *testing.T, files map[string]string) io.Reader {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	for _, name := range names {
+		assert.NilError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(files[name])), Typeflag: tar.TypeReg}))
+		_, err := tw.Write([]byte(files[name]))
+		assert.NilError(t, err)
+	}
+	assert.NilError(t, tw.Close())
+	return &archive
+}
+
+func TestImportCacheWithManifest(t *testing.T) {
+	cachePath := t.TempDir()
+	t.Setenv("KCL_PKG_PATH", cachePath)
+	assert.NilError(t, os.MkdirAll(filepath.Join(cachePath, "k8s_1.28"), 0755))
+	assert.NilError(t, os.WriteFile(filepath.Join(cachePath, "k8s_1.28", "main.k"), []byte("a = 1\n"), 0644))
+	sum, err := utils.HashDir(filepath.Join(cachePath, "k8s_1.28"))
+	assert.NilError(t, err)
+
+	pkgPath := t.TempDir()
+	assert.NilError(t, os.WriteFile(filepath.Join(pkgPath, "kcl.mod"), []byte("[package]\nname = \"kcl_pkg\"\nedition = \"0.0.1\"\nversion = \"0.0.1\"\n"), 0644))
+	kclPkg, err := pkg.LoadKclPkg(pkgPath)
+	assert.NilError(t, err)
+	kclPkg.Dependencies.Deps["k8s"] = pkg.Dependency{
+		Name:     "k8s",
+		FullName: "k8s_1.28",
+		Version:  "1.28",
+		Sum:      sum,
+		Source:   pkg.Source{Oci: &pkg.Oci{Reg: "ghcr.io", Repo: "kcl-lang/k8s", Tag: "1.28"}},
+	}
+	assert.NilError(t, kclPkg.LockDepsVersion())
+
+	var archive bytes.Buffer
+	assert.NilError(t, ExportCacheForPackage(pkgPath, &archive))
+	importPath := t.TempDir()
+	t.Setenv("KCL_PKG_PATH", importPath)
+	assert.NilError(t, ImportCache(bytes.NewReader(archive.Bytes())))
+	content, err := os.ReadFile(filepath.Join(importPath, "k8s_1.28", "main.k"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "a = 1\n")
+
+	// The entry is changed after it is exported.
+	err = ImportCache(newCacheArchive(t, map[string]string{
+		cacheManifestName: `{"entries": ["k8s_1.28"], "sums": {"k8s_1.28": "` + sum + `"}}`,
+		"k8s_1.28/main.k": "a = 2\n",
+	}))
+	assert.ErrorContains(t, err, "the checksum of 'k8s_1.28' is")
+	content, err = os.ReadFile(filepath.Join(importPath, "k8s_1.28", "main.k"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "a = 1\n")
+
+	// The entry is not in the manifest.
+	err = ImportCache(newCacheArchive(t, map[string]string{
+		cacheManifestName:      `{"entries": ["k8s_1.28"]}`,
+		"k8s_1.28/main.k":      "a = 1\n",
+		"unknown_0.0.1/main.k": "b = 1\n",
+	}))
+	assert.ErrorContains(t, err, "'unknown_0.0.1' is not an entry in the manifest of the exported cache")
+	assert.Assert(t, !utils.DirExists(filepath.Join(importPath, "unknown_0.0.1")))
+
+	// The entry in the manifest is missing.
+	err = ImportCache(newCacheArchive(t, map[string]string{
+		cacheManifestName: `{"entries": ["k8s_1.28", "flask_v0.1.0"]}`,
+		"k8s_1.28/main.k": "a = 1\n",
+	}))
+	assert.ErrorContains(t, err, "'flask_v0.1.0' in the manifest is missing in the exported cache")
+}
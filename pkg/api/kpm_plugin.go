@@ -0,0 +1,63 @@
+package api
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"kcl-lang.io/kpm/pkg/opt"
+	pkg "kcl-lang.io/kpm/pkg/package"
+	"kcl-lang.io/kpm/pkg/reporter"
+	"kcl-lang.io/kpm/pkg/utils"
+)
+
+// checkPlugins will verify the plugins pinned in the kcl.mod of 'kclPkg' against the plugin path in the compile options.
+// Each plugin is the subdirectory named by the plugin in the plugin path, and its checksum must match the sum pinned in kcl.mod.
+// The plugins not present in the plugin path and the plugins pinned without a sum are not verified.
+func checkPlugins(kclPkg *pkg.KclPkg, opts *opt.CompileOptions) error {
+	if len(opts.PluginPath()) == 0 || len(kclPkg.ModFile.Plugins) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(kclPkg.ModFile.Plugins))
+	for name := range kclPkg.ModFile.Plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		plugin := kclPkg.ModFile.Plugins[name]
+		if len(plugin.Sum) == 0 {
+			continue
+		}
+		pluginDir := filepath.Join(opts.PluginPath(), name)
+		info, err := os.Stat(pluginDir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return reporter.NewErrorEvent(reporter.FailedAccessPkgPath, err, fmt.Sprintf("could not access the plugin '%s'", pluginDir))
+		}
+		if !info.IsDir() {
+			return reporter.NewErrorEvent(reporter.PluginNotMatched, fmt.Errorf("'%s' is not a directory", pluginDir), fmt.Sprintf("invalid plugin '%s'", name))
+		}
+
+		sum, err := utils.HashDir(pluginDir)
+		if err != nil {
+			return reporter.NewErrorEvent(reporter.FailedHashPkg, err, fmt.Sprintf("failed to hash the plugin '%s'", pluginDir))
+		}
+		if sum != plugin.Sum {
+			pinned := name
+			if len(plugin.Version) != 0 {
+				pinned = fmt.Sprintf("%s %s", name, plugin.Version)
+			}
+			return reporter.NewErrorEvent(
+				reporter.PluginNotMatched,
+				fmt.Errorf("the checksum of '%s' is '%s', but '%s' is pinned in kcl.mod", pluginDir, sum, plugin.Sum),
+				fmt.Sprintf("the plugin '%s' does not match the one pinned in kcl.mod", pinned),
+			)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package api
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"kcl-lang.io/kpm/pkg/client"
+	"kcl-lang.io/kpm/pkg/env"
+	"kcl-lang.io/kpm/pkg/opt"
+	pkg "kcl-lang.io/kpm/pkg/package"
+	"kcl-lang.io/kpm/pkg/reporter"
+	"kcl-lang.io/kpm/pkg/utils"
+)
+
+// The names of the checks in the preflight report.
+const (
+	PreflightCheckModFile      = "kcl.mod"
+	PreflightCheckDependencies = "dependencies"
+	PreflightCheckEntries      = "entries"
+	PreflightCheckLockFile     = "kcl.mod.lock"
+)
+
+// PreflightCheck is the result of one check of the preflight.
+type PreflightCheck struct {
+	// Name is the name of the check.
+	Name string
+	// Passed is true if the check is passed.
+	Passed bool
+	// Skipped is true if the check is skipped because of the failure of the previous check.
+	Skipped bool
+	// Problems are the reasons why the check is failed.
+	Problems []string
+}
+
+// PreflightReport is the report of the preflight of a kcl package.
+type PreflightReport struct {
+	Checks []PreflightCheck
+}
+
+// Passed returns true if all the checks in the report are passed.
+func (r *PreflightReport) Passed() bool {
+	for _, check := range r.Checks {
+		if !check.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// GetCheck returns the check with the name in the report.
+func (r *PreflightReport) GetCheck(name string) *PreflightCheck {
+	for i := range r.Checks {
+		if r.Checks[i].Name == name {
+			return &r.Checks[i]
+		}
+	}
+	return nil
+}
+
+// addCheck will add a check to the report with the problems found by the check.
+func (r *PreflightReport) addCheck(name string, problems []string) {
+	sort.Strings(problems)
+	r.Checks = append(r.Checks, PreflightCheck{
+		Name:     name,
+		Passed:   len(problems) == 0,
+		Problems: problems,
+	})
+}
+
+// Preflight will check whether the kcl package in 'pkgPath' is runnable without compiling it.
+// It checks that the 'kcl.mod' can be parsed, all the dependencies can be found locally,
+// the entries exist and the 'kcl.mod.lock' is consistent with the 'kcl.mod'.
+// Preflight does not download the dependencies or update the 'kcl.mod.lock'.
+// The returned error is only for the failures of preflight itself, the failed checks are in the report.
+func Preflight(pkgPath string, opts *opt.CompileOptions) (*PreflightReport, error) {
+	if opts == nil {
+		opts = opt.DefaultCompileOptions()
+	}
+
+	absPkgPath, err := filepath.Abs(pkgPath)
+	if err != nil {
+		return nil, reporter.NewErrorEvent(reporter.Bug, err, "internal bugs, please contact us to fix it.")
+	}
+
+	report := &PreflightReport{}
+
+	// 1. Check the kcl.mod.
+	kclPkg, err := pkg.LoadKclPkg(absPkgPath)
+	if err != nil {
+		report.addCheck(PreflightCheckModFile, []string{strings.TrimSpace(err.Error())})
+		for _, name := range []string{PreflightCheckDependencies, PreflightCheckEntries, PreflightCheckLockFile} {
+			report.Checks = append(report.Checks, PreflightCheck{Name: name, Skipped: true})
+		}
+		return report, nil
+	}
+	report.addCheck(PreflightCheckModFile, nil)
+
+	// 2. Check the dependencies can be found locally.
+	if opts.IsVendor() {
+		kclPkg.SetVendorModeWithOpts(opts.VendorMode())
+	}
+	globalPkgPath, err := env.GetAbsPkgPath()
+	if err != nil {
+		return nil, err
+	}
+	var depProblems []string
+	for name, dep := range kclPkg.ModFile.Dependencies.Deps {
+		// In the vendor mode, the dependencies are in the vendor subdirectory of the current package.
+		// Otherwise, the dependencies are in the $KCL_PKG_PATH.
+		depPath := filepath.Join(globalPkgPath, dep.FullName)
+		if kclPkg.IsVendoredDep(name) {
+			depPath = filepath.Join(kclPkg.LocalVendorPath(), dep.FullName)
+		}
+		if dep.IsFromLocal() {
+			depPath = dep.GetLocalFullPath(absPkgPath)
+		}
+		if !utils.DirExists(depPath) {
+			depProblems = append(depProblems, fmt.Sprintf("dependency '%s' not found in '%s'", name, depPath))
+		}
+	}
+	report.addCheck(PreflightCheckDependencies, depProblems)
+
+	// 3. Check the entries exist.
+	entries := opts.Entries()
+	if len(entries) == 0 {
+		entries = kclPkg.GetEntryKclFilesFromModFile()
+	}
+	var entryProblems []string
+	for _, entry := range entries {
+		entryPath := entry
+		if !filepath.IsAbs(entryPath) {
+			entryPath = filepath.Join(absPkgPath, entry)
+		}
+		if !utils.DirExists(entryPath) {
+			entryProblems = append(entryProblems, fmt.Sprintf("entry '%s' not found", entry))
+		}
+	}
+	report.addCheck(PreflightCheckEntries, entryProblems)
+
+	// 4. Check the kcl.mod.lock is consistent with the kcl.mod.
+	var lockProblems []string
+	if !opts.NoSumCheck() {
+		for name, modDep := range kclPkg.ModFile.Dependencies.Deps {
+			lockDep, ok := kclPkg.Dependencies.Deps[name]
+			if !ok {
+				lockProblems = append(lockProblems, fmt.Sprintf("dependency '%s' is not locked", name))
+			} else if !lockDep.WithTheSameVersion(modDep) {
+				lockProblems = append(lockProblems, fmt.Sprintf("dependency '%s' is locked with version '%s', but '%s' is required", name, lockDep.Version, modDep.Version))
+			}
+		}
+		for name := range kclPkg.Dependencies.Deps {
+			if _, ok := kclPkg.ModFile.Dependencies.Deps[name]; !ok {
+				lockProblems = append(lockProblems, fmt.Sprintf("dependency '%s' is locked, but not required", name))
+			}
+		}
+	}
+	report.addCheck(PreflightCheckLockFile, lockProblems)
+
+	return report, nil
+}
+
+// ResolveOnly will resolve the dependencies of the kcl package in 'pkgPath' with the compile options as the compilation does,
+// and stop before compiling it, e.g. as a fast gate in CI that the dependencies can be resolved.
+// Unlike 'Preflight', the missing dependencies are downloaded, their checksums are checked, and the 'kcl.mod.lock' is updated.
+func ResolveOnly(pkgPath string, opts *opt.CompileOptions) error {
+	if opts == nil {
+		opts = opt.DefaultCompileOptions()
+	}
+	err := resolveOnly(pkgPath, opts)
+	if err != nil {
+		return formatError(err, opts)
+	}
+	return nil
+}
+
+// resolveOnly will load the kcl package in 'pkgPath' to run and resolve its dependencies.
+func resolveOnly(pkgPath string, opts *opt.CompileOptions) error {
+	restoreEnvs, err := loadEnvFile(opts)
+	if err != nil {
+		return err
+	}
+	defer restoreEnvs()
+
+	kpmcli, err := client.NewKpmClient()
+	if err != nil {
+		return err
+	}
+	kpmcli.SetNoSumCheck(opts.NoSumCheck())
+
+	opts.SetPkgPath(pkgPath)
+	kclPkg, err := loadPkgToRun(kpmcli, opts)
+	if err != nil {
+		return err
+	}
+	_, err = kpmcli.ResolveDepsIntoMap(kclPkg)
+	return err
+}
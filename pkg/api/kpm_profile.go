@@ -0,0 +1,86 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"kcl-lang.io/kpm/pkg/reporter"
+)
+
+// traceEvent is a complete event in the trace event format, which can be viewed in 'chrome://tracing' or Perfetto.
+type traceEvent struct {
+	Name string `json:"name"`
+	// Phase is 'X' for the complete events.
+	Phase string `json:"ph"`
+	// Timestamp is the start of the event in microseconds.
+	Timestamp int64 `json:"ts"`
+	// Duration is the duration of the event in microseconds.
+	Duration int64             `json:"dur"`
+	Pid      int               `json:"pid"`
+	Tid      int               `json:"tid"`
+	Args     map[string]string `json:"args,omitempty"`
+}
+
+// profiler records the spans of the compilation, e.g. loading the package, resolving the dependencies and compiling each entry.
+// The nil profiler records nothing, and the spans can be ended concurrently.
+type profiler struct {
+	path   string
+	start  time.Time
+	mu     sync.Mutex
+	events []traceEvent
+}
+
+// newProfiler returns the profiler writing the profile into 'path', nil is returned if 'path' is empty.
+func newProfiler(path string) *profiler {
+	if len(path) == 0 {
+		return nil
+	}
+	return &profiler{path: path, start: time.Now()}
+}
+
+// span starts the span 'name' with the entries compiled in it, and returns the function to end the span.
+func (p *profiler) span(name string, entries ...string) func() {
+	if p == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		event := traceEvent{
+			Name:      name,
+			Phase:     "X",
+			Timestamp: start.Sub(p.start).Microseconds(),
+			Duration:  time.Since(start).Microseconds(),
+			Pid:       1,
+			Tid:       1,
+		}
+		if len(entries) != 0 {
+			event.Args = map[string]string{"entries": strings.Join(entries, ", ")}
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.events = append(p.events, event)
+	}
+}
+
+// write will write the recorded spans into the profile.
+func (p *profiler) write() error {
+	if p == nil {
+		return nil
+	}
+	content, err := json.MarshalIndent(map[string]interface{}{
+		"traceEvents":     p.events,
+		"displayTimeUnit": "ms",
+	}, "", "  ")
+	if err != nil {
+		return reporter.NewErrorEvent(reporter.Bug, err, "internal bug: failed to marshal the profile into json")
+	}
+	err = os.WriteFile(p.path, append(content, '\n'), 0644)
+	if err != nil {
+		return reporter.NewErrorEvent(reporter.FailedCreateFile, err, fmt.Sprintf("failed to write the profile into '%s'", p.path))
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"kcl-lang.io/kpm/pkg/constants"
+	pkg "kcl-lang.io/kpm/pkg/package"
+	"kcl-lang.io/kpm/pkg/reporter"
+)
+
+// sourceHash returns the sha256 of the kcl files and the kcl.mod of the kcl package in 'pkgPath',
+// the files are hashed with their paths relative to the package in order, and the vendor directory and the hidden directories are skipped.
+func sourceHash(pkgPath string) (string, error) {
+	var files []string
+	err := filepath.WalkDir(pkgPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != pkgPath && (d.Name() == "vendor" || strings.HasPrefix(d.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) == constants.KFilePathSuffix || (d.Name() == pkg.MOD_FILE && filepath.Dir(path) == pkgPath) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(files)
+
+	hasher := sha256.New()
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		rel, _ := filepath.Rel(pkgPath, file)
+		hasher.Write([]byte(filepath.ToSlash(rel)))
+		hasher.Write([]byte{0})
+		hasher.Write(content)
+		hasher.Write([]byte{0})
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// provenanceHash returns the hash of the inputs of the compilation of the kcl package in 'pkgPath',
+// which is the sha256 of the source hash and the sha256 of the kcl.mod.lock resolved by the compilation, in the form of 'sha256:<hex>'.
+func provenanceHash(pkgPath string) (string, error) {
+	source, err := sourceHash(pkgPath)
+	if err != nil {
+		return "", reporter.NewErrorEvent(reporter.FailedHashPkg, err, fmt.Sprintf("failed to hash the sources of '%s'", pkgPath))
+	}
+	lock, err := os.ReadFile(filepath.Join(pkgPath, pkg.MOD_LOCK_FILE))
+	if err != nil && !os.IsNotExist(err) {
+		return "", reporter.NewErrorEvent(reporter.FailedLoadKclModLock, err, fmt.Sprintf("failed to hash the kcl.mod.lock of '%s'", pkgPath))
+	}
+	lockSum := sha256.Sum256(lock)
+	sum := sha256.Sum256([]byte(fmt.Sprintf("source:%s\nlock:%s\n", source, hex.EncodeToString(lockSum[:]))))
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// annotateProvenance will set the annotation 'key' of each kubernetes-style document of the compile result,
+// i.e. the object with 'apiVersion' and 'kind', to the provenance hash of the kcl package in 'pkgPath'.
+// The other documents are kept as they are.
+func (r *CompileResult) annotateProvenance(key, pkgPath string) error {
+	hash, err := provenanceHash(pkgPath)
+	if err != nil {
+		return err
+	}
+
+	return r.rewriteDocuments("annotated", func(i int, value interface{}) (interface{}, bool, error) {
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			return value, false, nil
+		}
+		if _, ok := fields["apiVersion"].(string); !ok {
+			return value, false, nil
+		}
+		if _, ok := fields["kind"].(string); !ok {
+			return value, false, nil
+		}
+		if _, ok := fields["metadata"]; !ok {
+			fields["metadata"] = map[string]interface{}{}
+		}
+		metadata, ok := fields["metadata"].(map[string]interface{})
+		if !ok {
+			return value, false, nil
+		}
+		if _, ok := metadata["annotations"]; !ok || metadata["annotations"] == nil {
+			metadata["annotations"] = map[string]interface{}{}
+		}
+		annotations, ok := metadata["annotations"].(map[string]interface{})
+		if !ok {
+			return value, false, nil
+		}
+		annotations[key] = hash
+		return fields, true, nil
+	})
+}
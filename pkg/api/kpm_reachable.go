@@ -0,0 +1,161 @@
+package api
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"kcl-lang.io/kpm/pkg/constants"
+	"kcl-lang.io/kpm/pkg/opt"
+	pkg "kcl-lang.io/kpm/pkg/package"
+	"kcl-lang.io/kpm/pkg/reporter"
+	"kcl-lang.io/kpm/pkg/utils"
+)
+
+// ReachableFiles will return the kcl files of the package in 'pkgPath' which are reachable from the entries 'entries',
+// i.e. the kcl files of the entries and of the modules in the package imported by them in turn, so that a minimal bundle can be built.
+// The relative entries are resolved by the package path, and the default entries of the package are used if 'entries' is empty.
+// The imports are found statically without resolving the dependencies, the import aliases in the compile options are respected,
+// and the modules imported from the dependencies are not followed. A nil 'opts' means the default compile options.
+// The files are returned as the sorted slash-separated paths relative to the package, and the files out of the package are not returned.
+func ReachableFiles(pkgPath string, entries []string, opts *opt.CompileOptions) ([]string, error) {
+	if opts == nil {
+		opts = opt.DefaultCompileOptions()
+	}
+	absPkgPath, err := filepath.Abs(pkgPath)
+	if err != nil {
+		return nil, reporter.NewErrorEvent(reporter.Bug, err, "internal bugs, please contact us to fix it.")
+	}
+	kclPkg, err := pkg.LoadKclPkg(absPkgPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(entries) == 0 {
+		entries, err = DefaultEntries(absPkgPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	absEntries := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !filepath.IsAbs(entry) {
+			entry = filepath.Join(absPkgPath, entry)
+		}
+		if !utils.DirExists(entry) {
+			return nil, reporter.NewErrorEvent(reporter.LocalPathNotExist, fmt.Errorf("entry '%s' not found", entry))
+		}
+		absEntries = append(absEntries, entry)
+	}
+
+	reachable := make(map[string]bool)
+	addFiles := func(path string) {
+		for _, file := range kclFiles(path) {
+			if rel, err := filepath.Rel(absPkgPath, file); err == nil && !strings.HasPrefix(rel, "..") {
+				reachable[filepath.ToSlash(rel)] = true
+			}
+		}
+	}
+	for _, entry := range absEntries {
+		addFiles(entry)
+	}
+	err = walkImportsFrom(kclPkg, absEntries, importedDepNames(kclPkg, opts), func(file, module, path, dep string) error {
+		if len(path) != 0 {
+			addFiles(path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, reporter.NewErrorEvent(reporter.FailedAccessPkgPath, err, "failed to find the modules imported by the entries")
+	}
+
+	files := make([]string, 0, len(reachable))
+	for file := range reachable {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// ImportersOfDependency will return the kcl files of the package in 'pkgPath' which import the dependency 'depName',
+// directly or through the other modules of the package, e.g. to check whether it is safe to remove the dependency.
+// All the kcl files of the package are checked except the ones in the vendor directory and the hidden directories,
+// and the imports are found statically without resolving the dependencies, so the imports through the other dependencies are not followed.
+// The files are returned as the sorted slash-separated paths relative to the package, and nil is returned if the dependency is not imported.
+func ImportersOfDependency(pkgPath, depName string) ([]string, error) {
+	absPkgPath, err := filepath.Abs(pkgPath)
+	if err != nil {
+		return nil, reporter.NewErrorEvent(reporter.Bug, err, "internal bugs, please contact us to fix it.")
+	}
+	kclPkg, err := pkg.LoadKclPkg(absPkgPath)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := kclPkg.ModFile.Dependencies.Deps[depName]; !ok {
+		return nil, reporter.NewErrorEvent(
+			reporter.DependencyNotFound,
+			fmt.Errorf("'%s' is not a dependency of '%s'", depName, kclPkg.GetPkgName()),
+			fmt.Sprintf("failed to find the importers of '%s'", depName),
+		)
+	}
+
+	var files []string
+	err = filepath.WalkDir(absPkgPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != absPkgPath && (d.Name() == "vendor" || strings.HasPrefix(d.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) == constants.KFilePathSuffix {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, reporter.NewErrorEvent(reporter.FailedAccessPkgPath, err, fmt.Sprintf("failed to find the kcl files in '%s'", absPkgPath))
+	}
+
+	// The files importing each file of the package, and the files importing the dependency directly.
+	importers := make(map[string][]string)
+	var pending []string
+	err = walkImportsFrom(kclPkg, files, importedDepNames(kclPkg, opt.DefaultCompileOptions()), func(file, module, path, dep string) error {
+		if dep == depName {
+			pending = append(pending, file)
+		}
+		if len(path) != 0 {
+			for _, imported := range kclFiles(path) {
+				importers[imported] = append(importers[imported], file)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, reporter.NewErrorEvent(reporter.FailedAccessPkgPath, err, "failed to find the modules imported by the kcl files")
+	}
+
+	found := make(map[string]bool)
+	for len(pending) != 0 {
+		file := pending[0]
+		pending = pending[1:]
+		if found[file] {
+			continue
+		}
+		found[file] = true
+		pending = append(pending, importers[file]...)
+	}
+
+	var result []string
+	for file := range found {
+		if rel, err := filepath.Rel(absPkgPath, file); err == nil && !strings.HasPrefix(rel, "..") {
+			result = append(result, filepath.ToSlash(rel))
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
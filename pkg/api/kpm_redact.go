@@ -0,0 +1,147 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"kcl-lang.io/kpm/pkg/reporter"
+)
+
+// RedactedValue is the placeholder of the values redacted by 'opt.WithRedactPaths'.
+const RedactedValue = "[REDACTED]"
+
+// redactSegment is a segment of a redact path, which is either the key of a field or the index of an item.
+type redactSegment struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// parseRedactPath parses the JSONPath 'path', e.g. '$.data.password', 'spec.containers[*].env[0].value' or "$['app.kubernetes.io/name']",
+// into the segments. The leading '$' is optional, and '*' matches all the fields of an object or all the items of a list.
+func parseRedactPath(path string) ([]redactSegment, error) {
+	invalid := func(reason string) error {
+		return reporter.NewErrorEvent(reporter.InvalidRedactPath, fmt.Errorf("%s", reason), fmt.Sprintf("invalid redact path '%s'", path))
+	}
+
+	rest := strings.TrimPrefix(path, "$")
+	var segments []redactSegment
+	for len(rest) != 0 {
+		switch {
+		case strings.HasPrefix(rest, "['") || strings.HasPrefix(rest, `["`):
+			quote := rest[1:2]
+			end := strings.Index(rest[2:], quote+"]")
+			if end < 0 {
+				return nil, invalid("the quoted key is not closed")
+			}
+			segments = append(segments, redactSegment{key: rest[2 : 2+end]})
+			rest = rest[2+end+2:]
+		case strings.HasPrefix(rest, "["):
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, invalid("the index is not closed")
+			}
+			index := rest[1:end]
+			if index == "*" {
+				segments = append(segments, redactSegment{isIndex: true, wildcard: true})
+			} else {
+				i, err := strconv.Atoi(index)
+				if err != nil || i < 0 {
+					return nil, invalid(fmt.Sprintf("the index '%s' is not a non-negative integer", index))
+				}
+				segments = append(segments, redactSegment{isIndex: true, index: i})
+			}
+			rest = rest[end+1:]
+		default:
+			// The first key can be written without the leading '.'.
+			if len(segments) != 0 || strings.HasPrefix(rest, ".") {
+				if !strings.HasPrefix(rest, ".") {
+					return nil, invalid(fmt.Sprintf("unexpected '%s'", rest))
+				}
+				rest = rest[1:]
+			}
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			key := rest[:end]
+			if len(key) == 0 {
+				return nil, invalid("empty key")
+			}
+			segments = append(segments, redactSegment{key: key, wildcard: key == "*"})
+			rest = rest[end:]
+		}
+	}
+	if len(segments) == 0 {
+		return nil, invalid("the whole document can not be redacted")
+	}
+	return segments, nil
+}
+
+// redactValue replaces the values in 'value' matched by the segments with 'RedactedValue',
+// and returns the redacted value and whether anything is redacted.
+func redactValue(value interface{}, segments []redactSegment) (interface{}, bool) {
+	if len(segments) == 0 {
+		return RedactedValue, true
+	}
+	segment, rest := segments[0], segments[1:]
+	redacted := false
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if segment.isIndex {
+			return v, false
+		}
+		for key, field := range v {
+			if segment.wildcard || key == segment.key {
+				var ok bool
+				v[key], ok = redactValue(field, rest)
+				redacted = redacted || ok
+			}
+		}
+	case []interface{}:
+		if !segment.isIndex && !segment.wildcard {
+			return v, false
+		}
+		for i, item := range v {
+			if segment.wildcard || i == segment.index {
+				var ok bool
+				v[i], ok = redactValue(item, rest)
+				redacted = redacted || ok
+			}
+		}
+	}
+	return value, redacted
+}
+
+// redact will write the yaml output into 'sink' if it is not nil,
+// and replace the values in the JSONPaths 'paths' of the documents with 'RedactedValue'.
+// The documents without the redacted fields are kept as they are.
+func (r *CompileResult) redact(paths []string, sink io.Writer) error {
+	pathSegments := make([][]redactSegment, 0, len(paths))
+	for _, path := range paths {
+		segments, err := parseRedactPath(path)
+		if err != nil {
+			return err
+		}
+		pathSegments = append(pathSegments, segments)
+	}
+
+	if sink != nil {
+		if _, err := io.WriteString(sink, r.GetRawYamlResult()); err != nil {
+			return reporter.NewErrorEvent(reporter.FailedCreateFile, err, "failed to write the unredacted output")
+		}
+	}
+
+	return r.rewriteDocuments("redacted", func(i int, value interface{}) (interface{}, bool, error) {
+		redacted := false
+		for _, segments := range pathSegments {
+			var ok bool
+			value, ok = redactValue(value, segments)
+			redacted = redacted || ok
+		}
+		return value, redacted, nil
+	})
+}
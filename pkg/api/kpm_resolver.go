@@ -0,0 +1,143 @@
+package api
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"kcl-lang.io/kcl-go/pkg/kcl"
+	"kcl-lang.io/kpm/pkg/constants"
+	"kcl-lang.io/kpm/pkg/env"
+	"kcl-lang.io/kpm/pkg/opt"
+	pkg "kcl-lang.io/kpm/pkg/package"
+	"kcl-lang.io/kpm/pkg/reporter"
+	"kcl-lang.io/kpm/pkg/utils"
+)
+
+// resolvedImportsDir is the directory in $KCL_PKG_PATH where the filesystems returned by the import resolver are written.
+const resolvedImportsDir = ".resolved_imports"
+
+// systemModules is the kcl system modules, which are always resolved by the kcl compiler.
+var systemModules = map[string]bool{
+	"base64": true, "collection": true, "crypto": true, "datetime": true, "file": true, "json": true, "manifests": true,
+	"math": true, "net": true, "regex": true, "runtime": true, "template": true, "units": true, "yaml": true,
+}
+
+// resolveUnknownImports will consult the import resolver in the compile options for the imports which kpm can not resolve,
+// i.e. the imports which are not relative, not the system modules, not the dependencies or the external packages,
+// and not the modules of the package. The resolver is called with the import path of the first import of each top-level name,
+// and the returned filesystem is compiled as the external package of the top-level name.
+func resolveUnknownImports(kclPkg *pkg.KclPkg, opts *opt.CompileOptions) error {
+	resolver := opts.ImportResolver()
+	if resolver == nil {
+		return nil
+	}
+
+	resolved := make(map[string]bool)
+	for _, externalPkg := range opts.ExternalPkgs {
+		resolved[externalPkg.PkgName] = true
+	}
+	err := walkImports(kclPkg, opts, func(file, module, path, dep string) error {
+		name := strings.Split(module, ".")[0]
+		if len(dep) != 0 || strings.HasPrefix(module, ".") || systemModules[name] || resolved[name] {
+			return nil
+		}
+		if _, err := os.Stat(path); err == nil {
+			return nil
+		}
+		resolved[name] = true
+
+		fsys, ok, err := resolver(module)
+		if err != nil {
+			return reporter.NewErrorEvent(reporter.FailedResolveImport, err, fmt.Sprintf("failed to resolve the import '%s' in '%s'", module, file))
+		}
+		if !ok {
+			return nil
+		}
+		dir, err := writeResolvedImport(name, fsys)
+		if err != nil {
+			return reporter.NewErrorEvent(reporter.FailedResolveImport, err, fmt.Sprintf("failed to write the package resolved for the import '%s'", module))
+		}
+		opts.Merge(kcl.WithExternalPkgs(fmt.Sprintf(constants.EXTERNAL_PKGS_ARG_PATTERN, name, dir)))
+		return nil
+	})
+	if err != nil {
+		if _, ok := err.(*reporter.KpmEvent); ok {
+			return err
+		}
+		return reporter.NewErrorEvent(reporter.FailedAccessPkgPath, err, "failed to find the modules imported by the entries")
+	}
+	return nil
+}
+
+// writeResolvedImport will write the files in 'fsys' into the directory in $KCL_PKG_PATH named by 'name' and the checksum of the files,
+// and return the directory. The directory written before for the same files is reused.
+func writeResolvedImport(name string, fsys fs.FS) (string, error) {
+	hash := sha256.New()
+	err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		content, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(hash, "%s\x00%d\x00", path, len(content))
+		_, err = hash.Write(content)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	globalPkgPath, err := env.GetAbsPkgPath()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(globalPkgPath, resolvedImportsDir, fmt.Sprintf("%s_%x", name, hash.Sum(nil)[:8]))
+	if _, err := os.Stat(dir); err == nil {
+		return dir, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return "", err
+	}
+	tmpDir, err := os.MkdirTemp(filepath.Dir(dir), name)
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpDir)
+	err = fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(tmpDir, filepath.FromSlash(path))
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		src, err := fsys.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		dst, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+		defer dst.Close()
+		_, err = io.Copy(dst, src)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	// The directory may be written by another process in the meantime, which has the same files.
+	if err := os.Rename(tmpDir, dir); err != nil && !utils.DirExists(dir) {
+		return "", err
+	}
+	return dir, nil
+}
@@ -0,0 +1,604 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"google.golang.org/protobuf/types/known/structpb"
+	"gopkg.in/yaml.v3"
+	"kcl-lang.io/kcl-go/pkg/kcl"
+	"kcl-lang.io/kpm/pkg/client"
+	"kcl-lang.io/kpm/pkg/jsonschema"
+	"kcl-lang.io/kpm/pkg/opt"
+	"kcl-lang.io/kpm/pkg/reporter"
+)
+
+// yamlDocumentSeparator is the separator between the yaml documents in the compile result.
+const yamlDocumentSeparator = "---"
+
+// Document is one document of the compile result.
+type Document struct {
+	// Source is the entry which produces the document.
+	Source string
+	// Yaml is the document in yaml format.
+	Yaml string
+	// Json is the document in json format.
+	Json string
+}
+
+// CompileResult is the result of compiling a kcl package by kpm.
+type CompileResult struct {
+	documents []Document
+	// separatorComment is whether to insert the '# source: <entry>' comment before each document separator.
+	separatorComment bool
+	// depOrigins is where the resolved dependencies are served from, the key is the name of the dependency.
+	depOrigins map[string]client.Origin
+	// outputEncoding is the encoding of the serialized output, nil means utf-8.
+	outputEncoding encoding.Encoding
+	// resolvedInput is the input values of the compilation, nil if they are not captured.
+	resolvedInput *ResolvedInput
+	// diff is the changes of the documents from the diff base.
+	diff []DocumentDiff
+	// serialized is the output of the custom serializer of the output format, nil for the built-in formats.
+	serialized []byte
+}
+
+// ResolvedInput is the input values of the compilation after the defaults, the settings files,
+// the profile in 'kcl.mod' and the options are merged.
+type ResolvedInput struct {
+	// Args is the top-level arguments, the later one wins if an argument is set more than once.
+	Args map[string]string `json:"args,omitempty" yaml:"args,omitempty"`
+	// Overrides is the overrides of the fields in the order they are applied, e.g. 'app.replicas=2'.
+	Overrides []string `json:"overrides,omitempty" yaml:"overrides,omitempty"`
+}
+
+// newResolvedInput returns the input values of the compilation with the compile options.
+func newResolvedInput(opts *opt.CompileOptions) *ResolvedInput {
+	config := opts.Effective()
+	return &ResolvedInput{Args: config.Args, Overrides: config.Overrides}
+}
+
+// addDocuments will split the kcl compile result into documents and add them to the compile result.
+func (r *CompileResult) addDocuments(result *kcl.KCLResultList, source string) {
+	if result == nil {
+		return
+	}
+
+	yamlDocs := splitYamlDocuments(result.GetRawYamlResult())
+	jsonDocs := splitJsonDocuments(result.GetRawJsonResult(), len(yamlDocs))
+	for i, yamlDoc := range yamlDocs {
+		doc := Document{
+			Source: source,
+			Yaml:   yamlDoc,
+		}
+		if i < len(jsonDocs) {
+			doc.Json = jsonDocs[i]
+		}
+		r.documents = append(r.documents, doc)
+	}
+}
+
+// Documents returns the documents of the compile result.
+func (r *CompileResult) Documents() []Document {
+	return r.documents
+}
+
+// ResolvedInput returns the input values of the compilation, i.e. the top-level arguments and the overrides
+// after all of them are merged, it is nil unless the input is captured by 'opt.WithCaptureInput'.
+func (r *CompileResult) ResolvedInput() *ResolvedInput {
+	return r.resolvedInput
+}
+
+// DependencyOrigins returns whether each resolved dependency is served from the cache, the vendor directory,
+// the local path or freshly downloaded, the key is the name of the dependency.
+func (r *CompileResult) DependencyOrigins() map[string]client.Origin {
+	return r.depOrigins
+}
+
+// GetYamlDocuments returns the yaml documents of the compile result without separators and comments.
+func (r *CompileResult) GetYamlDocuments() []string {
+	docs := make([]string, 0, len(r.documents))
+	for _, doc := range r.documents {
+		docs = append(docs, doc.Yaml)
+	}
+	return docs
+}
+
+// GetRawYamlResult returns the yaml documents joined by '---'.
+// If the separator comment is enabled, '# source: <entry>' will be inserted before each '---'.
+func (r *CompileResult) GetRawYamlResult() string {
+	var sb strings.Builder
+	for i, doc := range r.documents {
+		if r.separatorComment && len(doc.Source) != 0 {
+			sb.WriteString(fmt.Sprintf("# source: %s\n", doc.Source))
+		}
+		if i > 0 || r.separatorComment {
+			sb.WriteString(yamlDocumentSeparator + "\n")
+		}
+		sb.WriteString(doc.Yaml)
+		if !strings.HasSuffix(doc.Yaml, "\n") {
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String()
+}
+
+// GetRawJsonResult returns the json documents of the compile result.
+// A single document is returned as is, and multiple documents are returned as a json array.
+func (r *CompileResult) GetRawJsonResult() string {
+	if len(r.documents) == 1 {
+		return r.documents[0].Json
+	}
+	docs := make([]string, 0, len(r.documents))
+	for _, doc := range r.documents {
+		docs = append(docs, doc.Json)
+	}
+	return "[" + strings.Join(docs, ", ") + "]"
+}
+
+// EncodedYamlResult returns the raw yaml result transcoded into the output encoding.
+// An error is returned if the result has characters which can not be represented in the output encoding.
+func (r *CompileResult) EncodedYamlResult() ([]byte, error) {
+	encoded, err := encodeOutput(r.outputEncoding, r.GetRawYamlResult())
+	if err != nil {
+		return nil, reporter.NewErrorEvent(reporter.InvalidOutput, err, "failed to transcode the yaml result")
+	}
+	return encoded, nil
+}
+
+// EncodedJsonResult returns the raw json result transcoded into the output encoding.
+// An error is returned if the result has characters which can not be represented in the output encoding.
+func (r *CompileResult) EncodedJsonResult() ([]byte, error) {
+	encoded, err := encodeOutput(r.outputEncoding, r.GetRawJsonResult())
+	if err != nil {
+		return nil, reporter.NewErrorEvent(reporter.InvalidOutput, err, "failed to transcode the json result")
+	}
+	return encoded, nil
+}
+
+// encodeOutput transcodes 'content' into the encoding 'enc', 'content' is returned as is if 'enc' is nil.
+// The characters which can not be represented in 'enc' are never replaced, the first one is reported with its line instead.
+func encodeOutput(enc encoding.Encoding, content string) ([]byte, error) {
+	if enc == nil {
+		return []byte(content), nil
+	}
+	encoded, err := enc.NewEncoder().Bytes([]byte(content))
+	if err == nil {
+		return encoded, nil
+	}
+	for i, line := range strings.Split(content, "\n") {
+		for _, char := range line {
+			if _, charErr := enc.NewEncoder().String(string(char)); charErr != nil {
+				return nil, fmt.Errorf("the character '%c' (%U) on line %d can not be represented in the output encoding", char, char, i+1)
+			}
+		}
+	}
+	return nil, err
+}
+
+// splitYamlDocuments splits the yaml stream into documents by the '---' lines.
+func splitYamlDocuments(yamlResult string) []string {
+	var docs []string
+	var lines []string
+	flush := func() {
+		doc := strings.Join(lines, "\n")
+		if len(strings.TrimSpace(doc)) != 0 {
+			docs = append(docs, strings.TrimRight(doc, "\n")+"\n")
+		}
+		lines = nil
+	}
+	for _, line := range strings.Split(yamlResult, "\n") {
+		if strings.TrimRight(line, " \r") == yamlDocumentSeparator {
+			flush()
+			continue
+		}
+		lines = append(lines, line)
+	}
+	flush()
+	return docs
+}
+
+// splitJsonDocuments splits the json result into documents.
+// The json result of multiple documents is a json array.
+func splitJsonDocuments(jsonResult string, count int) []string {
+	if count <= 1 {
+		return []string{jsonResult}
+	}
+	var docs []json.RawMessage
+	if err := json.Unmarshal([]byte(jsonResult), &docs); err != nil || len(docs) != count {
+		return nil
+	}
+	res := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		res = append(res, string(doc))
+	}
+	return res
+}
+
+// maxExactFloatInt is the max integer which can be represented exactly by float64.
+const maxExactFloatInt = 1 << 53
+
+// AsStructpb converts each document of the compile result into 'google.protobuf.Struct'.
+// The documents are decoded without float64 coercion, so integers which can not be represented
+// exactly by the number value of protobuf are kept as string values to avoid losing precision.
+func (r *CompileResult) AsStructpb() ([]*structpb.Struct, error) {
+	structs := make([]*structpb.Struct, 0, len(r.documents))
+	for i, doc := range r.documents {
+		decoder := json.NewDecoder(strings.NewReader(doc.Json))
+		decoder.UseNumber()
+		var fields map[string]interface{}
+		if err := decoder.Decode(&fields); err != nil {
+			return nil, reporter.NewErrorEvent(reporter.FailedConvertResult, err, fmt.Sprintf("failed to convert the document %d into 'google.protobuf.Struct'", i))
+		}
+
+		s := &structpb.Struct{Fields: make(map[string]*structpb.Value, len(fields))}
+		for k, v := range fields {
+			value, err := toStructpbValue(v)
+			if err != nil {
+				return nil, reporter.NewErrorEvent(reporter.FailedConvertResult, err, fmt.Sprintf("failed to convert the document %d into 'google.protobuf.Struct'", i))
+			}
+			s.Fields[k] = value
+		}
+		structs = append(structs, s)
+	}
+	return structs, nil
+}
+
+// toStructpbValue converts the value decoded from json with 'UseNumber' into 'google.protobuf.Value'.
+func toStructpbValue(v interface{}) (*structpb.Value, error) {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			if i > maxExactFloatInt || i < -maxExactFloatInt {
+				return structpb.NewStringValue(v.String()), nil
+			}
+			return structpb.NewNumberValue(float64(i)), nil
+		}
+		if _, ok := new(big.Int).SetString(v.String(), 10); ok {
+			// The integer overflows int64.
+			return structpb.NewStringValue(v.String()), nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return structpb.NewNumberValue(f), nil
+	case map[string]interface{}:
+		s := &structpb.Struct{Fields: make(map[string]*structpb.Value, len(v))}
+		for k, item := range v {
+			value, err := toStructpbValue(item)
+			if err != nil {
+				return nil, err
+			}
+			s.Fields[k] = value
+		}
+		return structpb.NewStructValue(s), nil
+	case []interface{}:
+		list := &structpb.ListValue{Values: make([]*structpb.Value, 0, len(v))}
+		for _, item := range v {
+			value, err := toStructpbValue(item)
+			if err != nil {
+				return nil, err
+			}
+			list.Values = append(list.Values, value)
+		}
+		return structpb.NewListValue(list), nil
+	default:
+		// The values of nil, bool and string.
+		return structpb.NewValue(v)
+	}
+}
+
+// Transform calls 'transform' with each object document of the compile result,
+// and replaces the document with the one returned, or drops it if nil is returned.
+// The documents returned are serialized into yaml and json again with the keys sorted.
+func (r *CompileResult) Transform(transform opt.ResultTransform) error {
+	return r.rewriteDocuments("transformed", func(i int, value interface{}) (interface{}, bool, error) {
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			// The documents which are not objects are kept as they are.
+			return value, false, nil
+		}
+		fields, err := transform(fields)
+		if err != nil {
+			return nil, false, reporter.NewErrorEvent(reporter.InvalidOutput, err, fmt.Sprintf("failed to transform %s", documentName(r.documents, i)))
+		}
+		if fields == nil {
+			// The document is dropped.
+			return nil, true, nil
+		}
+		return fields, true, nil
+	})
+}
+
+// rewriteDocuments calls 'rewrite' with the value of the i-th document of the compile result decoded from json,
+// and replaces the changed documents with the values returned, which are serialized into yaml and json again with the keys sorted,
+// or drops them if nil is returned. The documents which are not changed are kept as they are.
+// 'name' describes the rewritten documents in the error messages, e.g. 'transformed'.
+func (r *CompileResult) rewriteDocuments(name string, rewrite func(i int, value interface{}) (interface{}, bool, error)) error {
+	documents := make([]Document, 0, len(r.documents))
+	for i, doc := range r.documents {
+		value, err := decodeDocument(doc)
+		if err != nil {
+			return reporter.NewErrorEvent(reporter.FailedConvertResult, err, fmt.Sprintf("failed to decode %s", documentName(r.documents, i)))
+		}
+		value, changed, err := rewrite(i, value)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			documents = append(documents, doc)
+			continue
+		}
+		if value == nil {
+			continue
+		}
+
+		jsonDoc, err := json.Marshal(value)
+		if err != nil {
+			return reporter.NewErrorEvent(reporter.FailedConvertResult, err, fmt.Sprintf("failed to convert the %s %s into json", name, documentName(r.documents, i)))
+		}
+		yamlDoc, err := encodeYaml(value)
+		if err != nil {
+			return reporter.NewErrorEvent(reporter.FailedConvertResult, err, fmt.Sprintf("failed to convert the %s %s into yaml", name, documentName(r.documents, i)))
+		}
+		documents = append(documents, Document{Source: doc.Source, Yaml: yamlDoc, Json: string(jsonDoc)})
+	}
+	r.documents = documents
+	return nil
+}
+
+// decodeDocument returns the value of the document 'doc' decoded from json,
+// the integers are decoded into 'int64' and the other numbers into 'float64' as 'fromJsonNumbers' does.
+func decodeDocument(doc Document) (interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader(doc.Json))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return fromJsonNumbers(value), nil
+}
+
+// encodeYaml returns the value 'v' serialized into yaml with the indent of 2 spaces.
+func encodeYaml(v interface{}) (string, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(v); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// fromJsonNumbers converts the numbers decoded from json with 'UseNumber' into 'int64' or 'float64',
+// the integers which overflow int64 are kept as 'json.Number'.
+func fromJsonNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if _, ok := new(big.Int).SetString(v.String(), 10); ok {
+			return v
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return v
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = fromJsonNumbers(item)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = fromJsonNumbers(item)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// defaultSplitOutputNameTemplate is the default template of the file names of the split output.
+const defaultSplitOutputNameTemplate = "{.metadata.name}"
+
+// templateFieldPattern matches the fields in the file name template, e.g. '{.metadata.name}'.
+var templateFieldPattern = regexp.MustCompile(`\{\.([^{}]*)\}`)
+
+// WriteSplitOutput writes each document of the compile result into a separate file in the directory 'dir'.
+// The file name is rendered from 'nameTemplate' whose fields like '{.metadata.name}' are replaced by the values in the document,
+// and '.yaml' is appended if the file name has no extension. The documents are written in json if the file name ends with '.json'.
+// The file names must be unique and in 'dir'.
+func (r *CompileResult) WriteSplitOutput(dir, nameTemplate string) error {
+	if len(nameTemplate) == 0 {
+		nameTemplate = defaultSplitOutputNameTemplate
+	}
+
+	owners := make(map[string]int)
+	names := make([]string, 0, len(r.documents))
+	for i, doc := range r.documents {
+		name, err := renderFileName(nameTemplate, doc.Json)
+		if err != nil {
+			return reporter.NewErrorEvent(reporter.InvalidOutput, err, fmt.Sprintf("failed to render the file name of %s", documentName(r.documents, i)))
+		}
+		if len(filepath.Ext(name)) == 0 {
+			name += ".yaml"
+		}
+		name = filepath.Clean(filepath.FromSlash(name))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return reporter.NewErrorEvent(
+				reporter.InvalidOutput,
+				fmt.Errorf("the file name '%s' is out of the directory '%s'", name, dir),
+				fmt.Sprintf("failed to render the file name of %s", documentName(r.documents, i)),
+			)
+		}
+		if owner, ok := owners[name]; ok {
+			return reporter.NewErrorEvent(
+				reporter.InvalidOutput,
+				fmt.Errorf("the file name '%s' is rendered by both %s and %s", name, documentName(r.documents, owner), documentName(r.documents, i)),
+				"the file names of the split output must be unique",
+			)
+		}
+		owners[name] = i
+		names = append(names, name)
+	}
+
+	for i, doc := range r.documents {
+		path := filepath.Join(dir, names[i])
+		content := doc.Yaml
+		if filepath.Ext(path) == ".json" {
+			content = doc.Json + "\n"
+		}
+		encoded, err := encodeOutput(r.outputEncoding, content)
+		if err != nil {
+			return reporter.NewErrorEvent(reporter.InvalidOutput, err, fmt.Sprintf("failed to transcode %s", documentName(r.documents, i)))
+		}
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			return reporter.NewErrorEvent(reporter.FailedCreateFile, err, fmt.Sprintf("failed to create '%s'", filepath.Dir(path)))
+		}
+		err = os.WriteFile(path, encoded, 0644)
+		if err != nil {
+			return reporter.NewErrorEvent(reporter.FailedCreateFile, err, fmt.Sprintf("failed to write '%s'", path))
+		}
+	}
+	return nil
+}
+
+// renderFileName replaces the fields in 'nameTemplate' with the values in the json document 'doc'.
+func renderFileName(nameTemplate, doc string) (string, error) {
+	decoder := json.NewDecoder(strings.NewReader(doc))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return "", err
+	}
+
+	var renderErr error
+	name := templateFieldPattern.ReplaceAllStringFunc(nameTemplate, func(field string) string {
+		path := templateFieldPattern.FindStringSubmatch(field)[1]
+		switch v := fieldValue(value, path).(type) {
+		case string:
+			return v
+		case json.Number, bool:
+			return fmt.Sprint(v)
+		default:
+			if renderErr == nil {
+				renderErr = fmt.Errorf("the field '.%s' is not a string, number or bool in the document", path)
+			}
+			return ""
+		}
+	})
+	if renderErr != nil {
+		return "", renderErr
+	}
+	return name, nil
+}
+
+// fieldValue returns the value of the field in the dot-separated 'path', e.g. 'metadata.name', in the decoded json 'value',
+// nil is returned if the field does not exist.
+func fieldValue(value interface{}, path string) interface{} {
+	current := value
+	for _, key := range strings.Split(path, ".") {
+		fields, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = fields[key]
+	}
+	return current
+}
+
+// SortDocuments sorts the documents of the compile result by the value of the field in the dot-separated 'key', e.g. 'metadata.name'.
+// The numbers are compared by their values, and the other values are compared as strings.
+// The documents whose field is missing or is not a string, number or bool are sorted last,
+// and the documents with the same value are kept in the order they are compiled.
+func (r *CompileResult) SortDocuments(key string) {
+	type sortValue struct {
+		ok  bool
+		str string
+		num *big.Float
+	}
+	values := make([]sortValue, len(r.documents))
+	for i, doc := range r.documents {
+		decoder := json.NewDecoder(strings.NewReader(doc.Json))
+		decoder.UseNumber()
+		var value interface{}
+		if err := decoder.Decode(&value); err != nil {
+			continue
+		}
+		switch v := fieldValue(value, key).(type) {
+		case string:
+			values[i] = sortValue{ok: true, str: v}
+		case bool:
+			values[i] = sortValue{ok: true, str: fmt.Sprint(v)}
+		case json.Number:
+			values[i] = sortValue{ok: true, str: v.String()}
+			values[i].num, _ = new(big.Float).SetString(v.String())
+		}
+	}
+
+	indexes := make([]int, len(r.documents))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.SliceStable(indexes, func(i, j int) bool {
+		vi, vj := values[indexes[i]], values[indexes[j]]
+		if !vi.ok || !vj.ok {
+			return vi.ok && !vj.ok
+		}
+		if vi.num != nil && vj.num != nil {
+			return vi.num.Cmp(vj.num) < 0
+		}
+		return vi.str < vj.str
+	})
+
+	documents := make([]Document, 0, len(r.documents))
+	for _, i := range indexes {
+		documents = append(documents, r.documents[i])
+	}
+	r.documents = documents
+}
+
+// ValidateWithSchema validates each document of the compile result against the json schema in 'schemaPath',
+// and returns an error with the paths of the invalid values if any document is invalid.
+func (r *CompileResult) ValidateWithSchema(schemaPath string) error {
+	schema, err := jsonschema.Load(schemaPath)
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	for i, doc := range r.documents {
+		errs, err := schema.ValidateJson(doc.Json)
+		if err != nil {
+			return reporter.NewErrorEvent(reporter.InvalidOutput, err, fmt.Sprintf("failed to parse the document %d", i))
+		}
+		for _, e := range errs {
+			if len(doc.Source) != 0 {
+				problems = append(problems, fmt.Sprintf("document %d (%s): %s", i, doc.Source, e.Error()))
+			} else {
+				problems = append(problems, fmt.Sprintf("document %d: %s", i, e.Error()))
+			}
+		}
+	}
+
+	if len(problems) != 0 {
+		return reporter.NewErrorEvent(
+			reporter.InvalidOutput,
+			fmt.Errorf("%s", strings.Join(problems, "\n")),
+			fmt.Sprintf("the compiled documents do not match the json schema '%s'", schemaPath),
+		)
+	}
+	return nil
+}
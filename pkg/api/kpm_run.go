@@ -1,16 +1,20 @@
 package api
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
 
 	"kcl-lang.io/kcl-go/pkg/kcl"
+	"kcl-lang.io/kcl-go/pkg/spec/gpyrpc"
 	"kcl-lang.io/kpm/pkg/client"
 	"kcl-lang.io/kpm/pkg/constants"
 	"kcl-lang.io/kpm/pkg/env"
 	"kcl-lang.io/kpm/pkg/errors"
-	"kcl-lang.io/kpm/pkg/oci"
 	"kcl-lang.io/kpm/pkg/opt"
 	pkg "kcl-lang.io/kpm/pkg/package"
 	"kcl-lang.io/kpm/pkg/reporter"
@@ -43,6 +47,29 @@ func RunOci(ociRef, version string, opts *opt.CompileOptions) (string, error) {
 	return compileResult.GetRawYamlResult(), nil
 }
 
+// RunOciRef will compile the kcl package referenced purely by the OCI reference 'ref' with the tag in it,
+// e.g. 'oci://ghcr.io/kcl-lang/helloworld:0.1.0' or 'ghcr.io/kcl-lang/helloworld:0.1.0'.
+// The package is pulled into a temporary directory, which is cleaned up after the compilation.
+// The latest version is compiled if there is no tag in 'ref'.
+func RunOciRef(ref string, opts *opt.CompileOptions) (string, error) {
+	ociRef, tag := splitOciRefTag(ref)
+	return RunOci(ociRef, tag, opts)
+}
+
+// splitOciRefTag splits the OCI url 'oci://<registry>/<repo>:<tag>' into the url without the tag and the tag.
+// The other OCI references are returned as they are, because the tags in them are parsed by the kpm client.
+func splitOciRefTag(ref string) (string, string) {
+	if !strings.HasPrefix(ref, "oci://") {
+		return ref, ""
+	}
+	slash := strings.LastIndex(ref, "/")
+	colon := strings.LastIndex(ref, ":")
+	if colon <= slash {
+		return ref, ""
+	}
+	return ref[:colon], ref[colon+1:]
+}
+
 // RunPkg will compile current kcl package.
 func RunPkg(opts *opt.CompileOptions) (string, error) {
 
@@ -91,9 +118,51 @@ func RunWithOpts(opts ...opt.Option) (*kcl.KCLResultList, error) {
 	for _, opt := range opts {
 		opt(mergedOpts)
 	}
+
+	restoreEnvs, err := loadEnvFile(mergedOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer restoreEnvs()
+
 	return runPkgWithOpt(mergedOpts)
 }
 
+// loadEnvFile will set the environment variables from the '.env' file in the compile options,
+// and $KCL_PLUGINS_ROOT from the plugin path in the compile options,
+// and return the function to restore the environment variables after the compilation.
+func loadEnvFile(opts *opt.CompileOptions) (func(), error) {
+	restoreEnvs := func() {}
+	if len(opts.EnvFile()) != 0 {
+		envs, err := env.LoadEnvFile(opts.EnvFile())
+		if err != nil {
+			return nil, err
+		}
+		restoreEnvs, err = env.SetEnvs(envs, opts.EnvFileOverride())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(opts.PluginPath()) == 0 {
+		return restoreEnvs, nil
+	}
+	pluginPath, err := filepath.Abs(opts.PluginPath())
+	if err != nil {
+		restoreEnvs()
+		return nil, reporter.NewErrorEvent(reporter.Bug, err, "internal bugs, please contact us to fix it.")
+	}
+	restorePlugins, err := env.SetEnvs(map[string]string{env.PLUGINS_ROOT: pluginPath}, true)
+	if err != nil {
+		restoreEnvs()
+		return nil, err
+	}
+	return func() {
+		restorePlugins()
+		restoreEnvs()
+	}, nil
+}
+
 // getAbsInputPath will return the abs path of the file path described by '--input'.
 // If the path exists after 'inputPath' is computed as a full path, it will be returned.
 // If not, the kpm checks whether the full path of 'pkgPath/inputPath' exists,
@@ -154,7 +223,11 @@ func RunTarPkg(tarPath string, opts *opt.CompileOptions) (*kcl.KCLResultList, er
 	// e.g.
 	// 'xxx/xxx/xxx/test.tar' will be extracted to the directory 'xxx/xxx/xxx/test'.
 	destDir := strings.TrimSuffix(absTarPath, filepath.Ext(absTarPath))
-	err = utils.UnTarDir(absTarPath, destDir)
+	err = utils.UnTarDirWithSymlinks(absTarPath, destDir, opts.SymlinkPolicy().CheckSymlink)
+	if err != nil {
+		return nil, err
+	}
+	err = checkTarLocalDeps(destDir, absTarPath)
 	if err != nil {
 		return nil, err
 	}
@@ -180,6 +253,7 @@ func RunOciPkg(ociRef, version string, opts *opt.CompileOptions) (*kcl.KCLResult
 		return nil, err
 	}
 	kpmcli.SetNoSumCheck(opts.NoSumCheck())
+	kpmcli.SetUserAgent(opts.UserAgent())
 	ociOpts, err := kpmcli.ParseOciOptionFromString(ociRef, version)
 
 	if err != nil {
@@ -197,9 +271,8 @@ func RunOciPkg(ociRef, version string, opts *opt.CompileOptions) (*kcl.KCLResult
 	localPath := ociOpts.AddStoragePathSuffix(tmpDir)
 
 	// 2. Pull the tar.
-	err = oci.Pull(localPath, ociOpts.Reg, ociOpts.Repo, ociOpts.Tag, kpmcli.GetSettings())
-
-	if err != (*reporter.KpmEvent)(nil) {
+	err = kpmcli.PullTarFromOci(localPath, ociOpts)
+	if err != nil {
 		return nil, err
 	}
 
@@ -222,7 +295,11 @@ func RunOciPkg(ociRef, version string, opts *opt.CompileOptions) (*kcl.KCLResult
 	// e.g.
 	// 'xxx/xxx/xxx/test.tar' will be extracted to the directory 'xxx/xxx/xxx/test'.
 	destDir := strings.TrimSuffix(absTarPath, filepath.Ext(absTarPath))
-	err = utils.UnTarDir(absTarPath, destDir)
+	err = utils.UnTarDirWithSymlinks(absTarPath, destDir, opts.SymlinkPolicy().CheckSymlink)
+	if err != nil {
+		return nil, err
+	}
+	err = checkTarLocalDeps(destDir, absTarPath)
 	if err != nil {
 		return nil, err
 	}
@@ -233,6 +310,553 @@ func RunOciPkg(ociRef, version string, opts *opt.CompileOptions) (*kcl.KCLResult
 
 // 'run' will compile the kcl package from the compile options by kpm client.
 func run(kpmcli *client.KpmClient, opts *opt.CompileOptions) (*kcl.KCLResultList, error) {
+	compileResult, err := compilePkg(kpmcli, opts)
+	if err != nil {
+		return nil, formatError(err, opts)
+	}
+	return compileResult, nil
+}
+
+// compilePkg will compile the kcl package from the compile options by kpm client,
+// and finish the documents compiled in the same way as 'compilePkgToResult'.
+// The options which change the documents are rejected, since they can not be applied to the '*kcl.KCLResultList' returned.
+func compilePkg(kpmcli *client.KpmClient, opts *opt.CompileOptions) (*kcl.KCLResultList, error) {
+	err := checkResultListOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	prof := newProfiler(opts.Profile())
+	endLoad := prof.span("load")
+	kclPkg, err := loadPkgToRun(kpmcli, opts)
+	endLoad()
+	if err != nil {
+		return nil, err
+	}
+
+	// Calculate the absolute path of entry file described by '--input'.
+	compiler := runner.NewCompilerWithOpts(opts)
+
+	// Call the kcl compiler.
+	compileResult, err := profiledCompile(kpmcli, kclPkg, prof)(compiler)
+
+	if err != nil {
+		return nil, reporter.NewErrorEvent(reporter.CompileFailed, err, "failed to compile the kcl package")
+	}
+
+	result := &CompileResult{}
+	result.addDocuments(compileResult, "")
+	endFinish := prof.span("finish")
+	_, err = finishResult(result, opts)
+	endFinish()
+	if err != nil {
+		return nil, err
+	}
+
+	err = prof.write()
+	if err != nil {
+		return nil, err
+	}
+	return compileResult, nil
+}
+
+// resultOnlyOptions returns the names of the options set in 'opts' which change the compiled documents
+// or how they are produced, they are only applied to the compile result returned by 'RunWithResult'.
+func resultOnlyOptions(opts *opt.CompileOptions) []string {
+	var names []string
+	if opts.ResultTransform() != nil {
+		names = append(names, "WithResultTransform")
+	}
+	if len(opts.RedactPaths()) != 0 {
+		names = append(names, "WithRedactPaths")
+	}
+	if len(opts.GlobalDefaults()) != 0 {
+		names = append(names, "WithGlobalDefaults")
+	}
+	if len(opts.StableDocumentOrder()) != 0 {
+		names = append(names, "WithStableDocumentOrder")
+	}
+	if len(opts.OutputTemplate()) != 0 {
+		names = append(names, "WithOutputTemplate")
+	}
+	if len(opts.ProvenanceAnnotation()) != 0 {
+		names = append(names, "WithProvenanceAnnotation")
+	}
+	if format := opts.OutputFormat(); format != opt.YAML && format != opt.JSON {
+		names = append(names, "WithOutputFormat")
+	}
+	if opts.OutputEncoding() != nil {
+		names = append(names, "WithOutputEncoding")
+	}
+	if opts.DocumentSeparatorComment() {
+		names = append(names, "WithDocumentSeparatorComment")
+	}
+	if len(opts.IncludeDependencyOutput()) != 0 {
+		names = append(names, "WithIncludeDependencyOutput")
+	}
+	if len(opts.IncrementalCacheDir()) != 0 {
+		names = append(names, "WithIncremental")
+	}
+	return names
+}
+
+// checkResultListOptions will return an error if any option which changes the compiled documents is set in 'opts',
+// instead of returning the unchanged '*kcl.KCLResultList' of the compiler silently.
+func checkResultListOptions(opts *opt.CompileOptions) error {
+	names := resultOnlyOptions(opts)
+	if len(names) == 0 {
+		return nil
+	}
+	return reporter.NewErrorEvent(
+		reporter.UnsupportedFeature,
+		fmt.Errorf("%s can not be applied to the '*kcl.KCLResultList' returned by the compiler", strings.Join(names, ", ")),
+		"compile by 'RunWithResult' to apply the options to the compiled documents",
+	)
+}
+
+// profiledCompile returns the function to compile 'kclPkg' by kpm client,
+// with the spans of resolving the dependencies and compiling the entries recorded by the profiler.
+func profiledCompile(kpmcli *client.KpmClient, kclPkg *pkg.KclPkg, prof *profiler) func(*runner.Compiler) (*kcl.KCLResultList, error) {
+	return func(compiler *runner.Compiler) (*kcl.KCLResultList, error) {
+		endResolve := prof.span("resolve")
+		depsMap, err := kpmcli.ResolveDepsIntoMap(kclPkg)
+		endResolve()
+		if err != nil {
+			return nil, err
+		}
+
+		entries := make([]string, 0, len(compiler.KFilenames()))
+		for _, entry := range compiler.KFilenames() {
+			entries = append(entries, entrySource(kclPkg.HomePath, entry))
+		}
+		defer prof.span("compile", entries...)()
+		return kpmcli.CompileWithDepsMap(depsMap, compiler)
+	}
+}
+
+// RunWithResult will compile the kcl package with the compile options,
+// and return the compile result which keeps the documents produced by each entry.
+func RunWithResult(opts ...opt.Option) (*CompileResult, error) {
+	mergedOpts := opt.DefaultCompileOptions()
+	for _, opt := range opts {
+		opt(mergedOpts)
+	}
+
+	restoreEnvs, err := loadEnvFile(mergedOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer restoreEnvs()
+
+	kpmcli, err := client.NewKpmClient()
+	if err != nil {
+		return nil, err
+	}
+	kpmcli.SetNoSumCheck(mergedOpts.NoSumCheck())
+
+	return runWithResult(kpmcli, mergedOpts)
+}
+
+// 'runWithResult' will compile the kcl package from the compile options by kpm client,
+// and collect the documents of the compile result.
+func runWithResult(kpmcli *client.KpmClient, opts *opt.CompileOptions) (*CompileResult, error) {
+	result, err := compilePkgToResult(kpmcli, opts)
+	if err != nil {
+		return nil, formatError(err, opts)
+	}
+	return result, nil
+}
+
+// compilePkgToResult will compile the kcl package from the compile options by kpm client into the compile result.
+func compilePkgToResult(kpmcli *client.KpmClient, opts *opt.CompileOptions) (*CompileResult, error) {
+	prof := newProfiler(opts.Profile())
+	endLoad := prof.span("load")
+	kclPkg, err := loadPkgToRun(kpmcli, opts)
+	endLoad()
+	if err != nil {
+		return nil, err
+	}
+
+	var result *CompileResult
+	if len(opts.IncrementalCacheDir()) != 0 && len(opts.KFilenameList) != 0 {
+		result, err = compileIncrementally(kpmcli, kclPkg, opts, prof)
+	} else {
+		result, err = compileToResult(opts, profiledCompile(kpmcli, kclPkg, prof))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result.depOrigins = kpmcli.GetDependencyOrigins()
+	if opts.CaptureInput() {
+		result.resolvedInput = newResolvedInput(opts)
+	}
+
+	if len(opts.IncludeDependencyOutput()) != 0 {
+		err = addDependencyOutput(kpmcli, kclPkg, result, opts.IncludeDependencyOutput())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	endFinish := prof.span("finish")
+	result, err = finishResult(result, opts)
+	endFinish()
+	if err != nil {
+		return nil, err
+	}
+	err = prof.write()
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// addDependencyOutput will compile the entries of the dependencies 'depNames' of 'kclPkg',
+// and add their documents after the documents of the root package in the order of 'depNames'.
+// The documents which define the same top-level keys are reported as collisions.
+func addDependencyOutput(kpmcli *client.KpmClient, kclPkg *pkg.KclPkg, result *CompileResult, depNames []string) error {
+	depsMap, err := kpmcli.ResolveDepsIntoMap(kclPkg)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range depNames {
+		depPath, ok := depsMap[name]
+		if !ok {
+			return reporter.NewErrorEvent(
+				reporter.DependencyNotFound,
+				fmt.Errorf("dependency '%s' not found in '%s'", name, kclPkg.ModFile.GetModFilePath()),
+				fmt.Sprintf("failed to include the output of the dependency '%s'", name),
+			)
+		}
+
+		depOpts := opt.DefaultCompileOptions()
+		depOpts.SetPkgPath(depPath)
+		depResult, err := runWithResult(kpmcli, depOpts)
+		if err != nil {
+			return reporter.NewErrorEvent(reporter.CompileFailed, err, fmt.Sprintf("failed to compile the dependency '%s'", name))
+		}
+		for _, doc := range depResult.documents {
+			doc.Source = name
+			result.documents = append(result.documents, doc)
+		}
+	}
+
+	return checkDocumentCollisions(result.documents)
+}
+
+// checkDocumentCollisions will return an error if the top-level keys are defined by more than one document.
+func checkDocumentCollisions(documents []Document) error {
+	owners := make(map[string]int)
+	var collisions []string
+	for i, doc := range documents {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(doc.Json), &fields); err != nil {
+			// The documents which are not objects have no keys to collide.
+			continue
+		}
+		keys := make([]string, 0, len(fields))
+		for key := range fields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if owner, ok := owners[key]; ok {
+				collisions = append(collisions, fmt.Sprintf("'%s' is defined by both %s and %s", key, documentName(documents, owner), documentName(documents, i)))
+				continue
+			}
+			owners[key] = i
+		}
+	}
+
+	if len(collisions) != 0 {
+		return reporter.NewErrorEvent(
+			reporter.InvalidOutput,
+			fmt.Errorf("%s", strings.Join(collisions, "\n")),
+			"the outputs of the root package and the dependencies collide",
+		)
+	}
+	return nil
+}
+
+// documentName returns the name of the document 'i' used in the messages.
+func documentName(documents []Document, i int) string {
+	if len(documents[i].Source) != 0 {
+		return fmt.Sprintf("document %d (%s)", i, documents[i].Source)
+	}
+	return fmt.Sprintf("document %d", i)
+}
+
+// compileToResult will compile the entries in the compile options by 'compile' into the compile result.
+func compileToResult(opts *opt.CompileOptions, compile func(*runner.Compiler) (*kcl.KCLResultList, error)) (*CompileResult, error) {
+	result := &CompileResult{
+		separatorComment: opts.DocumentSeparatorComment(),
+	}
+
+	entries := opts.KFilenameList
+	if !opts.DocumentSeparatorComment() || len(entries) <= 1 {
+		compileResult, err := compile(runner.NewCompilerWithOpts(opts))
+		if err != nil {
+			return nil, reporter.NewErrorEvent(reporter.CompileFailed, err, "failed to compile the kcl package")
+		}
+		var source string
+		if len(entries) == 1 {
+			source = entrySource(opts.PkgPath(), entries[0])
+		}
+		result.addDocuments(compileResult, source)
+		return result, nil
+	}
+
+	// The entries are compiled together for the output, since they may depend on each other.
+	compileResult, err := compile(runner.NewCompilerWithOpts(opts))
+	if err != nil {
+		return nil, reporter.NewErrorEvent(reporter.CompileFailed, err, "failed to compile the kcl package")
+	}
+	combined := &CompileResult{}
+	combined.addDocuments(compileResult, "")
+
+	// Compile each entry separately to find out which documents are produced by the entry.
+	entryResult := &CompileResult{}
+	for i, entry := range entries {
+		compileResult, err := compile(runner.NewCompilerWithOpts(entryCompileOptions(opts, i)))
+		if err != nil {
+			return nil, reporter.NewErrorEvent(
+				reporter.CompileFailed,
+				err,
+				fmt.Sprintf("failed to attribute the documents to the entry '%s', it can not be compiled separately", entry),
+			)
+		}
+		entryResult.addDocuments(compileResult, entrySource(opts.PkgPath(), entry))
+	}
+
+	result.documents, err = attributeDocuments(combined.documents, entryResult.documents)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// attributeDocuments returns the documents compiled from the entries together 'combined',
+// with the sources of the documents compiled from each entry separately 'entryDocs'.
+// The documents are attributed one by one if they are the same, or the only document compiled together
+// is split into the documents of the entries if its top-level fields are partitioned by them.
+// An error is returned if the documents compiled separately do not add up to the documents compiled together.
+func attributeDocuments(combined, entryDocs []Document) ([]Document, error) {
+	if sameDocuments(combined, entryDocs) {
+		docs := make([]Document, 0, len(combined))
+		for i, doc := range combined {
+			doc.Source = entryDocs[i].Source
+			docs = append(docs, doc)
+		}
+		return docs, nil
+	}
+	if len(combined) == 1 && partitionsDocument(combined[0], entryDocs) {
+		return entryDocs, nil
+	}
+	return nil, reporter.NewErrorEvent(
+		reporter.InvalidOutput,
+		fmt.Errorf("the %d documents compiled from the entries separately do not add up to the %d documents compiled from them together", len(entryDocs), len(combined)),
+		"failed to attribute the documents to the entries, compile without the document separator comment",
+	)
+}
+
+// sameDocuments returns whether the documents 'a' and 'b' have the same values in the same order.
+func sameDocuments(a, b []Document) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		aValue, err := decodeDocument(a[i])
+		if err != nil {
+			return false
+		}
+		bValue, err := decodeDocument(b[i])
+		if err != nil || !reflect.DeepEqual(aValue, bValue) {
+			return false
+		}
+	}
+	return true
+}
+
+// partitionsDocument returns whether each top-level field of the document 'doc' is defined by exactly one of the documents 'parts',
+// with the same value, and the documents 'parts' define no other fields.
+func partitionsDocument(doc Document, parts []Document) bool {
+	value, err := decodeDocument(doc)
+	if err != nil {
+		return false
+	}
+	fields, ok := value.(map[string]interface{})
+	if !ok {
+		return false
+	}
+
+	defined := make(map[string]bool, len(fields))
+	for _, part := range parts {
+		partValue, err := decodeDocument(part)
+		if err != nil {
+			return false
+		}
+		partFields, ok := partValue.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for key, partField := range partFields {
+			field, ok := fields[key]
+			if !ok || defined[key] || !reflect.DeepEqual(field, partField) {
+				return false
+			}
+			defined[key] = true
+		}
+	}
+	return len(defined) == len(fields)
+}
+
+// entryCompileOptions returns the compile options to compile the i-th entry in the compile options separately,
+// all the options other than the kcl files and the in-memory sources are kept.
+func entryCompileOptions(opts *opt.CompileOptions, i int) *opt.CompileOptions {
+	entryOpts := opts.Clone()
+	entryOpts.KFilenameList = []string{opts.KFilenameList[i]}
+	// The in-memory sources are paired with the entries by index.
+	if len(opts.KCodeList) == len(opts.KFilenameList) {
+		entryOpts.KCodeList = []string{opts.KCodeList[i]}
+	}
+	return entryOpts
+}
+
+// finishResult will transform the documents of the compile result by the result transform in the compile options,
+// sort them, validate them against the output schema, check they can be transcoded into the output encoding,
+// validate the serialized output, check the number of them, diff them against the diff base,
+// and write them into the split output directory.
+func finishResult(result *CompileResult, opts *opt.CompileOptions) (*CompileResult, error) {
+	err := finishDocuments(result, opts)
+	if err != nil {
+		return nil, err
+	}
+	err = checkMaxDocuments(len(result.documents), opts.MaxDocuments())
+	if err != nil {
+		return nil, err
+	}
+	if len(opts.DiffBase()) != 0 {
+		err = result.diffWithBase(opts.DiffBase())
+		if err != nil {
+			return nil, err
+		}
+		if opts.FailOnDiff() {
+			err = checkDiff(result.diff, opts.DiffBase())
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if dir, nameTemplate := opts.SplitOutput(); len(dir) != 0 {
+		err := result.WriteSplitOutput(dir, nameTemplate)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// finishDocuments will merge the global defaults beneath the documents of the compile result,
+// transform them by the result transform in the compile options,
+// sort them by the stable document order, validate them against the output schema and the contract of the package,
+// wrap them by the output template, check they can be transcoded into the output encoding, validate the serialized output by the output validator,
+// redact the sensitive fields, and check they can be converted into the output format.
+func finishDocuments(result *CompileResult, opts *opt.CompileOptions) error {
+	if len(opts.GlobalDefaults()) != 0 {
+		err := result.mergeGlobalDefaults(opts.GlobalDefaults())
+		if err != nil {
+			return err
+		}
+	}
+	if opts.ResultTransform() != nil {
+		err := result.Transform(opts.ResultTransform())
+		if err != nil {
+			return err
+		}
+	}
+	if len(opts.ProvenanceAnnotation()) != 0 {
+		err := result.annotateProvenance(opts.ProvenanceAnnotation(), opts.PkgPath())
+		if err != nil {
+			return err
+		}
+	}
+	if len(opts.StableDocumentOrder()) != 0 {
+		result.SortDocuments(opts.StableDocumentOrder())
+	}
+	if len(opts.OutputSchema()) != 0 {
+		err := result.ValidateWithSchema(opts.OutputSchema())
+		if err != nil {
+			return err
+		}
+	}
+	if opts.ContractCheck() {
+		err := checkContract(result, opts.PkgPath())
+		if err != nil {
+			return err
+		}
+	}
+	if len(opts.OutputTemplate()) != 0 {
+		err := result.wrapWithTemplate(opts.OutputTemplate())
+		if err != nil {
+			return err
+		}
+	}
+	if opts.OutputEncoding() != nil || opts.OutputValidator() != nil {
+		result.outputEncoding = opts.OutputEncoding()
+		out, err := result.EncodedYamlResult()
+		if err != nil {
+			return err
+		}
+		err = validateOutput(out, opts.OutputValidator())
+		if err != nil {
+			return err
+		}
+	}
+	if len(opts.RedactPaths()) != 0 {
+		err := result.redact(opts.RedactPaths(), opts.UnredactedSink())
+		if err != nil {
+			return err
+		}
+	}
+	return convertResult(result, opts)
+}
+
+// validateOutput will validate the serialized output 'out' by the output validator 'validator' if it is set.
+func validateOutput(out []byte, validator opt.OutputValidator) error {
+	if validator == nil {
+		return nil
+	}
+	if err := validator(out); err != nil {
+		return reporter.NewErrorEvent(reporter.InvalidOutput, err, "the output is rejected by the output validator")
+	}
+	return nil
+}
+
+// checkMaxDocuments will return an error if the number of the compiled documents 'count' exceeds 'max', 0 means no limit.
+func checkMaxDocuments(count, max int) error {
+	if max <= 0 || count <= max {
+		return nil
+	}
+	return reporter.NewErrorEvent(
+		reporter.InvalidOutput,
+		fmt.Errorf("%d documents are compiled, which exceeds the limit %d", count, max),
+		"too many documents are compiled",
+	)
+}
+
+// entrySource returns the entry path relative to the package path if possible.
+func entrySource(pkgPath, entry string) string {
+	if relPath, err := filepath.Rel(pkgPath, entry); err == nil && !strings.HasPrefix(relPath, "..") {
+		return filepath.ToSlash(relPath)
+	}
+	return entry
+}
+
+// 'loadPkgToRun' will load the kcl package to compile from the compile options,
+// and fill the entries of the package into the compile options.
+func loadPkgToRun(kpmcli *client.KpmClient, opts *opt.CompileOptions) (*pkg.KclPkg, error) {
 	pkgPath, err := filepath.Abs(opts.PkgPath())
 	if err != nil {
 		return nil, reporter.NewErrorEvent(reporter.Bug, err, "internal bugs, please contact us to fix it.")
@@ -243,7 +867,11 @@ func run(kpmcli *client.KpmClient, opts *opt.CompileOptions) (*kcl.KCLResultList
 		return nil, err
 	}
 
-	kclPkg.SetVendorMode(opts.IsVendor())
+	kclPkg.SetVendorModeWithOpts(opts.VendorMode())
+	if len(opts.VersionOverride()) != 0 {
+		kclPkg.ModFile.OverrideVersion(opts.VersionOverride())
+		opts.Merge(kcl.WithOptions(fmt.Sprintf("%s=%s", constants.PKG_VERSION_ARG, opts.VersionOverride())))
+	}
 
 	globalPkgPath, err := env.GetAbsPkgPath()
 	if err != nil {
@@ -255,6 +883,14 @@ func run(kpmcli *client.KpmClient, opts *opt.CompileOptions) (*kcl.KCLResultList
 		return nil, err
 	}
 
+	fallbackEntry := ""
+	// The kcl files in the settings files are compiled instead of the fallback entry.
+	if len(opts.Entries()) == 0 && !opts.HasSettingsYaml() {
+		fallbackEntry, err = kclPkg.GetFallbackEntry()
+		if err != nil {
+			return nil, err
+		}
+	}
 	if len(opts.Entries()) > 0 {
 		// add entry from '--input'
 		for _, entry := range opts.Entries() {
@@ -265,25 +901,120 @@ func run(kpmcli *client.KpmClient, opts *opt.CompileOptions) (*kcl.KCLResultList
 			}
 		}
 		// add entry from 'kcl.mod'
+	} else if len(fallbackEntry) != 0 {
+		// add the fallback entry from the 'entry' in 'kcl.mod'
+		opts.Merge(*kclPkg.GetKclOpts())
+		opts.Merge(kcl.WithKFilenames(fallbackEntry))
 	} else if kclPkg.HasProfile() {
 		opts.Merge(*kclPkg.GetKclOpts())
-	} else if !opts.HasSettingsYaml() {
-		// no entry
-		opts.Merge(kcl.WithKFilenames(opts.PkgPath()))
 	}
 	opts.Merge(kcl.WithWorkDir(opts.PkgPath()))
 
-	// Calculate the absolute path of entry file described by '--input'.
-	compiler := runner.NewCompilerWithOpts(opts)
+	kpmcli.SetFailOnLockChange(opts.FailOnLockChange())
+	kpmcli.SetAllowedRegistries(opts.AllowedRegistries())
+	kpmcli.SetWarningsAsErrors(opts.WarningsAsErrors())
+	for primary, mirrors := range opts.RegistryMirrors() {
+		kpmcli.SetRegistryMirrors(primary, mirrors)
+	}
+	kpmcli.SetLogWriter(reporter.NewLocalizedWriter(opts.LogWriter(), opts.Locale()))
+	kpmcli.SetLogLevel(opts.LogLevel())
+	kpmcli.SetCredentialProvider(opts.CredentialProvider())
+	kpmcli.SetFailFast(opts.FailFast())
+	kpmcli.SetPreResolveHook(opts.PreResolveHook())
+	kpmcli.SetAtomicLockWrite(opts.AtomicLockWrite())
+	kpmcli.SetLogDependencyOrigins(opts.LogDependencyOrigins())
+	kpmcli.SetPullThroughCache(opts.PullThroughCache())
+	kpmcli.SetGitCloneDepth(opts.GitCloneDepth())
+	kpmcli.SetNewChecksumHook(opts.NewChecksumHook())
+	kpmcli.SetTargetPlatform(opts.TargetPlatform())
+	kpmcli.SetUserAgent(opts.UserAgent())
+	kpmcli.SetMutableRefTTL(opts.MutableRefTTL())
+	kpmcli.SetDiagnosticHandler(diagnosticHandler(opts))
+	kpmcli.SetExposeDepPaths(opts.ExposeDepPaths())
+	kpmcli.SetModuleProxy(opts.ModuleProxy())
+	kpmcli.SetSymlinkPolicy(opts.SymlinkPolicy())
+	kpmcli.SetOverrideFile(opts.OverrideFile())
+
+	var depsToResolve []string
+	if opts.SkipUnusedDeps() {
+		depsToResolve, err = usedDeps(kclPkg, opts)
+		if err != nil {
+			return nil, reporter.NewErrorEvent(reporter.FailedAccessPkgPath, err, "failed to find the dependencies imported by the entries")
+		}
+	}
+	kpmcli.SetDepsToResolve(depsToResolve)
+
+	err = checkFileAccess(opts)
+	if err != nil {
+		return nil, err
+	}
 
-	kpmcli.SetLogWriter(opts.LogWriter())
+	err = checkCaseSensitivePaths(kclPkg, opts)
+	if err != nil {
+		return nil, err
+	}
 
-	// Call the kcl compiler.
-	compileResult, err := kpmcli.Compile(kclPkg, compiler)
+	err = checkSymlinks(kclPkg, opts)
+	if err != nil {
+		return nil, err
+	}
 
+	err = resolveUnknownImports(kclPkg, opts)
 	if err != nil {
-		return nil, reporter.NewErrorEvent(reporter.CompileFailed, err, "failed to compile the kcl package")
+		return nil, err
 	}
 
-	return compileResult, nil
+	err = checkPlugins(kclPkg, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkDisabledBuiltins(kclPkg, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(opts.OutputTemplate()) != 0 {
+		_, err = parseOutputTemplate(opts.OutputTemplate())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, path := range opts.RedactPaths() {
+		_, err = parseRedactPath(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(opts.DumpArgs()) != 0 {
+		err = dumpArgs(opts.DumpArgs(), opts.Args)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return kclPkg, nil
+}
+
+// dumpArgs will write the resolved top-level arguments into the json file in 'path'.
+// The arguments are merged from the defaults, the settings files and the '-D' arguments,
+// and the later argument with the same name overrides the earlier one as the kcl compiler does.
+// The values are kept as they are passed to the kcl compiler.
+func dumpArgs(path string, args []*gpyrpc.CmdArgSpec) error {
+	resolvedArgs := make(map[string]string, len(args))
+	for _, arg := range args {
+		resolvedArgs[arg.Name] = arg.Value
+	}
+
+	content, err := json.MarshalIndent(resolvedArgs, "", "  ")
+	if err != nil {
+		return reporter.NewErrorEvent(reporter.Bug, err, "internal bug: failed to marshal the arguments into json")
+	}
+	err = os.WriteFile(path, append(content, '\n'), 0644)
+	if err != nil {
+		return reporter.NewErrorEvent(reporter.FailedCreateFile, err, fmt.Sprintf("failed to dump the arguments into '%s'", path))
+	}
+	return nil
 }
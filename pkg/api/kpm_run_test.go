@@ -2,15 +2,27 @@ package api
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 
+	"github.com/fsnotify/fsnotify"
+	"github.com/otiai10/copy"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/encoding/charmap"
 	"kcl-lang.io/kcl-go/pkg/kcl"
+	"kcl-lang.io/kcl-go/pkg/spec/gpyrpc"
+	"kcl-lang.io/kpm/pkg/client"
 	"kcl-lang.io/kpm/pkg/opt"
+	pkg "kcl-lang.io/kpm/pkg/package"
+	"kcl-lang.io/kpm/pkg/reporter"
 	"kcl-lang.io/kpm/pkg/utils"
 )
 
@@ -65,6 +77,35 @@ func TestRunPkgInPathInvalidPath(t *testing.T) {
 	assert.Equal(t, result, "")
 }
 
+func TestRunPkgInPathWithErrorFormatter(t *testing.T) {
+	pkgPath := getTestDir("test_run_pkg_in_path")
+	opts := opt.DefaultCompileOptions()
+	opts.AddEntry(filepath.Join(pkgPath, "test_kcl", "not_exist.k"))
+	opts.SetPkgPath(filepath.Join(pkgPath, "test_kcl"))
+	opt.WithErrorFormatter(reporter.JsonErrorFormatter)(opts)
+	_, err := RunPkgInPath(opts)
+	assert.NotEqual(t, err, nil)
+	assert.Equal(t, err.Error(), fmt.Sprintf(`[{"kind":"compile","message":"failed to compile the kcl package","detail":"Cannot find the kcl file, please check the file path %s"}]`, filepath.Join(pkgPath, "test_kcl", "not_exist.k")))
+	assert.Equal(t, reporter.GetErrorKind(err), reporter.KindCompile)
+}
+
+func TestRunPkgInPathWithDiagnosticHandler(t *testing.T) {
+	pkgPath := getTestDir("test_run_pkg_in_path")
+	opts := opt.DefaultCompileOptions()
+	opts.AddEntry(filepath.Join(pkgPath, "test_kcl", "not_exist.k"))
+	opts.SetPkgPath(filepath.Join(pkgPath, "test_kcl"))
+	var diagnostics []reporter.Diagnostic
+	opt.WithDiagnosticHandler(func(diagnostic reporter.Diagnostic) {
+		diagnostics = append(diagnostics, diagnostic)
+	})(opts)
+	_, err := RunPkgInPath(opts)
+	assert.NotEqual(t, err, nil)
+	assert.Equal(t, len(diagnostics), 1)
+	assert.Equal(t, diagnostics[0].Severity, reporter.SeverityError)
+	assert.Equal(t, diagnostics[0].Message, "failed to compile the kcl package")
+	assert.Equal(t, diagnostics, reporter.NewDiagnostics(err))
+}
+
 func TestRunPkgInPathInvalidPkg(t *testing.T) {
 	pkgPath := getTestDir("test_run_pkg_in_path")
 	opts := opt.DefaultCompileOptions()
@@ -244,3 +285,1400 @@ func TestRunWithOptsWithNoLog(t *testing.T) {
 
 	assert.Equal(t, buf.String(), "")
 }
+
+func TestRunWithOptsAndResultOnlyOptions(t *testing.T) {
+	pkgPath := getTestDir("test_run_with_separator_comment")
+
+	defer func() {
+		_ = os.Remove(filepath.Join(pkgPath, "kcl.mod.lock"))
+	}()
+
+	testCases := []struct {
+		name   string
+		option opt.Option
+	}{
+		{"WithResultTransform", opt.WithResultTransform(func(doc map[string]interface{}) (map[string]interface{}, error) { return doc, nil })},
+		{"WithRedactPaths", opt.WithRedactPaths([]string{"$.a"})},
+		{"WithGlobalDefaults", opt.WithGlobalDefaults(filepath.Join(pkgPath, "kcl.mod"))},
+		{"WithStableDocumentOrder", opt.WithStableDocumentOrder("kind")},
+		{"WithOutputTemplate", opt.WithOutputTemplate("{{ .Output }}")},
+		{"WithProvenanceAnnotation", opt.WithProvenanceAnnotation("kcl-lang.io/provenance")},
+		{"WithOutputFormat", opt.WithOutputFormat(opt.CUE)},
+		{"WithOutputFormat", func(opts *opt.CompileOptions) {
+			opt.WithSerializer("lines", func(docs []interface{}) ([]byte, error) { return []byte(fmt.Sprint(docs...)), nil })(opts)
+			opt.WithOutputFormat("lines")(opts)
+		}},
+		{"WithOutputEncoding", opt.WithOutputEncoding(charmap.ISO8859_1)},
+		{"WithDocumentSeparatorComment", opt.WithDocumentSeparatorComment(true)},
+		{"WithIncludeDependencyOutput", opt.WithIncludeDependencyOutput([]string{"dep_pkg"})},
+		{"WithIncremental", opt.WithIncremental(t.TempDir())},
+	}
+	for _, tc := range testCases {
+		_, err := RunWithOpts(
+			opt.WithLogWriter(nil),
+			opt.WithEntries([]string{"a.k", "b.k"}),
+			opt.WithKclOption(kcl.WithWorkDir(pkgPath)),
+			tc.option,
+		)
+		assert.NotEqual(t, err, nil)
+		assert.Equal(t, reporter.GetErrorKind(err), reporter.KindCompile)
+		assert.Contains(t, err.Error(), fmt.Sprintf("%s can not be applied to the '*kcl.KCLResultList'", tc.name))
+	}
+}
+
+func TestRunWithOptsAndSplitOutput(t *testing.T) {
+	pkgPath := getTestDir("test_run_with_separator_comment")
+
+	defer func() {
+		_ = os.Remove(filepath.Join(pkgPath, "kcl.mod.lock"))
+	}()
+
+	dir := t.TempDir()
+	_, err := RunWithOpts(
+		opt.WithLogWriter(nil),
+		opt.WithEntries([]string{"a.k", "b.k"}),
+		opt.WithKclOption(kcl.WithWorkDir(pkgPath)),
+		opt.WithSplitOutput(dir, "{.a}{.b}"),
+	)
+	assert.Equal(t, err, nil)
+	content, err := os.ReadFile(filepath.Join(dir, "ab.yaml"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, string(content), "a: a\nb: b\n")
+}
+
+func TestRunWithOptsAndFailOnDiff(t *testing.T) {
+	pkgPath := getTestDir("test_run_with_separator_comment")
+
+	defer func() {
+		_ = os.Remove(filepath.Join(pkgPath, "kcl.mod.lock"))
+	}()
+
+	basePath := filepath.Join(t.TempDir(), "base.yaml")
+	assert.Equal(t, os.WriteFile(basePath, []byte("a: a\nb: c\n"), 0644), nil)
+	_, err := RunWithOpts(
+		opt.WithLogWriter(nil),
+		opt.WithEntries([]string{"a.k", "b.k"}),
+		opt.WithKclOption(kcl.WithWorkDir(pkgPath)),
+		opt.WithDiffBase(basePath),
+		opt.WithFailOnDiff(true),
+	)
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "the compile result drifts from the diff base")
+	assert.Contains(t, err.Error(), "document 0: ~ b: c -> b")
+}
+
+func TestRunWithDocumentSeparatorComment(t *testing.T) {
+	pkgPath := getTestDir("test_run_with_separator_comment")
+
+	defer func() {
+		_ = os.Remove(filepath.Join(pkgPath, "kcl.mod.lock"))
+	}()
+
+	result, err := RunWithResult(
+		opt.WithLogWriter(nil),
+		opt.WithEntries([]string{"a.k", "b.k"}),
+		opt.WithKclOption(kcl.WithWorkDir(pkgPath)),
+		opt.WithDocumentSeparatorComment(true),
+	)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, result.GetRawYamlResult(), "# source: a.k\n---\na: a\n# source: b.k\n---\nb: b\n")
+	assert.Equal(t, result.GetYamlDocuments(), []string{"a: a\n", "b: b\n"})
+}
+
+func TestRunWithDocumentSeparatorCommentAndDependentEntries(t *testing.T) {
+	pkgPath := getTestDir("test_run_with_dependent_entries")
+
+	defer func() {
+		_ = os.Remove(filepath.Join(pkgPath, "kcl.mod.lock"))
+	}()
+
+	result, err := RunWithResult(
+		opt.WithLogWriter(nil),
+		opt.WithEntries([]string{"base.k", "main.k"}),
+		opt.WithKclOption(kcl.WithWorkDir(pkgPath)),
+	)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, result.GetYamlDocuments(), []string{"base: base\nmain: base-main\n"})
+
+	// 'main.k' can not be compiled without 'base.k', so its documents can not be attributed.
+	_, err = RunWithResult(
+		opt.WithLogWriter(nil),
+		opt.WithEntries([]string{"base.k", "main.k"}),
+		opt.WithKclOption(kcl.WithWorkDir(pkgPath)),
+		opt.WithDocumentSeparatorComment(true),
+	)
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "failed to attribute the documents to the entry 'main.k', it can not be compiled separately")
+}
+
+func TestAttributeDocuments(t *testing.T) {
+	combined := []Document{{Json: `{"a": "a", "b": "b"}`}}
+	entryDocs := []Document{{Source: "a.k", Json: `{"a": "a"}`}, {Source: "b.k", Json: `{"b": "b"}`}}
+	docs, err := attributeDocuments(combined, entryDocs)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, docs, entryDocs)
+
+	combined = []Document{{Yaml: "a: a\n", Json: `{"a": "a"}`}, {Yaml: "b: b\n", Json: `{"b": "b"}`}}
+	docs, err = attributeDocuments(combined, entryDocs)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, docs, []Document{{Source: "a.k", Yaml: "a: a\n", Json: `{"a": "a"}`}, {Source: "b.k", Yaml: "b: b\n", Json: `{"b": "b"}`}})
+
+	// The value of 'b' compiled together differs from the one compiled separately.
+	combined = []Document{{Json: `{"a": "a", "b": "ab"}`}}
+	_, err = attributeDocuments(combined, entryDocs)
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "the 2 documents compiled from the entries separately do not add up to the 1 documents compiled from them together")
+
+	// The field 'c' is not defined by any entry compiled separately.
+	combined = []Document{{Json: `{"a": "a", "b": "b", "c": "c"}`}}
+	_, err = attributeDocuments(combined, entryDocs)
+	assert.NotEqual(t, err, nil)
+}
+
+func TestRunPkgStream(t *testing.T) {
+	pkgPath := getTestDir("test_run_with_separator_comment")
+
+	defer func() {
+		_ = os.Remove(filepath.Join(pkgPath, "kcl.mod.lock"))
+	}()
+
+	opts := opt.DefaultCompileOptions()
+	opt.WithLogWriter(nil)(opts)
+	opt.WithEntries([]string{"a.k", "b.k"})(opts)
+	opt.WithKclOption(kcl.WithWorkDir(pkgPath))(opts)
+	docs, errs := RunPkgStream(opts)
+	var streamed []Document
+	for doc := range docs {
+		streamed = append(streamed, doc)
+	}
+	assert.Equal(t, <-errs, nil)
+	assert.Equal(t, streamed, []Document{
+		{Source: "a.k", Yaml: "a: a\n", Json: "{\n    \"a\": \"a\"\n}"},
+		{Source: "b.k", Yaml: "b: b\n", Json: "{\n    \"b\": \"b\"\n}"},
+	})
+
+	opts = opt.DefaultCompileOptions()
+	opt.WithLogWriter(nil)(opts)
+	opt.WithEntries([]string{"a.k", "b.k"})(opts)
+	opt.WithKclOption(kcl.WithWorkDir(pkgPath))(opts)
+	opt.WithMaxDocuments(1)(opts)
+	docs, errs = RunPkgStream(opts)
+	streamed = nil
+	for doc := range docs {
+		streamed = append(streamed, doc)
+	}
+	err := <-errs
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "too many documents are compiled")
+	assert.Equal(t, len(streamed), 1)
+}
+
+func TestRunWithCaptureInput(t *testing.T) {
+	pkgPath := getTestDir("test_run_with_separator_comment")
+
+	defer func() {
+		_ = os.Remove(filepath.Join(pkgPath, "kcl.mod.lock"))
+	}()
+
+	result, err := RunWithResult(
+		opt.WithLogWriter(nil),
+		opt.WithEntries([]string{"a.k"}),
+		opt.WithKclOption(kcl.WithWorkDir(pkgPath)),
+		opt.WithKclOption(kcl.WithOptions("env=dev", "replicas=1", "env=prod")),
+		opt.WithKclOption(kcl.WithOverrides("a=b")),
+		opt.WithCaptureInput(true),
+	)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, result.ResolvedInput(), &ResolvedInput{
+		Args:      map[string]string{"env": "prod", "replicas": "1"},
+		Overrides: []string{"a=b"},
+	})
+
+	result, err = RunWithResult(
+		opt.WithLogWriter(nil),
+		opt.WithEntries([]string{"a.k"}),
+		opt.WithKclOption(kcl.WithWorkDir(pkgPath)),
+	)
+	assert.Equal(t, err, nil)
+	assert.Nil(t, result.ResolvedInput())
+}
+
+func TestRunEntries(t *testing.T) {
+	pkgPath := getTestDir("test_run_with_separator_comment")
+
+	defer func() {
+		_ = os.Remove(filepath.Join(pkgPath, "kcl.mod.lock"))
+	}()
+
+	opts := opt.DefaultCompileOptions()
+	opt.WithLogWriter(nil)(opts)
+	results, err := RunEntries(pkgPath, []string{"a.k", "b.k"}, opts)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(results), 2)
+	assert.Equal(t, results["a.k"].Documents(), []Document{{Source: "a.k", Yaml: "a: a\n", Json: "{\n    \"a\": \"a\"\n}"}})
+	assert.Equal(t, results["b.k"].Documents(), []Document{{Source: "b.k", Yaml: "b: b\n", Json: "{\n    \"b\": \"b\"\n}"}})
+
+	opts = opt.DefaultCompileOptions()
+	opt.WithLogWriter(nil)(opts)
+	opt.WithEntryConcurrency(2)(opts)
+	concurrentResults, err := RunEntries(pkgPath, []string{"a.k", "b.k"}, opts)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(concurrentResults), 2)
+	assert.Equal(t, concurrentResults["a.k"].Documents(), results["a.k"].Documents())
+	assert.Equal(t, concurrentResults["b.k"].Documents(), results["b.k"].Documents())
+
+	results, err = RunEntries(pkgPath, nil, nil)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(results), 0)
+}
+
+func TestRunEntriesWithImportAlias(t *testing.T) {
+	pkgPath := filepath.Join(getTestDir("test_import_alias"), "kcl_pkg")
+
+	defer func() {
+		_ = os.Remove(filepath.Join(pkgPath, "kcl.mod.lock"))
+	}()
+
+	opts := opt.DefaultCompileOptions()
+	opt.WithLogWriter(nil)(opts)
+	opt.WithImportAlias("aliased_pkg", "dep_pkg")(opts)
+	results, err := RunEntries(pkgPath, []string{"main.k"}, opts)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, results["main.k"].Documents(), []Document{{Source: "main.k", Yaml: "a: dep\n", Json: "{\n    \"a\": \"dep\"\n}"}})
+}
+
+func TestRunEntriesWithRandSeed(t *testing.T) {
+	pkgPath := getTestDir("test_run_with_separator_comment")
+
+	defer func() {
+		_ = os.Remove(filepath.Join(pkgPath, "kcl.mod.lock"))
+	}()
+
+	opts := opt.DefaultCompileOptions()
+	opt.WithLogWriter(nil)(opts)
+	opt.WithRandSeed(1)(opts)
+	_, err := RunEntries(pkgPath, []string{"a.k", "b.k"}, opts)
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "failed to compile the entry 'a.k'")
+	assert.Contains(t, err.Error(), "seeding the random number generator with 1 is not supported by the kcl compiler")
+}
+
+func TestRunEntriesWithEntryWorkDir(t *testing.T) {
+	pkgPath := getTestDir("test_entry_work_dir")
+
+	defer func() {
+		_ = os.Remove(filepath.Join(pkgPath, "kcl.mod.lock"))
+	}()
+
+	// The entries read 'data.txt' in the package path without their own working directories.
+	opts := opt.DefaultCompileOptions()
+	opt.WithLogWriter(nil)(opts)
+	results, err := RunEntries(pkgPath, []string{"dev.k", "prod.k"}, opts)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, results["dev.k"].GetYamlDocuments(), []string{"data: root\n"})
+	assert.Equal(t, results["prod.k"].GetYamlDocuments(), []string{"data: root\n"})
+
+	opts = opt.DefaultCompileOptions()
+	opt.WithLogWriter(nil)(opts)
+	opt.WithEntryWorkDir("dev.k", "dev")(opts)
+	opt.WithEntryWorkDir("prod.k", filepath.Join(pkgPath, "prod"))(opts)
+	results, err = RunEntries(pkgPath, []string{"dev.k", "prod.k"}, opts)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, results["dev.k"].GetYamlDocuments(), []string{"data: dev\n"})
+	assert.Equal(t, results["prod.k"].GetYamlDocuments(), []string{"data: prod\n"})
+}
+
+func TestEntryWorkDir(t *testing.T) {
+	pkgPath := getTestDir("test_work_dir")
+	opts := opt.DefaultCompileOptions()
+	opts.SetPkgPath(pkgPath)
+	opts.Merge(kcl.WithWorkDir(pkgPath))
+	opt.WithEntryWorkDir("dev/main.k", "dev")(opts)
+	opt.WithEntryWorkDir("base/base.k", filepath.Join(pkgPath, "base"))(opts)
+
+	assert.Equal(t, entryWorkDir(opts, "dev/main.k"), filepath.Join(pkgPath, "dev"))
+	assert.Equal(t, entryWorkDir(opts, "base/base.k"), filepath.Join(pkgPath, "base"))
+	assert.Equal(t, entryWorkDir(opts, "main.k"), pkgPath)
+}
+
+func TestRunWithImportAlias(t *testing.T) {
+	pkgPath := filepath.Join(getTestDir("test_import_alias"), "kcl_pkg")
+
+	defer func() {
+		_ = os.Remove(filepath.Join(pkgPath, "kcl.mod.lock"))
+	}()
+
+	result, err := RunWithOpts(
+		opt.WithLogWriter(nil),
+		opt.WithKclOption(kcl.WithWorkDir(pkgPath)),
+		opt.WithImportAlias("aliased_pkg", "dep_pkg"),
+	)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, utils.RmNewline(result.GetRawYamlResult()), "a: dep")
+
+	_, err = RunWithOpts(
+		opt.WithLogWriter(nil),
+		opt.WithKclOption(kcl.WithWorkDir(pkgPath)),
+		opt.WithImportAlias("dep_pkg", "dep_pkg"),
+	)
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "the import alias 'dep_pkg' shadows the dependency 'dep_pkg'")
+}
+
+func TestRunWithExposeDepPaths(t *testing.T) {
+	testDir := getTestDir("test_expose_dep_paths")
+	pkgPath := filepath.Join(testDir, "kcl_pkg")
+
+	defer func() {
+		_ = os.Remove(filepath.Join(pkgPath, "kcl.mod.lock"))
+	}()
+
+	result, err := RunWithOpts(
+		opt.WithLogWriter(nil),
+		opt.WithKclOption(kcl.WithWorkDir(pkgPath)),
+		opt.WithExposeDepPaths(true),
+	)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, result.GetRawYamlResult(), fmt.Sprintf("name: dep\ndep_path: %s\n", filepath.Join(testDir, "dep_pkg")))
+
+	result, err = RunWithOpts(
+		opt.WithLogWriter(nil),
+		opt.WithKclOption(kcl.WithWorkDir(pkgPath)),
+	)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, result.GetRawYamlResult(), "name: dep\ndep_path: null\n")
+}
+
+func TestCompileResultAsStructpb(t *testing.T) {
+	result := &CompileResult{
+		documents: []Document{
+			{Json: `{"small": 1, "big": 9007199254740993, "float": 1.5, "list": [true, null, "a"], "nested": {"huge": 123456789012345678901234567890}}`},
+			{Json: `{"name": "b"}`},
+		},
+	}
+
+	structs, err := result.AsStructpb()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(structs), 2)
+
+	fields := structs[0].GetFields()
+	assert.Equal(t, fields["small"].GetNumberValue(), float64(1))
+	assert.Equal(t, fields["big"].GetStringValue(), "9007199254740993")
+	assert.Equal(t, fields["float"].GetNumberValue(), 1.5)
+	assert.Equal(t, fields["list"].GetListValue().GetValues()[0].GetBoolValue(), true)
+	assert.Equal(t, fields["nested"].GetStructValue().GetFields()["huge"].GetStringValue(), "123456789012345678901234567890")
+	assert.Equal(t, structs[1].GetFields()["name"].GetStringValue(), "b")
+}
+
+func TestRunWithOutputSchema(t *testing.T) {
+	pkgPath := getTestDir("test_run_with_output_schema")
+
+	defer func() {
+		_ = os.Remove(filepath.Join(pkgPath, "kcl.mod.lock"))
+	}()
+
+	_, err := RunWithOpts(
+		opt.WithLogWriter(nil),
+		opt.WithKclOption(kcl.WithWorkDir(pkgPath)),
+		opt.WithOutputSchema(filepath.Join(pkgPath, "schema.json")),
+	)
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "document 0: $.replicas: value 0 is less than the minimum 1")
+}
+
+func TestCompileResultValidateWithSchema(t *testing.T) {
+	schemaPath := filepath.Join(getTestDir("test_run_with_output_schema"), "schema.json")
+	result := &CompileResult{
+		documents: []Document{
+			{Source: "a.k", Json: `{"name": "a", "replicas": 1}`},
+			{Source: "b.k", Json: `{"replicas": "1"}`},
+		},
+	}
+
+	err := result.ValidateWithSchema(schemaPath)
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "document 1 (b.k): $: missing required property 'name'\ndocument 1 (b.k): $.replicas: expected integer, but got string")
+}
+
+func TestWatch(t *testing.T) {
+	pkgPath := filepath.Join(t.TempDir(), "test_watch")
+	err := copy.Copy(getTestDir("test_watch"), pkgPath)
+	assert.Equal(t, err, nil)
+
+	results := make(chan string, 8)
+	stop, err := Watch(pkgPath, opt.DefaultCompileOptions(), func(result *CompileResult, err error) {
+		if err != nil {
+			results <- err.Error()
+			return
+		}
+		results <- result.GetRawYamlResult()
+	})
+	assert.Equal(t, err, nil)
+	defer stop()
+
+	nextResult := func() string {
+		select {
+		case res := <-results:
+			return res
+		case <-time.After(10 * time.Second):
+			t.Fatal("timeout waiting for the compile result")
+			return ""
+		}
+	}
+	assert.Equal(t, nextResult(), "a: 1\n")
+
+	err = os.WriteFile(filepath.Join(pkgPath, "main.k"), []byte("a = 2\n"), 0644)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, nextResult(), "a: 2\n")
+}
+
+func TestWatcherChanged(t *testing.T) {
+	pkgPath := t.TempDir()
+	opts := opt.DefaultCompileOptions()
+	opts.SetPkgPath(pkgPath)
+	fsWatcher, err := fsnotify.NewWatcher()
+	assert.Equal(t, err, nil)
+	defer fsWatcher.Close()
+	w := &watcher{
+		opts:      opts,
+		fsWatcher: fsWatcher,
+		entries:   map[string]bool{"/abs/entry.k": true},
+	}
+
+	assert.Equal(t, w.changed(fsnotify.Event{Name: filepath.Join(pkgPath, "kcl.mod"), Op: fsnotify.Write}), true)
+	assert.Equal(t, w.changed(fsnotify.Event{Name: filepath.Join(pkgPath, "main.k"), Op: fsnotify.Write}), true)
+	assert.Equal(t, w.changed(fsnotify.Event{Name: filepath.Join(pkgPath, "sub", "a.k"), Op: fsnotify.Remove}), true)
+	assert.Equal(t, w.changed(fsnotify.Event{Name: "/abs/entry.k", Op: fsnotify.Rename}), true)
+	assert.Equal(t, w.changed(fsnotify.Event{Name: filepath.Join(pkgPath, "main.k"), Op: fsnotify.Chmod}), false)
+	assert.Equal(t, w.changed(fsnotify.Event{Name: filepath.Join(pkgPath, "README.md"), Op: fsnotify.Write}), false)
+	assert.Equal(t, w.changed(fsnotify.Event{Name: filepath.Join(pkgPath, "vendor", "dep", "a.k"), Op: fsnotify.Write}), false)
+	assert.Equal(t, w.changed(fsnotify.Event{Name: filepath.Join(pkgPath, ".git", "a.k"), Op: fsnotify.Write}), false)
+	assert.Equal(t, w.changed(fsnotify.Event{Name: "/abs/other.k", Op: fsnotify.Write}), false)
+
+	// The directory created in the package is watched.
+	subDir := filepath.Join(pkgPath, "sub")
+	assert.Equal(t, os.Mkdir(subDir, 0755), nil)
+	assert.Equal(t, w.changed(fsnotify.Event{Name: subDir, Op: fsnotify.Create}), true)
+	assert.Contains(t, fsWatcher.WatchList(), subDir)
+
+	vendorDir := filepath.Join(pkgPath, "vendor")
+	assert.Equal(t, os.Mkdir(vendorDir, 0755), nil)
+	assert.Equal(t, w.changed(fsnotify.Event{Name: vendorDir, Op: fsnotify.Create}), false)
+	assert.NotContains(t, fsWatcher.WatchList(), vendorDir)
+}
+
+func TestRunWithIncludeDependencyOutput(t *testing.T) {
+	testDir := filepath.Join(t.TempDir(), "test_include_dependency_output")
+	err := copy.Copy(getTestDir("test_include_dependency_output"), testDir)
+	assert.Equal(t, err, nil)
+
+	result, err := RunWithResult(
+		opt.WithLogWriter(nil),
+		opt.WithKclOption(kcl.WithWorkDir(filepath.Join(testDir, "kcl_pkg"))),
+		opt.WithIncludeDependencyOutput([]string{"dep_pkg"}),
+	)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, result.GetYamlDocuments(), []string{"a: 1\n", "b: 2\n"})
+	assert.Equal(t, result.Documents()[1].Source, "dep_pkg")
+
+	_, err = RunWithResult(
+		opt.WithLogWriter(nil),
+		opt.WithKclOption(kcl.WithWorkDir(filepath.Join(testDir, "kcl_pkg"))),
+		opt.WithIncludeDependencyOutput([]string{"not_exist"}),
+	)
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "dependency 'not_exist' not found")
+}
+
+func TestCheckDocumentCollisions(t *testing.T) {
+	err := checkDocumentCollisions([]Document{
+		{Json: `{"a": 1}`},
+		{Source: "dep_pkg", Json: `{"b": 2}`},
+	})
+	assert.Equal(t, err, nil)
+
+	err = checkDocumentCollisions([]Document{
+		{Json: `{"a": 1, "b": 1}`},
+		{Source: "dep_pkg", Json: `{"b": 2}`},
+	})
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "'b' is defined by both document 0 and document 1 (dep_pkg)")
+}
+
+func TestDumpArgs(t *testing.T) {
+	dumpPath := filepath.Join(t.TempDir(), "args.json")
+	err := dumpArgs(dumpPath, []*gpyrpc.CmdArgSpec{
+		{Name: "env", Value: "dev"},
+		{Name: "replicas", Value: "1"},
+		{Name: "env", Value: "prod"},
+	})
+	assert.Equal(t, err, nil)
+
+	content, err := os.ReadFile(dumpPath)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, string(content), "{\n  \"env\": \"prod\",\n  \"replicas\": \"1\"\n}\n")
+}
+
+func TestCompileSources(t *testing.T) {
+	modFile := "[package]\nname = \"test_compile_sources\"\nedition = \"0.0.1\"\nversion = \"0.0.1\"\n"
+	opts := opt.DefaultCompileOptions()
+	opts.SetLogWriter(nil)
+
+	result, err := CompileSources(map[string]string{"main.k": "a = 1\n"}, modFile, opts)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, result.GetRawYamlResult(), "a: 1\n")
+
+	// The dependencies resolved for the same 'kcl.mod' are reused.
+	result, err = CompileSources(map[string]string{"main.k": "a = 2\n", "b.k": "b = a + 1\n"}, modFile, opts)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, result.GetRawYamlResult(), "b: 3\na: 2\n")
+
+	_, err = CompileSources(map[string]string{"../main.k": "a = 1\n"}, modFile, opts)
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "invalid source file name '../main.k'")
+}
+
+func TestCheckFileAccess(t *testing.T) {
+	tmpDir := t.TempDir()
+	root := filepath.Join(tmpDir, "root")
+	pkgPath := filepath.Join(root, "pkg")
+	assert.Equal(t, os.MkdirAll(filepath.Join(pkgPath, "sub"), 0755), nil)
+	assert.Equal(t, os.WriteFile(filepath.Join(tmpDir, "secret.k"), []byte("secret = 1\n"), 0644), nil)
+	assert.Equal(t, os.WriteFile(filepath.Join(pkgPath, "base.k"), []byte("base = 1\n"), 0644), nil)
+	assert.Equal(t, os.WriteFile(filepath.Join(pkgPath, "sub", "main.k"), []byte("import ..base\n\na = base.base\n"), 0644), nil)
+
+	newOpts := func() *opt.CompileOptions {
+		opts := opt.DefaultCompileOptions()
+		opts.SetPkgPath(pkgPath)
+		opts.Merge(kcl.WithKFilenames(filepath.Join(pkgPath, "sub", "main.k")), kcl.WithWorkDir(pkgPath))
+		opt.WithFileAccessRoot(root)(opts)
+		return opts
+	}
+	assert.Equal(t, checkFileAccess(newOpts()), nil)
+
+	// Escape by the relative import.
+	assert.Equal(t, os.WriteFile(filepath.Join(pkgPath, "escape.k"), []byte("import ...secret\n"), 0644), nil)
+	err := checkFileAccess(newOpts())
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), fmt.Sprintf("'%s' is out of the file access root", filepath.Join(tmpDir, "secret.k")))
+	assert.Equal(t, os.Remove(filepath.Join(pkgPath, "escape.k")), nil)
+
+	// Escape by the symlink.
+	assert.Equal(t, os.Symlink(tmpDir, filepath.Join(pkgPath, "link")), nil)
+	err = checkFileAccess(newOpts())
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "is out of the file access root")
+	assert.Equal(t, os.Remove(filepath.Join(pkgPath, "link")), nil)
+
+	// The 'file' module is rejected.
+	assert.Equal(t, os.WriteFile(filepath.Join(pkgPath, "read.k"), []byte("import file\n\na = file.read(\"/etc/passwd\")\n"), 0644), nil)
+	err = checkFileAccess(newOpts())
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "imports the 'file' module")
+}
+
+func TestCheckCaseSensitivePaths(t *testing.T) {
+	pkgPath := t.TempDir()
+	assert.Equal(t, os.MkdirAll(filepath.Join(pkgPath, "Sub"), 0755), nil)
+	assert.Equal(t, os.WriteFile(filepath.Join(pkgPath, "kcl.mod"), []byte("[package]\nname = \"test_case\"\nedition = \"0.0.1\"\nversion = \"0.0.1\"\n"), 0644), nil)
+	assert.Equal(t, os.WriteFile(filepath.Join(pkgPath, "base.k"), []byte("base = 1\n"), 0644), nil)
+	assert.Equal(t, os.WriteFile(filepath.Join(pkgPath, "Sub", "main.k"), []byte("import ..base\n\na = base.base\n"), 0644), nil)
+	kclPkg, err := pkg.LoadKclPkg(pkgPath)
+	assert.Equal(t, err, nil)
+
+	newOpts := func(entry string) *opt.CompileOptions {
+		opts := opt.DefaultCompileOptions()
+		opts.SetPkgPath(pkgPath)
+		opts.Merge(kcl.WithKFilenames(filepath.Join(pkgPath, entry)))
+		opt.WithCaseSensitivePaths(true)(opts)
+		return opts
+	}
+	assert.Equal(t, checkCaseSensitivePaths(kclPkg, newOpts("Sub/main.k")), nil)
+
+	// The check is disabled by default.
+	opts := newOpts("sub/main.k")
+	opt.WithCaseSensitivePaths(false)(opts)
+	assert.Equal(t, checkCaseSensitivePaths(kclPkg, opts), nil)
+
+	err = checkCaseSensitivePaths(kclPkg, newOpts("sub/main.k"))
+	assert.NotEqual(t, err, nil)
+	assert.Equal(t, err.(*reporter.KpmEvent).Type(), reporter.PathCaseMismatch)
+	assert.Contains(t, err.Error(), fmt.Sprintf("'%s' is '%s' on the disk", filepath.Join(pkgPath, "sub"), filepath.Join(pkgPath, "Sub")))
+
+	// The module imported in a different case.
+	assert.Equal(t, os.WriteFile(filepath.Join(pkgPath, "Sub", "main.k"), []byte("import ..Base\n\na = Base.base\n"), 0644), nil)
+	err = checkCaseSensitivePaths(kclPkg, newOpts("Sub/main.k"))
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "the case of the module '..Base' imported by")
+	assert.Contains(t, err.Error(), fmt.Sprintf("'%s' is '%s' on the disk", filepath.Join(pkgPath, "Base.k"), filepath.Join(pkgPath, "base.k")))
+}
+
+func TestCheckSymlinks(t *testing.T) {
+	pkgPath := t.TempDir()
+	outside := t.TempDir()
+	assert.Equal(t, os.WriteFile(filepath.Join(pkgPath, "kcl.mod"), []byte("[package]\nname = \"test_symlink\"\nedition = \"0.0.1\"\nversion = \"0.0.1\"\n"), 0644), nil)
+	assert.Equal(t, os.WriteFile(filepath.Join(pkgPath, "base.k"), []byte("base = 1\n"), 0644), nil)
+	assert.Equal(t, os.WriteFile(filepath.Join(outside, "secret.k"), []byte("secret = 1\n"), 0644), nil)
+	assert.Equal(t, os.Symlink("base.k", filepath.Join(pkgPath, "alias.k")), nil)
+	kclPkg, err := pkg.LoadKclPkg(pkgPath)
+	assert.Equal(t, err, nil)
+	newOpts := func(policy opt.SymlinkPolicy) *opt.CompileOptions {
+		opts := opt.DefaultCompileOptions()
+		opts.SetPkgPath(pkgPath)
+		opt.WithSymlinkPolicy(policy)(opts)
+		return opts
+	}
+
+	// The symlinks in the root of the package are followed by default.
+	assert.Equal(t, checkSymlinks(kclPkg, opt.DefaultCompileOptions()), nil)
+	err = checkSymlinks(kclPkg, newOpts(opt.Reject))
+	assert.NotEqual(t, err, nil)
+	assert.Equal(t, err.(*reporter.KpmEvent).Type(), reporter.SymlinkNotAllowed)
+	assert.Contains(t, err.Error(), "'alias.k' is a symlink to 'base.k'")
+
+	// The symlinks escaping the root of the package are rejected unless they are preserved.
+	assert.Equal(t, os.Symlink(filepath.Join(outside, "secret.k"), filepath.Join(pkgPath, "secret.k")), nil)
+	err = checkSymlinks(kclPkg, newOpts(opt.FollowWithinRoot))
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), fmt.Sprintf("'secret.k' is a symlink to '%s' out of the root of the package", filepath.Join(outside, "secret.k")))
+	assert.Equal(t, checkSymlinks(kclPkg, newOpts(opt.Preserve)), nil)
+}
+
+func TestResolveUnknownImports(t *testing.T) {
+	t.Setenv("KCL_PKG_PATH", t.TempDir())
+	pkgPath := t.TempDir()
+	assert.Equal(t, os.WriteFile(filepath.Join(pkgPath, "kcl.mod"), []byte("[package]\nname = \"test_resolver\"\nedition = \"0.0.1\"\nversion = \"0.0.1\"\n"), 0644), nil)
+	assert.Equal(t, os.WriteFile(filepath.Join(pkgPath, "base.k"), []byte("base = 1\n"), 0644), nil)
+	assert.Equal(t, os.WriteFile(filepath.Join(pkgPath, "main.k"), []byte("import json\nimport base\nimport mock.sub\nimport mock\nimport other\n"), 0644), nil)
+	kclPkg, err := pkg.LoadKclPkg(pkgPath)
+	assert.Equal(t, err, nil)
+
+	var consulted []string
+	newOpts := func(resolveErr error) *opt.CompileOptions {
+		opts := opt.DefaultCompileOptions()
+		opts.SetPkgPath(pkgPath)
+		opts.Merge(kcl.WithKFilenames(filepath.Join(pkgPath, "main.k")))
+		opt.WithImportResolver(func(importPath string) (fs.FS, bool, error) {
+			consulted = append(consulted, importPath)
+			if resolveErr != nil {
+				return nil, false, resolveErr
+			}
+			if importPath == "mock.sub" {
+				return fstest.MapFS{"sub.k": {Data: []byte("a = 1\n")}}, true, nil
+			}
+			return nil, false, nil
+		})(opts)
+		return opts
+	}
+
+	// The system modules and the modules of the package are not resolved by the resolver.
+	opts := newOpts(nil)
+	assert.Equal(t, resolveUnknownImports(kclPkg, opts), nil)
+	assert.Equal(t, consulted, []string{"mock.sub", "other"})
+	assert.Equal(t, len(opts.ExternalPkgs), 1)
+	assert.Equal(t, opts.ExternalPkgs[0].PkgName, "mock")
+	content, err := os.ReadFile(filepath.Join(opts.ExternalPkgs[0].PkgPath, "sub.k"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, string(content), "a = 1\n")
+
+	consulted = nil
+	err = resolveUnknownImports(kclPkg, newOpts(fmt.Errorf("rejected")))
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "failed to resolve the import 'mock.sub'")
+	assert.Contains(t, err.Error(), "rejected")
+}
+
+func TestCheckPlugins(t *testing.T) {
+	pluginPath := t.TempDir()
+	assert.Equal(t, os.MkdirAll(filepath.Join(pluginPath, "hello"), 0755), nil)
+	assert.Equal(t, os.WriteFile(filepath.Join(pluginPath, "hello", "plugin.py"), []byte("def say_hello(msg):\n    return msg\n"), 0644), nil)
+	sum, err := utils.HashDir(filepath.Join(pluginPath, "hello"))
+	assert.Equal(t, err, nil)
+
+	newPkg := func(pinned string) *pkg.KclPkg {
+		pkgPath := t.TempDir()
+		mod := fmt.Sprintf("[package]\nname = \"test_plugins\"\nedition = \"0.0.1\"\nversion = \"0.0.1\"\n\n[plugins]\nhello = { version = \"0.0.1\", sum = \"%s\" }\nmissing = { version = \"0.0.1\", sum = \"xxx\" }\n", pinned)
+		assert.Equal(t, os.WriteFile(filepath.Join(pkgPath, "kcl.mod"), []byte(mod), 0644), nil)
+		kclPkg, err := pkg.LoadKclPkg(pkgPath)
+		assert.Equal(t, err, nil)
+		return kclPkg
+	}
+	opts := opt.DefaultCompileOptions()
+	opt.WithPluginPath(pluginPath)(opts)
+
+	// The plugins are not verified without the plugin path, and the plugins not present are not verified.
+	assert.Equal(t, checkPlugins(newPkg("xxx"), opt.DefaultCompileOptions()), nil)
+	assert.Equal(t, checkPlugins(newPkg(sum), opts), nil)
+
+	err = checkPlugins(newPkg("xxx"), opts)
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "the plugin 'hello 0.0.1' does not match the one pinned in kcl.mod")
+	assert.Contains(t, err.Error(), sum)
+}
+
+func TestRunWithSkipUnusedDeps(t *testing.T) {
+	testDir := filepath.Join(t.TempDir(), "test_skip_unused_deps")
+	err := copy.Copy(getTestDir("test_skip_unused_deps"), testDir)
+	assert.Equal(t, err, nil)
+	pkgPath := filepath.Join(testDir, "kcl_pkg")
+
+	newOpts := func(skip bool) *opt.CompileOptions {
+		opts := opt.DefaultCompileOptions()
+		opts.SetPkgPath(pkgPath)
+		opts.SetLogWriter(nil)
+		opts.SetEntries([]string{"main.k"})
+		opt.WithSkipUnusedDeps(skip)(opts)
+		return opts
+	}
+
+	kpmcli, err := client.NewKpmClient()
+	assert.Equal(t, err, nil)
+
+	// The dependency 'unused_pkg' does not exist and fails the resolution.
+	kclPkg, err := loadPkgToRun(kpmcli, newOpts(false))
+	assert.Equal(t, err, nil)
+	_, err = kpmcli.ResolveDepsIntoMap(kclPkg)
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "dependency 'unused_pkg' not found")
+
+	// Only the dependency 'used_pkg' imported by 'main.k' through 'sub' is resolved.
+	kclPkg, err = loadPkgToRun(kpmcli, newOpts(true))
+	assert.Equal(t, err, nil)
+	depsMap, err := kpmcli.ResolveDepsIntoMap(kclPkg)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, depsMap, map[string]string{"used_pkg": filepath.Join(testDir, "used_pkg")})
+}
+
+func TestCompileResultTransform(t *testing.T) {
+	result := &CompileResult{
+		documents: []Document{
+			{Source: "a.k", Json: `{"kind": "Deployment", "metadata": {"name": "a"}, "spec": {"replicas": 2}}`},
+			{Source: "b.k", Json: `{"kind": "Secret"}`},
+			{Source: "c.k", Yaml: "- 1\n", Json: `[1]`},
+		},
+	}
+
+	err := result.Transform(func(doc map[string]interface{}) (map[string]interface{}, error) {
+		if doc["kind"] == "Secret" {
+			return nil, nil
+		}
+		doc["metadata"].(map[string]interface{})["labels"] = map[string]interface{}{"team": "kcl"}
+		return doc, nil
+	})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, result.GetYamlDocuments(), []string{
+		"kind: Deployment\nmetadata:\n  labels:\n    team: kcl\n  name: a\nspec:\n  replicas: 2\n",
+		"- 1\n",
+	})
+	assert.Equal(t, result.Documents()[0].Json, `{"kind":"Deployment","metadata":{"labels":{"team":"kcl"},"name":"a"},"spec":{"replicas":2}}`)
+	assert.Equal(t, result.Documents()[0].Source, "a.k")
+
+	err = result.Transform(func(doc map[string]interface{}) (map[string]interface{}, error) {
+		return nil, fmt.Errorf("invalid document")
+	})
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "failed to transform document 0 (a.k)")
+	assert.Contains(t, err.Error(), "invalid document")
+}
+
+func TestCompileResultWriteSplitOutput(t *testing.T) {
+	result := &CompileResult{
+		documents: []Document{
+			{Yaml: "kind: Deployment\nmetadata:\n  name: nginx\n", Json: `{"kind": "Deployment", "metadata": {"name": "nginx"}}`},
+			{Yaml: "kind: Service\nmetadata:\n  name: nginx\n", Json: `{"kind": "Service", "metadata": {"name": "nginx"}}`},
+		},
+	}
+
+	dir := t.TempDir()
+	err := result.WriteSplitOutput(dir, "{.kind}/{.metadata.name}")
+	assert.Equal(t, err, nil)
+	content, err := os.ReadFile(filepath.Join(dir, "Deployment", "nginx.yaml"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, string(content), "kind: Deployment\nmetadata:\n  name: nginx\n")
+	assert.Equal(t, utils.DirExists(filepath.Join(dir, "Service", "nginx.yaml")), true)
+
+	err = result.WriteSplitOutput(dir, "{.kind}-{.metadata.name}.json")
+	assert.Equal(t, err, nil)
+	content, err = os.ReadFile(filepath.Join(dir, "Service-nginx.json"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, string(content), "{\"kind\": \"Service\", \"metadata\": {\"name\": \"nginx\"}}\n")
+
+	err = result.WriteSplitOutput(dir, "")
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "the file name 'nginx.yaml' is rendered by both document 0 and document 1")
+
+	err = result.WriteSplitOutput(dir, "{.metadata.namespace}")
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "the field '.metadata.namespace' is not a string, number or bool in the document")
+
+	err = result.WriteSplitOutput(dir, "../{.kind}")
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "is out of the directory")
+}
+
+func TestCompileResultSortDocuments(t *testing.T) {
+	result := &CompileResult{
+		documents: []Document{
+			{Source: "a", Json: `{"metadata": {"name": "nginx"}}`},
+			{Source: "b", Json: `{"kind": "Namespace"}`},
+			{Source: "c", Json: `{"metadata": {"name": "apache"}}`},
+			{Source: "d", Json: `[1, 2]`},
+			{Source: "e", Json: `{"metadata": {"name": "apache"}}`},
+			{Source: "f", Json: `{"metadata": {"name": {"first": "x"}}}`},
+		},
+	}
+	result.SortDocuments("metadata.name")
+	sources := make([]string, 0, len(result.documents))
+	for _, doc := range result.Documents() {
+		sources = append(sources, doc.Source)
+	}
+	assert.Equal(t, sources, []string{"c", "e", "a", "b", "d", "f"})
+
+	result = &CompileResult{
+		documents: []Document{
+			{Source: "a", Json: `{"replicas": 10}`},
+			{Source: "b", Json: `{"replicas": 9}`},
+			{Source: "c", Json: `{"replicas": 1.5}`},
+		},
+	}
+	result.SortDocuments("replicas")
+	assert.Equal(t, []string{result.documents[0].Source, result.documents[1].Source, result.documents[2].Source}, []string{"c", "b", "a"})
+}
+
+func TestCompileResultOutputEncoding(t *testing.T) {
+	result := &CompileResult{
+		documents:      []Document{{Yaml: "name: café\n", Json: `{"name": "café"}`}},
+		outputEncoding: charmap.ISO8859_1,
+	}
+	encoded, err := result.EncodedYamlResult()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, encoded, []byte("name: caf\xe9\n"))
+	encoded, err = result.EncodedJsonResult()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, encoded, []byte(`{"name": "caf`+"\xe9"+`"}`))
+
+	result.documents = append(result.documents, Document{Yaml: "name: 東京\n", Json: `{"name": "東京"}`})
+	_, err = result.EncodedYamlResult()
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "the character '東' (U+6771) on line 3 can not be represented in the output encoding")
+
+	result.outputEncoding = nil
+	encoded, err = result.EncodedYamlResult()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, string(encoded), result.GetRawYamlResult())
+}
+
+func TestIncrementalEntryCache(t *testing.T) {
+	pkgPath := filepath.Join(t.TempDir(), "test_incremental")
+	err := copy.Copy(getTestDir("test_incremental"), pkgPath)
+	assert.Equal(t, err, nil)
+	kclPkg, err := pkg.LoadKclPkg(pkgPath)
+	assert.Equal(t, err, nil)
+
+	opts := opt.DefaultCompileOptions()
+	opts.Merge(kcl.WithKFilenames(filepath.Join(pkgPath, "main.k")))
+	hash := func() string {
+		h, err := entryInputsHash(kclPkg, map[string]string{}, entryCompileOptions(opts, 0))
+		assert.Equal(t, err, nil)
+		return h
+	}
+
+	files, err := importedFiles(pkgPath, filepath.Join(pkgPath, "main.k"), map[string]string{})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, files, []string{filepath.Join(pkgPath, "main.k"), filepath.Join(pkgPath, "sub", "sub.k")})
+
+	// The files not imported by the entry do not change the hash.
+	before := hash()
+	assert.Equal(t, os.WriteFile(filepath.Join(pkgPath, "other.k"), []byte("b = 2\n"), 0644), nil)
+	assert.Equal(t, hash(), before)
+
+	// The files imported transitively change the hash.
+	assert.Equal(t, os.WriteFile(filepath.Join(pkgPath, "sub", "sub.k"), []byte("name = \"changed\"\n"), 0644), nil)
+	after := hash()
+	assert.NotEqual(t, after, before)
+
+	// The cached documents are loaded by the entry.
+	cacheDir := t.TempDir()
+	entry := filepath.Join(pkgPath, "main.k")
+	cachePath := entryCachePath(cacheDir, entry)
+	_, ok := loadCachedEntry(cachePath)
+	assert.Equal(t, ok, false)
+	err = storeCachedEntry(cachePath, entry, after, []Document{{Source: "main.k", Yaml: "a: changed\n", Json: `{"a": "changed"}`}})
+	assert.Equal(t, err, nil)
+	cached, ok := loadCachedEntry(cachePath)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, cached.Hash, after)
+	assert.Equal(t, cached.Documents, []cachedDocument{{Yaml: "a: changed\n", Json: `{"a": "changed"}`}})
+}
+
+func TestProfiler(t *testing.T) {
+	// The nil profiler records nothing.
+	var nilProf *profiler
+	nilProf.span("load")()
+	assert.Equal(t, nilProf.write(), nil)
+	assert.Equal(t, newProfiler(""), (*profiler)(nil))
+
+	path := filepath.Join(t.TempDir(), "profile.json")
+	prof := newProfiler(path)
+	prof.span("load")()
+	prof.span("compile", "main.k", "sub/main.k")()
+	assert.Equal(t, prof.write(), nil)
+
+	content, err := os.ReadFile(path)
+	assert.Equal(t, err, nil)
+	var trace struct {
+		TraceEvents []traceEvent `json:"traceEvents"`
+	}
+	assert.Equal(t, json.Unmarshal(content, &trace), nil)
+	assert.Equal(t, len(trace.TraceEvents), 2)
+	assert.Equal(t, trace.TraceEvents[0].Name, "load")
+	assert.Equal(t, trace.TraceEvents[1].Name, "compile")
+	assert.Equal(t, trace.TraceEvents[1].Phase, "X")
+	assert.Equal(t, trace.TraceEvents[1].Args, map[string]string{"entries": "main.k, sub/main.k"})
+}
+
+func TestSplitOciRefTag(t *testing.T) {
+	cases := []struct {
+		ref, ociRef, tag string
+	}{
+		{"oci://ghcr.io/kcl-lang/helloworld:0.1.0", "oci://ghcr.io/kcl-lang/helloworld", "0.1.0"},
+		{"oci://ghcr.io/kcl-lang/helloworld", "oci://ghcr.io/kcl-lang/helloworld", ""},
+		{"oci://localhost:5001/kcl-lang/helloworld", "oci://localhost:5001/kcl-lang/helloworld", ""},
+		{"oci://localhost:5001/kcl-lang/helloworld:0.1.0", "oci://localhost:5001/kcl-lang/helloworld", "0.1.0"},
+		{"helloworld:0.1.0", "helloworld:0.1.0", ""},
+	}
+	for _, c := range cases {
+		ociRef, tag := splitOciRefTag(c.ref)
+		assert.Equal(t, ociRef, c.ociRef)
+		assert.Equal(t, tag, c.tag)
+	}
+}
+
+func TestCheckMaxDocuments(t *testing.T) {
+	assert.Equal(t, checkMaxDocuments(3, 0), nil)
+	assert.Equal(t, checkMaxDocuments(3, 3), nil)
+	err := checkMaxDocuments(4, 3)
+	assert.NotEqual(t, err, nil)
+	assert.Equal(t, reporter.GetErrorKind(err), reporter.KindCompile)
+	assert.Contains(t, err.Error(), "4 documents are compiled, which exceeds the limit 3")
+
+	result := &CompileResult{documents: []Document{{Yaml: "a: 1"}, {Yaml: "b: 2"}}}
+	_, err = finishResult(result, opt.DefaultCompileOptions())
+	assert.Equal(t, err, nil)
+	opts := opt.DefaultCompileOptions()
+	opt.WithMaxDocuments(1)(opts)
+	_, err = finishResult(result, opts)
+	assert.NotEqual(t, err, nil)
+}
+
+func TestFinishResultWithOutputValidator(t *testing.T) {
+	result := &CompileResult{documents: []Document{{Yaml: "a: 1\n"}, {Yaml: "b: 2\n"}}}
+	var validated []byte
+	opts := opt.DefaultCompileOptions()
+	opt.WithOutputValidator(func(out []byte) error {
+		validated = out
+		if bytes.Contains(out, []byte("b: 2")) {
+			return fmt.Errorf("'b' must not be 2")
+		}
+		return nil
+	})(opts)
+
+	_, err := finishResult(result, opts)
+	assert.NotEqual(t, err, nil)
+	assert.Equal(t, reporter.GetErrorKind(err), reporter.KindCompile)
+	assert.Contains(t, err.Error(), "the output is rejected by the output validator")
+	assert.Contains(t, err.Error(), "'b' must not be 2")
+	assert.Equal(t, string(validated), "a: 1\n---\nb: 2\n")
+
+	result = &CompileResult{documents: []Document{{Yaml: "a: 1\n"}}}
+	_, err = finishResult(result, opts)
+	assert.Equal(t, err, nil)
+}
+
+func TestFinishResultWithDiffBase(t *testing.T) {
+	basePath := filepath.Join(t.TempDir(), "base.yaml")
+	base := "name: app\nlabels:\n  env: dev\n  team: a\nports: [80]\n---\nkind: Service\n---\nkind: Removed\n"
+	assert.Equal(t, os.WriteFile(basePath, []byte(base), 0644), nil)
+	newResult := func() *CompileResult {
+		return &CompileResult{documents: []Document{
+			{Source: "main.k", Yaml: "labels:\n  team: a\n  env: prod\nname: app\nports:\n  - 80\n  - 443\n"},
+			{Source: "main.k", Yaml: "kind: Service\n"},
+		}}
+	}
+	opts := opt.DefaultCompileOptions()
+	opt.WithDiffBase(basePath)(opts)
+
+	result, err := finishResult(newResult(), opts)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, result.Diff(), []DocumentDiff{
+		{Index: 0, Source: "main.k", Changes: []FieldChange{
+			{Path: "labels.env", Kind: ChangeModified, Base: "dev", Result: "prod"},
+			{Path: "ports[1]", Kind: ChangeAdded, Result: 443},
+		}},
+		{Index: 2, Changes: []FieldChange{
+			{Kind: ChangeRemoved, Base: map[string]interface{}{"kind": "Removed"}},
+		}},
+	})
+
+	opt.WithFailOnDiff(true)(opts)
+	_, err = finishResult(newResult(), opts)
+	assert.NotEqual(t, err, nil)
+	assert.Equal(t, reporter.GetErrorKind(err), reporter.KindCompile)
+	assert.Contains(t, err.Error(), "the compile result drifts from the diff base")
+	assert.Contains(t, err.Error(), "document 0: ~ labels.env: dev -> prod")
+	assert.Contains(t, err.Error(), "document 2: - <document>: map[kind:Removed]")
+
+	assert.Equal(t, os.WriteFile(basePath, []byte("kind: Service\n"), 0644), nil)
+	result, err = finishResult(&CompileResult{documents: []Document{{Yaml: "kind: Service\n"}}}, opts)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(result.Diff()), 0)
+}
+
+func TestCompileResultOutputFormat(t *testing.T) {
+	result := &CompileResult{documents: []Document{{
+		Json: `{"name": "app", "replicas": 2, "ratio": 1.0, "_hidden": null, "labels": {"app.kubernetes.io/name": "app"}, "ports": [80, 443], "empty": {}, "cmd": "echo ${HOME}"}`,
+	}}}
+
+	cue, err := result.GetCueResult()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, cue, `name: "app"
+replicas: 2
+ratio: 1.0
+"_hidden": null
+labels: {
+	"app.kubernetes.io/name": "app"
+}
+ports: [
+	80,
+	443,
+]
+empty: {}
+cmd: "echo ${HOME}"
+`)
+
+	opts := opt.DefaultCompileOptions()
+	opt.WithOutputFormat(opt.HCL)(opts)
+	_, err = finishResult(result, opts)
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "the key '_hidden' is not a valid identifier of HCL")
+
+	result.documents[0].Json = `{"name": "app", "replicas": 2, "labels": {"app.kubernetes.io/name": "app"}, "ports": [80], "cmd": "echo ${HOME}"}`
+	_, err = finishResult(result, opts)
+	assert.Equal(t, err, nil)
+	hcl, err := result.GetHclResult()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, hcl, `name = "app"
+replicas = 2
+labels = {
+  "app.kubernetes.io/name" = "app"
+}
+ports = [
+  80,
+]
+cmd = "echo $${HOME}"
+`)
+
+	result.documents = append(result.documents, Document{Json: `{"name": "other"}`})
+	_, err = result.GetHclResult()
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "2 documents are compiled, but HCL has no multiple documents")
+	cue, err = result.GetCueResult()
+	assert.Equal(t, err, nil)
+	assert.Contains(t, cue, "[\n\t{\n\t\tname: \"app\"\n")
+}
+
+func TestCompileResultWithSerializer(t *testing.T) {
+	newResult := func() *CompileResult {
+		return &CompileResult{documents: []Document{{Json: `{"name": "app", "replicas": 2}`}, {Json: `{"name": "db", "ratio": 0.5}`}}}
+	}
+	// A line of 'key=value' for each field of the documents.
+	properties := func(docs []interface{}) ([]byte, error) {
+		var sb strings.Builder
+		for i, doc := range docs {
+			fields, ok := doc.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("the document %d is not an object", i)
+			}
+			keys := make([]string, 0, len(fields))
+			for key := range fields {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				sb.WriteString(fmt.Sprintf("%d.%s=%v (%T)\n", i, key, fields[key], fields[key]))
+			}
+		}
+		return []byte(sb.String()), nil
+	}
+
+	opts := opt.DefaultCompileOptions()
+	opt.WithSerializer("properties", properties)(opts)
+	opt.WithOutputFormat("properties")(opts)
+	result, err := finishResult(newResult(), opts)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, string(result.SerializedResult()), "0.name=app (string)\n0.replicas=2 (int64)\n1.name=db (string)\n1.ratio=0.5 (float64)\n")
+	assert.Equal(t, opts.Effective().OutputFormat, "properties")
+
+	// The serializer is not used for the built-in formats.
+	opt.WithOutputFormat(opt.YAML)(opts)
+	result, err = finishResult(newResult(), opts)
+	assert.Equal(t, err, nil)
+	assert.Nil(t, result.SerializedResult())
+
+	result = newResult()
+	result.documents = append(result.documents, Document{Json: `[1, 2]`})
+	opt.WithOutputFormat("properties")(opts)
+	_, err = finishResult(result, opts)
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "failed to serialize the compile result into 'properties'")
+	assert.Contains(t, err.Error(), "the document 2 is not an object")
+
+	opt.WithOutputFormat("toml")(opts)
+	_, err = finishResult(newResult(), opts)
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "no serializer is registered for the output format 'toml'")
+}
+
+func TestFinishResultWithContractCheck(t *testing.T) {
+	pkgPath := t.TempDir()
+	schema, err := os.ReadFile(filepath.Join(getTestDir("test_run_with_output_schema"), "schema.json"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, os.MkdirAll(filepath.Join(pkgPath, "contract"), 0755), nil)
+	assert.Equal(t, os.WriteFile(filepath.Join(pkgPath, "contract", "output.json"), schema, 0644), nil)
+	writeMod := func(contract string) {
+		mod := "[package]\nname = \"test_contract\"\nedition = \"0.0.1\"\nversion = \"0.0.1\"\n" + contract
+		assert.Equal(t, os.WriteFile(filepath.Join(pkgPath, "kcl.mod"), []byte(mod), 0644), nil)
+	}
+	newResult := func() *CompileResult {
+		return &CompileResult{documents: []Document{{Source: "main.k", Json: `{"replicas": 1}`}}}
+	}
+	opts := opt.DefaultCompileOptions()
+	opts.SetPkgPath(pkgPath)
+
+	writeMod("contract = \"contract/output.json\"\n")
+	_, err = finishResult(newResult(), opts)
+	assert.Equal(t, err, nil)
+
+	opt.WithContractCheck(true)(opts)
+	_, err = finishResult(newResult(), opts)
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "document 0 (main.k): $: missing required property 'name'")
+	assert.Contains(t, err.Error(), filepath.Join(pkgPath, "contract", "output.json"))
+
+	// The packages declaring no contract are not validated.
+	writeMod("")
+	_, err = finishResult(newResult(), opts)
+	assert.Equal(t, err, nil)
+}
+
+func TestFinishResultWithOutputTemplate(t *testing.T) {
+	newResult := func() *CompileResult {
+		return &CompileResult{documents: []Document{
+			{Source: "a.k", Yaml: "a: 1\n", Json: `{"a": 1}`},
+			{Source: "b.k", Yaml: "b: b\n", Json: `{"b": "b"}`},
+		}}
+	}
+	newOpts := func(tmpl string) *opt.CompileOptions {
+		opts := opt.DefaultCompileOptions()
+		opt.WithOutputTemplate(tmpl)(opts)
+		return opts
+	}
+
+	configMap := "apiVersion: v1\nkind: ConfigMap\ndata:\n  output.yaml: |\n{{ .Output | indent 4 }}"
+	result, err := finishResult(newResult(), newOpts(configMap))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, result.GetRawYamlResult(), "apiVersion: v1\nkind: ConfigMap\ndata:\n  output.yaml: |\n    a: 1\n    ---\n    b: b\n")
+	assert.Equal(t, result.GetRawJsonResult(), `{"apiVersion":"v1","data":{"output.yaml":"a: 1\n---\nb: b\n"},"kind":"ConfigMap"}`)
+
+	list := "kind: List\nitems:\n{{- range .Documents }}\n  - {{ toJson . }}\n{{- end }}\n"
+	result, err = finishResult(newResult(), newOpts(list))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, result.GetRawJsonResult(), `{"items":[{"a":1},{"b":"b"}],"kind":"List"}`)
+
+	// The template is validated.
+	_, err = parseOutputTemplate("kind: List\n")
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "none of the placeholders '{{ .Output }}' and '{{ .Documents }}' is referenced")
+	_, err = parseOutputTemplate("{{ .Output ")
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "failed to parse the output template")
+	_, err = finishResult(newResult(), newOpts("{{ .Unknown }}{{ .Output }}"))
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "failed to render the output template")
+
+	// A single document must be rendered.
+	_, err = finishResult(newResult(), newOpts("{{ .Output }}"))
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "2 documents are rendered by the output template, but a single document is expected")
+}
+
+func TestFinishResultWithRedactPaths(t *testing.T) {
+	newResult := func() *CompileResult {
+		return &CompileResult{documents: []Document{
+			{Source: "secret.k", Yaml: "kind: Secret\ndata:\n  password: p\n  user: u\n", Json: `{"kind": "Secret", "data": {"password": "p", "user": "u"}}`},
+			{Source: "app.k", Yaml: "containers:\n- env:\n  - value: v\n", Json: `{"containers": [{"env": [{"value": "v"}]}]}`},
+		}}
+	}
+	var sink bytes.Buffer
+	opts := opt.DefaultCompileOptions()
+	opt.WithRedactPaths([]string{"$.data.password", "containers[*].env[0].value", "$['not_exist']"})(opts)
+	opt.WithUnredactedSink(&sink)(opts)
+
+	result, err := finishResult(newResult(), opts)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, result.GetRawYamlResult(), "data:\n  password: '[REDACTED]'\n  user: u\nkind: Secret\n---\ncontainers:\n  - env:\n      - value: '[REDACTED]'\n")
+	assert.Equal(t, result.Documents()[0].Json, `{"data":{"password":"[REDACTED]","user":"u"},"kind":"Secret"}`)
+	assert.Equal(t, sink.String(), newResult().GetRawYamlResult())
+
+	// The documents without the redacted fields are kept as they are.
+	opt.WithRedactPaths([]string{"data.*"})(opts)
+	opt.WithUnredactedSink(nil)(opts)
+	result, err = finishResult(newResult(), opts)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, result.Documents()[0].Yaml, "data:\n  password: '[REDACTED]'\n  user: '[REDACTED]'\nkind: Secret\n")
+	assert.Equal(t, result.Documents()[1], newResult().documents[1])
+
+	for _, path := range []string{"$", "a[x]", "a..b", "a['b"} {
+		_, err = parseRedactPath(path)
+		assert.NotEqual(t, err, nil)
+		assert.Contains(t, err.Error(), fmt.Sprintf("invalid redact path '%s'", path))
+	}
+}
+
+func TestFinishResultWithGlobalDefaults(t *testing.T) {
+	defaultsPath := filepath.Join(t.TempDir(), "defaults.yaml")
+	assert.Equal(t, os.WriteFile(defaultsPath, []byte("metadata:\n  labels:\n    org: kcl\n    team: default\nreplicas: 1\nports: [80]\n"), 0644), nil)
+	newResult := func() *CompileResult {
+		return &CompileResult{documents: []Document{
+			{Source: "a.k", Yaml: "metadata:\n  labels:\n    team: app\nports:\n- 8080\n", Json: `{"metadata": {"labels": {"team": "app"}}, "ports": [8080]}`},
+			{Source: "b.k", Yaml: "- 1\n", Json: `[1]`},
+		}}
+	}
+	opts := opt.DefaultCompileOptions()
+	opt.WithGlobalDefaults(defaultsPath)(opts)
+
+	result, err := finishResult(newResult(), opts)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, result.Documents()[0].Json, `{"metadata":{"labels":{"org":"kcl","team":"app"}},"ports":[8080],"replicas":1}`)
+	assert.Equal(t, result.Documents()[0].Yaml, "metadata:\n  labels:\n    org: kcl\n    team: app\nports:\n  - 8080\nreplicas: 1\n")
+	// The documents which are not objects are kept as they are.
+	assert.Equal(t, result.Documents()[1], newResult().documents[1])
+
+	assert.Equal(t, os.WriteFile(defaultsPath, []byte("- 1\n"), 0644), nil)
+	_, err = finishResult(newResult(), opts)
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "it must be a yaml or json object")
+
+	opt.WithGlobalDefaults(filepath.Join(t.TempDir(), "not_exist.yaml"))(opts)
+	_, err = finishResult(newResult(), opts)
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "failed to read the global defaults")
+}
+
+func TestFinishResultWithProvenanceAnnotation(t *testing.T) {
+	pkgPath := t.TempDir()
+	assert.Equal(t, os.WriteFile(filepath.Join(pkgPath, "kcl.mod"), []byte("[package]\nname = \"kcl_pkg\"\n"), 0644), nil)
+	assert.Equal(t, os.WriteFile(filepath.Join(pkgPath, "main.k"), []byte("a = 1\n"), 0644), nil)
+	newResult := func() *CompileResult {
+		return &CompileResult{documents: []Document{
+			{Source: "main.k", Yaml: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: app\n", Json: `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "app"}}`},
+			{Source: "main.k", Yaml: "a: 1\n", Json: `{"a": 1}`},
+		}}
+	}
+	opts := opt.DefaultCompileOptions()
+	opts.SetPkgPath(pkgPath)
+	opt.WithProvenanceAnnotation("kcl-lang.io/provenance")(opts)
+
+	result, err := finishResult(newResult(), opts)
+	assert.Equal(t, err, nil)
+	hash, err := provenanceHash(pkgPath)
+	assert.Equal(t, err, nil)
+	assert.True(t, strings.HasPrefix(hash, "sha256:"))
+	assert.Equal(t, result.Documents()[0].Json, fmt.Sprintf(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"annotations":{"kcl-lang.io/provenance":"%s"},"name":"app"}}`, hash))
+	// The documents which are not kubernetes-style are kept as they are.
+	assert.Equal(t, result.Documents()[1], newResult().documents[1])
+
+	// The hash changes with the sources and the kcl.mod.lock.
+	assert.Equal(t, os.WriteFile(filepath.Join(pkgPath, "kcl.mod.lock"), []byte("version = 1\n"), 0644), nil)
+	lockedHash, err := provenanceHash(pkgPath)
+	assert.Equal(t, err, nil)
+	assert.NotEqual(t, lockedHash, hash)
+	assert.Equal(t, os.WriteFile(filepath.Join(pkgPath, "main.k"), []byte("a = 2\n"), 0644), nil)
+	changedHash, err := provenanceHash(pkgPath)
+	assert.Equal(t, err, nil)
+	assert.NotEqual(t, changedHash, lockedHash)
+}
+
+func TestCheckDisabledBuiltins(t *testing.T) {
+	pkgPath := t.TempDir()
+	writeFile := func(name, content string) string {
+		path := filepath.Join(pkgPath, name)
+		assert.Equal(t, os.MkdirAll(filepath.Dir(path), 0755), nil)
+		assert.Equal(t, os.WriteFile(path, []byte(content), 0644), nil)
+		return path
+	}
+	writeFile("kcl.mod", "[package]\nname = \"kcl_pkg\"\nedition = \"0.0.1\"\nversion = \"0.0.1\"\n")
+	kclPkg, err := pkg.LoadKclPkg(pkgPath)
+	assert.Equal(t, err, nil)
+
+	check := func(entry string, names ...string) error {
+		opts := opt.DefaultCompileOptions()
+		opts.Merge(kcl.WithKFilenames(entry))
+		opt.WithDisabledBuiltins(names)(opts)
+		return checkDisabledBuiltins(kclPkg, opts)
+	}
+
+	// The uses in the comments and the strings are not checked.
+	safe := writeFile("safe.k", "import file\n# print(file.read('a'))\na = \"print(1)\"\nb = \"\"\"file.read('a')\"\"\"\nprints = 1\n")
+	assert.Equal(t, check(safe, "print", "file.read"), nil)
+
+	unsafe := writeFile("unsafe.k", "import file as f\n\na = f.read(\"secret\")\n")
+	err = check(unsafe, "print", "file.read")
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "the builtin 'file.read' is disabled")
+	assert.Equal(t, reporter.GetErrorKind(err), reporter.KindCompile)
+	assert.Equal(t, reporter.NewDiagnostics(err)[0].Locations, []reporter.Location{{File: unsafe, Line: 3, Column: 5}})
+	assert.Equal(t, check(unsafe, "print"), nil)
+
+	// The interpolations in the strings and the kcl files imported from the package are checked.
+	writeFile("utils/log.k", "a = \"${print('x')}\"\n")
+	main := writeFile("main.k", "import utils.log\n\nb = log.a\n")
+	err = check(main, "print")
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "the builtin 'print' is disabled")
+	assert.Contains(t, err.Error(), filepath.Join(pkgPath, "utils", "log.k")+":1:8")
+
+	err = check(main, "file.read()")
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "invalid disabled builtin")
+}
+
+func TestAssertEquivalent(t *testing.T) {
+	testDir := t.TempDir()
+	writePkg := func(name, main string) string {
+		pkgPath := filepath.Join(testDir, name)
+		assert.Equal(t, os.MkdirAll(pkgPath, 0755), nil)
+		modContent := fmt.Sprintf("[package]\nname = \"%s\"\nedition = \"0.0.1\"\nversion = \"0.0.1\"\n", name)
+		assert.Equal(t, os.WriteFile(filepath.Join(pkgPath, "kcl.mod"), []byte(modContent), 0644), nil)
+		assert.Equal(t, os.WriteFile(filepath.Join(pkgPath, "main.k"), []byte(main), 0644), nil)
+		return pkgPath
+	}
+	oldPkg := writePkg("old_pkg", "env = option(\"env\") or \"dev\"\nreplicas = 3 if env == \"prod\" else 1\n")
+	newPkg := writePkg("new_pkg", "_replicas = {prod = 3}\nenv = option(\"env\") or \"dev\"\nreplicas = _replicas[env] if env in _replicas else 1\n")
+	otherPkg := writePkg("other_pkg", "env = option(\"env\") or \"dev\"\nreplicas = 1\n")
+	inputs := []map[string]string{{}, {"env": "prod"}}
+
+	opts := opt.DefaultCompileOptions()
+	opt.WithLogWriter(nil)(opts)
+	report, err := AssertEquivalent(oldPkg, newPkg, inputs, opts)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(report.Cases), 2)
+	assert.True(t, report.Equivalent())
+	assert.Equal(t, report.String(), "the outputs are equivalent\n")
+
+	report, err = AssertEquivalent(oldPkg, otherPkg, inputs, opts)
+	assert.Equal(t, err, nil)
+	assert.False(t, report.Equivalent())
+	assert.Equal(t, len(report.Cases[0].Diffs), 0)
+	assert.Equal(t, report.String(), "input {env=prod}: document 0: ~ replicas: 3 -> 1\n")
+}
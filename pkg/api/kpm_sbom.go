@@ -0,0 +1,386 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	pkg "kcl-lang.io/kpm/pkg/package"
+	"kcl-lang.io/kpm/pkg/reporter"
+	"kcl-lang.io/kpm/pkg/version"
+)
+
+// SBOMFormat is the format of the software bill of materials generated by 'GenerateSBOM'.
+type SBOMFormat string
+
+const (
+	// SBOMFormatCycloneDX is the CycloneDX 1.4 json format.
+	SBOMFormatCycloneDX SBOMFormat = "cyclonedx"
+	// SBOMFormatSPDX is the SPDX 2.3 json format.
+	SBOMFormatSPDX SBOMFormat = "spdx"
+)
+
+const sbomToolName = "kpm"
+
+// GenerateSBOM will generate the software bill of materials for the kcl package in 'pkgPath'.
+//
+// The dependencies are resolved in the same way as 'kpm run',
+// so the SBOM lists exactly the dependencies that will be compiled,
+// with their versions, sources and checksums.
+func GenerateSBOM(pkgPath string, format SBOMFormat) ([]byte, error) {
+	if format != SBOMFormatCycloneDX && format != SBOMFormatSPDX {
+		return nil, reporter.NewErrorEvent(
+			reporter.UnsupportedSBOMFormat,
+			fmt.Errorf("unsupported sbom format '%s'", format),
+			fmt.Sprintf("only '%s' and '%s' are supported", SBOMFormatCycloneDX, SBOMFormatSPDX),
+		)
+	}
+
+	_, kclPkg, err := loadAndResolvePkg(pkgPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var sbom interface{}
+	if format == SBOMFormatCycloneDX {
+		sbom = newCycloneDXBom(kclPkg)
+	} else {
+		sbom = newSPDXDocument(kclPkg)
+	}
+
+	data, err := json.MarshalIndent(sbom, "", "  ")
+	if err != nil {
+		return nil, reporter.NewErrorEvent(reporter.Bug, err, "internal bug: failed to marshal the sbom into json")
+	}
+	return data, nil
+}
+
+// sortedDeps returns the resolved dependencies of 'kclPkg' sorted by name,
+// the SBOM is expected to be stable for the same kcl.mod.lock.
+func sortedDeps(kclPkg *pkg.KclPkg) []pkg.Dependency {
+	deps := make([]pkg.Dependency, 0, len(kclPkg.Dependencies.Deps))
+	for _, d := range kclPkg.Dependencies.Deps {
+		deps = append(deps, d)
+	}
+	sort.Slice(deps, func(i, j int) bool {
+		return deps[i].Name < deps[j].Name
+	})
+	return deps
+}
+
+// depVersion returns the version of the dependency,
+// local dependencies have no version in kcl.mod, so the version in its own kcl.mod is used.
+func depVersion(kclPkg *pkg.KclPkg, dep *pkg.Dependency) string {
+	if len(dep.Version) == 0 && dep.IsFromLocal() {
+		modFile, err := pkg.LoadModFile(dep.GetLocalFullPath(kclPkg.HomePath))
+		if err == nil {
+			return modFile.Pkg.Version
+		}
+	}
+	return dep.Version
+}
+
+// depsOfDep returns the names of the dependencies declared in the kcl.mod of the dependency 'dep'.
+// If the kcl.mod of the dependency can not be loaded, no dependencies will be returned.
+func depsOfDep(kclPkg *pkg.KclPkg, dep *pkg.Dependency) []string {
+	modFile, err := pkg.LoadModFile(dep.GetLocalFullPath(kclPkg.HomePath))
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for name := range modFile.Dependencies.Deps {
+		if _, ok := kclPkg.Dependencies.Deps[name]; ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sumToHex transforms the base64 checksum in kcl.mod.lock into a hex sha256 digest.
+func sumToHex(sum string) string {
+	raw, err := base64.StdEncoding.DecodeString(sum)
+	if err != nil {
+		return ""
+	}
+	return hex.EncodeToString(raw)
+}
+
+// depPurl returns the package url of the dependency, or an empty string for local dependencies.
+func depPurl(dep *pkg.Dependency) string {
+	if dep.Source.Oci != nil {
+		qualifiers := url.Values{}
+		qualifiers.Set("repository_url", fmt.Sprintf("%s/%s", dep.Source.Oci.Reg, dep.Source.Oci.Repo))
+		if len(dep.Source.Oci.Tag) != 0 {
+			qualifiers.Set("tag", dep.Source.Oci.Tag)
+		}
+		return fmt.Sprintf("pkg:oci/%s?%s", url.PathEscape(dep.Name), qualifiers.Encode())
+	}
+	if dep.Source.Git != nil {
+		qualifiers := url.Values{}
+		qualifiers.Set("vcs_url", fmt.Sprintf("git+%s@%s", dep.Source.Git.Url, dep.Version))
+		purl := fmt.Sprintf("pkg:generic/%s@%s?%s", url.PathEscape(dep.Name), url.PathEscape(dep.Version), qualifiers.Encode())
+		if len(dep.Source.Git.Subdir) != 0 {
+			purl = fmt.Sprintf("%s#%s", purl, filepath.ToSlash(dep.Source.Git.Subdir))
+		}
+		return purl
+	}
+	return ""
+}
+
+// depDownloadLocation returns where the dependency comes from.
+func depDownloadLocation(dep *pkg.Dependency) string {
+	if dep.Source.Oci != nil {
+		return fmt.Sprintf("oci://%s/%s:%s", dep.Source.Oci.Reg, dep.Source.Oci.Repo, dep.Source.Oci.Tag)
+	}
+	if dep.Source.Git != nil {
+		return fmt.Sprintf("git+%s@%s", dep.Source.Git.Url, dep.Version)
+	}
+	if dep.Source.Local != nil {
+		return dep.Source.Local.Path
+	}
+	if dep.Source.LocalRegistry != nil {
+		return dep.Source.LocalRegistry.GetTarPath(dep.Name)
+	}
+	return ""
+}
+
+// The CycloneDX 1.4 json format, only the fields used by kpm are defined.
+type cycloneDXBom struct {
+	BomFormat    string                `json:"bomFormat"`
+	SpecVersion  string                `json:"specVersion"`
+	Version      int                   `json:"version"`
+	Metadata     cycloneDXMetadata     `json:"metadata"`
+	Components   []cycloneDXComponent  `json:"components"`
+	Dependencies []cycloneDXDependency `json:"dependencies"`
+}
+
+type cycloneDXMetadata struct {
+	Timestamp string             `json:"timestamp"`
+	Tools     []cycloneDXTool    `json:"tools"`
+	Component cycloneDXComponent `json:"component"`
+}
+
+type cycloneDXTool struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type cycloneDXComponent struct {
+	BomRef      string                 `json:"bom-ref"`
+	Type        string                 `json:"type"`
+	Name        string                 `json:"name"`
+	Version     string                 `json:"version,omitempty"`
+	Description string                 `json:"description,omitempty"`
+	Purl        string                 `json:"purl,omitempty"`
+	Hashes      []cycloneDXHash        `json:"hashes,omitempty"`
+	ExtRefs     []cycloneDXExternalRef `json:"externalReferences,omitempty"`
+	Properties  []cycloneDXProperty    `json:"properties,omitempty"`
+}
+
+type cycloneDXHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cycloneDXExternalRef struct {
+	Type string `json:"type"`
+	Url  string `json:"url"`
+}
+
+type cycloneDXProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type cycloneDXDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+func newCycloneDXBom(kclPkg *pkg.KclPkg) *cycloneDXBom {
+	root := cycloneDXComponent{
+		BomRef:      kclPkg.GetPkgFullName(),
+		Type:        "library",
+		Name:        kclPkg.GetPkgName(),
+		Version:     kclPkg.GetPkgVersion(),
+		Description: kclPkg.GetPkgDescription(),
+	}
+
+	bom := &cycloneDXBom{
+		BomFormat:   "CycloneDX",
+		SpecVersion: "1.4",
+		Version:     1,
+		Metadata: cycloneDXMetadata{
+			Timestamp: time.Now().UTC().Format(time.RFC3339),
+			Tools:     []cycloneDXTool{{Name: sbomToolName, Version: version.GetVersionInStr()}},
+			Component: root,
+		},
+		Components:   []cycloneDXComponent{},
+		Dependencies: []cycloneDXDependency{},
+	}
+
+	rootDependsOn := []string{}
+	deps := sortedDeps(kclPkg)
+	for i := range deps {
+		dep := &deps[i]
+		component := cycloneDXComponent{
+			BomRef:  dep.FullName,
+			Type:    "library",
+			Name:    dep.Name,
+			Version: depVersion(kclPkg, dep),
+			Purl:    depPurl(dep),
+		}
+		if digest := sumToHex(dep.Sum); len(digest) != 0 {
+			component.Hashes = []cycloneDXHash{{Alg: "SHA-256", Content: digest}}
+		}
+		if dep.Source.Git != nil {
+			component.ExtRefs = []cycloneDXExternalRef{{Type: "vcs", Url: dep.Source.Git.Url}}
+		}
+		if dep.Source.Local != nil {
+			component.Properties = []cycloneDXProperty{{Name: "kpm:local_path", Value: dep.Source.Local.Path}}
+		}
+		bom.Components = append(bom.Components, component)
+
+		if _, ok := kclPkg.ModFile.Dependencies.Deps[dep.Name]; ok {
+			rootDependsOn = append(rootDependsOn, dep.FullName)
+		}
+
+		dependsOn := []string{}
+		for _, name := range depsOfDep(kclPkg, dep) {
+			dependsOn = append(dependsOn, kclPkg.Dependencies.Deps[name].FullName)
+		}
+		bom.Dependencies = append(bom.Dependencies, cycloneDXDependency{Ref: dep.FullName, DependsOn: dependsOn})
+	}
+
+	bom.Dependencies = append([]cycloneDXDependency{{Ref: root.BomRef, DependsOn: rootDependsOn}}, bom.Dependencies...)
+	return bom
+}
+
+// The SPDX 2.3 json format, only the fields used by kpm are defined.
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	SPDXID           string            `json:"SPDXID"`
+	Name             string            `json:"name"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	Checksums        []spdxChecksum    `json:"checksums,omitempty"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SpdxElementId      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSpdxElement string `json:"relatedSpdxElement"`
+}
+
+const spdxNoAssertion = "NOASSERTION"
+
+var invalidSpdxIdChars = regexp.MustCompile(`[^a-zA-Z0-9.-]`)
+
+// spdxId returns a valid SPDX identifier, which only contains letters, numbers, '.' and '-'.
+func spdxId(fullName string) string {
+	return "SPDXRef-Package-" + invalidSpdxIdChars.ReplaceAllString(fullName, "-")
+}
+
+func newSPDXDocument(kclPkg *pkg.KclPkg) *spdxDocument {
+	rootId := spdxId(kclPkg.GetPkgFullName())
+	doc := &spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              kclPkg.GetPkgFullName(),
+		DocumentNamespace: fmt.Sprintf("https://kcl-lang.io/spdx/%s-%d", url.PathEscape(kclPkg.GetPkgFullName()), time.Now().UnixNano()),
+		CreationInfo: spdxCreationInfo{
+			Created:  time.Now().UTC().Format(time.RFC3339),
+			Creators: []string{fmt.Sprintf("Tool: %s-%s", sbomToolName, version.GetVersionInStr())},
+		},
+		Packages: []spdxPackage{{
+			SPDXID:           rootId,
+			Name:             kclPkg.GetPkgName(),
+			VersionInfo:      kclPkg.GetPkgVersion(),
+			DownloadLocation: spdxNoAssertion,
+		}},
+		Relationships: []spdxRelationship{{
+			SpdxElementId:      "SPDXRef-DOCUMENT",
+			RelationshipType:   "DESCRIBES",
+			RelatedSpdxElement: rootId,
+		}},
+	}
+
+	deps := sortedDeps(kclPkg)
+	for i := range deps {
+		dep := &deps[i]
+		id := spdxId(dep.FullName)
+		spdxPkg := spdxPackage{
+			SPDXID:           id,
+			Name:             dep.Name,
+			VersionInfo:      depVersion(kclPkg, dep),
+			DownloadLocation: depDownloadLocation(dep),
+		}
+		if len(spdxPkg.DownloadLocation) == 0 {
+			spdxPkg.DownloadLocation = spdxNoAssertion
+		}
+		if digest := sumToHex(dep.Sum); len(digest) != 0 {
+			spdxPkg.Checksums = []spdxChecksum{{Algorithm: "SHA256", ChecksumValue: digest}}
+		}
+		if purl := depPurl(dep); len(purl) != 0 {
+			spdxPkg.ExternalRefs = []spdxExternalRef{{
+				ReferenceCategory: "PACKAGE-MANAGER",
+				ReferenceType:     "purl",
+				ReferenceLocator:  purl,
+			}}
+		}
+		doc.Packages = append(doc.Packages, spdxPkg)
+
+		if _, ok := kclPkg.ModFile.Dependencies.Deps[dep.Name]; ok {
+			doc.Relationships = append(doc.Relationships, spdxRelationship{
+				SpdxElementId:      rootId,
+				RelationshipType:   "DEPENDS_ON",
+				RelatedSpdxElement: id,
+			})
+		}
+		for _, name := range depsOfDep(kclPkg, dep) {
+			doc.Relationships = append(doc.Relationships, spdxRelationship{
+				SpdxElementId:      id,
+				RelationshipType:   "DEPENDS_ON",
+				RelatedSpdxElement: spdxId(kclPkg.Dependencies.Deps[name].FullName),
+			})
+		}
+	}
+
+	return doc
+}
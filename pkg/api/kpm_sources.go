@@ -0,0 +1,154 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"kcl-lang.io/kcl-go/pkg/kcl"
+	"kcl-lang.io/kpm/pkg/client"
+	"kcl-lang.io/kpm/pkg/constants"
+	"kcl-lang.io/kpm/pkg/opt"
+	pkg "kcl-lang.io/kpm/pkg/package"
+	"kcl-lang.io/kpm/pkg/reporter"
+	"kcl-lang.io/kpm/pkg/runner"
+)
+
+// defaultSourcesModFile is the content of 'kcl.mod' used by 'CompileSources' if no 'kcl.mod' is provided.
+const defaultSourcesModFile = "[package]\nname = \"main\"\nedition = \"0.0.1\"\nversion = \"0.0.1\"\n"
+
+// sourcesPkg is the kcl package created from the 'kcl.mod' content passed to 'CompileSources'.
+type sourcesPkg struct {
+	pkgPath string
+	depsMap map[string]string
+}
+
+// sourcesPkgCache caches the resolved dependencies by the hash of the 'kcl.mod' content,
+// so that the dependencies are only resolved once for the same 'kcl.mod'.
+var sourcesPkgCache = struct {
+	sync.Mutex
+	pkgs map[string]*sourcesPkg
+}{pkgs: make(map[string]*sourcesPkg)}
+
+// CompileSources will compile the in-memory kcl sources 'files', which is a map from the file name to the file content,
+// with the dependencies declared in the 'kcl.mod' content 'modFile'.
+// The dependencies are resolved once for the same 'modFile' and are reused by the later calls,
+// so only the changed sources are compiled again, which is useful for the playgrounds.
+// The file names must be relative '.k' file names, and the files are compiled in the name order as the main package.
+func CompileSources(files map[string]string, modFile string, opts *opt.CompileOptions) (*CompileResult, error) {
+	if opts == nil {
+		opts = opt.DefaultCompileOptions()
+	}
+	result, err := compileSources(files, modFile, opts)
+	if err != nil {
+		return nil, formatError(err, opts)
+	}
+	return result, nil
+}
+
+// compileSources will compile the in-memory kcl sources with the dependencies declared in 'modFile'.
+func compileSources(files map[string]string, modFile string, opts *opt.CompileOptions) (*CompileResult, error) {
+	if len(files) == 0 {
+		return nil, reporter.NewErrorEvent(reporter.CompileFailed, fmt.Errorf("no kcl sources to compile"))
+	}
+	if len(modFile) == 0 {
+		modFile = defaultSourcesModFile
+	}
+
+	kpmcli, err := client.NewKpmClient()
+	if err != nil {
+		return nil, err
+	}
+	kpmcli.SetNoSumCheck(opts.NoSumCheck())
+	kpmcli.SetLogWriter(reporter.NewLocalizedWriter(opts.LogWriter(), opts.Locale()))
+	kpmcli.SetLogLevel(opts.LogLevel())
+	kpmcli.SetCredentialProvider(opts.CredentialProvider())
+	kpmcli.SetFailFast(opts.FailFast())
+	kpmcli.SetPreResolveHook(opts.PreResolveHook())
+	kpmcli.SetAtomicLockWrite(opts.AtomicLockWrite())
+	kpmcli.SetLogDependencyOrigins(opts.LogDependencyOrigins())
+	kpmcli.SetPullThroughCache(opts.PullThroughCache())
+	kpmcli.SetGitCloneDepth(opts.GitCloneDepth())
+	kpmcli.SetNewChecksumHook(opts.NewChecksumHook())
+	kpmcli.SetTargetPlatform(opts.TargetPlatform())
+	kpmcli.SetUserAgent(opts.UserAgent())
+	kpmcli.SetMutableRefTTL(opts.MutableRefTTL())
+	kpmcli.SetDiagnosticHandler(diagnosticHandler(opts))
+	kpmcli.SetExposeDepPaths(opts.ExposeDepPaths())
+	kpmcli.SetModuleProxy(opts.ModuleProxy())
+	kpmcli.SetSymlinkPolicy(opts.SymlinkPolicy())
+	kpmcli.SetOverrideFile(opts.OverrideFile())
+
+	sources, err := loadSourcesPkg(kpmcli, modFile)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		if filepath.IsAbs(name) || filepath.Ext(name) != constants.KFilePathSuffix || strings.HasPrefix(filepath.Clean(name), "..") {
+			return nil, reporter.NewErrorEvent(
+				reporter.CompileFailed,
+				fmt.Errorf("invalid source file name '%s', a relative '%s' file name is required", name, constants.KFilePathSuffix),
+			)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	compileOpts := opts.Clone()
+	compileOpts.SetPkgPath(sources.pkgPath)
+	compileOpts.Merge(kcl.WithWorkDir(sources.pkgPath))
+	for _, name := range names {
+		compileOpts.Merge(kcl.WithKFilenames(filepath.Join(sources.pkgPath, name)), kcl.WithCode(files[name]))
+	}
+
+	result, err := compileToResult(compileOpts, func(compiler *runner.Compiler) (*kcl.KCLResultList, error) {
+		return kpmcli.CompileWithDepsMap(sources.depsMap, compiler)
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.depOrigins = kpmcli.GetDependencyOrigins()
+	return finishResult(result, opts)
+}
+
+// loadSourcesPkg will return the kcl package for the 'kcl.mod' content 'modFile' with the dependencies resolved.
+func loadSourcesPkg(kpmcli *client.KpmClient, modFile string) (*sourcesPkg, error) {
+	sum := sha256.Sum256([]byte(modFile))
+	key := hex.EncodeToString(sum[:])
+
+	sourcesPkgCache.Lock()
+	defer sourcesPkgCache.Unlock()
+	if sources, ok := sourcesPkgCache.pkgs[key]; ok {
+		return sources, nil
+	}
+
+	pkgPath := filepath.Join(os.TempDir(), "kpm-sources", key[:16])
+	err := os.MkdirAll(pkgPath, 0755)
+	if err != nil {
+		return nil, reporter.NewErrorEvent(reporter.FailedCreateFile, err, fmt.Sprintf("failed to create '%s'", pkgPath))
+	}
+	err = os.WriteFile(filepath.Join(pkgPath, pkg.MOD_FILE), []byte(modFile), 0644)
+	if err != nil {
+		return nil, reporter.NewErrorEvent(reporter.FailedCreateFile, err, fmt.Sprintf("failed to create '%s'", filepath.Join(pkgPath, pkg.MOD_FILE)))
+	}
+
+	kclPkg, err := pkg.LoadKclPkg(pkgPath)
+	if err != nil {
+		return nil, err
+	}
+	depsMap, err := kpmcli.ResolveDepsIntoMap(kclPkg)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := &sourcesPkg{pkgPath: pkgPath, depsMap: depsMap}
+	sourcesPkgCache.pkgs[key] = sources
+	return sources, nil
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"fmt"
+
+	"kcl-lang.io/kpm/pkg/client"
+	"kcl-lang.io/kpm/pkg/opt"
+	"kcl-lang.io/kpm/pkg/reporter"
+	"kcl-lang.io/kpm/pkg/runner"
+)
+
+// RunPkgStream will compile the kcl package with the compile options, and emit each compiled document on the returned
+// document channel as soon as the entry which produces it is compiled, so that the consumer can start processing the documents
+// before the whole package is compiled, and the documents of the compiled entries are not kept in memory.
+// The entries are compiled one by one in order, the documents are transformed, validated and counted as 'RunWithResult' does,
+// but the output validator is called with the output of each entry, and they are not written into the split output directory.
+//
+// The document channel is closed after all the documents are emitted or the compilation fails,
+// and then the error channel receives the error if any and is closed.
+// The consumer must drain the document channel, otherwise the compilation is blocked.
+func RunPkgStream(opts *opt.CompileOptions) (<-chan Document, <-chan error) {
+	docs := make(chan Document)
+	errs := make(chan error, 1)
+	go func() {
+		err := runPkgStream(opts, docs)
+		close(docs)
+		if err != nil {
+			errs <- formatError(err, opts)
+		}
+		close(errs)
+	}()
+	return docs, errs
+}
+
+// runPkgStream will compile the kcl package with the compile options entry by entry,
+// and send the documents of each entry into 'docs' after the entry is compiled.
+func runPkgStream(opts *opt.CompileOptions, docs chan<- Document) error {
+	restoreEnvs, err := loadEnvFile(opts)
+	if err != nil {
+		return err
+	}
+	defer restoreEnvs()
+
+	kpmcli, err := client.NewKpmClient()
+	if err != nil {
+		return err
+	}
+	kpmcli.SetNoSumCheck(opts.NoSumCheck())
+
+	prof := newProfiler(opts.Profile())
+	endLoad := prof.span("load")
+	kclPkg, err := loadPkgToRun(kpmcli, opts)
+	endLoad()
+	if err != nil {
+		return err
+	}
+	compile := profiledCompile(kpmcli, kclPkg, prof)
+
+	entries := opts.KFilenameList
+	entryOpts := []*opt.CompileOptions{opts}
+	sources := []string{""}
+	if len(entries) == 1 {
+		sources[0] = entrySource(opts.PkgPath(), entries[0])
+	} else if len(entries) > 1 {
+		entryOpts, sources = nil, nil
+		for i, entry := range entries {
+			entryOpts = append(entryOpts, entryCompileOptions(opts, i))
+			sources = append(sources, entrySource(opts.PkgPath(), entry))
+		}
+	}
+
+	count := 0
+	for i := range entryOpts {
+		compileResult, err := compile(runner.NewCompilerWithOpts(entryOpts[i]))
+		if err != nil {
+			if len(entries) > 1 {
+				return reporter.NewErrorEvent(reporter.CompileFailed, err, fmt.Sprintf("failed to compile the entry '%s'", entries[i]))
+			}
+			return reporter.NewErrorEvent(reporter.CompileFailed, err, "failed to compile the kcl package")
+		}
+
+		result := &CompileResult{}
+		result.addDocuments(compileResult, sources[i])
+		err = finishDocuments(result, opts)
+		if err != nil {
+			return err
+		}
+		count += len(result.documents)
+		err = checkMaxDocuments(count, opts.MaxDocuments())
+		if err != nil {
+			return err
+		}
+		for _, doc := range result.documents {
+			docs <- doc
+		}
+	}
+
+	return prof.write()
+}
@@ -0,0 +1,276 @@
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"kcl-lang.io/kpm/pkg/constants"
+	"kcl-lang.io/kpm/pkg/opt"
+	"kcl-lang.io/kpm/pkg/reporter"
+)
+
+// SymbolKind is the kind of the symbol exported by a kcl package.
+type SymbolKind string
+
+const (
+	SchemaSymbol   SymbolKind = "schema"
+	ProtocolSymbol SymbolKind = "protocol"
+	MixinSymbol    SymbolKind = "mixin"
+	RuleSymbol     SymbolKind = "rule"
+	FunctionSymbol SymbolKind = "function"
+	VariableSymbol SymbolKind = "variable"
+)
+
+// Symbol is a public schema, function or variable exported by a kcl package.
+type Symbol struct {
+	// Name is the name of the symbol.
+	Name string `json:"name"`
+	// Kind is the kind of the symbol.
+	Kind SymbolKind `json:"kind"`
+	// Module is the module of the symbol relative to the package root, e.g. 'sub.mod', it is empty for the root module.
+	Module string `json:"module,omitempty"`
+	// File is the path of the file which defines the symbol relative to the package root.
+	File string `json:"file"`
+	// Line is the line in the file which defines the symbol, starting from 1.
+	Line int `json:"line"`
+	// Type is the type annotation of the variable, e.g. 'str'.
+	Type string `json:"type,omitempty"`
+	// Doc is the docstring of the schema, or the comments above the symbol.
+	Doc string `json:"doc,omitempty"`
+}
+
+// SymbolTable is the symbols exported by a kcl package.
+type SymbolTable struct {
+	Symbols []Symbol `json:"symbols"`
+}
+
+// Lookup returns the symbol 'name' in the module 'module'.
+func (t *SymbolTable) Lookup(module, name string) (*Symbol, bool) {
+	for i, s := range t.Symbols {
+		if s.Module == module && s.Name == name {
+			return &t.Symbols[i], true
+		}
+	}
+	return nil, false
+}
+
+var (
+	// definitionPattern matches the schema-like definitions, e.g. 'schema Name[arg](Base):'.
+	definitionPattern = regexp.MustCompile(`^(schema|protocol|mixin|rule)\s+([A-Za-z_]\w*)`)
+	// assignmentPattern matches the top-level assignments, e.g. 'name: str = "kcl"'.
+	assignmentPattern = regexp.MustCompile(`^([A-Za-z_]\w*)\s*(?::\s*([^=]+?))?\s*=[^=]\s*(.*)$`)
+	// unificationPattern matches the top-level unifications, e.g. 'config: Config {'.
+	unificationPattern = regexp.MustCompile(`^([A-Za-z_]\w*)\s*:\s*([A-Za-z_][\w.]*)?\s*\{`)
+	// lambdaPattern matches the functions assigned to the variables.
+	lambdaPattern = regexp.MustCompile(`^lambda\b`)
+)
+
+// ExportedSymbols returns the public schemas, functions and variables of the kcl package in 'pkgPath',
+// with the doc comments extracted from the source files, so that the documents of the package can be generated without running it.
+// The symbols whose names start with '_' are private and are not exported.
+// The kcl files of the entries in the compile options are used if there are any,
+// otherwise all the kcl files in the package except the tests and the vendored dependencies are used.
+func ExportedSymbols(pkgPath string, opts *opt.CompileOptions) (*SymbolTable, error) {
+	if opts == nil {
+		opts = opt.DefaultCompileOptions()
+	}
+
+	pkgPath, err := filepath.Abs(pkgPath)
+	if err != nil {
+		return nil, reporter.NewErrorEvent(reporter.Bug, err, "internal bugs, please contact us to fix it.")
+	}
+
+	var files []string
+	for _, entry := range opts.Entries() {
+		if !filepath.IsAbs(entry) {
+			entry = filepath.Join(pkgPath, entry)
+		}
+		files = append(files, kclFiles(entry)...)
+	}
+	if len(opts.Entries()) == 0 {
+		files, err = packageKclFiles(pkgPath)
+		if err != nil {
+			return nil, reporter.NewErrorEvent(reporter.FailedAccessPkgPath, err, fmt.Sprintf("failed to access the kcl package '%s'", pkgPath))
+		}
+	}
+	sort.Strings(files)
+
+	table := &SymbolTable{Symbols: []Symbol{}}
+	for _, file := range files {
+		symbols, err := fileSymbols(file)
+		if err != nil {
+			return nil, reporter.NewErrorEvent(reporter.FailedAccessPkgPath, err, fmt.Sprintf("failed to read the symbols in '%s'", file))
+		}
+		relFile := entrySource(pkgPath, file)
+		module := strings.ReplaceAll(filepath.ToSlash(filepath.Dir(relFile)), "/", ".")
+		if module == "." {
+			module = ""
+		}
+		for _, s := range symbols {
+			if _, ok := table.Lookup(module, s.Name); ok {
+				continue
+			}
+			s.Module = module
+			s.File = relFile
+			table.Symbols = append(table.Symbols, s)
+		}
+	}
+
+	return table, nil
+}
+
+// packageKclFiles returns the kcl files in the package 'pkgPath' except the tests and the vendored dependencies.
+func packageKclFiles(pkgPath string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(pkgPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != pkgPath && (d.Name() == "vendor" || strings.HasPrefix(d.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) == constants.KFilePathSuffix && !strings.HasSuffix(path, "_test"+constants.KFilePathSuffix) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// fileSymbols returns the public symbols defined at the top level of the kcl file 'path'.
+func fileSymbols(path string) ([]Symbol, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var symbols []Symbol
+	var comments []string
+	inString := false
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		// Skip the lines in the multi-line strings.
+		if inString {
+			inString = strings.Count(line, `"""`)%2 == 0
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			comments = append(comments, strings.TrimSpace(strings.TrimPrefix(line, "#")))
+			continue
+		}
+		// The decorators are kept with the comments above the symbol.
+		if strings.HasPrefix(line, "@") || len(strings.TrimSpace(line)) == 0 && len(comments) == 0 {
+			continue
+		}
+		doc := strings.Join(comments, "\n")
+		comments = nil
+		if strings.Count(line, `"""`)%2 == 1 {
+			inString = true
+		}
+		if len(line) == 0 || line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+
+		if matches := definitionPattern.FindStringSubmatch(line); matches != nil {
+			if docstring := schemaDocstring(lines[i+1:]); len(docstring) != 0 {
+				doc = docstring
+			}
+			symbols = append(symbols, Symbol{Name: matches[2], Kind: SymbolKind(matches[1]), Line: i + 1, Doc: doc})
+			continue
+		}
+		if matches := assignmentPattern.FindStringSubmatch(line); matches != nil {
+			kind := VariableSymbol
+			if lambdaPattern.MatchString(matches[3]) {
+				kind = FunctionSymbol
+			}
+			symbols = append(symbols, Symbol{Name: matches[1], Kind: kind, Line: i + 1, Type: strings.TrimSpace(matches[2]), Doc: doc})
+			continue
+		}
+		if matches := unificationPattern.FindStringSubmatch(line); matches != nil {
+			symbols = append(symbols, Symbol{Name: matches[1], Kind: VariableSymbol, Line: i + 1, Type: matches[2], Doc: doc})
+		}
+	}
+
+	public := symbols[:0]
+	for _, s := range symbols {
+		if !strings.HasPrefix(s.Name, "_") {
+			public = append(public, s)
+		}
+	}
+	return public, nil
+}
+
+// schemaDocstring returns the docstring in the first lines of the schema body 'lines'.
+func schemaDocstring(lines []string) string {
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		quote := ""
+		for _, q := range []string{`"""`, `'''`} {
+			if strings.HasPrefix(strings.TrimPrefix(line, "r"), q) {
+				quote = q
+			}
+		}
+		if len(quote) == 0 {
+			return ""
+		}
+
+		content := strings.TrimPrefix(strings.TrimPrefix(line, "r"), quote)
+		if end := strings.Index(content, quote); end >= 0 {
+			return strings.TrimSpace(content[:end])
+		}
+		docLines := []string{content}
+		for _, next := range lines[i+1:] {
+			if end := strings.Index(next, quote); end >= 0 {
+				docLines = append(docLines, next[:end])
+				break
+			}
+			docLines = append(docLines, next)
+		}
+		return trimDocstring(docLines)
+	}
+	return ""
+}
+
+// trimDocstring removes the common indentation and the blank lines around the docstring 'lines'.
+func trimDocstring(lines []string) string {
+	indent := -1
+	for _, line := range lines[1:] {
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+		n := len(line) - len(strings.TrimLeft(line, " \t"))
+		if indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	trimmed := []string{strings.TrimSpace(lines[0])}
+	for _, line := range lines[1:] {
+		if indent > 0 && len(line) >= indent {
+			line = line[indent:]
+		}
+		trimmed = append(trimmed, strings.TrimRight(line, " \t"))
+	}
+	return strings.TrimSpace(strings.Join(trimmed, "\n"))
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"kcl-lang.io/kpm/pkg/opt"
+	pkg "kcl-lang.io/kpm/pkg/package"
+	"kcl-lang.io/kpm/pkg/reporter"
+	"kcl-lang.io/kpm/pkg/utils"
+)
+
+// checkSymlinks will apply the symlink policy of the compile options to the symlinks in the kcl package 'kclPkg',
+// so that the files resolved by the compilation through the symlinks are the same wherever the package is.
+// The vendor directory and the hidden directories are not checked, and the symlinks are not followed by the check.
+func checkSymlinks(kclPkg *pkg.KclPkg, opts *opt.CompileOptions) error {
+	if opts.SymlinkPolicy() == opt.Preserve {
+		return nil
+	}
+
+	root := kclPkg.HomePath
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root && (d.Name() == "vendor" || strings.HasPrefix(d.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+		target, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		return opts.SymlinkPolicy().CheckSymlink(filepath.ToSlash(rel), target, utils.PathInDir(root, path))
+	})
+	if err != nil {
+		if _, ok := err.(*reporter.KpmEvent); ok {
+			return err
+		}
+		return reporter.NewErrorEvent(reporter.FailedAccessPkgPath, err, fmt.Sprintf("failed to check the symlinks in '%s'", root))
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"gopkg.in/yaml.v3"
+	"kcl-lang.io/kpm/pkg/reporter"
+)
+
+// outputTemplateData is the data to render the output template, the fields are the placeholders of the compiled documents.
+type outputTemplateData struct {
+	// Output is the yaml stream of the compiled documents.
+	Output string
+	// Documents is the list of the compiled documents.
+	Documents []interface{}
+}
+
+// outputTemplatePlaceholders is the placeholders in the output template, one of which must be referenced.
+var outputTemplatePlaceholders = []string{"Output", "Documents"}
+
+// outputTemplateFuncs is the functions available in the output template.
+var outputTemplateFuncs = template.FuncMap{
+	// indent indents each non-empty line of 's' by 'n' spaces, e.g. to embed the output into a block scalar.
+	"indent": func(n int, s string) string {
+		lines := strings.Split(s, "\n")
+		for i, line := range lines {
+			if len(line) != 0 {
+				lines[i] = strings.Repeat(" ", n) + line
+			}
+		}
+		return strings.Join(lines, "\n")
+	},
+	"toYaml": func(v interface{}) (string, error) {
+		out, err := encodeYaml(v)
+		return strings.TrimSuffix(out, "\n"), err
+	},
+	"toJson": func(v interface{}) (string, error) {
+		out, err := json.Marshal(v)
+		return string(out), err
+	},
+}
+
+// parseOutputTemplate parses the output template 'tmpl' and checks that it references one of the placeholders.
+func parseOutputTemplate(tmpl string) (*template.Template, error) {
+	t, err := template.New("output").Funcs(outputTemplateFuncs).Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return nil, reporter.NewErrorEvent(reporter.InvalidOutputTemplate, err, "failed to parse the output template")
+	}
+	if t.Tree == nil || !referencesPlaceholder(t.Tree.Root) {
+		return nil, reporter.NewErrorEvent(
+			reporter.InvalidOutputTemplate,
+			fmt.Errorf("none of the placeholders '{{ .Output }}' and '{{ .Documents }}' is referenced"),
+			"the output template has no place to inject the compiled documents",
+		)
+	}
+	return t, nil
+}
+
+// referencesPlaceholder returns true if one of the placeholders is referenced in the template node 'node'.
+func referencesPlaceholder(node parse.Node) bool {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return false
+		}
+		for _, child := range n.Nodes {
+			if referencesPlaceholder(child) {
+				return true
+			}
+		}
+	case *parse.ActionNode:
+		return referencesPlaceholder(n.Pipe)
+	case *parse.PipeNode:
+		if n == nil {
+			return false
+		}
+		for _, cmd := range n.Cmds {
+			if referencesPlaceholder(cmd) {
+				return true
+			}
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			if referencesPlaceholder(arg) {
+				return true
+			}
+		}
+	case *parse.FieldNode:
+		for _, placeholder := range outputTemplatePlaceholders {
+			if n.Ident[0] == placeholder {
+				return true
+			}
+		}
+	case *parse.IfNode:
+		return referencesPlaceholder(n.Pipe) || referencesPlaceholder(n.List) || referencesPlaceholder(n.ElseList)
+	case *parse.RangeNode:
+		return referencesPlaceholder(n.Pipe) || referencesPlaceholder(n.List) || referencesPlaceholder(n.ElseList)
+	case *parse.WithNode:
+		return referencesPlaceholder(n.Pipe) || referencesPlaceholder(n.List) || referencesPlaceholder(n.ElseList)
+	}
+	return false
+}
+
+// wrapWithTemplate will replace the documents of the compile result with the single document rendered by the output template 'tmpl'.
+func (r *CompileResult) wrapWithTemplate(tmpl string) error {
+	t, err := parseOutputTemplate(tmpl)
+	if err != nil {
+		return err
+	}
+
+	data := outputTemplateData{Output: r.GetRawYamlResult(), Documents: make([]interface{}, 0, len(r.documents))}
+	for i, doc := range r.documents {
+		value, err := decodeDocument(doc)
+		if err != nil {
+			return reporter.NewErrorEvent(reporter.FailedConvertResult, err, fmt.Sprintf("failed to decode %s", documentName(r.documents, i)))
+		}
+		data.Documents = append(data.Documents, value)
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return reporter.NewErrorEvent(reporter.InvalidOutputTemplate, err, "failed to render the output template")
+	}
+
+	docs := splitYamlDocuments(buf.String())
+	if len(docs) != 1 {
+		return reporter.NewErrorEvent(
+			reporter.InvalidOutput,
+			fmt.Errorf("%d documents are rendered by the output template, but a single document is expected", len(docs)),
+			"failed to wrap the compiled documents",
+		)
+	}
+	var value interface{}
+	if err := yaml.Unmarshal([]byte(docs[0]), &value); err != nil {
+		return reporter.NewErrorEvent(reporter.InvalidOutput, err, "the document rendered by the output template is not valid yaml")
+	}
+	jsonDoc, err := json.Marshal(value)
+	if err != nil {
+		return reporter.NewErrorEvent(reporter.FailedConvertResult, err, "failed to convert the document rendered by the output template into json")
+	}
+
+	yamlDoc := docs[0]
+	if !strings.HasSuffix(yamlDoc, "\n") {
+		yamlDoc += "\n"
+	}
+	r.documents = []Document{{Yaml: yamlDoc, Json: string(jsonDoc)}}
+	return nil
+}
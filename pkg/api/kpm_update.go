@@ -0,0 +1,210 @@
+package api
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"kcl-lang.io/kpm/pkg/client"
+	"kcl-lang.io/kpm/pkg/oci"
+	"kcl-lang.io/kpm/pkg/opt"
+	pkg "kcl-lang.io/kpm/pkg/package"
+	"kcl-lang.io/kpm/pkg/reporter"
+	"kcl-lang.io/kpm/pkg/semver"
+)
+
+// DependencyUpdate is the update of a dependency.
+type DependencyUpdate struct {
+	Name        string
+	FromVersion string
+	ToVersion   string
+	// Kind is the kind of the version bump, e.g. major, minor or patch.
+	Kind semver.BumpKind
+}
+
+// UpdateReport is the report of updating the dependencies of a kcl package.
+type UpdateReport struct {
+	// Updates are the updated dependencies sorted by name.
+	Updates []DependencyUpdate
+}
+
+// UpdateDependencies will update the dependencies of the kcl package in 'pkgPath'
+// to the newest versions compatible with the current versions, and rewrite the kcl.mod and kcl.mod.lock.
+// The versions with the same major version are compatible unless 'AllowMajor' is set.
+// Only the dependencies from the oci registry can be updated, the dependencies from git or local path are skipped.
+func UpdateDependencies(pkgPath string, opts opt.UpdateOptions) (*UpdateReport, error) {
+	kpmcli, err := client.NewKpmClient()
+	if err != nil {
+		return nil, err
+	}
+
+	absPkgPath, err := filepath.Abs(pkgPath)
+	if err != nil {
+		return nil, reporter.NewErrorEvent(reporter.Bug, err, "internal bugs, please contact us to fix it.")
+	}
+
+	kclPkg, err := pkg.LoadKclPkg(absPkgPath)
+	if err != nil {
+		return nil, err
+	}
+
+	toUpdate := make(map[string]bool)
+	for _, name := range opts.Only {
+		if _, ok := kclPkg.ModFile.Dependencies.Deps[name]; !ok {
+			return nil, reporter.NewErrorEvent(
+				reporter.DependencyNotFound,
+				fmt.Errorf("dependency '%s' not found in '%s'", name, kclPkg.ModFile.GetModFilePath()),
+			)
+		}
+		toUpdate[name] = true
+	}
+
+	report := &UpdateReport{}
+	for name, dep := range kclPkg.ModFile.Dependencies.Deps {
+		if len(toUpdate) != 0 && !toUpdate[name] {
+			continue
+		}
+		if dep.Source.Oci == nil {
+			continue
+		}
+
+		tags, err := ociDepVersions(kpmcli, &dep)
+		if err != nil {
+			return nil, err
+		}
+
+		latest, err := semver.LatestCompatibleVersion(dep.Version, tags, opts.AllowMajor)
+		if err != nil {
+			return nil, err
+		}
+		if latest == dep.Version {
+			continue
+		}
+
+		kind, err := semver.GetBumpKind(dep.Version, latest)
+		if err != nil {
+			return nil, err
+		}
+		report.Updates = append(report.Updates, DependencyUpdate{
+			Name:        name,
+			FromVersion: dep.Version,
+			ToVersion:   latest,
+			Kind:        kind,
+		})
+
+		dep.Version = latest
+		dep.Sum = ""
+		dep.Source.Oci.Tag = latest
+		dep.FullName = dep.GenDepFullName()
+		kclPkg.ModFile.Dependencies.Deps[name] = dep
+	}
+
+	sort.Slice(report.Updates, func(i, j int) bool {
+		return report.Updates[i].Name < report.Updates[j].Name
+	})
+
+	if len(report.Updates) == 0 {
+		return report, nil
+	}
+
+	// Download the updated dependencies and rewrite the kcl.mod and kcl.mod.lock.
+	err = kpmcli.UpdateDeps(kclPkg)
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// ociDepVersions returns the versions of the oci dependency 'dep' available in its registry.
+func ociDepVersions(kpmcli *client.KpmClient, dep *pkg.Dependency) ([]string, error) {
+	ociClient, err := oci.NewOciClient(dep.Source.Oci.Reg, dep.Source.Oci.Repo, kpmcli.GetSettings())
+	if err != nil {
+		return nil, err
+	}
+	ociClient.SetUserAgent(kpmcli.GetUserAgent())
+	return ociClient.Tags()
+}
+
+// OutdatedStatus is how far the version of a dependency is behind the latest available version.
+type OutdatedStatus string
+
+const (
+	UpToDate    OutdatedStatus = "up-to-date"
+	PatchBehind OutdatedStatus = "patch"
+	MinorBehind OutdatedStatus = "minor"
+	MajorBehind OutdatedStatus = "major"
+)
+
+// OutdatedDep is the current and the latest available versions of a dependency.
+type OutdatedDep struct {
+	Name    string
+	Current string
+	Latest  string
+	Status  OutdatedStatus
+}
+
+// OutdatedDependencies will return the current and the latest available versions of the dependencies of the kcl package in 'pkgPath',
+// sorted by name, without changing anything. The latest version is the newest one in the registry including the major versions,
+// and the pre-release versions are skipped. Only the dependencies from the oci registry are reported,
+// the dependencies from git or local path are skipped.
+func OutdatedDependencies(pkgPath string) ([]OutdatedDep, error) {
+	kpmcli, err := client.NewKpmClient()
+	if err != nil {
+		return nil, err
+	}
+
+	absPkgPath, err := filepath.Abs(pkgPath)
+	if err != nil {
+		return nil, reporter.NewErrorEvent(reporter.Bug, err, "internal bugs, please contact us to fix it.")
+	}
+
+	kclPkg, err := pkg.LoadKclPkg(absPkgPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var outdated []OutdatedDep
+	for _, name := range sortedDepNames(kclPkg.ModFile.Dependencies.Deps) {
+		dep := kclPkg.ModFile.Dependencies.Deps[name]
+		if dep.Source.Oci == nil {
+			continue
+		}
+		tags, err := ociDepVersions(kpmcli, &dep)
+		if err != nil {
+			return nil, err
+		}
+		outdatedDep, err := newOutdatedDep(name, dep.Version, tags)
+		if err != nil {
+			return nil, err
+		}
+		outdated = append(outdated, *outdatedDep)
+	}
+	return outdated, nil
+}
+
+// newOutdatedDep returns how far the version 'current' of the dependency 'name' is behind the latest one in 'versions'.
+func newOutdatedDep(name, current string, versions []string) (*OutdatedDep, error) {
+	latest, err := semver.LatestCompatibleVersion(current, versions, true)
+	if err != nil {
+		return nil, err
+	}
+	outdatedDep := &OutdatedDep{Name: name, Current: current, Latest: latest, Status: UpToDate}
+	if latest == current {
+		return outdatedDep, nil
+	}
+
+	kind, err := semver.GetBumpKind(current, latest)
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case semver.MajorBump:
+		outdatedDep.Status = MajorBehind
+	case semver.MinorBump:
+		outdatedDep.Status = MinorBehind
+	default:
+		outdatedDep.Status = PatchBehind
+	}
+	return outdatedDep, nil
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"kcl-lang.io/kpm/pkg/constants"
+	"kcl-lang.io/kpm/pkg/reporter"
+)
+
+// digestAlgorithm is the algorithm of the digests of the tars, which is the one of the oci layers.
+const digestAlgorithm = "sha256"
+
+// VerifyTar will verify the integrity of the kcl package tar in 'tarPath' before it is extracted by 'RunTar',
+// so that a truncated or tampered tar fails early with a specific error rather than during the extraction or the compilation.
+// The tar must be read to the end without errors, have only the files and the directories in the package,
+// and contain 'kcl.mod' in its root.
+// If 'expectedDigest' is not empty, the digest of the tar must match it,
+// the digest is in the form of 'sha256:<hex>' as the oci layers, and the hex without the algorithm is also accepted.
+func VerifyTar(tarPath string, expectedDigest string) error {
+	file, err := os.Open(tarPath)
+	if err != nil {
+		return reporter.NewErrorEvent(reporter.FailedAccessPkgPath, err, fmt.Sprintf("could not access the tar '%s'", tarPath))
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	tarReader := tar.NewReader(io.TeeReader(file, hasher))
+	hasModFile := false
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return invalidTarError(tarPath, err)
+		}
+
+		name := path.Clean(header.Name)
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return invalidTarError(tarPath, fmt.Errorf("the entry '%s' is out of the package", header.Name))
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+		case tar.TypeReg:
+			if name == constants.KCL_MOD {
+				hasModFile = true
+			}
+			if _, err := io.Copy(io.Discard, tarReader); err != nil {
+				return invalidTarError(tarPath, fmt.Errorf("failed to read the entry '%s': %w", header.Name, err))
+			}
+		default:
+			return invalidTarError(tarPath, fmt.Errorf("the entry '%s' is neither a file nor a directory", header.Name))
+		}
+	}
+	// The padding after the end of the archive is also a part of the digest.
+	if _, err := io.Copy(hasher, file); err != nil {
+		return reporter.NewErrorEvent(reporter.FailedAccessPkgPath, err, fmt.Sprintf("failed to read the tar '%s'", tarPath))
+	}
+
+	if !hasModFile {
+		return invalidTarError(tarPath, fmt.Errorf("'%s' not found in the root of the tar", constants.KCL_MOD))
+	}
+
+	if len(expectedDigest) == 0 {
+		return nil
+	}
+	expected := expectedDigest
+	if algorithm, encoded, ok := strings.Cut(expectedDigest, ":"); ok {
+		if algorithm != digestAlgorithm {
+			return reporter.NewErrorEvent(
+				reporter.CheckSumMismatch,
+				fmt.Errorf("the algorithm '%s' of the digest '%s' is not supported, only '%s' is supported", algorithm, expectedDigest, digestAlgorithm),
+				fmt.Sprintf("failed to verify the tar '%s'", tarPath),
+			)
+		}
+		expected = encoded
+	}
+	digest := hex.EncodeToString(hasher.Sum(nil))
+	if !strings.EqualFold(digest, expected) {
+		return reporter.NewErrorEvent(
+			reporter.CheckSumMismatch,
+			fmt.Errorf("the digest of the tar is '%s:%s', but '%s' is expected", digestAlgorithm, digest, expectedDigest),
+			fmt.Sprintf("the tar '%s' may be tampered", tarPath),
+		)
+	}
+	return nil
+}
+
+// invalidTarError returns the error that the tar in 'tarPath' is not a well-formed kcl package tar.
+func invalidTarError(tarPath string, err error) error {
+	return reporter.NewErrorEvent(reporter.InvalidKclPkg, err, fmt.Sprintf("the tar '%s' is not a valid kcl package, it may be truncated or tampered", tarPath))
+}
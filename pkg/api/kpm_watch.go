@@ -0,0 +1,296 @@
+package api
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"kcl-lang.io/kcl-go/pkg/kcl"
+	"kcl-lang.io/kpm/pkg/client"
+	"kcl-lang.io/kpm/pkg/constants"
+	"kcl-lang.io/kpm/pkg/opt"
+	"kcl-lang.io/kpm/pkg/reporter"
+	"kcl-lang.io/kpm/pkg/runner"
+)
+
+// watchDebounce is the quiet period after the last change before recompiling,
+// so that a burst of changes, e.g. saving several files at once, only triggers one compilation.
+var watchDebounce = 200 * time.Millisecond
+
+// watcher compiles the kcl package again when the watched files are changed.
+type watcher struct {
+	kpmcli  *client.KpmClient
+	opts    *opt.CompileOptions
+	handler func(*CompileResult, error)
+
+	// runOpts is the compile options with the entries of the loaded package.
+	runOpts *opt.CompileOptions
+	// depsMap is the resolved dependencies which are reused until 'kcl.mod' is changed.
+	depsMap map[string]string
+	// fsWatcher notifies the changes of the files in the watched directories.
+	fsWatcher *fsnotify.Watcher
+	// entries is the absolute paths of the entry files of the loaded package.
+	entries map[string]bool
+}
+
+// Watch will compile the kcl package in 'pkgPath' and call 'handler' with the compile result,
+// then compile the package again each time the entry files, the other '.k' files in the package or 'kcl.mod' are changed.
+// The dependencies are resolved again only if 'kcl.mod' is changed.
+// The changes are notified by the file system events of the directories in the package and the directories of the entry files,
+// and rapid changes are debounced.
+//
+// The returned 'stop' function stops watching, and 'handler' will not be called after 'stop' returns.
+// 'stop' must not be called in 'handler'.
+func Watch(pkgPath string, opts *opt.CompileOptions, handler func(*CompileResult, error)) (func(), error) {
+	if opts == nil {
+		opts = opt.DefaultCompileOptions()
+	}
+	absPkgPath, err := filepath.Abs(pkgPath)
+	if err != nil {
+		return nil, reporter.NewErrorEvent(reporter.Bug, err, "internal bugs, please contact us to fix it.")
+	}
+	opts = opts.Clone()
+	opts.SetPkgPath(absPkgPath)
+
+	kpmcli, err := client.NewKpmClient()
+	if err != nil {
+		return nil, err
+	}
+	kpmcli.SetNoSumCheck(opts.NoSumCheck())
+
+	w := &watcher{
+		kpmcli:  kpmcli,
+		opts:    opts,
+		handler: handler,
+	}
+	if err := w.resolve(); err != nil {
+		return nil, err
+	}
+	w.fsWatcher, err = fsnotify.NewWatcher()
+	if err != nil {
+		return nil, reporter.NewErrorEvent(reporter.FailedAccessPkgPath, err, "failed to watch the kcl package")
+	}
+	if err := w.watch(); err != nil {
+		_ = w.fsWatcher.Close()
+		return nil, err
+	}
+	w.report(w.compile())
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		defer w.fsWatcher.Close()
+		w.loop(done)
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-stopped
+		})
+	}, nil
+}
+
+// loop handles the file system events until 'done' is closed, and compiles the package after the changes are settled.
+func (w *watcher) loop(done <-chan struct{}) {
+	debounce := time.NewTimer(watchDebounce)
+	stopTimer(debounce)
+	defer debounce.Stop()
+
+	modChanged := false
+	for {
+		select {
+		case <-done:
+			return
+		case err, ok := <-w.fsWatcher.Errors:
+			if !ok {
+				return
+			}
+			w.report(nil, reporter.NewErrorEvent(reporter.FailedAccessPkgPath, err, "failed to watch the kcl package"))
+		case event, ok := <-w.fsWatcher.Events:
+			if !ok {
+				return
+			}
+			if !w.changed(event) {
+				continue
+			}
+			modChanged = modChanged || event.Name == w.modFilePath()
+			stopTimer(debounce)
+			debounce.Reset(watchDebounce)
+		case <-debounce.C:
+			if modChanged {
+				modChanged = false
+				if err := w.resolve(); err != nil {
+					w.report(nil, err)
+					continue
+				}
+				// The entries may be changed in 'kcl.mod'.
+				if err := w.watch(); err != nil {
+					w.report(nil, err)
+					continue
+				}
+			}
+			w.report(w.compile())
+		}
+	}
+}
+
+// stopTimer stops the timer and drains its channel, so that it can be reset without firing for the previous change.
+func stopTimer(timer *time.Timer) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+}
+
+// report calls the handler with the compile result, the error is rendered by the error formatter and the locale in the compile options.
+func (w *watcher) report(result *CompileResult, err error) {
+	if err != nil {
+		w.handler(nil, formatError(err, w.opts))
+		return
+	}
+	w.handler(result, nil)
+}
+
+// resolve loads the kcl package and resolves its dependencies.
+func (w *watcher) resolve() error {
+	runOpts := w.opts.Clone()
+	kclPkg, err := loadPkgToRun(w.kpmcli, runOpts)
+	if err != nil {
+		return err
+	}
+	depsMap, err := w.kpmcli.ResolveDepsIntoMap(kclPkg)
+	if err != nil {
+		return err
+	}
+	w.runOpts = runOpts
+	w.depsMap = depsMap
+	return nil
+}
+
+// compile compiles the kcl package with the resolved dependencies.
+func (w *watcher) compile() (*CompileResult, error) {
+	restoreEnvs, err := loadEnvFile(w.runOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer restoreEnvs()
+
+	result, err := compileToResult(w.runOpts.Clone(), func(compiler *runner.Compiler) (*kcl.KCLResultList, error) {
+		return w.kpmcli.CompileWithDepsMap(w.depsMap, compiler)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return finishResult(result, w.runOpts)
+}
+
+// modFilePath returns the path of 'kcl.mod' of the watched package.
+func (w *watcher) modFilePath() string {
+	return filepath.Join(w.opts.PkgPath(), constants.KCL_MOD)
+}
+
+// watch watches the directories in the package except the hidden and vendor directories,
+// and the directories of the entry files out of the package.
+func (w *watcher) watch() error {
+	if err := w.watchDir(w.opts.PkgPath()); err != nil {
+		return err
+	}
+
+	pkgPath := w.opts.PkgPath()
+	entries := make(map[string]bool, len(w.runOpts.KFilenameList))
+	for _, entry := range w.runOpts.KFilenameList {
+		if !filepath.IsAbs(entry) {
+			entry = filepath.Join(pkgPath, entry)
+		}
+		if info, err := os.Stat(entry); err == nil && info.IsDir() {
+			continue
+		}
+		entries[entry] = true
+		// The directory is watched instead of the file, so that the file replaced by renaming is still watched.
+		if err := w.fsWatcher.Add(filepath.Dir(entry)); err != nil && !os.IsNotExist(err) {
+			return reporter.NewErrorEvent(reporter.FailedAccessPkgPath, err, "failed to watch the kcl package")
+		}
+	}
+	w.entries = entries
+	return nil
+}
+
+// watchDir watches the directory 'dir' and the directories in it except the hidden and vendor directories.
+func (w *watcher) watchDir(dir string) error {
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != w.opts.PkgPath() && !isWatchedDir(path) {
+			return filepath.SkipDir
+		}
+		return w.fsWatcher.Add(path)
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return reporter.NewErrorEvent(reporter.FailedAccessPkgPath, err, "failed to watch the kcl package")
+	}
+	return nil
+}
+
+// changed returns whether the file system event changes the watched files,
+// and the directory created in the package is watched, since it may be created with the '.k' files in it.
+func (w *watcher) changed(event fsnotify.Event) bool {
+	if event.Op == fsnotify.Chmod {
+		return false
+	}
+	if event.Op.Has(fsnotify.Create) && w.inWatchedDir(event.Name) {
+		if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+			if !isWatchedDir(event.Name) {
+				return false
+			}
+			if err := w.watchDir(event.Name); err != nil {
+				w.report(nil, err)
+			}
+			return true
+		}
+	}
+	return w.isWatchedFile(event.Name)
+}
+
+// isWatchedFile returns whether the file in 'path' is 'kcl.mod', a '.k' file in the watched directories of the package, or an entry file.
+func (w *watcher) isWatchedFile(path string) bool {
+	if path == w.modFilePath() || w.entries[path] {
+		return true
+	}
+	return filepath.Ext(path) == constants.KFilePathSuffix && w.inWatchedDir(path)
+}
+
+// inWatchedDir returns whether 'path' is in the package, but not in the hidden or vendor directories.
+func (w *watcher) inWatchedDir(path string) bool {
+	rel, err := filepath.Rel(w.opts.PkgPath(), filepath.Dir(path))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+	if rel == "." {
+		return true
+	}
+	for _, name := range strings.Split(rel, string(filepath.Separator)) {
+		if !isWatchedDir(name) {
+			return false
+		}
+	}
+	return true
+}
+
+// isWatchedDir returns whether the directory in 'path' is watched, the hidden and vendor directories are not.
+func isWatchedDir(path string) bool {
+	name := filepath.Base(path)
+	return !strings.HasPrefix(name, ".") && name != "vendor"
+}
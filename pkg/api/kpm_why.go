@@ -0,0 +1,263 @@
+package api
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	pkg "kcl-lang.io/kpm/pkg/package"
+	"kcl-lang.io/kpm/pkg/reporter"
+)
+
+// WhyReason is the reason why the resolved version of a dependency is selected.
+type WhyReason string
+
+const (
+	// WhyDeclared means the version is declared in the kcl.mod of the package,
+	// and no other dependency requires a different version.
+	WhyDeclared WhyReason = "declared"
+	// WhyOverride means the version declared in the kcl.mod of the package
+	// overrides the different versions required by the other dependencies.
+	WhyOverride WhyReason = "override"
+	// WhyRequired means the dependency is not declared in the kcl.mod of the package,
+	// and the version is the only one required by the other dependencies.
+	WhyRequired WhyReason = "required"
+	// WhyLocked means the other dependencies require different versions,
+	// and the version locked in the kcl.mod.lock is kept.
+	WhyLocked WhyReason = "locked"
+)
+
+// WhyRequirement is a version of a dependency required by a dependent.
+type WhyRequirement struct {
+	// Dependent is the name of the dependent, it is the name of the package for its own kcl.mod.
+	Dependent string
+	// Version is the version required by the dependent.
+	Version string
+}
+
+// WhyReport explains why a dependency is resolved for a kcl package and why its version is selected.
+type WhyReport struct {
+	// Name is the name of the dependency.
+	Name string
+	// Version is the resolved version of the dependency.
+	Version string
+	// Direct is true if the dependency is declared in the kcl.mod of the package.
+	Direct bool
+	// Paths is the chains of the dependencies from the ones declared in the kcl.mod of the package to the dependency,
+	// e.g. ["k8s", "helper"] means the package depends on 'k8s' which depends on 'helper'.
+	Paths [][]string
+	// Requirements is the versions of the dependency required by the package and the other dependencies.
+	Requirements []WhyRequirement
+	// Reason is the reason why the version is selected.
+	Reason WhyReason
+	// Explanation is the reason explained in words.
+	Explanation string
+}
+
+// WhyDependency will explain why the dependency 'name' is resolved for the kcl package in 'pkgPath',
+// i.e. which dependencies require it, and why the resolved version is selected among the required versions.
+// The dependencies are resolved in the same way as 'kpm run', and downloaded into the cache if they are not vendored or cached.
+func WhyDependency(pkgPath, name string) (*WhyReport, error) {
+	absPkgPath, err := filepath.Abs(pkgPath)
+	if err != nil {
+		return nil, reporter.NewErrorEvent(reporter.Bug, err, "internal bugs, please contact us to fix it.")
+	}
+	// The kcl.mod is loaded before resolving, which adds the indirect dependencies into it.
+	declared, err := pkg.LoadModFile(absPkgPath)
+	if err != nil {
+		return nil, err
+	}
+
+	_, kclPkg, err := loadAndResolvePkg(absPkgPath)
+	if err != nil {
+		return nil, err
+	}
+	graph := walkDependencyGraph(kclPkg, declared)
+	target, ok := graph[name]
+	if !ok {
+		return nil, reporter.NewErrorEvent(
+			reporter.DependencyNotFound,
+			fmt.Errorf("dependency '%s' not found in '%s'", name, kclPkg.ModFile.GetModFilePath()),
+		)
+	}
+
+	report := &WhyReport{
+		Name:    name,
+		Version: target.version,
+	}
+	if dep, ok := declared.Dependencies.Deps[name]; ok {
+		report.Direct = true
+		report.Requirements = append(report.Requirements, WhyRequirement{
+			Dependent: kclPkg.GetPkgName(),
+			Version:   requiredVersion(absPkgPath, &dep),
+		})
+	}
+
+	for _, root := range sortedDepNames(declared.Dependencies.Deps) {
+		report.Paths = append(report.Paths, dependencyPaths(graph, []string{root}, name)...)
+	}
+
+	dependents := make([]string, 0, len(graph))
+	for dependent := range graph {
+		dependents = append(dependents, dependent)
+	}
+	sort.Strings(dependents)
+	for _, dependent := range dependents {
+		node := graph[dependent]
+		if dep, ok := node.deps[name]; ok && dependent != name {
+			report.Requirements = append(report.Requirements, WhyRequirement{
+				Dependent: dependent,
+				Version:   requiredVersion(node.home, &dep),
+			})
+		}
+	}
+
+	report.Reason, report.Explanation = whyReason(report, kclPkg.GetPkgName())
+	return report, nil
+}
+
+// depNode is a dependency in the graph of the kcl.mod files walked from a kcl package.
+type depNode struct {
+	// home is the directory of the dependency.
+	home string
+	// version is the resolved version of the dependency.
+	version string
+	// deps is the dependencies declared in the kcl.mod of the dependency.
+	deps map[string]pkg.Dependency
+}
+
+// walkDependencyGraph walks the kcl.mod files from the dependencies in 'declared', the kcl.mod of 'kclPkg' before resolving,
+// and returns the graph of the dependencies, the key is the name of the dependency.
+// The dependencies locked in the kcl.mod.lock are found by the kcl.mod.lock, and the others by the kcl.mod of their dependents,
+// e.g. the local dependencies of the local dependencies. The dependency found first in the breadth-first order wins.
+func walkDependencyGraph(kclPkg *pkg.KclPkg, declared *pkg.ModFile) map[string]*depNode {
+	type pending struct {
+		dep        pkg.Dependency
+		parentHome string
+	}
+	graph := make(map[string]*depNode)
+	var queue []pending
+	for _, name := range sortedDepNames(declared.Dependencies.Deps) {
+		queue = append(queue, pending{dep: declared.Dependencies.Deps[name], parentHome: kclPkg.HomePath})
+	}
+
+	for len(queue) != 0 {
+		next := queue[0]
+		queue = queue[1:]
+		name := next.dep.Name
+		if _, ok := graph[name]; ok {
+			continue
+		}
+
+		node := &depNode{}
+		if locked, ok := kclPkg.Dependencies.Deps[name]; ok {
+			node.home = locked.GetLocalFullPath(kclPkg.HomePath)
+			node.version = depVersion(kclPkg, &locked)
+		} else {
+			node.home = next.dep.GetLocalFullPath(next.parentHome)
+			node.version = requiredVersion(next.parentHome, &next.dep)
+		}
+		graph[name] = node
+
+		if len(node.home) == 0 {
+			continue
+		}
+		modFile, err := pkg.LoadModFile(node.home)
+		if err != nil {
+			continue
+		}
+		node.deps = modFile.Dependencies.Deps
+		for _, depName := range sortedDepNames(node.deps) {
+			queue = append(queue, pending{dep: node.deps[depName], parentHome: node.home})
+		}
+	}
+	return graph
+}
+
+// sortedDepNames returns the sorted names of the dependencies 'deps'.
+func sortedDepNames(deps map[string]pkg.Dependency) []string {
+	names := make([]string, 0, len(deps))
+	for name := range deps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// dependencyPaths returns the chains of the dependencies in 'graph' which start with 'path' and end with the dependency 'target'.
+// The dependencies already in the chain are not visited again, so the cycles are not followed.
+func dependencyPaths(graph map[string]*depNode, path []string, target string) [][]string {
+	last := path[len(path)-1]
+	if last == target {
+		return [][]string{append([]string(nil), path...)}
+	}
+	node, ok := graph[last]
+	if !ok {
+		return nil
+	}
+
+	var paths [][]string
+	for _, next := range sortedDepNames(node.deps) {
+		visited := false
+		for _, name := range path {
+			if name == next {
+				visited = true
+				break
+			}
+		}
+		if !visited {
+			paths = append(paths, dependencyPaths(graph, append(path, next), target)...)
+		}
+	}
+	return paths
+}
+
+// requiredVersion returns the version of the dependency 'dep' required by the kcl.mod in 'homePath',
+// local dependencies have no version in kcl.mod, so the version in its own kcl.mod is used.
+func requiredVersion(homePath string, dep *pkg.Dependency) string {
+	if len(dep.Version) == 0 && dep.IsFromLocal() {
+		modFile, err := pkg.LoadModFile(dep.GetLocalFullPath(homePath))
+		if err == nil {
+			return modFile.Pkg.Version
+		}
+	}
+	return dep.Version
+}
+
+// whyReason returns the reason why the resolved version in 'report' is selected and its explanation.
+func whyReason(report *WhyReport, pkgName string) (WhyReason, string) {
+	var others []string
+	versions := make(map[string]bool)
+	for _, req := range report.Requirements {
+		if req.Dependent == pkgName && report.Direct {
+			continue
+		}
+		versions[req.Version] = true
+		if req.Version != report.Version {
+			others = append(others, fmt.Sprintf("'%s' by '%s'", req.Version, req.Dependent))
+		}
+	}
+
+	if report.Direct {
+		if len(others) != 0 {
+			return WhyOverride, fmt.Sprintf(
+				"the version '%s' declared in the kcl.mod of '%s' overrides the versions required by the dependencies: %s",
+				report.Version, pkgName, strings.Join(others, ", "),
+			)
+		}
+		return WhyDeclared, fmt.Sprintf("the version '%s' is declared in the kcl.mod of '%s'", report.Version, pkgName)
+	}
+
+	var dependents []string
+	for _, req := range report.Requirements {
+		dependents = append(dependents, fmt.Sprintf("'%s'", req.Dependent))
+	}
+	if len(versions) <= 1 {
+		return WhyRequired, fmt.Sprintf("the version '%s' is required by %s", report.Version, strings.Join(dependents, ", "))
+	}
+	return WhyLocked, fmt.Sprintf(
+		"the dependencies require different versions, and the version '%s' locked in the kcl.mod.lock is kept, the others are: %s",
+		report.Version, strings.Join(others, ", "),
+	)
+}
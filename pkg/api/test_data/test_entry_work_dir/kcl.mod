@@ -0,0 +1,5 @@
+[package]
+name = "test_entry_work_dir"
+edition = "0.0.1"
+version = "0.0.1"
+
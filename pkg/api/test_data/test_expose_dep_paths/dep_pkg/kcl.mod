@@ -0,0 +1,4 @@
+[package]
+name = "dep_pkg"
+edition = "0.0.1"
+version = "0.0.1"
@@ -0,0 +1,7 @@
+[package]
+name = "common_pkg"
+edition = "0.0.1"
+version = "0.0.1"
+
+[dependencies]
+base_pkg = { path = "../base_pkg" }
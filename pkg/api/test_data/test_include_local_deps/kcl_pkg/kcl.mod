@@ -0,0 +1,8 @@
+[package]
+name = "kcl_pkg"
+edition = "0.0.1"
+version = "0.0.1"
+
+[dependencies]
+common_pkg = { path = "../common_pkg" }
+sub_pkg = { path = "./sub_pkg" }
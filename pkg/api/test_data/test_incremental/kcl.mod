@@ -0,0 +1,4 @@
+[package]
+name = "test_incremental"
+edition = "0.0.1"
+version = "0.0.1"
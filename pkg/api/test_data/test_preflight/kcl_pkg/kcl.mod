@@ -0,0 +1,8 @@
+[package]
+name = "kcl_pkg"
+edition = "0.0.1"
+version = "0.0.1"
+
+[dependencies]
+dep_pkg = { path = "../dep_pkg" }
+missing_pkg = { path = "../missing_pkg" }
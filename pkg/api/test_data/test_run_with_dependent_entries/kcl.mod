@@ -0,0 +1,5 @@
+[package]
+name = "test_run_with_dependent_entries"
+edition = "0.0.1"
+version = "0.0.1"
+
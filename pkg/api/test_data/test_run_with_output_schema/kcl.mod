@@ -0,0 +1,6 @@
+[package]
+name = "test_run_with_output_schema"
+edition = "0.0.1"
+version = "0.0.1"
+
+[dependencies]
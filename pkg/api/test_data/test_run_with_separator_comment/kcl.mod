@@ -0,0 +1,5 @@
+[package]
+name = "test_run_with_separator_comment"
+edition = "0.0.1"
+version = "0.0.1"
+
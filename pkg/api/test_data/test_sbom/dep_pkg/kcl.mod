@@ -0,0 +1,5 @@
+[package]
+name = "dep_pkg"
+edition = "0.0.1"
+version = "0.0.2"
+
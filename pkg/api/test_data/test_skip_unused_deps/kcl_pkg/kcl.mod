@@ -0,0 +1,8 @@
+[package]
+name = "kcl_pkg"
+edition = "0.0.1"
+version = "0.0.1"
+
+[dependencies]
+used_pkg = { path = "../used_pkg" }
+unused_pkg = { path = "../unused_pkg" }
@@ -0,0 +1,7 @@
+[package]
+name = "test_update_dependencies"
+edition = "0.0.1"
+version = "0.0.1"
+
+[dependencies]
+helloworld = "0.1.0"
@@ -0,0 +1,6 @@
+[package]
+name = "test_watch"
+edition = "0.0.1"
+version = "0.0.1"
+
+[dependencies]
@@ -1,16 +1,24 @@
 package client
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
+	"net/http"
 	"os"
 	"path/filepath"
 	"reflect"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/otiai10/copy"
+	"golang.org/x/sync/errgroup"
 	"kcl-lang.io/kcl-go/pkg/kcl"
 	"kcl-lang.io/kpm/pkg/constants"
 	"kcl-lang.io/kpm/pkg/env"
@@ -21,6 +29,7 @@ import (
 	pkg "kcl-lang.io/kpm/pkg/package"
 	"kcl-lang.io/kpm/pkg/reporter"
 	"kcl-lang.io/kpm/pkg/runner"
+	"kcl-lang.io/kpm/pkg/semver"
 	"kcl-lang.io/kpm/pkg/settings"
 	"kcl-lang.io/kpm/pkg/utils"
 	"oras.land/oras-go/v2"
@@ -30,14 +39,87 @@ import (
 type KpmClient struct {
 	// The writer of the log.
 	logWriter io.Writer
+	// The level of detail of the log, the logs above the level are not written.
+	logLevel reporter.LogLevel
 	// The home path of kpm for global configuration file and kcl package storage path.
 	homePath string
 	// The settings of kpm loaded from the global configuration file.
 	settings settings.Settings
 	// The flag of whether to check the checksum of the package and update kcl.mod.lock.
 	noSumCheck bool
+	// The flag of whether to fail if the kcl.mod.lock would be created or modified.
+	failOnLockChange bool
+	// The mirrors of the registries, the key is the primary registry.
+	registryMirrors map[string][]string
+	// The registries which the dependencies are pulled from, the key is the name of the dependency.
+	pullSources map[string]string
+	// The registries which the oci dependencies are allowed to come from, all registries are allowed if it is empty.
+	allowedRegistries []string
+	// The flag of whether to fail on the warnings.
+	warningsAsErrors bool
+	// The warnings reported during resolving and compiling.
+	warnings []*reporter.KpmEvent
+	// The names of the dependencies to resolve, all the dependencies are resolved if it is nil.
+	depsToResolve map[string]bool
+	// The provider to resolve the credentials referenced by the dependencies.
+	credentialProvider opt.CredentialProvider
+	// The flag of whether to stop downloading the dependencies on the first failure.
+	failFast bool
+	// The hook to inspect and modify the dependencies before they are resolved.
+	preResolveHook opt.PreResolveHook
+	// The flag of whether to replace kcl.mod and kcl.mod.lock atomically when they are written.
+	atomicLockWrite bool
+	// The origins of the resolved dependencies, the key is the name of the dependency.
+	depOrigins map[string]Origin
+	// The flag of whether to log the origins of the resolved dependencies at the info level.
+	logDepOrigins bool
+	// The pull-through cache which the oci dependencies are pulled from instead of their registries, e.g. 'cache.example.com/ghcr'.
+	pullThroughCache string
+	// The number of the commits cloned for the git dependencies, 0 means the full history.
+	gitCloneDepth int
+	// The hook to call with the checksums newly recorded in kcl.mod.lock.
+	newChecksumHook opt.NewChecksumHook
+	// The platform of the variant pulled if an oci dependency is a manifest list, e.g. 'linux/amd64'.
+	targetPlatform string
+	// The user-agent of the requests to the oci registries, empty means the default one of kpm.
+	userAgent string
+	// The time after which the cached dependencies of the mutable refs are fetched again, 0 means they are cached forever.
+	mutableRefTTL time.Duration
+	// The handler to call with each warning as it is reported.
+	diagnosticHandler opt.DiagnosticHandler
+	// The flag of whether to pass the resolved paths of the dependencies to the compilation as the top-level arguments.
+	exposeDepPaths bool
+	// The module proxy which the metadata and the packages of the oci dependencies are fetched from, e.g. 'https://proxy.example.com'.
+	moduleProxy string
+	// The http client of the requests to the module proxy.
+	proxyClient *http.Client
+	// The policy of the symlinks in the packages extracted from the tars.
+	symlinkPolicy opt.SymlinkPolicy
+	// The file of the overrides of the dependencies applied to the resolution.
+	overrideFile string
+	// The mutex of the states recorded by the concurrent downloads, e.g. 'pullSources', 'depOrigins' and 'warnings'.
+	mu sync.Mutex
+	// The mutex of the writes to the log writer from the concurrent downloads.
+	logMu sync.Mutex
 }
 
+// DefaultModuleProxyTimeout is the time limit of a request to the module proxy, including reading the package served.
+const DefaultModuleProxyTimeout = 5 * time.Minute
+
+// Origin is where a resolved dependency is served from.
+type Origin string
+
+const (
+	// OriginCache means the dependency is found in the global cache '$KCL_PKG_PATH'.
+	OriginCache Origin = "cache"
+	// OriginVendor means the dependency is found in the vendor directory of the package.
+	OriginVendor Origin = "vendor"
+	// OriginDownload means the dependency is freshly downloaded.
+	OriginDownload Origin = "download"
+	// OriginLocal means the dependency is a local path dependency.
+	OriginLocal Origin = "local"
+)
+
 // NewKpmClient will create a new kpm client with default settings.
 func NewKpmClient() (*KpmClient, error) {
 	settings := settings.GetSettings()
@@ -52,9 +134,12 @@ func NewKpmClient() (*KpmClient, error) {
 	}
 
 	return &KpmClient{
-		logWriter: os.Stdout,
-		settings:  *settings,
-		homePath:  homePath,
+		logWriter:       os.Stdout,
+		settings:        *settings,
+		homePath:        homePath,
+		failFast:        true,
+		atomicLockWrite: true,
+		proxyClient:     &http.Client{Timeout: DefaultModuleProxyTimeout},
 	}, nil
 }
 
@@ -68,6 +153,533 @@ func (c *KpmClient) GetNoSumCheck() bool {
 	return c.noSumCheck
 }
 
+// SetFailOnLockChange will set the 'failOnLockChange' flag.
+func (c *KpmClient) SetFailOnLockChange(failOnLockChange bool) {
+	c.failOnLockChange = failOnLockChange
+}
+
+// GetFailOnLockChange will return the 'failOnLockChange' flag.
+func (c *KpmClient) GetFailOnLockChange() bool {
+	return c.failOnLockChange
+}
+
+// SetRegistryMirrors will set the mirrors of the 'primary' registry,
+// the mirrors will be tried in order if pulling from the 'primary' registry fails.
+// The package from a mirror is verified by the checksum in 'kcl.mod.lock', or by the digest of its manifest
+// in the 'primary' registry if the dependency is not locked.
+func (c *KpmClient) SetRegistryMirrors(primary string, mirrors []string) {
+	if c.registryMirrors == nil {
+		c.registryMirrors = make(map[string][]string)
+	}
+	c.registryMirrors[primary] = mirrors
+}
+
+// SetAllowedRegistries will set the registries which the oci dependencies are allowed to come from.
+// The oci dependencies from other registries will fail to be resolved, all registries are allowed if 'hosts' is empty.
+func (c *KpmClient) SetAllowedRegistries(hosts []string) {
+	c.allowedRegistries = hosts
+}
+
+// GetAllowedRegistries will return the registries which the oci dependencies are allowed to come from.
+func (c *KpmClient) GetAllowedRegistries() []string {
+	return c.allowedRegistries
+}
+
+// isAllowedRegistry will check whether the registry 'reg' is in the allowed registries.
+// The host in the allowed registries matches the registry with any port.
+func (c *KpmClient) isAllowedRegistry(reg string) bool {
+	if len(c.allowedRegistries) == 0 {
+		return true
+	}
+	host := reg
+	if h, _, err := net.SplitHostPort(reg); err == nil {
+		host = h
+	}
+	for _, allowed := range c.allowedRegistries {
+		if reg == allowed || host == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRegistryAllowed will return an error if the dependency is from an oci registry which is not allowed.
+func (c *KpmClient) checkRegistryAllowed(dep *pkg.Dependency) error {
+	if dep.Source.Oci == nil {
+		return nil
+	}
+	reg := dep.Source.Oci.Reg
+	if len(reg) == 0 {
+		reg = c.GetSettings().DefaultOciRegistry()
+	}
+	if !c.isAllowedRegistry(reg) {
+		return reporter.NewErrorEvent(
+			reporter.RegistryNotAllowed,
+			fmt.Errorf("the registry '%s' is not in the allowed registries [%s]", reg, strings.Join(c.allowedRegistries, ", ")),
+			fmt.Sprintf("the dependency '%s' comes from a registry which is not allowed", dep.Name),
+		)
+	}
+	return nil
+}
+
+// SetWarningsAsErrors will set the flag of whether to fail on the warnings.
+func (c *KpmClient) SetWarningsAsErrors(warningsAsErrors bool) {
+	c.warningsAsErrors = warningsAsErrors
+}
+
+// GetWarningsAsErrors will return the flag of whether to fail on the warnings.
+func (c *KpmClient) GetWarningsAsErrors() bool {
+	return c.warningsAsErrors
+}
+
+// GetWarnings will return the warnings reported during resolving and compiling.
+func (c *KpmClient) GetWarnings() []*reporter.KpmEvent {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.warnings
+}
+
+// SetDiagnosticHandler will set the handler to call with each warning as it is reported.
+func (c *KpmClient) SetDiagnosticHandler(handler opt.DiagnosticHandler) {
+	c.diagnosticHandler = handler
+}
+
+// warn will report the warning to the log writer and the diagnostic handler, and keep it in the warnings.
+// If the 'warningsAsErrors' flag is set, the warning is returned as an error.
+// The same warning is only reported once.
+func (c *KpmClient) warn(warning *reporter.KpmEvent) error {
+	c.mu.Lock()
+	for _, w := range c.warnings {
+		if w.Type() == warning.Type() && w.Event() == warning.Event() {
+			c.mu.Unlock()
+			return c.warningError(warning)
+		}
+	}
+	c.warnings = append(c.warnings, warning)
+	c.mu.Unlock()
+	reporter.ReportMsgTo(fmt.Sprintf("warning: %s", strings.TrimSpace(warning.Event())), c.logWriterAt(reporter.WarnLevel))
+	if c.diagnosticHandler != nil {
+		c.diagnosticHandler(reporter.NewWarningDiagnostic(warning))
+	}
+	return c.warningError(warning)
+}
+
+// warningError will return the warning as an error if the 'warningsAsErrors' flag is set.
+func (c *KpmClient) warningError(warning *reporter.KpmEvent) error {
+	if c.warningsAsErrors {
+		return reporter.NewErrorEvent(warning.Type(), fmt.Errorf("warnings are treated as errors"), warning.Event())
+	}
+	return nil
+}
+
+// checkDeprecatedDep will report a warning if the dependency 'name' in 'depPath' is marked as deprecated in its 'kcl.mod'.
+func (c *KpmClient) checkDeprecatedDep(name, depPath string) error {
+	modFile, err := pkg.LoadModFile(depPath)
+	if err != nil {
+		// The dependency without 'kcl.mod' has no deprecation to report.
+		return nil
+	}
+	if len(modFile.Pkg.Deprecated) == 0 {
+		return nil
+	}
+
+	msg := fmt.Sprintf("the dependency '%s' is deprecated: %s", name, modFile.Pkg.Deprecated)
+	if len(modFile.Pkg.ReplacedBy) != 0 {
+		msg = fmt.Sprintf("%s, please use '%s' instead", msg, modFile.Pkg.ReplacedBy)
+	}
+	return c.warn(reporter.NewEvent(reporter.DependencyDeprecated, msg))
+}
+
+// SetFailFast will set the flag of whether to stop downloading the dependencies on the first failure.
+// The dependencies are downloaded concurrently, and the other downloads are cancelled on the first failure.
+// If it is false, the other dependencies are still downloaded and the failures are reported together.
+func (c *KpmClient) SetFailFast(failFast bool) {
+	c.failFast = failFast
+}
+
+// GetFailFast will return the flag of whether to stop downloading the dependencies on the first failure.
+func (c *KpmClient) GetFailFast() bool {
+	return c.failFast
+}
+
+// SetCredentialProvider will set the provider to resolve the credentials referenced by the dependencies in 'kcl.mod'.
+func (c *KpmClient) SetCredentialProvider(provider opt.CredentialProvider) {
+	c.credentialProvider = provider
+}
+
+// newOciClientForDep will new an OciClient to pull the oci dependency 'dep'.
+// The credential referenced by the dependency is resolved by the credential provider,
+// and the credential of the registry host is used if the dependency references no credential.
+func (c *KpmClient) newOciClientForDep(dep *pkg.Oci) (*oci.OciClient, error) {
+	if len(dep.Credential) == 0 {
+		return c.newOciClient(dep.Reg, dep.Repo)
+	}
+	if c.credentialProvider == nil {
+		return nil, reporter.NewErrorEvent(
+			reporter.FailedLoadCredential,
+			fmt.Errorf("no credential provider to resolve the credential '%s' of '%s'", dep.Credential, dep.Repo),
+			"set the credential provider to resolve the credentials referenced in 'kcl.mod'",
+		)
+	}
+	c.debugf("resolving the credential '%s' to pull '%s' from '%s'", dep.Credential, dep.Repo, dep.Reg)
+	credential, err := c.credentialProvider(dep.Credential, dep.Reg)
+	if err != nil {
+		return nil, reporter.NewErrorEvent(
+			reporter.FailedLoadCredential,
+			err,
+			fmt.Sprintf("failed to resolve the credential '%s' for '%s'", dep.Credential, dep.Reg),
+		)
+	}
+	ociClient, err := oci.NewOciClientWithCredential(dep.Reg, dep.Repo, &c.settings, credential)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.userAgent) != 0 {
+		ociClient.SetUserAgent(c.userAgent)
+	}
+	return ociClient, nil
+}
+
+// newOciClient will new an OciClient with the credential of the registry host and the user-agent of the client.
+func (c *KpmClient) newOciClient(reg, repo string) (*oci.OciClient, error) {
+	ociClient, err := oci.NewOciClient(reg, repo, &c.settings)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.userAgent) != 0 {
+		ociClient.SetUserAgent(c.userAgent)
+	}
+	return ociClient, nil
+}
+
+// SetLogDependencyOrigins will set the flag of whether to log the origins of the resolved dependencies at the info level.
+func (c *KpmClient) SetLogDependencyOrigins(logDepOrigins bool) {
+	c.logDepOrigins = logDepOrigins
+}
+
+// SetPullThroughCache will set the pull-through cache which the oci dependencies are pulled from instead of their registries.
+func (c *KpmClient) SetPullThroughCache(host string) {
+	c.pullThroughCache = host
+}
+
+// GetPullThroughCache will return the pull-through cache which the oci dependencies are pulled from.
+func (c *KpmClient) GetPullThroughCache() string {
+	return c.pullThroughCache
+}
+
+// SetGitCloneDepth will set the number of the commits cloned for the git dependencies, 0 means the full history.
+func (c *KpmClient) SetGitCloneDepth(depth int) {
+	c.gitCloneDepth = depth
+}
+
+// GetGitCloneDepth will return the number of the commits cloned for the git dependencies.
+func (c *KpmClient) GetGitCloneDepth() int {
+	return c.gitCloneDepth
+}
+
+// SetNewChecksumHook will set the hook to call with the checksums newly recorded in kcl.mod.lock.
+func (c *KpmClient) SetNewChecksumHook(hook opt.NewChecksumHook) {
+	c.newChecksumHook = hook
+}
+
+// SetTargetPlatform will set the platform of the variant pulled if an oci dependency is a manifest list, e.g. 'linux/amd64'.
+func (c *KpmClient) SetTargetPlatform(platform string) {
+	c.targetPlatform = platform
+}
+
+// GetTargetPlatform will return the platform of the variant pulled if an oci dependency is a manifest list.
+func (c *KpmClient) GetTargetPlatform() string {
+	return c.targetPlatform
+}
+
+// SetMutableRefTTL will set the time after which the cached dependencies of the mutable refs, e.g. the git branches, are fetched again,
+// 0 means they are cached forever as the immutable ones.
+func (c *KpmClient) SetMutableRefTTL(ttl time.Duration) {
+	c.mutableRefTTL = ttl
+}
+
+// GetMutableRefTTL will return the time after which the cached dependencies of the mutable refs are fetched again.
+func (c *KpmClient) GetMutableRefTTL() time.Duration {
+	return c.mutableRefTTL
+}
+
+// SetExposeDepPaths will set whether to pass the resolved path of each dependency to the compilation
+// as the top-level argument 'kcl_dep_path_<name>'.
+func (c *KpmClient) SetExposeDepPaths(expose bool) {
+	c.exposeDepPaths = expose
+}
+
+// GetExposeDepPaths will return whether the resolved paths of the dependencies are passed to the compilation.
+func (c *KpmClient) GetExposeDepPaths() bool {
+	return c.exposeDepPaths
+}
+
+// SetModuleProxy will set the module proxy which the metadata and the packages of the oci dependencies are fetched from.
+func (c *KpmClient) SetModuleProxy(url string) {
+	c.moduleProxy = url
+}
+
+// SetModuleProxyTimeout will set the time limit of a request to the module proxy, 0 means no time limit.
+func (c *KpmClient) SetModuleProxyTimeout(timeout time.Duration) {
+	c.proxyClient = &http.Client{Timeout: timeout}
+}
+
+// GetModuleProxy will return the module proxy which the oci dependencies are fetched from.
+func (c *KpmClient) GetModuleProxy() string {
+	return c.moduleProxy
+}
+
+// SetSymlinkPolicy will set the policy of the symlinks in the packages extracted from the tars,
+// the symlinks escaping the root of the package are rejected by default.
+func (c *KpmClient) SetSymlinkPolicy(policy opt.SymlinkPolicy) {
+	c.symlinkPolicy = policy
+}
+
+// GetSymlinkPolicy will return the policy of the symlinks in the packages extracted from the tars.
+func (c *KpmClient) GetSymlinkPolicy() opt.SymlinkPolicy {
+	return c.symlinkPolicy
+}
+
+// SetOverrideFile will set the file of the overrides which replace the dependencies declared in kcl.mod when they are resolved.
+func (c *KpmClient) SetOverrideFile(path string) {
+	c.overrideFile = path
+}
+
+// GetOverrideFile will return the file of the overrides of the dependencies.
+func (c *KpmClient) GetOverrideFile() string {
+	return c.overrideFile
+}
+
+// isExpiredMutableRef will check whether the dependency 'dep' cached in 'path' references a mutable revision
+// and was fetched longer ago than the TTL of the mutable refs.
+func (c *KpmClient) isExpiredMutableRef(dep *pkg.Dependency, path string) bool {
+	if c.mutableRefTTL <= 0 || !dep.IsMutableRef() {
+		return false
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	if time.Since(info.ModTime()) < c.mutableRefTTL {
+		return false
+	}
+	c.debugf("the cached '%s' in '%s' references a mutable revision and is expired after %s", dep.Name, path, c.mutableRefTTL)
+	return true
+}
+
+// SetUserAgent will set the user-agent of the requests to the oci registries, empty means the default one of kpm, e.g. 'kpm/0.7.0'.
+func (c *KpmClient) SetUserAgent(userAgent string) {
+	c.userAgent = userAgent
+}
+
+// GetUserAgent will return the user-agent of the requests to the oci registries.
+func (c *KpmClient) GetUserAgent() string {
+	if len(c.userAgent) == 0 {
+		return oci.DefaultUserAgent()
+	}
+	return c.userAgent
+}
+
+// GetDependencyOrigins will return where the resolved dependencies are served from,
+// the key is the name of the dependency.
+func (c *KpmClient) GetDependencyOrigins() map[string]Origin {
+	return c.depOrigins
+}
+
+// recordOrigin will record the origin of the dependency 'name',
+// the dependency downloaded during the resolution is not taken as from the cache after it is downloaded.
+func (c *KpmClient) recordOrigin(name string, origin Origin) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.depOrigins == nil {
+		c.depOrigins = make(map[string]Origin)
+	}
+	if c.depOrigins[name] == OriginDownload && origin == OriginCache {
+		return
+	}
+	c.depOrigins[name] = origin
+}
+
+// SetAtomicLockWrite will set the flag of whether to replace kcl.mod and kcl.mod.lock atomically when they are written.
+func (c *KpmClient) SetAtomicLockWrite(atomic bool) {
+	c.atomicLockWrite = atomic
+}
+
+// GetAtomicLockWrite will return the flag of whether to replace kcl.mod and kcl.mod.lock atomically when they are written.
+func (c *KpmClient) GetAtomicLockWrite() bool {
+	return c.atomicLockWrite
+}
+
+// SetPreResolveHook will set the hook to call with the dependencies declared in 'kcl.mod' before they are resolved.
+func (c *KpmClient) SetPreResolveHook(hook opt.PreResolveHook) {
+	c.preResolveHook = hook
+}
+
+// applyPreResolveHook will call the pre-resolution hook with the dependencies declared in the 'kcl.mod' of 'kclPkg',
+// and replace the dependencies to resolve with the returned ones.
+func (c *KpmClient) applyPreResolveHook(kclPkg *pkg.KclPkg) error {
+	if c.preResolveHook == nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(kclPkg.ModFile.Dependencies.Deps))
+	for name := range kclPkg.ModFile.Dependencies.Deps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	specs := make([]opt.DependencySpec, 0, len(names))
+	for _, name := range names {
+		specs = append(specs, newDependencySpec(kclPkg.ModFile.Dependencies.Deps[name]))
+	}
+
+	specs, err := c.preResolveHook(specs)
+	if err != nil {
+		return reporter.NewErrorEvent(reporter.DependencyRejected, err, "the dependencies are rejected by the pre-resolution hook")
+	}
+
+	deps := pkg.Dependencies{Deps: make(map[string]pkg.Dependency, len(specs))}
+	for _, spec := range specs {
+		d, err := newDependencyFromSpec(spec)
+		if err != nil {
+			return reporter.NewErrorEvent(reporter.DependencyRejected, err, fmt.Sprintf("invalid dependency '%s' returned by the pre-resolution hook", spec.Name))
+		}
+		if declared, ok := kclPkg.ModFile.Dependencies.Deps[d.Name]; ok {
+			// The registry declared in kcl.mod is kept if it is not changed by the hook.
+			if d.Oci != nil && declared.Oci != nil && d.Oci.Reg == declared.Oci.Reg {
+				d.Oci.DeclaredReg = declared.Oci.DeclaredReg
+			}
+			if reflect.DeepEqual(declared.Source, d.Source) {
+				d = declared
+			}
+		}
+		deps.Deps[d.Name] = d
+	}
+	kclPkg.ModFile.OverrideDependencies(deps)
+	return nil
+}
+
+// applyOverrideFile will replace the dependencies declared in the 'kcl.mod' of 'kclPkg' with the ones in the override file,
+// and mark the replaced dependencies as overridden by the override file.
+func (c *KpmClient) applyOverrideFile(kclPkg *pkg.KclPkg) error {
+	if len(c.overrideFile) == 0 {
+		return nil
+	}
+
+	overrides, err := pkg.LoadOverrideFile(c.overrideFile)
+	if err != nil {
+		return reporter.NewErrorEvent(reporter.FailedLoadOverrideFile, err, fmt.Sprintf("failed to load the override file '%s'", c.overrideFile))
+	}
+
+	deps := pkg.Dependencies{Deps: make(map[string]pkg.Dependency, len(kclPkg.ModFile.Dependencies.Deps))}
+	for name, d := range kclPkg.ModFile.Dependencies.Deps {
+		if override, ok := overrides.Deps[name]; ok {
+			c.debugf("overriding '%s' with version '%s' by '%s'", name, override.Version, c.overrideFile)
+			override.OverriddenBy = c.overrideFile
+			d = override
+		}
+		deps.Deps[name] = d
+	}
+	kclPkg.ModFile.OverrideDependencies(deps)
+	return nil
+}
+
+// newDependencySpec returns the spec of the dependency 'd' passed to the pre-resolution hook.
+func newDependencySpec(d pkg.Dependency) opt.DependencySpec {
+	spec := opt.DependencySpec{Name: d.Name, Version: d.Version}
+	switch {
+	case d.Git != nil:
+		spec.GitUrl = d.Git.Url
+		spec.GitBranch = d.Git.Branch
+		spec.GitCommit = d.Git.Commit
+		spec.GitTag = d.Git.Tag
+		spec.GitSubdir = d.Git.Subdir
+	case d.Oci != nil:
+		spec.OciReg = d.Oci.Reg
+		spec.OciRepo = d.Oci.Repo
+		spec.OciCredential = d.Oci.Credential
+	case d.Local != nil:
+		spec.LocalPath = d.Local.Path
+	case d.LocalRegistry != nil:
+		spec.LocalRegistry = d.LocalRegistry.Path
+	}
+	return spec
+}
+
+// newDependencyFromSpec returns the dependency of the spec returned by the pre-resolution hook.
+func newDependencyFromSpec(spec opt.DependencySpec) (pkg.Dependency, error) {
+	if len(spec.Name) == 0 {
+		return pkg.Dependency{}, fmt.Errorf("the name of the dependency is empty")
+	}
+	d := pkg.Dependency{Name: spec.Name, Version: spec.Version}
+	switch {
+	case len(spec.GitUrl) != 0:
+		d.Git = &pkg.Git{
+			Url:    spec.GitUrl,
+			Branch: spec.GitBranch,
+			Commit: spec.GitCommit,
+			Tag:    spec.GitTag,
+			Subdir: spec.GitSubdir,
+		}
+		version, err := d.Git.GetValidGitReference()
+		if err != nil {
+			return pkg.Dependency{}, err
+		}
+		d.Version = version
+	case len(spec.LocalPath) != 0:
+		d.Local = &pkg.Local{Path: spec.LocalPath}
+	case len(spec.LocalRegistry) != 0:
+		d.LocalRegistry = &pkg.LocalRegistry{Path: spec.LocalRegistry, Version: spec.Version}
+	default:
+		d.Oci = &pkg.Oci{
+			Reg:        spec.OciReg,
+			Repo:       spec.OciRepo,
+			Tag:        spec.Version,
+			Credential: spec.OciCredential,
+		}
+	}
+	d.FullName = d.GenDepFullName()
+	return d, nil
+}
+
+// SetDepsToResolve will set the names of the dependencies to resolve,
+// the other dependencies are not downloaded and are left out of the compilation if they are not found locally.
+// All the dependencies are resolved if 'names' is nil.
+func (c *KpmClient) SetDepsToResolve(names []string) {
+	if names == nil {
+		c.depsToResolve = nil
+		return
+	}
+	c.depsToResolve = make(map[string]bool, len(names))
+	for _, name := range names {
+		c.depsToResolve[name] = true
+	}
+}
+
+// shouldResolve will check whether the dependency 'name' should be resolved.
+func (c *KpmClient) shouldResolve(name string) bool {
+	return c.depsToResolve == nil || c.depsToResolve[name]
+}
+
+// depsToDownload will return the dependencies in 'deps' which should be resolved.
+func (c *KpmClient) depsToDownload(deps pkg.Dependencies) pkg.Dependencies {
+	if c.depsToResolve == nil {
+		return deps
+	}
+	filtered := pkg.Dependencies{Deps: make(map[string]pkg.Dependency)}
+	for name, d := range deps.Deps {
+		if c.shouldResolve(name) {
+			filtered.Deps[name] = d
+		}
+	}
+	return filtered
+}
+
+// GetPullSources will return the registries which the dependencies are pulled from,
+// the key is the name of the dependency.
+func (c *KpmClient) GetPullSources() map[string]string {
+	return c.pullSources
+}
+
 func (c *KpmClient) SetLogWriter(writer io.Writer) {
 	c.logWriter = writer
 }
@@ -76,6 +688,41 @@ func (c *KpmClient) GetLogWriter() io.Writer {
 	return c.logWriter
 }
 
+// SetLogLevel will set the level of detail of the log written to the log writer.
+func (c *KpmClient) SetLogLevel(level reporter.LogLevel) {
+	c.logLevel = level
+}
+
+// GetLogLevel will return the level of detail of the log written to the log writer.
+func (c *KpmClient) GetLogLevel() reporter.LogLevel {
+	return c.logLevel
+}
+
+// logWriterAt will return the log writer if the logs at 'level' are written under the log level, otherwise nil.
+func (c *KpmClient) logWriterAt(level reporter.LogLevel) io.Writer {
+	if !c.logLevel.Enabled(level) || c.logWriter == nil {
+		return nil
+	}
+	return &syncWriter{mu: &c.logMu, w: c.logWriter}
+}
+
+// syncWriter serializes the writes to the writer 'w', which are made by the concurrent downloads.
+type syncWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (w *syncWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
+
+// debugf will write the debug log to the log writer.
+func (c *KpmClient) debugf(format string, args ...interface{}) {
+	reporter.ReportMsgTo(fmt.Sprintf(format, args...), c.logWriterAt(reporter.DebugLevel))
+}
+
 // SetHomePath will set the home path of kpm.
 func (c *KpmClient) SetHomePath(homePath string) {
 	c.homePath = homePath
@@ -83,7 +730,7 @@ func (c *KpmClient) SetHomePath(homePath string) {
 
 // AcquirePackageCacheLock will acquire the lock of the package cache.
 func (c *KpmClient) AcquirePackageCacheLock() error {
-	return c.settings.AcquirePackageCacheLock(c.logWriter)
+	return c.settings.AcquirePackageCacheLock(c.logWriterAt(reporter.InfoLevel))
 }
 
 // ReleasePackageCacheLock will release the lock of the package cache.
@@ -151,9 +798,36 @@ func (c *KpmClient) ResolveDepsIntoMap(kclPkg *pkg.KclPkg) (map[string]string, e
 	if err != nil {
 		return nil, err
 	}
+	// The dependencies which are not resolved are left out if they are not found locally.
+	skipped := make(map[string]bool)
+	// The names in kcl.mod of the dependencies, the key is the name with '-' replaced by '_'.
+	declaredNames := make(map[string]string)
+	for name, d := range kclPkg.Dependencies.Deps {
+		declaredNames[d.GetAliasName()] = name
+		if !c.shouldResolve(name) && !utils.DirExists(d.GetLocalFullPath(kclPkg.HomePath)) {
+			skipped[d.GetAliasName()] = true
+		}
+	}
+
 	var pkgMap map[string]string = make(map[string]string)
-	for _, d := range depMetadatas.Deps {
+	names := make([]string, 0, len(depMetadatas.Deps))
+	for name, d := range depMetadatas.Deps {
+		if skipped[name] {
+			continue
+		}
 		pkgMap[d.GetAliasName()] = d.GetLocalFullPath(kclPkg.HomePath)
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		d := depMetadatas.Deps[name]
+		c.debugf("resolved '%s' to '%s'", name, d.GetLocalFullPath(kclPkg.HomePath))
+		if origin, ok := c.depOrigins[declaredNames[name]]; ok && c.logDepOrigins {
+			reporter.ReportMsgTo(fmt.Sprintf("the origin of '%s' is '%s'", declaredNames[name], origin), c.logWriterAt(reporter.InfoLevel))
+		}
+		if err := c.checkDeprecatedDep(d.Name, d.GetLocalFullPath(kclPkg.HomePath)); err != nil {
+			return nil, err
+		}
 	}
 
 	return pkgMap, nil
@@ -163,19 +837,36 @@ func (c *KpmClient) ResolveDepsIntoMap(kclPkg *pkg.KclPkg) (map[string]string, e
 // and check whether the package exists locally.
 // If the package does not exist, it will re-download to the local.
 func (c *KpmClient) ResolvePkgDepsMetadata(kclPkg *pkg.KclPkg, update bool) error {
-	var searchPath string
+	if err := c.applyOverrideFile(kclPkg); err != nil {
+		return err
+	}
+	if err := c.applyPreResolveHook(kclPkg); err != nil {
+		return err
+	}
+	return c.resolvePkgDepsMetadata(kclPkg, update)
+}
+
+// resolvePkgDepsMetadata will resolve the dependencies of 'kclPkg' after the pre-resolution hook is applied.
+func (c *KpmClient) resolvePkgDepsMetadata(kclPkg *pkg.KclPkg, update bool) error {
 	kclPkg.NoSumCheck = c.noSumCheck
+	kclPkg.FailOnLockChange = c.failOnLockChange
+	kclPkg.NonAtomicWrite = !c.atomicLockWrite
+	kclPkg.ModFile.NonAtomicWrite = !c.atomicLockWrite
+	kclPkg.NewChecksumHook = c.newChecksumHook
+
+	for _, deps := range []pkg.Dependencies{kclPkg.ModFile.Dependencies, kclPkg.Dependencies} {
+		for _, dep := range deps.Deps {
+			if err := c.checkRegistryAllowed(&dep); err != nil {
+				return err
+			}
+		}
+	}
 
 	if kclPkg.IsVendorMode() {
-		// In the vendor mode, the search path is the vendor subdirectory of the current package.
 		err := c.VendorDeps(kclPkg)
 		if err != nil {
 			return err
 		}
-		searchPath = kclPkg.LocalVendorPath()
-	} else {
-		// Otherwise, the search path is the $KCL_PKG_PATH.
-		searchPath = c.homePath
 	}
 
 	// If under the mode of '--no_sum_check', the checksum of the package will not be checked.
@@ -187,12 +878,13 @@ func (c *KpmClient) ResolvePkgDepsMetadata(kclPkg *pkg.KclPkg, update bool) erro
 		// alian the dependencies between kcl.mod and kcl.mod.lock
 		// clean the dependencies in kcl.mod.lock which not in kcl.mod
 		// clean the dependencies in kcl.mod.lock and kcl.mod which have different version
+		// clean the dependencies in kcl.mod.lock which are overridden differently from kcl.mod
 		for name, dep := range kclPkg.Dependencies.Deps {
 			modDep, ok := kclPkg.ModFile.Dependencies.Deps[name]
-			if !ok || !dep.WithTheSameVersion(modDep) {
+			if !ok || !dep.WithTheSameVersion(modDep) || dep.OverriddenBy != modDep.OverriddenBy {
 				reporter.ReportMsgTo(
 					fmt.Sprintf("removing '%s' with version '%s'", name, dep.Version),
-					c.logWriter,
+					c.logWriterAt(reporter.InfoLevel),
 				)
 				delete(kclPkg.Dependencies.Deps, name)
 			}
@@ -202,7 +894,7 @@ func (c *KpmClient) ResolvePkgDepsMetadata(kclPkg *pkg.KclPkg, update bool) erro
 			if _, ok := kclPkg.Dependencies.Deps[name]; !ok {
 				reporter.ReportMsgTo(
 					fmt.Sprintf("adding '%s' with version '%s'", name, d.Version),
-					c.logWriter,
+					c.logWriterAt(reporter.InfoLevel),
 				)
 				kclPkg.Dependencies.Deps[name] = d
 			}
@@ -214,6 +906,12 @@ func (c *KpmClient) ResolvePkgDepsMetadata(kclPkg *pkg.KclPkg, update bool) erro
 	}
 
 	for name, d := range kclPkg.Dependencies.Deps {
+		// In the vendor mode, the search path of the vendored dependency is the vendor subdirectory of the current package.
+		// Otherwise, the search path is the $KCL_PKG_PATH.
+		searchPath := c.homePath
+		if kclPkg.IsVendoredDep(name) {
+			searchPath = kclPkg.LocalVendorPath()
+		}
 		searchFullPath := filepath.Join(searchPath, d.FullName)
 		if !update {
 			if d.IsFromLocal() {
@@ -225,10 +923,21 @@ func (c *KpmClient) ResolvePkgDepsMetadata(kclPkg *pkg.KclPkg, update bool) erro
 			kclPkg.Dependencies.Deps[name] = d
 
 		} else {
-			if utils.DirExists(searchFullPath) && (c.GetNoSumCheck() || utils.CheckPackageSum(d.Sum, searchFullPath)) {
+			expired := !kclPkg.IsVendoredDep(name) && c.isExpiredMutableRef(&d, searchFullPath)
+			if utils.DirExists(searchFullPath) && !expired && (c.GetNoSumCheck() || utils.CheckPackageSum(d.Sum, searchFullPath)) {
+				c.debugf("found '%s' with version '%s' and checksum '%s' in '%s'", name, d.Version, d.Sum, searchFullPath)
+				if kclPkg.IsVendoredDep(name) {
+					c.recordOrigin(name, OriginVendor)
+				} else {
+					c.recordOrigin(name, OriginCache)
+				}
 				// Find it and update the local path of the dependency.
 				d.LocalFullPath = searchFullPath
 				kclPkg.Dependencies.Deps[name] = d
+			} else if !c.shouldResolve(name) {
+				c.debugf("skipped resolving '%s' which is not used", name)
+				// The dependencies which are not resolved are not downloaded.
+				continue
 			} else if d.IsFromLocal() && !utils.DirExists(d.GetLocalFullPath(kclPkg.HomePath)) {
 				return reporter.NewErrorEvent(reporter.DependencyNotFound, fmt.Errorf("dependency '%s' not found in '%s'", d.Name, searchFullPath))
 			} else if d.IsFromLocal() && utils.DirExists(d.GetLocalFullPath(kclPkg.HomePath)) {
@@ -236,11 +945,14 @@ func (c *KpmClient) ResolvePkgDepsMetadata(kclPkg *pkg.KclPkg, update bool) erro
 				if err != nil {
 					return reporter.NewErrorEvent(reporter.CalSumFailed, err, fmt.Sprintf("failed to calculate checksum for '%s' in '%s'", d.Name, searchFullPath))
 				}
+				c.debugf("found the local dependency '%s' with checksum '%s' in '%s'", name, sum, d.GetLocalFullPath(kclPkg.HomePath))
+				c.recordOrigin(name, OriginLocal)
 				d.Sum = sum
 				kclPkg.Dependencies.Deps[name] = d
 			} else {
+				c.debugf("'%s' with version '%s' is not found with the checksum '%s' in '%s'", name, d.Version, d.Sum, searchFullPath)
 				// Otherwise, re-vendor it.
-				if kclPkg.IsVendorMode() {
+				if kclPkg.IsVendoredDep(name) {
 					err := c.VendorDeps(kclPkg)
 					if err != nil {
 						return err
@@ -254,7 +966,7 @@ func (c *KpmClient) ResolvePkgDepsMetadata(kclPkg *pkg.KclPkg, update bool) erro
 				}
 				// After re-downloading or re-vendoring,
 				// re-resolving is required to update the dependent paths.
-				err := c.ResolvePkgDepsMetadata(kclPkg, update)
+				err := c.resolvePkgDepsMetadata(kclPkg, update)
 				if err != nil {
 					return err
 				}
@@ -317,12 +1029,57 @@ func (c *KpmClient) Compile(kclPkg *pkg.KclPkg, kclvmCompiler *runner.Compiler)
 		return nil, err
 	}
 
+	return c.CompileWithDepsMap(pkgMap, kclvmCompiler)
+}
+
+// CompileWithDepsMap will call kcl compiler with the dependencies already resolved by 'ResolveDepsIntoMap',
+// so that the dependencies are not resolved again if they are not changed.
+func (c *KpmClient) CompileWithDepsMap(depsMap map[string]string, kclvmCompiler *runner.Compiler) (*kcl.KCLResultList, error) {
+	pkgMap := make(map[string]string, len(depsMap))
+	for dName, dPath := range depsMap {
+		pkgMap[dName] = dPath
+	}
+
+	// Resolve the import aliases to the path of the aliased dependency.
+	aliasMap := make(map[string]string)
+	for from, to := range kclvmCompiler.ImportAliases() {
+		if _, ok := pkgMap[from]; ok {
+			return nil, reporter.NewErrorEvent(
+				reporter.InvalidImportAlias,
+				fmt.Errorf("the import alias '%s' shadows the dependency '%s'", from, from),
+			)
+		}
+		toPath, ok := pkgMap[to]
+		if !ok {
+			return nil, reporter.NewErrorEvent(
+				reporter.InvalidImportAlias,
+				fmt.Errorf("the aliased dependency '%s' of the import alias '%s' not found", to, from),
+			)
+		}
+		aliasMap[from] = toPath
+	}
+	for from, toPath := range aliasMap {
+		pkgMap[from] = toPath
+	}
+
 	// Fill the dependency path.
 	for dName, dPath := range pkgMap {
 		if !filepath.IsAbs(dPath) {
 			dPath = filepath.Join(c.homePath, dPath)
 		}
 		kclvmCompiler.AddDepPath(dName, dPath)
+		pkgMap[dName] = dPath
+	}
+
+	if c.exposeDepPaths {
+		names := make([]string, 0, len(pkgMap))
+		for dName := range pkgMap {
+			names = append(names, dName)
+		}
+		sort.Strings(names)
+		for _, dName := range names {
+			kclvmCompiler.AddKclOption(kcl.WithOptions(fmt.Sprintf("%s%s=%s", constants.DEP_PATH_ARG_PREFIX, dName, pkgMap[dName])))
+		}
 	}
 
 	return kclvmCompiler.Run()
@@ -336,13 +1093,39 @@ func (c *KpmClient) CompileWithOpts(opts *opt.CompileOptions) (*kcl.KCLResultLis
 	}
 
 	c.noSumCheck = opts.NoSumCheck()
+	c.failOnLockChange = opts.FailOnLockChange()
+	c.allowedRegistries = opts.AllowedRegistries()
+	c.warningsAsErrors = opts.WarningsAsErrors()
+	c.logLevel = opts.LogLevel()
+	c.credentialProvider = opts.CredentialProvider()
+	c.failFast = opts.FailFast()
+	c.preResolveHook = opts.PreResolveHook()
+	c.atomicLockWrite = opts.AtomicLockWrite()
+	c.logDepOrigins = opts.LogDependencyOrigins()
+	c.pullThroughCache = opts.PullThroughCache()
+	c.gitCloneDepth = opts.GitCloneDepth()
+	c.newChecksumHook = opts.NewChecksumHook()
+	c.targetPlatform = opts.TargetPlatform()
+	c.userAgent = opts.UserAgent()
+	c.mutableRefTTL = opts.MutableRefTTL()
+	c.exposeDepPaths = opts.ExposeDepPaths()
+	c.moduleProxy = opts.ModuleProxy()
+	c.symlinkPolicy = opts.SymlinkPolicy()
+	c.overrideFile = opts.OverrideFile()
+	for primary, mirrors := range opts.RegistryMirrors() {
+		c.SetRegistryMirrors(primary, mirrors)
+	}
 
 	kclPkg, err := pkg.LoadKclPkg(pkgPath)
 	if err != nil {
 		return nil, err
 	}
 
-	kclPkg.SetVendorMode(opts.IsVendor())
+	kclPkg.SetVendorModeWithOpts(opts.VendorMode())
+	if len(opts.VersionOverride()) != 0 {
+		kclPkg.ModFile.OverrideVersion(opts.VersionOverride())
+		opts.Merge(kcl.WithOptions(fmt.Sprintf("%s=%s", constants.PKG_VERSION_ARG, opts.VersionOverride())))
+	}
 
 	globalPkgPath, err := env.GetAbsPkgPath()
 	if err != nil {
@@ -353,6 +1136,14 @@ func (c *KpmClient) CompileWithOpts(opts *opt.CompileOptions) (*kcl.KCLResultLis
 	if err != (*reporter.KpmEvent)(nil) {
 		return nil, err
 	}
+	fallbackEntry := ""
+	// The kcl files in the settings files are compiled instead of the fallback entry.
+	if len(opts.Entries()) == 0 && !opts.HasSettingsYaml() {
+		fallbackEntry, err = kclPkg.GetFallbackEntry()
+		if err != nil {
+			return nil, err
+		}
+	}
 	// add all the options from 'kcl.mod'
 	opts.Merge(*kclPkg.GetKclOpts())
 	if len(opts.Entries()) > 0 {
@@ -364,9 +1155,9 @@ func (c *KpmClient) CompileWithOpts(opts *opt.CompileOptions) (*kcl.KCLResultLis
 				opts.Merge(kcl.WithKFilenames(filepath.Join(opts.PkgPath(), entry)))
 			}
 		}
-	} else if len(kclPkg.GetEntryKclFilesFromModFile()) == 0 && !opts.HasSettingsYaml() {
-		// no entry
-		opts.Merge(kcl.WithKFilenames(opts.PkgPath()))
+	} else if len(fallbackEntry) != 0 {
+		// add the fallback entry from the 'entry' in 'kcl.mod'
+		opts.Merge(kcl.WithKFilenames(fallbackEntry))
 	}
 	opts.Merge(kcl.WithWorkDir(opts.PkgPath()))
 
@@ -386,6 +1177,15 @@ func (c *KpmClient) CompileWithOpts(opts *opt.CompileOptions) (*kcl.KCLResultLis
 // CompilePkgWithOpts will compile the kcl package with the compile options.
 func (c *KpmClient) CompilePkgWithOpts(kclPkg *pkg.KclPkg, opts *opt.CompileOptions) (*kcl.KCLResultList, error) {
 	opts.SetPkgPath(kclPkg.HomePath)
+	var fallbackEntry string
+	var err error
+	// The kcl files in the settings files are compiled instead of the fallback entry.
+	if len(opts.Entries()) == 0 && !opts.HasSettingsYaml() {
+		fallbackEntry, err = kclPkg.GetFallbackEntry()
+		if err != nil {
+			return nil, err
+		}
+	}
 	if len(opts.Entries()) > 0 {
 		// add entry from '--input'
 		for _, entry := range opts.Entries() {
@@ -398,9 +1198,10 @@ func (c *KpmClient) CompilePkgWithOpts(kclPkg *pkg.KclPkg, opts *opt.CompileOpti
 		// add entry from 'kcl.mod'
 	} else if len(kclPkg.GetEntryKclFilesFromModFile()) > 0 {
 		opts.Merge(*kclPkg.GetKclOpts())
-	} else if !opts.HasSettingsYaml() {
-		// no entry
-		opts.Merge(kcl.WithKFilenames(opts.PkgPath()))
+	} else if len(fallbackEntry) != 0 {
+		// add the fallback entry from the 'entry' in 'kcl.mod'
+		opts.Merge(*kclPkg.GetKclOpts())
+		opts.Merge(kcl.WithKFilenames(fallbackEntry))
 	}
 	opts.Merge(kcl.WithWorkDir(opts.PkgPath()))
 	// Calculate the absolute path of entry file described by '--input'.
@@ -425,7 +1226,7 @@ func (c *KpmClient) CompileTarPkg(tarPath string, opts *opt.CompileOptions) (*kc
 	// e.g.
 	// 'xxx/xxx/xxx/test.tar' will be extracted to the directory 'xxx/xxx/xxx/test'.
 	destDir := strings.TrimSuffix(absTarPath, filepath.Ext(absTarPath))
-	err = utils.UnTarDir(absTarPath, destDir)
+	err = utils.UnTarDirWithSymlinks(absTarPath, destDir, opts.SymlinkPolicy().CheckSymlink)
 	if err != nil {
 		return nil, err
 	}
@@ -479,7 +1280,7 @@ func (c *KpmClient) CompileOciPkg(ociSource, version string, opts *opt.CompileOp
 
 // createIfNotExist will create a file if it does not exist.
 func (c *KpmClient) createIfNotExist(filepath string, storeFunc func() error) error {
-	reporter.ReportMsgTo(fmt.Sprintf("creating new :%s", filepath), c.GetLogWriter())
+	reporter.ReportMsgTo(fmt.Sprintf("creating new :%s", filepath), c.logWriterAt(reporter.InfoLevel))
 	err := utils.CreateFileIfNotExist(
 		filepath,
 		storeFunc,
@@ -489,7 +1290,7 @@ func (c *KpmClient) createIfNotExist(filepath string, storeFunc func() error) er
 			if errEvent.Type() != reporter.FileExists {
 				return err
 			} else {
-				reporter.ReportMsgTo(fmt.Sprintf("'%s' already exists", filepath), c.GetLogWriter())
+				reporter.ReportMsgTo(fmt.Sprintf("'%s' already exists", filepath), c.logWriterAt(reporter.InfoLevel))
 			}
 		} else {
 			return err
@@ -529,10 +1330,14 @@ func (c *KpmClient) AddDepWithOpts(kclPkg *pkg.KclPkg, opt *opt.AddOptions) (*pk
 	if err != nil {
 		return nil, err
 	}
+	// The registry is declared in kcl.mod if it is not the default one.
+	if d.Source.Oci != nil && d.Source.Oci.Reg != c.GetSettings().DefaultOciRegistry() {
+		d.Source.Oci.DeclaredReg = d.Source.Oci.Reg
+	}
 
 	reporter.ReportMsgTo(
 		fmt.Sprintf("adding dependency '%s'", d.Name),
-		c.logWriter,
+		c.logWriterAt(reporter.InfoLevel),
 	)
 	// 2. download the dependency to the local path.
 	err = c.AddDepToPkg(kclPkg, d)
@@ -553,7 +1358,7 @@ func (c *KpmClient) AddDepWithOpts(kclPkg *pkg.KclPkg, opt *opt.AddOptions) (*pk
 
 	reporter.ReportMsgTo(
 		fmt.Sprintf("add dependency '%s' successfully", succeedMsgInfo),
-		c.logWriter,
+		c.logWriterAt(reporter.InfoLevel),
 	)
 	return kclPkg, nil
 }
@@ -567,7 +1372,7 @@ func (c *KpmClient) AddDepToPkg(kclPkg *pkg.KclPkg, d *pkg.Dependency) error {
 	}
 
 	// download all the dependencies.
-	changedDeps, err := c.downloadDeps(kclPkg.ModFile.Dependencies, kclPkg.Dependencies)
+	changedDeps, err := c.downloadDeps(c.depsToDownload(kclPkg.ModFile.Dependencies), kclPkg.Dependencies)
 
 	if err != nil {
 		return err
@@ -621,6 +1426,29 @@ func (c *KpmClient) Package(kclPkg *pkg.KclPkg, tarPath string, vendorMode bool)
 	return nil
 }
 
+// PackageToWriter will package the current kcl package into a tar and write the tar to 'w' without intermediate files.
+// The files matching the patterns in '.kpmignore' will not be included in the tar.
+func (c *KpmClient) PackageToWriter(kclPkg *pkg.KclPkg, w io.Writer, vendorMode bool) error {
+	// Vendor all the dependencies into the current kcl package.
+	if vendorMode {
+		err := c.VendorDeps(kclPkg)
+		if err != nil {
+			return reporter.NewErrorEvent(reporter.FailedVendor, err, "failed to vendor dependencies")
+		}
+	}
+
+	ignorePatterns, err := utils.LoadIgnoreFile(filepath.Join(kclPkg.HomePath, constants.KPM_IGNORE_FILE))
+	if err != nil {
+		return err
+	}
+
+	err = utils.TarDirToWriter(kclPkg.HomePath, w, ignorePatterns)
+	if err != nil {
+		return reporter.NewErrorEvent(reporter.FailedPackage, err, "failed to package the kcl module")
+	}
+	return nil
+}
+
 // VendorDeps will vendor all the dependencies of the current kcl package.
 func (c *KpmClient) VendorDeps(kclPkg *pkg.KclPkg) error {
 	// Mkdir the dir "vendor".
@@ -642,6 +1470,10 @@ func (c *KpmClient) VendorDeps(kclPkg *pkg.KclPkg) error {
 		if len(d.Name) == 0 {
 			return errors.InvalidDependency
 		}
+		// The transitive dependencies are left in the global cache if only the direct dependencies are vendored.
+		if !kclPkg.IsVendoredDep(d.Name) {
+			continue
+		}
 		vendorFullPath := filepath.Join(vendorPath, d.FullName)
 		// If the package already exists in the 'vendor', do nothing.
 		if utils.DirExists(vendorFullPath) && check(d, vendorFullPath) {
@@ -687,15 +1519,25 @@ func (c *KpmClient) FillDepInfo(dep *pkg.Dependency) error {
 		return nil
 	}
 	if dep.Source.Oci != nil {
-		dep.Source.Oci.Reg = c.GetSettings().DefaultOciRegistry()
+		// The registry declared in kcl.mod is kept.
+		if len(dep.Source.Oci.Reg) == 0 {
+			dep.Source.Oci.Reg = c.GetSettings().DefaultOciRegistry()
+		}
 		urlpath := utils.JoinPath(c.GetSettings().DefaultOciRepo(), dep.Name)
 		dep.Source.Oci.Repo = urlpath
+		if len(c.moduleProxy) != 0 {
+			return c.fillDepInfoFromProxy(dep)
+		}
+		fetchOci := *dep.Source.Oci
+		if len(c.pullThroughCache) != 0 {
+			fetchOci = pullThroughCacheOci(dep.Source.Oci, c.pullThroughCache)
+		}
 		manifest := ocispec.Manifest{}
 		jsonDesc, err := c.FetchOciManifestIntoJsonStr(opt.OciFetchOptions{
 			FetchBytesOptions: oras.DefaultFetchBytesOptions,
 			OciOptions: opt.OciOptions{
-				Reg:  c.GetSettings().DefaultOciRegistry(),
-				Repo: fmt.Sprintf("%s/%s", c.GetSettings().DefaultOciRepo(), dep.Name),
+				Reg:  fetchOci.Reg,
+				Repo: fetchOci.Repo,
 				Tag:  dep.Version,
 			},
 		})
@@ -731,8 +1573,13 @@ func (c *KpmClient) FillDependenciesInfo(modFile *pkg.ModFile) error {
 
 // Download will download the dependency to the local path.
 func (c *KpmClient) Download(dep *pkg.Dependency, localPath string) (*pkg.Dependency, error) {
+	return c.DownloadWithContext(context.Background(), dep, localPath)
+}
+
+// DownloadWithContext will download the dependency to the local path, the download is stopped if 'ctx' is cancelled.
+func (c *KpmClient) DownloadWithContext(ctx context.Context, dep *pkg.Dependency, localPath string) (*pkg.Dependency, error) {
 	if dep.Source.Git != nil {
-		_, err := c.DownloadFromGit(dep.Source.Git, localPath)
+		_, err := c.downloadFromGit(ctx, dep.Source.Git, localPath)
 		if err != nil {
 			return nil, err
 		}
@@ -755,7 +1602,10 @@ func (c *KpmClient) Download(dep *pkg.Dependency, localPath string) (*pkg.Depend
 	}
 
 	if dep.Source.Oci != nil {
-		localPath, err := c.DownloadFromOci(dep.Source.Oci, localPath)
+		if err := c.checkRegistryAllowed(dep); err != nil {
+			return nil, err
+		}
+		localPath, err := c.downloadFromOciWithMirrors(ctx, dep, localPath)
 		if err != nil {
 			return nil, err
 		}
@@ -775,6 +1625,23 @@ func (c *KpmClient) Download(dep *pkg.Dependency, localPath string) (*pkg.Depend
 		dep.LocalFullPath = dep.Source.Local.Path
 	}
 
+	if dep.Source.LocalRegistry != nil {
+		localPath, err := c.DownloadFromLocalRegistry(dep.Name, dep.Source.LocalRegistry, localPath)
+		if err != nil {
+			return nil, err
+		}
+		dep.Version = dep.Source.LocalRegistry.Version
+		dep.LocalFullPath = localPath
+		// Creating symbolic links in a global cache is not an optimal solution.
+		// This allows kclvm to locate the package by default.
+		// This feature is unstable and will be removed soon.
+		err = utils.CreateSymlink(dep.LocalFullPath, filepath.Join(filepath.Dir(localPath), dep.Name))
+		if err != nil {
+			return nil, err
+		}
+		dep.FullName = dep.GenDepFullName()
+	}
+
 	var err error
 	dep.Sum, err = utils.HashDir(dep.LocalFullPath)
 	if err != nil {
@@ -788,8 +1655,57 @@ func (c *KpmClient) Download(dep *pkg.Dependency, localPath string) (*pkg.Depend
 	return dep, nil
 }
 
+// DownloadFromLocalRegistry will extract the package 'name' from the tarball in the local directory registry into 'localPath'.
+func (c *KpmClient) DownloadFromLocalRegistry(name string, registry *pkg.LocalRegistry, localPath string) (string, error) {
+	tarPath := registry.GetTarPath(name)
+	reporter.ReportMsgTo(
+		fmt.Sprintf("extracting '%s' with version '%s' from the local registry '%s'", name, registry.Version, registry.Path),
+		c.logWriterAt(reporter.InfoLevel),
+	)
+
+	if !utils.DirExists(tarPath) {
+		return localPath, reporter.NewErrorEvent(
+			reporter.FailedGetPkg,
+			fmt.Errorf("'%s' not found", tarPath),
+			fmt.Sprintf("failed to get the package '%s' with version '%s' from the local registry '%s'", name, registry.Version, registry.Path),
+		)
+	}
+
+	err := utils.UnTarDirWithSymlinks(tarPath, localPath, c.symlinkPolicy.CheckSymlink)
+	if err != nil {
+		return localPath, reporter.NewErrorEvent(
+			reporter.FailedUntarKclPkg,
+			err,
+			fmt.Sprintf("failed to untar the package '%s' into '%s'", tarPath, localPath),
+		)
+	}
+
+	return localPath, nil
+}
+
 // DownloadFromGit will download the dependency from the git repository.
+// If the subdir of the git source is set, the repository is cloned into a temporary directory,
+// and only the kcl package in the subdir is copied into 'localPath'.
 func (c *KpmClient) DownloadFromGit(dep *pkg.Git, localPath string) (string, error) {
+	return c.downloadFromGit(context.Background(), dep, localPath)
+}
+
+// downloadFromGit will download the dependency from the git repository, the clone is stopped if 'ctx' is cancelled.
+func (c *KpmClient) downloadFromGit(ctx context.Context, dep *pkg.Git, localPath string) (string, error) {
+	subdir, err := dep.GetValidSubdir()
+	if err != nil {
+		return localPath, reporter.NewErrorEvent(reporter.InvalidKclPkg, err, fmt.Sprintf("invalid git dependency '%s'", dep.Url))
+	}
+
+	clonePath := localPath
+	if len(subdir) != 0 {
+		clonePath, err = os.MkdirTemp("", "kpm-git-")
+		if err != nil {
+			return localPath, reporter.NewErrorEvent(reporter.FailedCreateFile, err, "failed to create a temporary directory to clone the git repository")
+		}
+		defer os.RemoveAll(clonePath)
+	}
+
 	var msg string
 	if len(dep.Tag) != 0 {
 		msg = fmt.Sprintf("with tag '%s'", dep.Tag)
@@ -801,35 +1717,381 @@ func (c *KpmClient) DownloadFromGit(dep *pkg.Git, localPath string) (string, err
 
 	reporter.ReportMsgTo(
 		fmt.Sprintf("cloning '%s' %s", dep.Url, msg),
-		c.logWriter,
+		c.logWriterAt(reporter.InfoLevel),
 	)
 
-	_, err := git.CloneWithOpts(
+	_, err = git.CloneWithOpts(
 		git.WithCommit(dep.Commit),
 		git.WithTag(dep.Tag),
 		git.WithRepoURL(dep.Url),
-		git.WithLocalPath(localPath),
-		git.WithWriter(c.logWriter),
+		git.WithLocalPath(clonePath),
+		git.WithWriter(c.logWriterAt(reporter.InfoLevel)),
+		git.WithDepth(c.gitCloneDepth),
+		git.WithContext(ctx),
 	)
 
 	if err != nil {
 		return localPath, reporter.NewErrorEvent(
 			reporter.FailedCloneFromGit,
 			err,
-			fmt.Sprintf("failed to clone from '%s' into '%s'.", dep.Url, localPath),
+			fmt.Sprintf("failed to clone from '%s' into '%s'.", dep.Url, clonePath),
 		)
 	}
 
+	if len(subdir) != 0 {
+		return localPath, copyGitSubdir(filepath.Join(clonePath, subdir), localPath, dep)
+	}
+
 	return localPath, err
 }
 
+// copyGitSubdir will copy the kcl package in 'subdirPath' of the cloned git repository into 'localPath'.
+func copyGitSubdir(subdirPath, localPath string, dep *pkg.Git) error {
+	if !utils.DirExists(filepath.Join(subdirPath, pkg.MOD_FILE)) {
+		return reporter.NewErrorEvent(
+			reporter.InvalidKclPkg,
+			fmt.Errorf("'%s' not found in the subdir '%s'", pkg.MOD_FILE, dep.Subdir),
+			fmt.Sprintf("the subdir '%s' of '%s' is not a kcl package", dep.Subdir, dep.Url),
+		)
+	}
+
+	err := copy.Copy(subdirPath, localPath)
+	if err != nil {
+		return reporter.NewErrorEvent(
+			reporter.FailedCreateFile,
+			err,
+			fmt.Sprintf("failed to copy the subdir '%s' of '%s' into '%s'", dep.Subdir, dep.Url, localPath),
+		)
+	}
+	return nil
+}
+
+// downloadFromOciWithMirrors will download the dependency from the oci repository.
+// If the download from the registry of the dependency fails, the mirrors of the registry will be tried in order.
+// The package from the mirror is accepted only if its checksum is the same as the checksum of the dependency,
+// or if the dependency is not locked, the digest of its manifest is the same as the one in the registry of the dependency.
+// The mirrors are not tried for the dependency without a version, whose package from the mirrors can not be verified.
+// If the module proxy is set, the dependency is downloaded from the proxy instead of the registry, the mirrors and the pull-through cache.
+// If the pull-through cache is set, the dependency is downloaded from the cache instead of the registry and the mirrors.
+func (c *KpmClient) downloadFromOciWithMirrors(ctx context.Context, dep *pkg.Dependency, localPath string) (string, error) {
+	if len(c.moduleProxy) != 0 {
+		return c.downloadFromModuleProxy(ctx, dep, localPath)
+	}
+	if len(c.pullThroughCache) != 0 {
+		return c.downloadFromPullThroughCache(ctx, dep, localPath)
+	}
+	primary := dep.Source.Oci.Reg
+	pulledPath, err := c.downloadFromOci(ctx, dep.Source.Oci, localPath)
+	if err == nil || len(c.registryMirrors[primary]) == 0 {
+		if err == nil {
+			c.recordPullSource(dep.Name, primary)
+		}
+		return pulledPath, err
+	}
+
+	errs := []string{fmt.Sprintf("'%s': %s", primary, strings.TrimSpace(err.Error()))}
+	mirrors := c.registryMirrors[primary]
+	if len(dep.Source.Oci.Tag) == 0 {
+		errs = append(errs, fmt.Sprintf("the mirrors are not tried, the version of '%s' is required to verify the packages from them", dep.Name))
+		mirrors = nil
+	}
+	// The digest of the manifest in the primary registry to verify the packages from the mirrors if the dependency is not locked.
+	var primaryDigest string
+	for _, mirror := range mirrors {
+		if !c.isAllowedRegistry(mirror) {
+			errs = append(errs, fmt.Sprintf("'%s': the registry is not allowed", mirror))
+			continue
+		}
+		reporter.ReportMsgTo(
+			fmt.Sprintf("failed to pull '%s' from '%s', trying the mirror '%s'", dep.Name, primary, mirror),
+			c.logWriterAt(reporter.InfoLevel),
+		)
+
+		mirrorOci := *dep.Source.Oci
+		mirrorOci.Reg = mirror
+		if len(dep.Sum) == 0 {
+			if len(primaryDigest) == 0 {
+				primaryDigest, err = c.resolveOciDigest(ctx, dep.Source.Oci)
+				if err != nil {
+					errs = append(errs, fmt.Sprintf("the checksum of '%s' is not locked and its digest can not be resolved from '%s', the packages from the mirrors can not be verified: %s", dep.Name, primary, strings.TrimSpace(err.Error())))
+					break
+				}
+			}
+			mirrorDigest, err := c.resolveOciDigest(ctx, &mirrorOci)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("'%s': %s", mirror, strings.TrimSpace(err.Error())))
+				continue
+			}
+			if mirrorDigest != primaryDigest {
+				errs = append(errs, fmt.Sprintf("'%s': the digest '%s' of '%s' is not the same as '%s' from '%s'", mirror, mirrorDigest, dep.Name, primaryDigest, primary))
+				continue
+			}
+		}
+
+		// Clean the package pulled from the previous registry.
+		os.RemoveAll(localPath)
+		pulledPath, err := c.downloadFromOci(ctx, &mirrorOci, localPath)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("'%s': %s", mirror, strings.TrimSpace(err.Error())))
+			continue
+		}
+
+		if len(dep.Sum) != 0 && !utils.CheckPackageSum(dep.Sum, pulledPath) {
+			errs = append(errs, fmt.Sprintf("'%s': the checksum of '%s' is not the same as the package from '%s'", mirror, dep.Name, primary))
+			continue
+		}
+
+		c.recordPullSource(dep.Name, mirror)
+		reporter.ReportMsgTo(fmt.Sprintf("pulled '%s' from the mirror '%s'", dep.Name, mirror), c.logWriterAt(reporter.InfoLevel))
+		return pulledPath, nil
+	}
+
+	os.RemoveAll(localPath)
+	return "", reporter.NewErrorEvent(
+		reporter.FailedGetPkg,
+		fmt.Errorf("%s", strings.Join(errs, "\n")),
+		fmt.Sprintf("failed to pull '%s' from '%s' and its mirrors", dep.Name, primary),
+	)
+}
+
+// resolveOciDigest returns the digest of the manifest of the oci dependency 'source' in its registry.
+func (c *KpmClient) resolveOciDigest(ctx context.Context, source *pkg.Oci) (string, error) {
+	ociClient, err := c.newOciClientForDep(source)
+	if err != nil {
+		return "", err
+	}
+	ociClient.SetContext(ctx)
+	return ociClient.ResolveDigest(source.Tag)
+}
+
+// downloadFromPullThroughCache will download the oci dependency from the pull-through cache rather than its registry.
+// The package is verified by the checksum of its content, so the package served by the cache under another repository
+// is accepted if it is the same as the one locked, and the registry and the repository of the dependency are kept in 'kcl.mod.lock'.
+func (c *KpmClient) downloadFromPullThroughCache(ctx context.Context, dep *pkg.Dependency, localPath string) (string, error) {
+	cacheOci := pullThroughCacheOci(dep.Source.Oci, c.pullThroughCache)
+	pulledPath, err := c.downloadFromOci(ctx, &cacheOci, localPath)
+	if err != nil {
+		return "", reporter.NewErrorEvent(
+			reporter.FailedGetPkg,
+			err,
+			fmt.Sprintf("failed to pull '%s' from the pull-through cache '%s'", dep.Name, c.pullThroughCache),
+		)
+	}
+	if !c.noSumCheck && len(dep.Sum) != 0 && !utils.CheckPackageSum(dep.Sum, pulledPath) {
+		os.RemoveAll(pulledPath)
+		return "", reporter.NewErrorEvent(
+			reporter.CheckSumMismatch,
+			fmt.Errorf("the checksum of '%s' from '%s/%s' is not '%s'", dep.Name, cacheOci.Reg, cacheOci.Repo, dep.Sum),
+			fmt.Sprintf("the package served by the pull-through cache '%s' is not the same as the one from '%s'", c.pullThroughCache, dep.Source.Oci.Reg),
+		)
+	}
+
+	dep.Source.Oci.Tag = cacheOci.Tag
+	c.recordPullSource(dep.Name, cacheOci.Reg)
+	return pulledPath, nil
+}
+
+// pullThroughCacheOci returns the copy of the oci source 'source' served by the pull-through cache 'cache',
+// which is the host of the cache with an optional path, e.g. the repository 'kcl-lang/k8s' is served
+// under 'proxy/kcl-lang/k8s' by 'cache.example.com/proxy'.
+func pullThroughCacheOci(source *pkg.Oci, cache string) pkg.Oci {
+	cacheOci := *source
+	host, path, _ := strings.Cut(strings.Trim(cache, "/"), "/")
+	cacheOci.Reg = host
+	if len(path) != 0 {
+		cacheOci.Repo = utils.JoinPath(path, source.Repo)
+	}
+	return cacheOci
+}
+
+// downloadFromModuleProxy will download the oci dependency from the module proxy rather than its registry.
+// The latest version listed by the proxy is selected if the version of the dependency is empty.
+// The package is accepted only if its content matches the checksum served by the proxy,
+// and the checksum served by the proxy is the same as the one in 'kcl.mod.lock' unless the checksum check is disabled.
+func (c *KpmClient) downloadFromModuleProxy(ctx context.Context, dep *pkg.Dependency, localPath string) (string, error) {
+	source := dep.Source.Oci
+	if len(source.Tag) == 0 {
+		tag, err := c.latestProxyVersion(ctx, source)
+		if err != nil {
+			return "", err
+		}
+		reporter.ReportMsgTo(
+			fmt.Sprintf("the lastest version '%s' will be added", tag),
+			c.logWriterAt(reporter.InfoLevel),
+		)
+		source.Tag = tag
+		localPath = localPath + tag
+	}
+
+	reporter.ReportMsgTo(
+		fmt.Sprintf("downloading '%s:%s' from the module proxy '%s'", source.Repo, source.Tag, c.moduleProxy),
+		c.logWriterAt(reporter.InfoLevel),
+	)
+
+	sum, err := c.fetchProxySum(ctx, source)
+	if err != nil {
+		return "", err
+	}
+	if !c.noSumCheck && len(dep.Sum) != 0 && dep.Sum != sum {
+		return "", reporter.NewErrorEvent(
+			reporter.CheckSumMismatch,
+			fmt.Errorf("the checksum of '%s:%s' served by the module proxy is '%s', but '%s' is locked", dep.Name, source.Tag, sum, dep.Sum),
+			fmt.Sprintf("the package served by the module proxy '%s' is not the same as the one locked", c.moduleProxy),
+		)
+	}
+
+	tarFile, err := os.CreateTemp("", "kpm-proxy-*.tar")
+	if err != nil {
+		return "", reporter.NewErrorEvent(reporter.FailedCreateFile, err, "failed to create the file for the package from the module proxy")
+	}
+	defer os.Remove(tarFile.Name())
+	err = c.fetchFromModuleProxy(ctx, source, source.Tag+".tar", tarFile)
+	tarFile.Close()
+	if err != nil {
+		return "", reporter.NewErrorEvent(
+			reporter.FailedGetPkg,
+			err,
+			fmt.Sprintf("failed to fetch '%s:%s' from the module proxy '%s'", dep.Name, source.Tag, c.moduleProxy),
+		)
+	}
+
+	err = utils.UnTarDirWithSymlinks(tarFile.Name(), localPath, c.symlinkPolicy.CheckSymlink)
+	if err != nil {
+		os.RemoveAll(localPath)
+		return "", reporter.NewErrorEvent(
+			reporter.FailedUntarKclPkg,
+			err,
+			fmt.Sprintf("failed to untar the kcl package from the module proxy into '%s'.", localPath),
+		)
+	}
+	if !utils.CheckPackageSum(sum, localPath) {
+		os.RemoveAll(localPath)
+		return "", reporter.NewErrorEvent(
+			reporter.CheckSumMismatch,
+			fmt.Errorf("the checksum of the package '%s:%s' is not '%s'", dep.Name, source.Tag, sum),
+			fmt.Sprintf("the package served by the module proxy '%s' does not match its checksum", c.moduleProxy),
+		)
+	}
+
+	c.recordPullSource(dep.Name, c.moduleProxy)
+	return localPath, nil
+}
+
+// fillDepInfoFromProxy will fill the version and the checksum of the oci dependency 'dep' from the module proxy,
+// the latest version listed by the proxy is selected if the version of the dependency is empty.
+func (c *KpmClient) fillDepInfoFromProxy(dep *pkg.Dependency) error {
+	if len(dep.Version) == 0 {
+		tag, err := c.latestProxyVersion(context.Background(), dep.Source.Oci)
+		if err != nil {
+			return err
+		}
+		dep.Version = tag
+		dep.Source.Oci.Tag = tag
+	}
+	source := *dep.Source.Oci
+	source.Tag = dep.Version
+	sum, err := c.fetchProxySum(context.Background(), &source)
+	if err != nil {
+		return err
+	}
+	dep.Sum = sum
+	return nil
+}
+
+// latestProxyVersion returns the latest version of the oci dependency 'source' listed by the module proxy.
+func (c *KpmClient) latestProxyVersion(ctx context.Context, source *pkg.Oci) (string, error) {
+	var list bytes.Buffer
+	err := c.fetchFromModuleProxy(ctx, source, "list", &list)
+	if err != nil {
+		return "", reporter.NewErrorEvent(
+			reporter.FailedGetPackageVersions,
+			err,
+			fmt.Sprintf("failed to list the versions of '%s' from the module proxy '%s'", source.Repo, c.moduleProxy),
+		)
+	}
+	versions := strings.Fields(list.String())
+	if len(versions) == 0 {
+		return "", reporter.NewErrorEvent(
+			reporter.FailedSelectLatestVersion,
+			fmt.Errorf("no versions of '%s' are listed", source.Repo),
+			fmt.Sprintf("failed to select the latest version of '%s' from the module proxy '%s'", source.Repo, c.moduleProxy),
+		)
+	}
+	return semver.LatestVersion(versions)
+}
+
+// fetchProxySum returns the checksum of the version 'source.Tag' of the oci dependency 'source' served by the module proxy.
+func (c *KpmClient) fetchProxySum(ctx context.Context, source *pkg.Oci) (string, error) {
+	var sum bytes.Buffer
+	err := c.fetchFromModuleProxy(ctx, source, source.Tag+".sum", &sum)
+	if err == nil && len(strings.TrimSpace(sum.String())) == 0 {
+		err = fmt.Errorf("the checksum is empty")
+	}
+	if err != nil {
+		return "", reporter.NewErrorEvent(
+			reporter.FailedGetPkg,
+			err,
+			fmt.Sprintf("failed to fetch the checksum of '%s:%s' from the module proxy '%s'", source.Repo, source.Tag, c.moduleProxy),
+		)
+	}
+	return strings.TrimSpace(sum.String()), nil
+}
+
+// fetchFromModuleProxy will write the file 'file' of the oci dependency 'source' served by the module proxy into 'w'.
+// The files of a dependency are served under '<proxy>/<registry>/<repository>/@v/', e.g. 'https://proxy.example.com/ghcr.io/kcl-lang/k8s/@v/list'.
+func (c *KpmClient) fetchFromModuleProxy(ctx context.Context, source *pkg.Oci, file string, w io.Writer) error {
+	url := utils.JoinPath(c.moduleProxy, utils.JoinPath(utils.JoinPath(source.Reg, source.Repo), "@v/"+file))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", c.GetUserAgent())
+	proxyClient := c.proxyClient
+	if proxyClient == nil {
+		proxyClient = &http.Client{Timeout: DefaultModuleProxyTimeout}
+	}
+	resp, err := proxyClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("'%s' responded with '%s'", url, resp.Status)
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// recordPullSource will record the registry which the dependency is pulled from.
+func (c *KpmClient) recordPullSource(depName, registry string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pullSources == nil {
+		c.pullSources = make(map[string]string)
+	}
+	c.pullSources[depName] = registry
+}
+
 // DownloadFromOci will download the dependency from the oci repository.
 func (c *KpmClient) DownloadFromOci(dep *pkg.Oci, localPath string) (string, error) {
-	ociClient, err := oci.NewOciClient(dep.Reg, dep.Repo, &c.settings)
+	return c.downloadFromOci(context.Background(), dep, localPath)
+}
+
+// downloadFromOci will download the dependency from the oci repository, the pull is stopped if 'ctx' is cancelled.
+func (c *KpmClient) downloadFromOci(ctx context.Context, dep *pkg.Oci, localPath string) (string, error) {
+	ociClient, err := c.newOciClientForDep(dep)
 	if err != nil {
 		return "", err
 	}
-	ociClient.SetLogWriter(c.logWriter)
+	ociClient.SetContext(ctx)
+	ociClient.SetLogWriter(c.logWriterAt(reporter.InfoLevel))
+	if len(c.targetPlatform) != 0 {
+		platform, err := oci.ParsePlatform(c.targetPlatform)
+		if err != nil {
+			return "", err
+		}
+		ociClient.SetTargetPlatform(platform)
+	}
 	// Select the latest tag, if the tag, the user inputed, is empty.
 	var tagSelected string
 	if len(dep.Tag) == 0 {
@@ -840,7 +2102,7 @@ func (c *KpmClient) DownloadFromOci(dep *pkg.Oci, localPath string) (string, err
 
 		reporter.ReportMsgTo(
 			fmt.Sprintf("the lastest version '%s' will be added", tagSelected),
-			c.logWriter,
+			c.logWriterAt(reporter.InfoLevel),
 		)
 
 		dep.Tag = tagSelected
@@ -851,7 +2113,7 @@ func (c *KpmClient) DownloadFromOci(dep *pkg.Oci, localPath string) (string, err
 
 	reporter.ReportMsgTo(
 		fmt.Sprintf("downloading '%s:%s' from '%s/%s:%s'", dep.Repo, tagSelected, dep.Reg, dep.Repo, tagSelected),
-		c.logWriter,
+		c.logWriterAt(reporter.InfoLevel),
 	)
 
 	// Pull the package with the tag.
@@ -878,7 +2140,7 @@ func (c *KpmClient) DownloadFromOci(dep *pkg.Oci, localPath string) (string, err
 	}
 
 	tarPath := matches[0]
-	untarErr := utils.UnTarDir(tarPath, localPath)
+	untarErr := utils.UnTarDirWithSymlinks(tarPath, localPath, c.symlinkPolicy.CheckSymlink)
 	if untarErr != nil {
 		return "", reporter.NewErrorEvent(
 			reporter.FailedUntarKclPkg,
@@ -919,12 +2181,12 @@ func (c *KpmClient) PullFromOci(localPath, source, tag string) error {
 	if len(tag) == 0 {
 		reporter.ReportMsgTo(
 			fmt.Sprintf("start to pull '%s'", source),
-			c.logWriter,
+			c.logWriterAt(reporter.InfoLevel),
 		)
 	} else {
 		reporter.ReportMsgTo(
 			fmt.Sprintf("start to pull '%s' with tag '%s'", source, tag),
-			c.logWriter,
+			c.logWriterAt(reporter.InfoLevel),
 		)
 	}
 
@@ -963,7 +2225,7 @@ func (c *KpmClient) PullFromOci(localPath, source, tag string) error {
 
 	// Untar the tar file.
 	storagePath := ociOpts.AddStoragePathSuffix(localPath)
-	err = utils.UnTarDir(matches[0], storagePath)
+	err = utils.UnTarDirWithSymlinks(matches[0], storagePath, c.symlinkPolicy.CheckSymlink)
 	if err != nil {
 		return reporter.NewErrorEvent(
 			reporter.FailedUntarKclPkg,
@@ -974,19 +2236,19 @@ func (c *KpmClient) PullFromOci(localPath, source, tag string) error {
 
 	reporter.ReportMsgTo(
 		fmt.Sprintf("pulled '%s' in '%s' successfully", source, storagePath),
-		c.logWriter,
+		c.logWriterAt(reporter.InfoLevel),
 	)
 	return nil
 }
 
 // PushToOci will push a kcl package to oci registry.
 func (c *KpmClient) PushToOci(localPath string, ociOpts *opt.OciOptions) error {
-	ociCli, err := oci.NewOciClient(ociOpts.Reg, ociOpts.Repo, &c.settings)
+	ociCli, err := c.newOciClient(ociOpts.Reg, ociOpts.Repo)
 	if err != nil {
 		return err
 	}
 
-	ociCli.SetLogWriter(c.logWriter)
+	ociCli.SetLogWriter(c.logWriterAt(reporter.InfoLevel))
 
 	exist, err := ociCli.ContainsTag(ociOpts.Tag)
 	if err != (*reporter.KpmEvent)(nil) {
@@ -1050,14 +2312,14 @@ func (c *KpmClient) ParseOciOptionFromString(oci string, tag string) (*opt.OciOp
 					reporter.InvalidFlag,
 					"kpm get version from oci reference '<repo_name>:<repo_tag>'",
 				),
-				c.logWriter,
+				c.logWriterAt(reporter.InfoLevel),
 			)
 			reporter.ReportEventTo(
 				reporter.NewEvent(
 					reporter.InvalidFlag,
 					"arg '--tag' is invalid for oci reference",
 				),
-				c.logWriter,
+				c.logWriterAt(reporter.InfoLevel),
 			)
 		}
 		return ociOpt, nil
@@ -1070,6 +2332,10 @@ func (c *KpmClient) ParseOciOptionFromString(oci string, tag string) (*opt.OciOp
 
 // dependencyExists will check whether the dependency exists in the local filesystem.
 func (c *KpmClient) dependencyExists(dep *pkg.Dependency, lockDeps *pkg.Dependencies) *pkg.Dependency {
+	// The cached dependency of an expired mutable ref is fetched again.
+	if c.isExpiredMutableRef(dep, filepath.Join(c.homePath, dep.FullName)) {
+		return nil
+	}
 
 	// If the flag '--no_sum_check' is set, skip the checksum check.
 	if c.noSumCheck {
@@ -1092,12 +2358,18 @@ func (c *KpmClient) dependencyExists(dep *pkg.Dependency, lockDeps *pkg.Dependen
 }
 
 // downloadDeps will download all the dependencies of the current kcl package.
+// The dependencies are downloaded concurrently. If 'failFast' is set, the other downloads are cancelled on the first failure,
+// the failures retriable are already retried by the clients of the registries. Otherwise, all the downloads are completed
+// and the failures are reported together in the order of the names of the dependencies.
 func (c *KpmClient) downloadDeps(deps pkg.Dependencies, lockDeps pkg.Dependencies) (*pkg.Dependencies, error) {
 	newDeps := pkg.Dependencies{
 		Deps: make(map[string]pkg.Dependency),
 	}
+	// The failures of downloading the dependencies if not failing fast, the key is the name of the dependency.
+	failures := make(map[string]error)
 
 	// Traverse all dependencies in kcl.mod
+	var toDownload []pkg.Dependency
 	for _, d := range deps.Deps {
 		if len(d.Name) == 0 {
 			return nil, errors.InvalidDependency
@@ -1105,41 +2377,56 @@ func (c *KpmClient) downloadDeps(deps pkg.Dependencies, lockDeps pkg.Dependencie
 
 		existDep := c.dependencyExists(&d, &lockDeps)
 		if existDep != nil {
+			c.debugf("'%s' with version '%s' already exists in '%s'", d.Name, d.Version, filepath.Join(c.homePath, d.FullName))
 			newDeps.Deps[d.Name] = *existDep
 			continue
 		}
 
-		expectedSum := lockDeps.Deps[d.Name].Sum
-		// Clean the cache
 		if len(c.homePath) == 0 || len(d.FullName) == 0 {
 			return nil, errors.InternalBug
 		}
-		dir := filepath.Join(c.homePath, d.FullName)
-		os.RemoveAll(dir)
-
-		// download dependencies
-
-		lockedDep, err := c.Download(&d, dir)
-		if err != nil {
-			return nil, err
-		}
-
-		if !lockedDep.IsFromLocal() {
-			if !c.noSumCheck && expectedSum != "" &&
-				lockedDep.Sum != expectedSum &&
-				existDep != nil &&
-				existDep.FullName == d.FullName {
-				return nil, reporter.NewErrorEvent(
-					reporter.CheckSumMismatch,
-					errors.CheckSumMismatchError,
-					fmt.Sprintf("checksum for '%s' changed in lock file", lockedDep.Name),
-				)
+		toDownload = append(toDownload, d)
+	}
+
+	// The mutex of 'newDeps', 'lockDeps' and 'failures' updated by the downloads.
+	var mu sync.Mutex
+	group, ctx := errgroup.WithContext(context.Background())
+	for _, d := range toDownload {
+		d := d
+		group.Go(func() error {
+			// Clean the cache
+			dir := filepath.Join(c.homePath, d.FullName)
+			os.RemoveAll(dir)
+
+			// download dependencies
+			lockedDep, err := c.DownloadWithContext(ctx, &d, dir)
+			if err != nil {
+				if c.failFast {
+					return err
+				}
+				mu.Lock()
+				failures[d.Name] = err
+				mu.Unlock()
+				return nil
+			}
+			c.debugf("downloaded '%s' with version '%s' and checksum '%s' into '%s'", lockedDep.Name, lockedDep.Version, lockedDep.Sum, dir)
+			if lockedDep.IsFromLocal() {
+				c.recordOrigin(d.Name, OriginLocal)
+			} else {
+				c.recordOrigin(d.Name, OriginDownload)
 			}
-		}
 
-		// Update kcl.mod and kcl.mod.lock
-		newDeps.Deps[d.Name] = *lockedDep
-		lockDeps.Deps[d.Name] = *lockedDep
+			// Update kcl.mod and kcl.mod.lock
+			lockedDep.OverriddenBy = d.OverriddenBy
+			mu.Lock()
+			newDeps.Deps[d.Name] = *lockedDep
+			lockDeps.Deps[d.Name] = *lockedDep
+			mu.Unlock()
+			return nil
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, err
 	}
 
 	// Recursively download the dependencies of the new dependencies.
@@ -1160,7 +2447,11 @@ func (c *KpmClient) downloadDeps(deps pkg.Dependencies, lockDeps pkg.Dependencie
 		// Download the dependencies.
 		nested, err := c.downloadDeps(deppkg.ModFile.Dependencies, lockDeps)
 		if err != nil {
-			return nil, err
+			if c.failFast {
+				return nil, err
+			}
+			failures[d.Name] = err
+			continue
 		}
 
 		// Update kcl.mod.
@@ -1171,9 +2462,31 @@ func (c *KpmClient) downloadDeps(deps pkg.Dependencies, lockDeps pkg.Dependencie
 		}
 	}
 
+	if len(failures) != 0 {
+		names := make([]string, 0, len(failures))
+		for name := range failures {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		errs := make([]string, 0, len(names))
+		for _, name := range names {
+			errs = append(errs, fmt.Sprintf("'%s': %s", name, strings.TrimSpace(failures[name].Error())))
+		}
+		return nil, reporter.NewErrorEvent(
+			reporter.FailedGetPkg,
+			fmt.Errorf("%s", strings.Join(errs, "\n")),
+			"failed to download the dependencies",
+		)
+	}
 	return &newDeps, nil
 }
 
+// PullTarFromOci will pull a kcl package tar file from oci registry into 'localPath',
+// with the credential and the user-agent of the client.
+func (c *KpmClient) PullTarFromOci(localPath string, ociOpts *opt.OciOptions) error {
+	return c.pullTarFromOci(localPath, ociOpts)
+}
+
 // pullTarFromOci will pull a kcl package tar file from oci registry.
 func (c *KpmClient) pullTarFromOci(localPath string, ociOpts *opt.OciOptions) error {
 	absPullPath, err := filepath.Abs(localPath)
@@ -1181,12 +2494,12 @@ func (c *KpmClient) pullTarFromOci(localPath string, ociOpts *opt.OciOptions) er
 		return reporter.NewErrorEvent(reporter.Bug, err)
 	}
 
-	ociCli, err := oci.NewOciClient(ociOpts.Reg, ociOpts.Repo, &c.settings)
+	ociCli, err := c.newOciClient(ociOpts.Reg, ociOpts.Repo)
 	if err != nil {
 		return err
 	}
 
-	ociCli.SetLogWriter(c.logWriter)
+	ociCli.SetLogWriter(c.logWriterAt(reporter.InfoLevel))
 
 	var tagSelected string
 	if len(ociOpts.Tag) == 0 {
@@ -1196,7 +2509,7 @@ func (c *KpmClient) pullTarFromOci(localPath string, ociOpts *opt.OciOptions) er
 		}
 		reporter.ReportMsgTo(
 			fmt.Sprintf("the lastest version '%s' will be pulled", tagSelected),
-			c.logWriter,
+			c.logWriterAt(reporter.InfoLevel),
 		)
 	} else {
 		tagSelected = ociOpts.Tag
@@ -1205,7 +2518,7 @@ func (c *KpmClient) pullTarFromOci(localPath string, ociOpts *opt.OciOptions) er
 	full_repo := utils.JoinPath(ociOpts.Reg, ociOpts.Repo)
 	reporter.ReportMsgTo(
 		fmt.Sprintf("pulling '%s:%s' from '%s'", ociOpts.Repo, tagSelected, full_repo),
-		c.logWriter,
+		c.logWriterAt(reporter.InfoLevel),
 	)
 
 	err = ociCli.Pull(absPullPath, tagSelected)
@@ -1218,7 +2531,7 @@ func (c *KpmClient) pullTarFromOci(localPath string, ociOpts *opt.OciOptions) er
 
 // FetchOciManifestConfIntoJsonStr will fetch the oci manifest config of the kcl package from the oci registry and return it into json string.
 func (c *KpmClient) FetchOciManifestIntoJsonStr(opts opt.OciFetchOptions) (string, error) {
-	ociCli, err := oci.NewOciClient(opts.Reg, opts.Repo, &c.settings)
+	ociCli, err := c.newOciClient(opts.Reg, opts.Repo)
 	if err != nil {
 		return "", err
 	}
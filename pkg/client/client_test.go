@@ -7,18 +7,23 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/otiai10/copy"
 	"github.com/stretchr/testify/assert"
 	"kcl-lang.io/kpm/pkg/env"
 	"kcl-lang.io/kpm/pkg/opt"
 	pkg "kcl-lang.io/kpm/pkg/package"
+	"kcl-lang.io/kpm/pkg/reporter"
 	"kcl-lang.io/kpm/pkg/runner"
 	"kcl-lang.io/kpm/pkg/utils"
+	remoteauth "oras.land/oras-go/v2/registry/remote/auth"
 )
 
 const testDataDir = "test_data"
@@ -78,6 +83,130 @@ func TestDownloadOci(t *testing.T) {
 	assert.Equal(t, err, nil)
 }
 
+func TestDownloadFromLocalRegistry(t *testing.T) {
+	registryPath := t.TempDir()
+	err := os.MkdirAll(filepath.Join(registryPath, "helloworld"), 0755)
+	assert.Equal(t, err, nil)
+	err = utils.TarDir(filepath.Join(getTestDir("test_local_registry"), "helloworld"), filepath.Join(registryPath, "helloworld", "0.1.0.tar"))
+	assert.Equal(t, err, nil)
+
+	depFromRegistry := pkg.Dependency{
+		Name: "helloworld",
+		Source: pkg.Source{
+			LocalRegistry: &pkg.LocalRegistry{
+				Path:    "file://" + registryPath,
+				Version: "0.1.0",
+			},
+		},
+	}
+	kpmcli, err := NewKpmClient()
+	assert.Equal(t, err, nil)
+	kpmcli.SetLogWriter(nil)
+
+	localPath := filepath.Join(t.TempDir(), "helloworld_0.1.0")
+	dep, err := kpmcli.Download(&depFromRegistry, localPath)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, dep.Version, "0.1.0")
+	assert.Equal(t, dep.FullName, "helloworld_0.1.0")
+	assert.Equal(t, dep.LocalFullPath, localPath)
+	assert.Equal(t, utils.DirExists(filepath.Join(localPath, "kcl.mod")), true)
+	assert.NotEqual(t, dep.Sum, "")
+
+	depFromRegistry.Source.LocalRegistry.Version = "0.2.0"
+	_, err = kpmcli.Download(&depFromRegistry, filepath.Join(t.TempDir(), "helloworld_0.2.0"))
+	assert.NotEqual(t, err, nil)
+}
+
+func TestDownloadWithAllowedRegistries(t *testing.T) {
+	kpmcli, err := NewKpmClient()
+	assert.Equal(t, err, nil)
+	kpmcli.SetLogWriter(nil)
+	kpmcli.SetAllowedRegistries([]string{"localhost", "ghcr.io"})
+
+	assert.Equal(t, kpmcli.isAllowedRegistry("ghcr.io"), true)
+	assert.Equal(t, kpmcli.isAllowedRegistry("localhost:5001"), true)
+	assert.Equal(t, kpmcli.isAllowedRegistry("ghcr.io.evil.com"), false)
+
+	depFromOci := pkg.Dependency{
+		Name:    "k8s",
+		Version: "1.27",
+		Source: pkg.Source{
+			Oci: &pkg.Oci{
+				Reg:  "ghcr.io.evil.com",
+				Repo: "kcl-lang/k8s",
+				Tag:  "1.27",
+			},
+		},
+	}
+	_, err = kpmcli.Download(&depFromOci, filepath.Join(t.TempDir(), "k8s_1.27"))
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "the registry 'ghcr.io.evil.com' is not in the allowed registries [localhost, ghcr.io]")
+}
+
+// TestDownloadOciWithMirrors tests the case that the dependency is pulled from the mirror.
+func TestDownloadOciWithMirrors(t *testing.T) {
+	testPath := filepath.Join(getTestDir("download"), "k8s_1.27")
+	err := os.MkdirAll(testPath, 0755)
+	assert.Equal(t, err, nil)
+	defer func() {
+		_ = os.RemoveAll(getTestDir("download"))
+	}()
+
+	depFromOci := pkg.Dependency{
+		Name:    "k8s",
+		Version: "1.27",
+		Sum:     "xnYM1FWHAy3m+KcQMQb2rjZouTxumqYt6FGZpu2T4yM=",
+		Source: pkg.Source{
+			Oci: &pkg.Oci{
+				Reg:  "invalid.registry.kcl-lang.io",
+				Repo: "kcl-lang/k8s",
+				Tag:  "1.27",
+			},
+		},
+	}
+	kpmcli, err := NewKpmClient()
+	assert.Equal(t, err, nil)
+	kpmcli.SetLogWriter(nil)
+	kpmcli.SetRegistryMirrors("invalid.registry.kcl-lang.io", []string{"ghcr.io"})
+	dep, err := kpmcli.Download(&depFromOci, testPath)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, dep.Sum, "xnYM1FWHAy3m+KcQMQb2rjZouTxumqYt6FGZpu2T4yM=")
+	// The registry of the dependency is not changed by the mirror.
+	assert.Equal(t, dep.Source.Oci.Reg, "invalid.registry.kcl-lang.io")
+	assert.Equal(t, kpmcli.GetPullSources()["k8s"], "ghcr.io")
+
+	// The package from the mirror with a different checksum is not accepted.
+	depFromOci.Sum = "invalid_sum"
+	_, err = kpmcli.Download(&depFromOci, testPath)
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "the checksum of 'k8s' is not the same as the package from 'invalid.registry.kcl-lang.io'")
+}
+
+// TestDownloadOciWithUnverifiableMirrors tests the case that the package from the mirror can not be verified.
+func TestDownloadOciWithUnverifiableMirrors(t *testing.T) {
+	kpmcli, err := NewKpmClient()
+	assert.Equal(t, err, nil)
+	kpmcli.SetLogWriter(nil)
+	kpmcli.SetRegistryMirrors("invalid.registry.kcl-lang.io", []string{"invalid.mirror.kcl-lang.io"})
+	newDep := func(tag string) *pkg.Dependency {
+		return &pkg.Dependency{
+			Name:   "k8s",
+			Source: pkg.Source{Oci: &pkg.Oci{Reg: "invalid.registry.kcl-lang.io", Repo: "kcl-lang/k8s", Tag: tag}},
+		}
+	}
+
+	// The digest of the dependency not locked is resolved from its registry to verify the package from the mirror.
+	_, err = kpmcli.Download(newDep("1.27"), filepath.Join(t.TempDir(), "k8s_1.27"))
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "the checksum of 'k8s' is not locked and its digest can not be resolved from 'invalid.registry.kcl-lang.io'")
+
+	// The mirrors are not tried for the dependency without a version.
+	_, err = kpmcli.Download(newDep(""), filepath.Join(t.TempDir(), "k8s_"))
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "the mirrors are not tried, the version of 'k8s' is required to verify the packages from them")
+	assert.Equal(t, len(kpmcli.GetPullSources()), 0)
+}
+
 // TestDownloadLatestOci tests the case that the version is empty.
 func TestDownloadLatestOci(t *testing.T) {
 	testPath := filepath.Join(getTestDir("download"), "a_random_name")
@@ -1061,3 +1190,541 @@ func TestAddWithGitCommit(t *testing.T) {
 		_ = os.Remove(testPkgPathModLock)
 	}()
 }
+
+func TestCopyGitSubdir(t *testing.T) {
+	repoPath := getTestDir("test_local_registry")
+	gitSource := &pkg.Git{Url: "https://github.com/kcl-lang/modules.git", Subdir: "helloworld"}
+
+	localPath := filepath.Join(t.TempDir(), "helloworld")
+	err := copyGitSubdir(filepath.Join(repoPath, "helloworld"), localPath, gitSource)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, utils.DirExists(filepath.Join(localPath, "kcl.mod")), true)
+
+	gitSource.Subdir = "."
+	err = copyGitSubdir(repoPath, filepath.Join(t.TempDir(), "not_pkg"), gitSource)
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "the subdir '.' of 'https://github.com/kcl-lang/modules.git' is not a kcl package")
+}
+
+func TestResolveDeprecatedDep(t *testing.T) {
+	testDir := filepath.Join(t.TempDir(), "test_deprecated_dep")
+	err := copy.Copy(getTestDir("test_deprecated_dep"), testDir)
+	assert.Equal(t, err, nil)
+
+	kpmcli, err := NewKpmClient()
+	assert.Equal(t, err, nil)
+	var buf bytes.Buffer
+	kpmcli.SetLogWriter(&buf)
+	var diagnostics []reporter.Diagnostic
+	kpmcli.SetDiagnosticHandler(func(diagnostic reporter.Diagnostic) {
+		diagnostics = append(diagnostics, diagnostic)
+	})
+
+	kclPkg, err := pkg.LoadKclPkg(filepath.Join(testDir, "kcl_pkg"))
+	assert.Equal(t, err, nil)
+	_, err = kpmcli.ResolveDepsIntoMap(kclPkg)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(kpmcli.GetWarnings()), 1)
+	expectedMsg := "the dependency 'dep_pkg' is deprecated: dep_pkg is no longer maintained, please use 'new_dep_pkg' instead"
+	assert.Contains(t, buf.String(), "warning: "+expectedMsg)
+	assert.Equal(t, len(diagnostics), 1)
+	assert.Equal(t, diagnostics[0].Severity, reporter.SeverityWarning)
+	assert.Equal(t, diagnostics[0].Message, expectedMsg)
+
+	// The same warning is only reported once.
+	_, err = kpmcli.ResolveDepsIntoMap(kclPkg)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(kpmcli.GetWarnings()), 1)
+	assert.Equal(t, len(diagnostics), 1)
+
+	kpmcli.SetWarningsAsErrors(true)
+	_, err = kpmcli.ResolveDepsIntoMap(kclPkg)
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), expectedMsg)
+}
+
+func TestResolveWithStableLock(t *testing.T) {
+	resolveLock := func() ([]byte, []byte) {
+		testDir := filepath.Join(t.TempDir(), "test_stable_lock")
+		err := copy.Copy(getTestDir("test_stable_lock"), testDir)
+		assert.Equal(t, err, nil)
+
+		kpmcli, err := NewKpmClient()
+		assert.Equal(t, err, nil)
+		kpmcli.SetLogWriter(nil)
+		kclPkg, err := pkg.LoadKclPkg(filepath.Join(testDir, "kcl_pkg"))
+		assert.Equal(t, err, nil)
+		_, err = kpmcli.ResolveDepsIntoMap(kclPkg)
+		assert.Equal(t, err, nil)
+
+		lockContent, err := os.ReadFile(filepath.Join(testDir, "kcl_pkg", "kcl.mod.lock"))
+		assert.Equal(t, err, nil)
+		modContent, err := os.ReadFile(filepath.Join(testDir, "kcl_pkg", "kcl.mod"))
+		assert.Equal(t, err, nil)
+		return lockContent, modContent
+	}
+
+	expectedLock, expectedMod := resolveLock()
+	assert.True(t, strings.Index(string(expectedLock), "a_pkg") < strings.Index(string(expectedLock), "b_pkg"))
+	assert.True(t, strings.Index(string(expectedLock), "b_pkg") < strings.Index(string(expectedLock), "c_pkg"))
+	for i := 0; i < 5; i++ {
+		gotLock, gotMod := resolveLock()
+		assert.Equal(t, string(gotLock), string(expectedLock))
+		assert.Equal(t, string(gotMod), string(expectedMod))
+	}
+}
+
+func TestResolveWithLogLevel(t *testing.T) {
+	resolveWithLevel := func(level reporter.LogLevel) string {
+		testDir := filepath.Join(t.TempDir(), "test_deprecated_dep")
+		err := copy.Copy(getTestDir("test_deprecated_dep"), testDir)
+		assert.Equal(t, err, nil)
+
+		kpmcli, err := NewKpmClient()
+		assert.Equal(t, err, nil)
+		var buf bytes.Buffer
+		kpmcli.SetLogWriter(&buf)
+		kpmcli.SetLogLevel(level)
+		kclPkg, err := pkg.LoadKclPkg(filepath.Join(testDir, "kcl_pkg"))
+		assert.Equal(t, err, nil)
+		_, err = kpmcli.ResolveDepsIntoMap(kclPkg)
+		assert.Equal(t, err, nil)
+		return buf.String()
+	}
+
+	debugLog := resolveWithLevel(reporter.DebugLevel)
+	assert.Contains(t, debugLog, "adding 'dep_pkg'")
+	assert.Contains(t, debugLog, "found the local dependency 'dep_pkg' with checksum")
+	assert.Contains(t, debugLog, "resolved 'dep_pkg' to")
+	assert.Contains(t, debugLog, "warning: the dependency 'dep_pkg' is deprecated")
+
+	infoLog := resolveWithLevel(reporter.InfoLevel)
+	assert.Contains(t, infoLog, "adding 'dep_pkg'")
+	assert.NotContains(t, infoLog, "resolved 'dep_pkg' to")
+
+	warnLog := resolveWithLevel(reporter.WarnLevel)
+	assert.NotContains(t, warnLog, "adding 'dep_pkg'")
+	assert.Contains(t, warnLog, "warning: the dependency 'dep_pkg' is deprecated")
+
+	assert.Equal(t, resolveWithLevel(reporter.ErrorLevel), "")
+}
+
+func TestNewOciClientForDepWithCredential(t *testing.T) {
+	kpmcli, err := NewKpmClient()
+	assert.Equal(t, err, nil)
+
+	dep := &pkg.Oci{Reg: "ghcr.io", Repo: "kcl-lang/k8s", Tag: "1.28", Credential: "team-a"}
+	_, err = kpmcli.newOciClientForDep(dep)
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "no credential provider to resolve the credential 'team-a' of 'kcl-lang/k8s'")
+
+	var refs []string
+	kpmcli.SetCredentialProvider(func(ref, host string) (*remoteauth.Credential, error) {
+		refs = append(refs, ref+"@"+host)
+		if ref != "team-a" {
+			return nil, fmt.Errorf("unknown credential '%s'", ref)
+		}
+		return &remoteauth.Credential{Username: "team-a", Password: "secret"}, nil
+	})
+	ociClient, err := kpmcli.newOciClientForDep(dep)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, ociClient.GetReference(), "ghcr.io/kcl-lang/k8s")
+
+	_, err = kpmcli.newOciClientForDep(&pkg.Oci{Reg: "ghcr.io", Repo: "kcl-lang/helloworld", Credential: "team-b"})
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "unknown credential 'team-b'")
+	assert.Equal(t, refs, []string{"team-a@ghcr.io", "team-b@ghcr.io"})
+}
+
+func TestDownloadDepsWithFailFast(t *testing.T) {
+	resolve := func(failFast bool) error {
+		pkgPath := t.TempDir()
+		registry := t.TempDir()
+		modContent := fmt.Sprintf(`[package]
+name = "test_fail_fast"
+edition = "0.0.1"
+version = "0.0.1"
+
+[dependencies]
+dep_a = { registry = %q, version = "0.0.1" }
+dep_b = { registry = %q, version = "0.0.1" }
+`, registry, registry)
+		assert.Equal(t, os.WriteFile(filepath.Join(pkgPath, "kcl.mod"), []byte(modContent), 0644), nil)
+
+		kpmcli, err := NewKpmClient()
+		assert.Equal(t, err, nil)
+		kpmcli.SetHomePath(t.TempDir())
+		kpmcli.SetLogWriter(nil)
+		kpmcli.SetFailFast(failFast)
+		kclPkg, err := pkg.LoadKclPkg(pkgPath)
+		assert.Equal(t, err, nil)
+		_, err = kpmcli.ResolveDepsIntoMap(kclPkg)
+		return err
+	}
+
+	err := resolve(true)
+	assert.NotEqual(t, err, nil)
+	assert.NotEqual(t, strings.Contains(err.Error(), "dep_a"), strings.Contains(err.Error(), "dep_b"))
+
+	err = resolve(false)
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "failed to download the dependencies")
+	assert.Contains(t, err.Error(), "'dep_a': ")
+	assert.Contains(t, err.Error(), "'dep_b': ")
+}
+
+func TestDownloadDepsWithFailFastCancelsDownloads(t *testing.T) {
+	cancelled := make(chan struct{})
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/ghcr.io/kcl-lang/slow/") {
+			select {
+			case <-r.Context().Done():
+				close(cancelled)
+			case <-time.After(time.Minute):
+			}
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer proxy.Close()
+
+	kpmcli, err := NewKpmClient()
+	assert.Equal(t, err, nil)
+	kpmcli.SetHomePath(t.TempDir())
+	kpmcli.SetLogWriter(io.Discard)
+	kpmcli.SetModuleProxy(proxy.URL)
+	kpmcli.SetFailFast(true)
+	newDep := func(name string) pkg.Dependency {
+		return pkg.Dependency{
+			Name:     name,
+			FullName: name + "_0.0.1",
+			Version:  "0.0.1",
+			Source:   pkg.Source{Oci: &pkg.Oci{Reg: "ghcr.io", Repo: "kcl-lang/" + name, Tag: "0.0.1"}},
+		}
+	}
+	deps := pkg.Dependencies{Deps: map[string]pkg.Dependency{"fast": newDep("fast"), "slow": newDep("slow")}}
+
+	_, err = kpmcli.downloadDeps(deps, pkg.Dependencies{Deps: make(map[string]pkg.Dependency)})
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "kcl-lang/fast:0.0.1")
+	select {
+	case <-cancelled:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the download of 'slow' is not cancelled")
+	}
+}
+
+func TestResolveWithPreResolveHook(t *testing.T) {
+	pkgPath := t.TempDir()
+	depPath := filepath.Join(pkgPath, "dep_a")
+	assert.Equal(t, os.MkdirAll(depPath, 0755), nil)
+	assert.Equal(t, os.WriteFile(filepath.Join(depPath, "kcl.mod"), []byte("[package]\nname = \"dep_a\"\nedition = \"0.0.1\"\nversion = \"0.0.1\"\n"), 0644), nil)
+	modContent := fmt.Sprintf(`[package]
+name = "test_pre_resolve_hook"
+edition = "0.0.1"
+version = "0.0.1"
+
+[dependencies]
+dep_a = { path = "./dep_a" }
+dep_b = { registry = %q, version = "0.0.1" }
+`, t.TempDir())
+	assert.Equal(t, os.WriteFile(filepath.Join(pkgPath, "kcl.mod"), []byte(modContent), 0644), nil)
+
+	resolve := func(hook opt.PreResolveHook) (map[string]string, error) {
+		kpmcli, err := NewKpmClient()
+		assert.Equal(t, err, nil)
+		kpmcli.SetHomePath(t.TempDir())
+		kpmcli.SetLogWriter(nil)
+		kpmcli.SetPreResolveHook(hook)
+		kclPkg, err := pkg.LoadKclPkg(pkgPath)
+		assert.Equal(t, err, nil)
+		return kpmcli.ResolveDepsIntoMap(kclPkg)
+	}
+
+	var names []string
+	depsMap, err := resolve(func(deps []opt.DependencySpec) ([]opt.DependencySpec, error) {
+		var kept []opt.DependencySpec
+		for _, d := range deps {
+			names = append(names, d.Name)
+			if d.Name != "dep_b" {
+				kept = append(kept, d)
+			}
+		}
+		return kept, nil
+	})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, names, []string{"dep_a", "dep_b"})
+	assert.Equal(t, depsMap, map[string]string{"dep_a": depPath})
+
+	lockContent, err := os.ReadFile(filepath.Join(pkgPath, "kcl.mod.lock"))
+	assert.Equal(t, err, nil)
+	assert.Contains(t, string(lockContent), "dep_a")
+	assert.NotContains(t, string(lockContent), "dep_b")
+	stored, err := os.ReadFile(filepath.Join(pkgPath, "kcl.mod"))
+	assert.Equal(t, err, nil)
+	assert.Contains(t, string(stored), "dep_b")
+
+	_, err = resolve(func(deps []opt.DependencySpec) ([]opt.DependencySpec, error) {
+		return nil, fmt.Errorf("dep_b is not allowed by the policy")
+	})
+	assert.NotEqual(t, err, nil)
+	assert.Equal(t, reporter.GetErrorKind(err), reporter.KindResolve)
+	assert.Contains(t, err.Error(), "dep_b is not allowed by the policy")
+}
+
+func TestDependencyOrigins(t *testing.T) {
+	registryPath := t.TempDir()
+	err := os.MkdirAll(filepath.Join(registryPath, "helloworld"), 0755)
+	assert.Equal(t, err, nil)
+	err = utils.TarDir(filepath.Join(getTestDir("test_local_registry"), "helloworld"), filepath.Join(registryPath, "helloworld", "0.1.0.tar"))
+	assert.Equal(t, err, nil)
+
+	pkgPath := t.TempDir()
+	depPath := filepath.Join(pkgPath, "dep_a")
+	assert.Equal(t, os.MkdirAll(depPath, 0755), nil)
+	assert.Equal(t, os.WriteFile(filepath.Join(depPath, "kcl.mod"), []byte("[package]\nname = \"dep_a\"\nedition = \"0.0.1\"\nversion = \"0.0.1\"\n"), 0644), nil)
+	modContent := fmt.Sprintf(`[package]
+name = "test_dependency_origins"
+edition = "0.0.1"
+version = "0.0.1"
+
+[dependencies]
+dep-a = { path = %q }
+helloworld = { registry = %q, version = "0.1.0" }
+`, depPath, registryPath)
+	assert.Equal(t, os.WriteFile(filepath.Join(pkgPath, "kcl.mod"), []byte(modContent), 0644), nil)
+
+	homePath := t.TempDir()
+	resolve := func() (*KpmClient, string) {
+		kpmcli, err := NewKpmClient()
+		assert.Equal(t, err, nil)
+		kpmcli.SetHomePath(homePath)
+		var buf bytes.Buffer
+		kpmcli.SetLogWriter(&buf)
+		kpmcli.SetLogDependencyOrigins(true)
+		kclPkg, err := pkg.LoadKclPkg(pkgPath)
+		assert.Equal(t, err, nil)
+		_, err = kpmcli.ResolveDepsIntoMap(kclPkg)
+		assert.Equal(t, err, nil)
+		return kpmcli, buf.String()
+	}
+
+	kpmcli, logs := resolve()
+	assert.Equal(t, kpmcli.GetDependencyOrigins(), map[string]Origin{"dep-a": OriginLocal, "helloworld": OriginDownload})
+	assert.Contains(t, logs, "the origin of 'dep-a' is 'local'")
+
+	kpmcli, logs = resolve()
+	assert.Equal(t, kpmcli.GetDependencyOrigins(), map[string]Origin{"dep-a": OriginLocal, "helloworld": OriginCache})
+	assert.Contains(t, logs, "the origin of 'helloworld' is 'cache'")
+}
+
+func TestPullThroughCacheOci(t *testing.T) {
+	source := &pkg.Oci{Reg: "ghcr.io", Repo: "kcl-lang/k8s", Tag: "1.28", Credential: "ghcr"}
+
+	cacheOci := pullThroughCacheOci(source, "cache.example.com:5000")
+	assert.Equal(t, cacheOci, pkg.Oci{Reg: "cache.example.com:5000", Repo: "kcl-lang/k8s", Tag: "1.28", Credential: "ghcr"})
+
+	cacheOci = pullThroughCacheOci(source, "cache.example.com/proxy/ghcr/")
+	assert.Equal(t, cacheOci, pkg.Oci{Reg: "cache.example.com", Repo: "proxy/ghcr/kcl-lang/k8s", Tag: "1.28", Credential: "ghcr"})
+	// The source of the dependency is kept.
+	assert.Equal(t, source.Reg, "ghcr.io")
+	assert.Equal(t, source.Repo, "kcl-lang/k8s")
+}
+
+func TestIsExpiredMutableRef(t *testing.T) {
+	cachePath := t.TempDir()
+	old := time.Now().Add(-2 * time.Hour)
+	assert.Equal(t, os.Chtimes(cachePath, old, old), nil)
+
+	branch := &pkg.Dependency{Name: "branch", Source: pkg.Source{Git: &pkg.Git{Url: "https://github.com/kcl-lang/flask-demo-kcl-manifests.git", Branch: "main"}}}
+	tag := &pkg.Dependency{Name: "tag", Source: pkg.Source{Git: &pkg.Git{Url: "https://github.com/kcl-lang/flask-demo-kcl-manifests.git", Tag: "v0.1.0"}}}
+	latest := &pkg.Dependency{Name: "latest", Source: pkg.Source{Oci: &pkg.Oci{Reg: "ghcr.io", Repo: "kcl-lang/k8s", Tag: "latest"}}}
+	assert.True(t, branch.IsMutableRef())
+	assert.False(t, tag.IsMutableRef())
+	assert.True(t, latest.IsMutableRef())
+
+	kpmcli, err := NewKpmClient()
+	assert.Equal(t, err, nil)
+	// The mutable refs are cached forever by default.
+	assert.False(t, kpmcli.isExpiredMutableRef(branch, cachePath))
+
+	kpmcli.SetMutableRefTTL(time.Hour)
+	assert.True(t, kpmcli.isExpiredMutableRef(branch, cachePath))
+	assert.True(t, kpmcli.isExpiredMutableRef(latest, cachePath))
+	assert.False(t, kpmcli.isExpiredMutableRef(tag, cachePath))
+	assert.False(t, kpmcli.isExpiredMutableRef(branch, filepath.Join(cachePath, "not_exist")))
+
+	kpmcli.SetMutableRefTTL(3 * time.Hour)
+	assert.False(t, kpmcli.isExpiredMutableRef(branch, cachePath))
+}
+
+func TestDownloadFromModuleProxy(t *testing.T) {
+	pkgDir := filepath.Join(getTestDir("test_local_registry"), "helloworld")
+	var pkgTar bytes.Buffer
+	assert.Equal(t, utils.TarDirToWriter(pkgDir, &pkgTar, nil), nil)
+	sum, err := utils.HashDir(pkgDir)
+	assert.Equal(t, err, nil)
+
+	servedSum := sum
+	var requests []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		assert.Equal(t, r.Header.Get("User-Agent"), "kpm-test")
+		switch r.URL.Path {
+		case "/ghcr.io/kcl-lang/helloworld/@v/list":
+			fmt.Fprint(w, "0.0.1\n0.1.0\n")
+		case "/ghcr.io/kcl-lang/helloworld/@v/0.1.0.tar":
+			w.Write(pkgTar.Bytes())
+		case "/ghcr.io/kcl-lang/helloworld/@v/0.1.0.sum":
+			fmt.Fprintln(w, servedSum)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer proxy.Close()
+
+	kpmcli, err := NewKpmClient()
+	assert.Equal(t, err, nil)
+	kpmcli.SetLogWriter(io.Discard)
+	kpmcli.SetUserAgent("kpm-test")
+	kpmcli.SetModuleProxy(proxy.URL + "/")
+	newDep := func() *pkg.Dependency {
+		return &pkg.Dependency{Name: "helloworld", Source: pkg.Source{Oci: &pkg.Oci{Reg: "ghcr.io", Repo: "kcl-lang/helloworld"}}}
+	}
+
+	// The latest version listed by the proxy is selected.
+	dep := newDep()
+	assert.Equal(t, kpmcli.FillDepInfo(dep), nil)
+	assert.Equal(t, dep.Version, "0.1.0")
+	assert.Equal(t, dep.Sum, sum)
+
+	cachePath := t.TempDir()
+	dep = newDep()
+	downloaded, err := kpmcli.Download(dep, filepath.Join(cachePath, "helloworld_"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, downloaded.Version, "0.1.0")
+	assert.Equal(t, downloaded.LocalFullPath, filepath.Join(cachePath, "helloworld_0.1.0"))
+	assert.True(t, utils.CheckPackageSum(sum, downloaded.LocalFullPath))
+	assert.Equal(t, requests[len(requests)-3:], []string{
+		"/ghcr.io/kcl-lang/helloworld/@v/list",
+		"/ghcr.io/kcl-lang/helloworld/@v/0.1.0.sum",
+		"/ghcr.io/kcl-lang/helloworld/@v/0.1.0.tar",
+	})
+
+	// The checksum served by the proxy must be the same as the one locked.
+	dep = newDep()
+	dep.Source.Oci.Tag = "0.1.0"
+	dep.Sum = "locked"
+	_, err = kpmcli.Download(dep, filepath.Join(t.TempDir(), "helloworld_0.1.0"))
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), fmt.Sprintf("the checksum of 'helloworld:0.1.0' served by the module proxy is '%s', but 'locked' is locked", sum))
+
+	// The package must match the checksum served by the proxy.
+	servedSum = "tampered"
+	dep = newDep()
+	dep.Source.Oci.Tag = "0.1.0"
+	localPath := filepath.Join(t.TempDir(), "helloworld_0.1.0")
+	_, err = kpmcli.Download(dep, localPath)
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "the checksum of the package 'helloworld:0.1.0' is not 'tampered'")
+	assert.False(t, utils.DirExists(localPath))
+}
+
+func TestDownloadFromModuleProxyWithTimeout(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Minute):
+		}
+	}))
+	defer proxy.Close()
+
+	kpmcli, err := NewKpmClient()
+	assert.Equal(t, err, nil)
+	kpmcli.SetLogWriter(io.Discard)
+	kpmcli.SetModuleProxy(proxy.URL)
+	kpmcli.SetModuleProxyTimeout(100 * time.Millisecond)
+	dep := &pkg.Dependency{Name: "helloworld", Source: pkg.Source{Oci: &pkg.Oci{Reg: "ghcr.io", Repo: "kcl-lang/helloworld", Tag: "0.1.0"}}}
+	_, err = kpmcli.Download(dep, filepath.Join(t.TempDir(), "helloworld_0.1.0"))
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "Client.Timeout exceeded")
+}
+
+func TestPullTarFromOciWithUserAgent(t *testing.T) {
+	var userAgents []string
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgents = append(userAgents, r.UserAgent())
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"name":"helloworld","tags":["0.1.0"]}`))
+	}))
+	defer registry.Close()
+
+	kpmcli, err := NewKpmClient()
+	assert.Equal(t, err, nil)
+	kpmcli.SetLogWriter(io.Discard)
+	kpmcli.SetUserAgent("kpm-test")
+	kpmcli.GetSettings().Conf.DefaultOciPlainHttp = true
+	// The pull fails on the fake manifest, after the tags are listed with the user-agent.
+	_ = kpmcli.PullTarFromOci(t.TempDir(), &opt.OciOptions{Reg: strings.TrimPrefix(registry.URL, "http://"), Repo: "helloworld"})
+	assert.NotEqual(t, len(userAgents), 0)
+	for _, userAgent := range userAgents {
+		assert.Equal(t, userAgent, "kpm-test")
+	}
+}
+
+func TestResolveWithOverrideFile(t *testing.T) {
+	pkgPath := t.TempDir()
+	overridePath := t.TempDir()
+	for _, dir := range []string{filepath.Join(pkgPath, "dep_a"), filepath.Join(overridePath, "fork_a")} {
+		assert.Equal(t, os.MkdirAll(dir, 0755), nil)
+		assert.Equal(t, os.WriteFile(filepath.Join(dir, "kcl.mod"), []byte("[package]\nname = \"dep_a\"\nedition = \"0.0.1\"\nversion = \"0.0.1\"\n"), 0644), nil)
+	}
+	modContent := `[package]
+name = "test_override_file"
+edition = "0.0.1"
+version = "0.0.1"
+
+[dependencies]
+dep_a = { path = "./dep_a" }
+`
+	assert.Equal(t, os.WriteFile(filepath.Join(pkgPath, "kcl.mod"), []byte(modContent), 0644), nil)
+	overrideFile := filepath.Join(overridePath, "overrides.toml")
+	assert.Equal(t, os.WriteFile(overrideFile, []byte("[overrides]\ndep_a = { path = \"./fork_a\" }\ndep_b = \"0.0.1\"\n"), 0644), nil)
+
+	resolve := func(overrideFile string) map[string]string {
+		kpmcli, err := NewKpmClient()
+		assert.Equal(t, err, nil)
+		kpmcli.SetHomePath(t.TempDir())
+		kpmcli.SetLogWriter(nil)
+		kpmcli.SetOverrideFile(overrideFile)
+		kclPkg, err := pkg.LoadKclPkg(pkgPath)
+		assert.Equal(t, err, nil)
+		depsMap, err := kpmcli.ResolveDepsIntoMap(kclPkg)
+		assert.Equal(t, err, nil)
+		return depsMap
+	}
+
+	assert.Equal(t, resolve(overrideFile), map[string]string{"dep_a": filepath.Join(overridePath, "fork_a")})
+	lockContent, err := os.ReadFile(filepath.Join(pkgPath, "kcl.mod.lock"))
+	assert.Equal(t, err, nil)
+	assert.Contains(t, string(lockContent), fmt.Sprintf("overridden_by = %q", overrideFile))
+	assert.NotContains(t, string(lockContent), "dep_b")
+	stored, err := os.ReadFile(filepath.Join(pkgPath, "kcl.mod"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, string(stored), modContent)
+
+	assert.Equal(t, resolve(""), map[string]string{"dep_a": filepath.Join(pkgPath, "dep_a")})
+	lockContent, err = os.ReadFile(filepath.Join(pkgPath, "kcl.mod.lock"))
+	assert.Equal(t, err, nil)
+	assert.NotContains(t, string(lockContent), "overridden_by")
+
+	kpmcli, err := NewKpmClient()
+	assert.Equal(t, err, nil)
+	kpmcli.SetOverrideFile(filepath.Join(overridePath, "not_exist.toml"))
+	kclPkg, err := pkg.LoadKclPkg(pkgPath)
+	assert.Equal(t, err, nil)
+	err = kpmcli.ResolvePkgDepsMetadata(kclPkg, true)
+	assert.NotEqual(t, err, nil)
+	assert.Equal(t, reporter.GetErrorKind(err), reporter.KindIO)
+	assert.Contains(t, err.Error(), "failed to load the override file")
+}
@@ -0,0 +1,8 @@
+[package]
+name = "dep_pkg"
+edition = "0.0.1"
+version = "0.0.1"
+deprecated = "dep_pkg is no longer maintained"
+replaced_by = "new_dep_pkg"
+
+[dependencies]
@@ -0,0 +1,6 @@
+[package]
+name = "helloworld"
+edition = "0.0.1"
+version = "0.1.0"
+
+[dependencies]
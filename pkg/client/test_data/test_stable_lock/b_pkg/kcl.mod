@@ -0,0 +1,6 @@
+[package]
+name = "b_pkg"
+edition = "0.0.1"
+version = "0.0.1"
+
+[dependencies]
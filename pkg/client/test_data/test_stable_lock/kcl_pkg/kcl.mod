@@ -0,0 +1,9 @@
+[package]
+name = "kcl_pkg"
+edition = "0.0.1"
+version = "0.0.1"
+
+[dependencies]
+c_pkg = { path = "../c_pkg" }
+a_pkg = { path = "../a_pkg" }
+b_pkg = { path = "../b_pkg" }
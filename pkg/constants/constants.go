@@ -10,6 +10,7 @@ const (
 	RefEntry                             = "ref"
 	TarEntry                             = "tar"
 	KCL_MOD                              = "kcl.mod"
+	KPM_IGNORE_FILE                      = ".kpmignore"
 	OCI_SEPARATOR                        = ":"
 	KCL_PKG_TAR                          = "*.tar"
 	DEFAULT_KCL_FILE_NAME                = "main.k"
@@ -22,4 +23,8 @@ const (
 
 	// The pattern of the external package argument.
 	EXTERNAL_PKGS_ARG_PATTERN = "%s=%s"
+	// The top-level argument of the overridden version of the package.
+	PKG_VERSION_ARG = "kcl_pkg_version"
+	// The prefix of the top-level arguments of the resolved paths of the dependencies, e.g. 'kcl_dep_path_k8s'.
+	DEP_PATH_ARG_PREFIX = "kcl_dep_path_"
 )
@@ -12,6 +12,7 @@ import (
 const PKG_PATH = "KCL_PKG_PATH"
 const DEFAULT_PKG_PATH_IN_UER_HOME = ".kcl"
 const KPM_SUB_DIR = "kpm"
+const PLUGINS_ROOT = "KCL_PLUGINS_ROOT"
 
 // GetEnvPkgPath will return the env $KCL_PKG_PATH.
 func GetEnvPkgPath() string {
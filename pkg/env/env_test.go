@@ -29,3 +29,39 @@ func TestGetAbsPkgPath(t *testing.T) {
 	assert.Equal(t, got, filepath.Join(homeDir, ".kcl/kpm"))
 	assert.Equal(t, err, nil)
 }
+
+func TestLoadEnvFile(t *testing.T) {
+	envs, err := LoadEnvFile(filepath.Join("test_data", "test.env"))
+	assert.Equal(t, err, nil)
+	assert.DeepEqual(t, envs, map[string]string{
+		"KPM_TEST_PLAIN":    "plain value",
+		"KPM_TEST_EXPORTED": "exported",
+		"KPM_TEST_SINGLE":   "single # not comment",
+		"KPM_TEST_DOUBLE":   "line1\nline2 \"quoted\"",
+		"KPM_TEST_EMPTY":    "",
+		"KPM_TEST_EXISTED":  "from_file",
+	})
+
+	_, err = LoadEnvFile(filepath.Join("test_data", "not_exist.env"))
+	assert.ErrorContains(t, err, "failed to load the env file")
+}
+
+func TestSetEnvs(t *testing.T) {
+	os.Setenv("KPM_TEST_EXISTED", "from_process")
+	defer os.Unsetenv("KPM_TEST_EXISTED")
+
+	envs := map[string]string{"KPM_TEST_EXISTED": "from_file", "KPM_TEST_NEW": "new"}
+	restore, err := SetEnvs(envs, false)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, os.Getenv("KPM_TEST_EXISTED"), "from_process")
+	assert.Equal(t, os.Getenv("KPM_TEST_NEW"), "new")
+	restore()
+	_, existed := os.LookupEnv("KPM_TEST_NEW")
+	assert.Equal(t, existed, false)
+
+	restore, err = SetEnvs(envs, true)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, os.Getenv("KPM_TEST_EXISTED"), "from_file")
+	restore()
+	assert.Equal(t, os.Getenv("KPM_TEST_EXISTED"), "from_process")
+}
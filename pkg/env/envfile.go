@@ -0,0 +1,130 @@
+package env
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"kcl-lang.io/kpm/pkg/reporter"
+)
+
+// LoadEnvFile will load the environment variables from the '.env' file in 'envFilePath'.
+// Each line is in the format of 'KEY=VALUE' and can be prefixed with 'export'.
+// The empty lines and the lines starting with '#' are skipped.
+// The value can be quoted by single quotes which keep the value as is,
+// or double quotes in which '\n', '\t', '\"' and '\\' are escaped.
+// The comment after an unquoted value starts with ' #'.
+func LoadEnvFile(envFilePath string) (map[string]string, error) {
+	content, err := os.ReadFile(envFilePath)
+	if err != nil {
+		return nil, reporter.NewErrorEvent(reporter.FailedLoadEnvFile, err, fmt.Sprintf("failed to load the env file '%s'", envFilePath))
+	}
+
+	envs := make(map[string]string)
+	for i, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+
+		key, value, found := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !found || len(key) == 0 || strings.ContainsAny(key, " \t") {
+			return nil, reporter.NewErrorEvent(
+				reporter.FailedLoadEnvFile,
+				fmt.Errorf("invalid line %d: '%s'", i+1, line),
+				fmt.Sprintf("failed to load the env file '%s'", envFilePath),
+			)
+		}
+
+		value, err = parseEnvValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, reporter.NewErrorEvent(
+				reporter.FailedLoadEnvFile,
+				fmt.Errorf("invalid line %d: %s", i+1, err.Error()),
+				fmt.Sprintf("failed to load the env file '%s'", envFilePath),
+			)
+		}
+		envs[key] = value
+	}
+
+	return envs, nil
+}
+
+// parseEnvValue will parse the value in the '.env' file.
+func parseEnvValue(value string) (string, error) {
+	if len(value) == 0 {
+		return "", nil
+	}
+
+	switch value[0] {
+	case '\'':
+		end := strings.Index(value[1:], "'")
+		if end < 0 {
+			return "", fmt.Errorf("unterminated quoted value '%s'", value)
+		}
+		return value[1 : end+1], nil
+	case '"':
+		var sb strings.Builder
+		for i := 1; i < len(value); i++ {
+			c := value[i]
+			if c == '"' {
+				return sb.String(), nil
+			}
+			if c == '\\' && i+1 < len(value) {
+				i++
+				switch value[i] {
+				case 'n':
+					sb.WriteByte('\n')
+				case 't':
+					sb.WriteByte('\t')
+				default:
+					sb.WriteByte(value[i])
+				}
+				continue
+			}
+			sb.WriteByte(c)
+		}
+		return "", fmt.Errorf("unterminated quoted value '%s'", value)
+	default:
+		if i := strings.Index(value, " #"); i >= 0 {
+			value = value[:i]
+		}
+		return strings.TrimSpace(value), nil
+	}
+}
+
+// SetEnvs will set the environment variables of the current process.
+// The environment variables which are already set will not be overridden unless 'override' is true.
+// The returned function will restore the environment variables to the values before setting.
+func SetEnvs(envs map[string]string, override bool) (func(), error) {
+	type oldEnv struct {
+		value   string
+		existed bool
+	}
+	olds := make(map[string]oldEnv)
+	restore := func() {
+		for key, old := range olds {
+			if old.existed {
+				_ = os.Setenv(key, old.value)
+			} else {
+				_ = os.Unsetenv(key)
+			}
+		}
+	}
+
+	for key, value := range envs {
+		oldValue, existed := os.LookupEnv(key)
+		if existed && !override {
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			restore()
+			return nil, reporter.NewErrorEvent(reporter.FailedLoadEnvFile, err, fmt.Sprintf("failed to set the environment variable '%s'", key))
+		}
+		olds[key] = oldEnv{value: oldValue, existed: existed}
+	}
+
+	return restore, nil
+}
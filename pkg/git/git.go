@@ -1,9 +1,11 @@
 package git
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"os"
 	"strings"
 
 	"github.com/go-git/go-git/v5"
@@ -19,8 +21,19 @@ type CloneOptions struct {
 	Branch    string
 	LocalPath string
 	Writer    io.Writer
+	// Depth is the number of the commits fetched from the tip of the history, 0 means the full history.
+	Depth int
+	// Context is the context of the clone, the clone is stopped if it is cancelled. nil means context.Background().
+	Context context.Context
 }
 
+// maxShallowCloneDepth is the largest depth tried before cloning the full history,
+// if the commit is not found in the shallow history.
+const maxShallowCloneDepth = 1024
+
+// errCommitNotFound is the error returned if the commit to checkout is not found in the cloned history.
+var errCommitNotFound = errors.New("not found")
+
 // CloneOption is a function that modifies CloneOptions
 type CloneOption func(*CloneOptions)
 
@@ -66,6 +79,20 @@ func WithWriter(writer io.Writer) CloneOption {
 	}
 }
 
+// WithDepth sets the clone depth for CloneOptions, 0 means the full history
+func WithDepth(depth int) CloneOption {
+	return func(o *CloneOptions) {
+		o.Depth = depth
+	}
+}
+
+// WithContext sets the context for CloneOptions, the clone is stopped if it is cancelled
+func WithContext(ctx context.Context) CloneOption {
+	return func(o *CloneOptions) {
+		o.Context = ctx
+	}
+}
+
 // Validate checks if the CloneOptions are valid
 func (cloneOpts *CloneOptions) Validate() error {
 	onlyOneAllowed := 0
@@ -83,19 +110,54 @@ func (cloneOpts *CloneOptions) Validate() error {
 		return errors.New("only one of branch, tag or commit is allowed")
 	}
 
+	if cloneOpts.Depth < 0 {
+		return fmt.Errorf("invalid clone depth %d, it must not be negative", cloneOpts.Depth)
+	}
+
 	return nil
 }
 
 // Clone clones a git repository
+// If the depth is set and the commit is not found in the shallow history,
+// the repository is cloned again with the doubled depth, and with the full history at last.
 func (cloneOpts *CloneOptions) Clone() (*git.Repository, error) {
 	err := cloneOpts.Validate()
 	if err != nil {
 		return nil, err
 	}
 
+	depth := cloneOpts.Depth
+	for {
+		repo, err := cloneOpts.cloneWithDepth(depth)
+		if depth == 0 || !errors.Is(err, errCommitNotFound) {
+			return repo, err
+		}
+
+		depth *= 2
+		if depth > maxShallowCloneDepth {
+			depth = 0
+		}
+		if cloneOpts.Writer != nil {
+			if depth == 0 {
+				fmt.Fprintf(cloneOpts.Writer, "commit '%s' not found in the shallow history, cloning the full history\n", cloneOpts.Commit)
+			} else {
+				fmt.Fprintf(cloneOpts.Writer, "commit '%s' not found in the shallow history, cloning with depth %d\n", cloneOpts.Commit, depth)
+			}
+		}
+		// Clean the repository cloned with the previous depth.
+		err = os.RemoveAll(cloneOpts.LocalPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// cloneWithDepth clones the git repository with the history of 'depth' commits, 0 means the full history.
+func (cloneOpts *CloneOptions) cloneWithDepth(depth int) (*git.Repository, error) {
 	gitCloneOpts := &git.CloneOptions{
 		URL:      cloneOpts.RepoURL,
 		Progress: nil,
+		Depth:    depth,
 	}
 
 	if cloneOpts.Tag != "" {
@@ -106,7 +168,11 @@ func (cloneOpts *CloneOptions) Clone() (*git.Repository, error) {
 		gitCloneOpts.ReferenceName = plumbing.ReferenceName(plumbing.NewBranchReferenceName(cloneOpts.Branch))
 	}
 
-	repo, err := git.PlainClone(cloneOpts.LocalPath, false, gitCloneOpts)
+	ctx := cloneOpts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	repo, err := git.PlainCloneContext(ctx, cloneOpts.LocalPath, false, gitCloneOpts)
 	if err != nil {
 		return nil, err
 	}
@@ -155,7 +221,7 @@ func (cloneOpts *CloneOptions) Clone() (*git.Repository, error) {
 				if err != nil {
 					return nil, err
 				} else {
-					return nil, fmt.Errorf("commit '%s' not found", cloneOpts.Commit)
+					return nil, fmt.Errorf("commit '%s' %w", cloneOpts.Commit, errCommitNotFound)
 				}
 			}
 			return repo, nil
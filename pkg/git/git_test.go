@@ -2,9 +2,16 @@ package git
 
 import (
 	"bytes"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"gotest.tools/v3/assert"
 )
 
@@ -57,3 +64,40 @@ func TestCloneWithOptions(t *testing.T) {
 	assert.Equal(t, head.Hash().String(), "4e59d5852cd76542f9f0ec65e5773ca9f4e02462")
 	assert.Equal(t, err, nil)
 }
+
+func TestCloneWithDepth(t *testing.T) {
+	repoPath := t.TempDir()
+	repo, err := git.PlainInit(repoPath, false)
+	assert.NilError(t, err)
+	w, err := repo.Worktree()
+	assert.NilError(t, err)
+	var commits []plumbing.Hash
+	for i := 0; i < 3; i++ {
+		assert.NilError(t, os.WriteFile(filepath.Join(repoPath, "main.k"), []byte(fmt.Sprintf("a = %d", i)), 0644))
+		_, err = w.Add("main.k")
+		assert.NilError(t, err)
+		hash, err := w.Commit(fmt.Sprintf("commit %d", i), &git.CommitOptions{
+			Author: &object.Signature{Name: "kpm", Email: "kpm@kcl-lang.io", When: time.Now()},
+		})
+		assert.NilError(t, err)
+		commits = append(commits, hash)
+	}
+
+	err = (&CloneOptions{RepoURL: "file://" + repoPath, LocalPath: t.TempDir(), Depth: -1}).Validate()
+	assert.ErrorContains(t, err, "invalid clone depth -1")
+
+	// The first commit is not in the history of depth 1, so the repository is cloned again with a larger depth.
+	var buf bytes.Buffer
+	cloned, err := CloneWithOpts(
+		WithRepoURL("file://"+repoPath),
+		WithCommit(commits[0].String()),
+		WithDepth(1),
+		WithWriter(&buf),
+		WithLocalPath(filepath.Join(t.TempDir(), "cloned")),
+	)
+	assert.NilError(t, err)
+	head, err := cloned.Head()
+	assert.NilError(t, err)
+	assert.Equal(t, head.Hash(), commits[0])
+	assert.Assert(t, strings.Contains(buf.String(), "not found in the shallow history"))
+}
@@ -0,0 +1,473 @@
+// Copyright 2023 The KCL Authors. All rights reserved.
+
+// Package jsonschema implements the validation of json documents against a subset of JSON Schema,
+// including the keywords about types, objects, arrays, numbers, strings, enums, combinations and local '$ref'.
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"kcl-lang.io/kpm/pkg/reporter"
+)
+
+// Schema is a loaded JSON Schema.
+type Schema struct {
+	root interface{}
+}
+
+// ValidationError is an error of the document which does not match the schema.
+type ValidationError struct {
+	// Path is the path of the invalid value in the document, e.g. '$.spec.containers[0].name'.
+	Path string
+	// Message is the reason why the value is invalid.
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// Load will load the JSON Schema from the file 'schemaPath'.
+func Load(schemaPath string) (*Schema, error) {
+	content, err := os.ReadFile(schemaPath)
+	if err != nil {
+		return nil, reporter.NewErrorEvent(reporter.FailedLoadSchema, err, fmt.Sprintf("failed to load the json schema '%s'", schemaPath))
+	}
+	schema, err := Parse(content)
+	if err != nil {
+		return nil, reporter.NewErrorEvent(reporter.FailedLoadSchema, err, fmt.Sprintf("failed to load the json schema '%s'", schemaPath))
+	}
+	return schema, nil
+}
+
+// Parse will parse the JSON Schema from the json content.
+func Parse(content []byte) (*Schema, error) {
+	root, err := decode(content)
+	if err != nil {
+		return nil, err
+	}
+	switch root.(type) {
+	case map[string]interface{}, bool:
+		return &Schema{root: root}, nil
+	default:
+		return nil, fmt.Errorf("the json schema must be an object or a boolean")
+	}
+}
+
+// ValidateJson will validate the json document against the schema.
+func (s *Schema) ValidateJson(doc string) ([]ValidationError, error) {
+	value, err := decode([]byte(doc))
+	if err != nil {
+		return nil, err
+	}
+	return s.Validate(value), nil
+}
+
+// Validate will validate the value decoded from json with 'UseNumber' against the schema.
+// The errors are sorted by the path of the invalid values.
+func (s *Schema) Validate(value interface{}) []ValidationError {
+	v := &validator{root: s.root}
+	v.validate(s.root, value, "$", 0)
+	sort.SliceStable(v.errs, func(i, j int) bool {
+		return v.errs[i].Path < v.errs[j].Path
+	})
+	return v.errs
+}
+
+func decode(content []byte) (interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader(string(content)))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// maxRefDepth limits the depth of '$ref' to avoid the infinite recursion of the schema referencing itself.
+const maxRefDepth = 64
+
+type validator struct {
+	root interface{}
+	errs []ValidationError
+}
+
+func (v *validator) addError(path, format string, args ...interface{}) {
+	v.errs = append(v.errs, ValidationError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// valid returns true if the value matches the schema without recording the errors.
+func (v *validator) valid(schema interface{}, value interface{}, path string, depth int) bool {
+	sub := &validator{root: v.root}
+	sub.validate(schema, value, path, depth)
+	return len(sub.errs) == 0
+}
+
+func (v *validator) validate(schema interface{}, value interface{}, path string, depth int) {
+	switch s := schema.(type) {
+	case bool:
+		if !s {
+			v.addError(path, "no value is allowed")
+		}
+		return
+	case map[string]interface{}:
+		v.validateObjectSchema(s, value, path, depth)
+	}
+}
+
+func (v *validator) validateObjectSchema(s map[string]interface{}, value interface{}, path string, depth int) {
+	if ref, ok := s["$ref"].(string); ok {
+		if depth >= maxRefDepth {
+			v.addError(path, "the '$ref' is nested too deeply")
+			return
+		}
+		target, err := v.resolveRef(ref)
+		if err != nil {
+			v.addError(path, "%s", err.Error())
+			return
+		}
+		v.validate(target, value, path, depth+1)
+	}
+
+	if types, ok := s["type"]; ok {
+		v.validateType(types, value, path)
+	}
+	if enum, ok := s["enum"].([]interface{}); ok {
+		matched := false
+		for _, e := range enum {
+			if equal(e, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			v.addError(path, "value must be one of %s", marshal(enum))
+		}
+	}
+	if c, ok := s["const"]; ok && !equal(c, value) {
+		v.addError(path, "value must be %s", marshal(c))
+	}
+
+	if all, ok := s["allOf"].([]interface{}); ok {
+		for _, sub := range all {
+			v.validate(sub, value, path, depth)
+		}
+	}
+	if anyOf, ok := s["anyOf"].([]interface{}); ok {
+		matched := false
+		for _, sub := range anyOf {
+			if v.valid(sub, value, path, depth) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			v.addError(path, "value must match at least one schema in 'anyOf'")
+		}
+	}
+	if oneOf, ok := s["oneOf"].([]interface{}); ok {
+		count := 0
+		for _, sub := range oneOf {
+			if v.valid(sub, value, path, depth) {
+				count++
+			}
+		}
+		if count != 1 {
+			v.addError(path, "value must match exactly one schema in 'oneOf', but matches %d", count)
+		}
+	}
+	if not, ok := s["not"]; ok && v.valid(not, value, path, depth) {
+		v.addError(path, "value must not match the schema in 'not'")
+	}
+
+	switch val := value.(type) {
+	case map[string]interface{}:
+		v.validateObject(s, val, path, depth)
+	case []interface{}:
+		v.validateArray(s, val, path, depth)
+	case string:
+		v.validateString(s, val, path)
+	case json.Number:
+		v.validateNumber(s, val, path)
+	}
+}
+
+func (v *validator) resolveRef(ref string) (interface{}, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("only the local '$ref' is supported, but got '%s'", ref)
+	}
+	var current interface{} = v.root
+	pointer := strings.TrimPrefix(ref, "#")
+	if len(pointer) == 0 {
+		return current, nil
+	}
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		switch c := current.(type) {
+		case map[string]interface{}:
+			next, ok := c[token]
+			if !ok {
+				return nil, fmt.Errorf("the '$ref' '%s' not found", ref)
+			}
+			current = next
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(c) {
+				return nil, fmt.Errorf("the '$ref' '%s' not found", ref)
+			}
+			current = c[i]
+		default:
+			return nil, fmt.Errorf("the '$ref' '%s' not found", ref)
+		}
+	}
+	return current, nil
+}
+
+func (v *validator) validateType(types interface{}, value interface{}, path string) {
+	var expected []string
+	switch t := types.(type) {
+	case string:
+		expected = []string{t}
+	case []interface{}:
+		for _, item := range t {
+			if s, ok := item.(string); ok {
+				expected = append(expected, s)
+			}
+		}
+	}
+	actual := typeOf(value)
+	for _, e := range expected {
+		if e == actual || (e == "number" && actual == "integer") {
+			return
+		}
+	}
+	v.addError(path, "expected %s, but got %s", strings.Join(expected, " or "), actual)
+}
+
+func (v *validator) validateObject(s map[string]interface{}, obj map[string]interface{}, path string, depth int) {
+	if required, ok := s["required"].([]interface{}); ok {
+		for _, r := range required {
+			if name, ok := r.(string); ok {
+				if _, exists := obj[name]; !exists {
+					v.addError(path, "missing required property '%s'", name)
+				}
+			}
+		}
+	}
+	if n, ok := toInt(s["minProperties"]); ok && len(obj) < n {
+		v.addError(path, "expected at least %d properties, but got %d", n, len(obj))
+	}
+	if n, ok := toInt(s["maxProperties"]); ok && len(obj) > n {
+		v.addError(path, "expected at most %d properties, but got %d", n, len(obj))
+	}
+
+	properties, _ := s["properties"].(map[string]interface{})
+	patternProperties, _ := s["patternProperties"].(map[string]interface{})
+	additional, hasAdditional := s["additionalProperties"]
+
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		propPath := joinPath(path, k)
+		matched := false
+		if propSchema, ok := properties[k]; ok {
+			matched = true
+			v.validate(propSchema, obj[k], propPath, depth)
+		}
+		for pattern, propSchema := range patternProperties {
+			if re, err := regexp.Compile(pattern); err == nil && re.MatchString(k) {
+				matched = true
+				v.validate(propSchema, obj[k], propPath, depth)
+			}
+		}
+		if !matched && hasAdditional {
+			if allowed, ok := additional.(bool); ok && !allowed {
+				v.addError(propPath, "additional property '%s' is not allowed", k)
+			} else {
+				v.validate(additional, obj[k], propPath, depth)
+			}
+		}
+	}
+}
+
+func (v *validator) validateArray(s map[string]interface{}, arr []interface{}, path string, depth int) {
+	if n, ok := toInt(s["minItems"]); ok && len(arr) < n {
+		v.addError(path, "expected at least %d items, but got %d", n, len(arr))
+	}
+	if n, ok := toInt(s["maxItems"]); ok && len(arr) > n {
+		v.addError(path, "expected at most %d items, but got %d", n, len(arr))
+	}
+	if unique, ok := s["uniqueItems"].(bool); ok && unique {
+		for i := 0; i < len(arr); i++ {
+			for j := i + 1; j < len(arr); j++ {
+				if equal(arr[i], arr[j]) {
+					v.addError(path, "items at %d and %d are not unique", i, j)
+				}
+			}
+		}
+	}
+	switch items := s["items"].(type) {
+	case []interface{}:
+		// The tuple validation.
+		for i, item := range arr {
+			if i < len(items) {
+				v.validate(items[i], item, fmt.Sprintf("%s[%d]", path, i), depth)
+			}
+		}
+	case nil:
+	default:
+		for i, item := range arr {
+			v.validate(items, item, fmt.Sprintf("%s[%d]", path, i), depth)
+		}
+	}
+}
+
+func (v *validator) validateString(s map[string]interface{}, str string, path string) {
+	length := len([]rune(str))
+	if n, ok := toInt(s["minLength"]); ok && length < n {
+		v.addError(path, "expected at least %d characters, but got %d", n, length)
+	}
+	if n, ok := toInt(s["maxLength"]); ok && length > n {
+		v.addError(path, "expected at most %d characters, but got %d", n, length)
+	}
+	if pattern, ok := s["pattern"].(string); ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			v.addError(path, "invalid pattern '%s' in the schema", pattern)
+		} else if !re.MatchString(str) {
+			v.addError(path, "value '%s' does not match the pattern '%s'", str, pattern)
+		}
+	}
+}
+
+func (v *validator) validateNumber(s map[string]interface{}, num json.Number, path string) {
+	value, ok := new(big.Float).SetString(num.String())
+	if !ok {
+		return
+	}
+	compare := func(keyword string, failed func(int) bool, format string) {
+		limit, ok := toBigFloat(s[keyword])
+		if ok && failed(value.Cmp(limit)) {
+			v.addError(path, format, num.String(), s[keyword])
+		}
+	}
+	compare("minimum", func(c int) bool { return c < 0 }, "value %s is less than the minimum %v")
+	compare("maximum", func(c int) bool { return c > 0 }, "value %s is greater than the maximum %v")
+	compare("exclusiveMinimum", func(c int) bool { return c <= 0 }, "value %s is not greater than the exclusive minimum %v")
+	compare("exclusiveMaximum", func(c int) bool { return c >= 0 }, "value %s is not less than the exclusive maximum %v")
+
+	if multipleOf, ok := toBigFloat(s["multipleOf"]); ok && multipleOf.Sign() != 0 {
+		quo := new(big.Float).Quo(value, multipleOf)
+		if !quo.IsInt() {
+			v.addError(path, "value %s is not a multiple of %v", num.String(), s["multipleOf"])
+		}
+	}
+}
+
+// typeOf returns the json type of the value decoded from json with 'UseNumber'.
+func typeOf(value interface{}) string {
+	switch val := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if f, ok := new(big.Float).SetString(val.String()); ok && f.IsInt() {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// equal returns true if two values decoded from json are equal, the numbers are compared by value.
+func equal(a, b interface{}) bool {
+	na, okA := a.(json.Number)
+	nb, okB := b.(json.Number)
+	if okA && okB {
+		fa, okA := new(big.Float).SetString(na.String())
+		fb, okB := new(big.Float).SetString(nb.String())
+		return okA && okB && fa.Cmp(fb) == 0
+	}
+	switch va := a.(type) {
+	case []interface{}:
+		vb, ok := b.([]interface{})
+		if !ok || len(va) != len(vb) {
+			return false
+		}
+		for i := range va {
+			if !equal(va[i], vb[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		vb, ok := b.(map[string]interface{})
+		if !ok || len(va) != len(vb) {
+			return false
+		}
+		for k, item := range va {
+			if !equal(item, vb[k]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func toInt(value interface{}) (int, bool) {
+	num, ok := value.(json.Number)
+	if !ok {
+		return 0, false
+	}
+	i, err := num.Int64()
+	if err != nil {
+		return 0, false
+	}
+	return int(i), true
+}
+
+func toBigFloat(value interface{}) (*big.Float, bool) {
+	num, ok := value.(json.Number)
+	if !ok {
+		return nil, false
+	}
+	return new(big.Float).SetString(num.String())
+}
+
+func marshal(value interface{}) string {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(content)
+}
+
+// identifierPattern matches the property names which can be joined to the path by '.'.
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func joinPath(path, key string) string {
+	if identifierPattern.MatchString(key) {
+		return path + "." + key
+	}
+	return fmt.Sprintf("%s[%s]", path, strconv.Quote(key))
+}
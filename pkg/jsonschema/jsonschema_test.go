@@ -0,0 +1,55 @@
+package jsonschema
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testDataDir = "test_data"
+
+func getTestDir(subDir string) string {
+	pwd, _ := os.Getwd()
+	testDir := filepath.Join(pwd, testDataDir)
+	testDir = filepath.Join(testDir, subDir)
+
+	return testDir
+}
+
+func TestValidateJson(t *testing.T) {
+	schema, err := Load(getTestDir("schema.json"))
+	assert.Equal(t, err, nil)
+
+	errs, err := schema.ValidateJson(`{"name": "app", "replicas": 3, "labels": {"app": "app"}, "ports": [80, 443], "mode": "dev"}`)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(errs), 0)
+
+	errs, err = schema.ValidateJson(`{"name": "App", "replicas": 1.5, "labels": {"app": 1}, "ports": [0], "mode": "test", "extra": true}`)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, errs, []ValidationError{
+		{Path: "$.extra", Message: "additional property 'extra' is not allowed"},
+		{Path: "$.labels.app", Message: "expected string, but got integer"},
+		{Path: "$.mode", Message: `value must be one of ["dev","prod"]`},
+		{Path: "$.name", Message: "value 'App' does not match the pattern '^[a-z]+$'"},
+		{Path: "$.ports[0]", Message: "value 0 is less than the minimum 1"},
+		{Path: "$.replicas", Message: "expected integer, but got number"},
+	})
+
+	errs, err = schema.ValidateJson(`{"ports": []}`)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, errs, []ValidationError{
+		{Path: "$", Message: "missing required property 'name'"},
+		{Path: "$", Message: "missing required property 'replicas'"},
+		{Path: "$.ports", Message: "expected at least 1 items, but got 0"},
+	})
+}
+
+func TestLoadInvalidSchema(t *testing.T) {
+	_, err := Load(getTestDir("not_exist.json"))
+	assert.NotEqual(t, err, nil)
+
+	_, err = Parse([]byte(`[]`))
+	assert.Equal(t, err.Error(), "the json schema must be an object or a boolean")
+}
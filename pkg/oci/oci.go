@@ -2,10 +2,12 @@ package oci
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	v1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/thoas/go-funk"
@@ -16,6 +18,7 @@ import (
 	"kcl-lang.io/kpm/pkg/semver"
 	"kcl-lang.io/kpm/pkg/settings"
 	"kcl-lang.io/kpm/pkg/utils"
+	"kcl-lang.io/kpm/pkg/version"
 	"oras.land/oras-go/pkg/auth"
 	dockerauth "oras.land/oras-go/pkg/auth/docker"
 	remoteauth "oras.land/oras-go/v2/registry/remote/auth"
@@ -30,6 +33,14 @@ import (
 const OCI_SCHEME = "oci"
 const DEFAULT_OCI_ARTIFACT_TYPE = "application/vnd.oci.image.layer.v1.tar"
 
+// MEDIA_TYPE_DOCKER_MANIFEST_LIST is the media type of the docker manifest lists, which are pulled as the oci image indexes.
+const MEDIA_TYPE_DOCKER_MANIFEST_LIST = "application/vnd.docker.distribution.manifest.list.v2+json"
+
+// DefaultUserAgent returns the user-agent of the requests to the oci registries by default, e.g. 'kpm/0.7.0'.
+func DefaultUserAgent() string {
+	return "kpm/" + version.GetVersionInStr()
+}
+
 // Login will login 'hostname' by 'username' and 'password'.
 func Login(hostname, username, password string, setting *settings.Settings) error {
 
@@ -48,6 +59,7 @@ func Login(hostname, username, password string, setting *settings.Settings) erro
 			auth.WithLoginHostname(hostname),
 			auth.WithLoginUsername(username),
 			auth.WithLoginSecret(password),
+			auth.WithLoginUserAgent(DefaultUserAgent()),
 		}...,
 	)
 
@@ -85,12 +97,31 @@ type OciClient struct {
 	repo      *remote.Repository
 	ctx       *context.Context
 	logWriter io.Writer
+	// The platform of the variant pulled from the manifest lists, nil means the manifest lists are pulled as they are.
+	platform *v1.Platform
 }
 
 func (ociClient *OciClient) SetLogWriter(writer io.Writer) {
 	ociClient.logWriter = writer
 }
 
+// SetUserAgent will set the user-agent of the requests to the oci registry.
+func (ociClient *OciClient) SetUserAgent(userAgent string) {
+	if client, ok := ociClient.repo.Client.(*remoteauth.Client); ok {
+		client.SetUserAgent(userAgent)
+	}
+}
+
+// SetContext will set the context of the requests to the oci registry, the requests are stopped if it is cancelled.
+func (ociClient *OciClient) SetContext(ctx context.Context) {
+	ociClient.ctx = &ctx
+}
+
+// SetTargetPlatform will set the platform of the variant pulled if the artifact is a manifest list.
+func (ociClient *OciClient) SetTargetPlatform(platform *v1.Platform) {
+	ociClient.platform = platform
+}
+
 func (ociClient *OciClient) GetReference() string {
 	return ociClient.repo.Reference.String()
 }
@@ -121,16 +152,38 @@ func NewOciClient(regName, repoName string, settings *settings.Settings) (*OciCl
 			fmt.Sprintf("failed to load credential for '%s' from '%s'.", regName, settings.CredentialsFile),
 		)
 	}
-	repo.Client = &remoteauth.Client{
+	return newOciClientWithCredential(repo, ctx, credential), nil
+}
+
+// NewOciClientWithCredential will new an OciClient with the credential 'credential' instead of the one of the registry host.
+func NewOciClientWithCredential(regName, repoName string, settings *settings.Settings, credential *remoteauth.Credential) (*OciClient, error) {
+	repoPath := utils.JoinPath(regName, repoName)
+	repo, err := remote.NewRepository(repoPath)
+
+	if err != nil {
+		return nil, reporter.NewErrorEvent(
+			reporter.RepoNotFound,
+			err,
+			fmt.Sprintf("repository '%s' not found", repoPath),
+		)
+	}
+	repo.PlainHTTP = settings.DefaultOciPlainHttp()
+	return newOciClientWithCredential(repo, context.Background(), credential), nil
+}
+
+func newOciClientWithCredential(repo *remote.Repository, ctx context.Context, credential *remoteauth.Credential) *OciClient {
+	client := &remoteauth.Client{
 		Client:     retry.DefaultClient,
 		Cache:      remoteauth.DefaultCache,
 		Credential: remoteauth.StaticCredential(repo.Reference.Host(), *credential),
 	}
+	client.SetUserAgent(DefaultUserAgent())
+	repo.Client = client
 
 	return &OciClient{
 		repo: repo,
 		ctx:  &ctx,
-	}, nil
+	}
 }
 
 // Pull will pull the oci artifacts from oci registry to local path.
@@ -142,8 +195,16 @@ func (ociClient *OciClient) Pull(localPath, tag string) error {
 	}
 	defer fs.Close()
 
+	srcRef := tag
+	if ociClient.platform != nil {
+		srcRef, err = ociClient.resolvePlatformRef(tag)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Copy from the remote repository to the file store
-	_, err = oras.Copy(*ociClient.ctx, ociClient.repo, tag, fs, tag, oras.DefaultCopyOptions)
+	_, err = oras.Copy(*ociClient.ctx, ociClient.repo, srcRef, fs, tag, oras.DefaultCopyOptions)
 	if err != nil {
 		return reporter.NewErrorEvent(
 			reporter.FailedGetPkg,
@@ -155,6 +216,106 @@ func (ociClient *OciClient) Pull(localPath, tag string) error {
 	return nil
 }
 
+// ResolveDigest will return the digest of the manifest tagged 'tag' in the oci registry.
+func (ociClient *OciClient) ResolveDigest(tag string) (string, error) {
+	desc, err := ociClient.repo.Resolve(*ociClient.ctx, tag)
+	if err != nil {
+		return "", reporter.NewErrorEvent(
+			reporter.FailedGetPkg,
+			err,
+			fmt.Sprintf("failed to resolve the digest of '%s' from '%s'", tag, ociClient.repo.Reference.String()),
+		)
+	}
+	return desc.Digest.String(), nil
+}
+
+// resolvePlatformRef will return the digest of the manifest for the target platform if 'tag' is a manifest list,
+// and 'tag' itself otherwise.
+func (ociClient *OciClient) resolvePlatformRef(tag string) (string, error) {
+	desc, content, err := oras.FetchBytes(*ociClient.ctx, ociClient.repo, tag, oras.DefaultFetchBytesOptions)
+	if err != nil {
+		return "", reporter.NewErrorEvent(
+			reporter.FailedGetPkg,
+			err,
+			fmt.Sprintf("failed to get package with '%s' from '%s'", tag, ociClient.repo.Reference.String()),
+		)
+	}
+	if desc.MediaType != v1.MediaTypeImageIndex && desc.MediaType != MEDIA_TYPE_DOCKER_MANIFEST_LIST {
+		return tag, nil
+	}
+
+	var index v1.Index
+	if err := json.Unmarshal(content, &index); err != nil {
+		return "", reporter.NewErrorEvent(
+			reporter.FailedGetPkg,
+			err,
+			fmt.Sprintf("failed to parse the manifest list '%s' from '%s'", tag, ociClient.repo.Reference.String()),
+		)
+	}
+	manifest, err := SelectPlatformManifest(index, ociClient.platform)
+	if err != nil {
+		return "", reporter.NewErrorEvent(
+			reporter.PlatformNotMatched,
+			err,
+			fmt.Sprintf("no variant of '%s:%s' matches the platform '%s'", ociClient.repo.Reference.String(), tag, FormatPlatform(ociClient.platform)),
+		)
+	}
+	return manifest.Digest.String(), nil
+}
+
+// ParsePlatform will parse the platform in the format 'os/arch[/variant]', e.g. 'linux/arm64/v8'.
+func ParsePlatform(platform string) (*v1.Platform, error) {
+	parts := strings.Split(platform, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return nil, reporter.NewErrorEvent(
+			reporter.InvalidFlag,
+			fmt.Errorf("invalid platform '%s'", platform),
+			"the platform should be in the format 'os/arch[/variant]', e.g. 'linux/amd64'",
+		)
+	}
+	for _, part := range parts {
+		if len(part) == 0 {
+			return nil, reporter.NewErrorEvent(
+				reporter.InvalidFlag,
+				fmt.Errorf("invalid platform '%s'", platform),
+				"the platform should be in the format 'os/arch[/variant]', e.g. 'linux/amd64'",
+			)
+		}
+	}
+	p := &v1.Platform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == 3 {
+		p.Variant = parts[2]
+	}
+	return p, nil
+}
+
+// FormatPlatform will format the platform in the format 'os/arch[/variant]'.
+func FormatPlatform(platform *v1.Platform) string {
+	formatted := platform.OS + "/" + platform.Architecture
+	if len(platform.Variant) != 0 {
+		formatted += "/" + platform.Variant
+	}
+	return formatted
+}
+
+// SelectPlatformManifest will return the first manifest in the manifest list 'index' for the platform 'platform'.
+// The variant is only compared if it is set in 'platform'.
+func SelectPlatformManifest(index v1.Index, platform *v1.Platform) (*v1.Descriptor, error) {
+	var available []string
+	for i, manifest := range index.Manifests {
+		if manifest.Platform == nil {
+			continue
+		}
+		if manifest.Platform.OS == platform.OS &&
+			manifest.Platform.Architecture == platform.Architecture &&
+			(len(platform.Variant) == 0 || manifest.Platform.Variant == platform.Variant) {
+			return &index.Manifests[i], nil
+		}
+		available = append(available, FormatPlatform(manifest.Platform))
+	}
+	return nil, fmt.Errorf("the available platforms are [%s]", strings.Join(available, ", "))
+}
+
 // TheLatestTag will return the latest tag of the kcl packages.
 func (ociClient *OciClient) TheLatestTag() (string, error) {
 	var tagSelected string
@@ -180,6 +341,26 @@ func (ociClient *OciClient) TheLatestTag() (string, error) {
 	return tagSelected, nil
 }
 
+// Tags will return all the tags of the kcl packages.
+func (ociClient *OciClient) Tags() ([]string, error) {
+	var allTags []string
+
+	err := ociClient.repo.Tags(*ociClient.ctx, "", func(tags []string) error {
+		allTags = append(allTags, tags...)
+		return nil
+	})
+
+	if err != nil {
+		return nil, reporter.NewErrorEvent(
+			reporter.FailedGetPackageVersions,
+			err,
+			fmt.Sprintf("failed to get the versions from '%s'", ociClient.repo.Reference.String()),
+		)
+	}
+
+	return allTags, nil
+}
+
 // ContainsTag will check if the tag exists in the repo.
 func (ociClient *OciClient) ContainsTag(tag string) (bool, *reporter.KpmEvent) {
 	var exists bool
@@ -1,13 +1,20 @@
 package oci
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/stretchr/testify/assert"
 	"kcl-lang.io/kpm/pkg/settings"
 	"kcl-lang.io/kpm/pkg/utils"
+	"oras.land/oras-go/v2/registry/remote"
+	remoteauth "oras.land/oras-go/v2/registry/remote/auth"
 )
 
 const testDataDir = "test_data"
@@ -40,3 +47,74 @@ func TestLogin(t *testing.T) {
 	err := Login(hostName, userName, userPwd, &settings)
 	assert.Equal(t, err.Error(), "failed to login 'ghcr.io', please check registry, username and password is valid\nGet \"https://ghcr.io/v2/\": denied: denied\n")
 }
+
+func TestOciClientUserAgent(t *testing.T) {
+	var userAgents []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgents = append(userAgents, r.UserAgent())
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"name":"test","tags":["0.0.1"]}`))
+	}))
+	defer server.Close()
+
+	newClient := func() *OciClient {
+		repo, err := remote.NewRepository(strings.TrimPrefix(server.URL, "http://") + "/test")
+		assert.Equal(t, err, nil)
+		repo.PlainHTTP = true
+		return newOciClientWithCredential(repo, context.Background(), &remoteauth.Credential{})
+	}
+
+	tags, err := newClient().Tags()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, tags, []string{"0.0.1"})
+
+	ociClient := newClient()
+	ociClient.SetUserAgent("my-pipeline/1.0")
+	_, err = ociClient.Tags()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, userAgents, []string{DefaultUserAgent(), "my-pipeline/1.0"})
+	assert.Equal(t, strings.HasPrefix(DefaultUserAgent(), "kpm/"), true)
+}
+
+func TestParsePlatform(t *testing.T) {
+	platform, err := ParsePlatform("linux/arm64/v8")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, platform, &v1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"})
+	assert.Equal(t, FormatPlatform(platform), "linux/arm64/v8")
+
+	platform, err = ParsePlatform("linux/amd64")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, FormatPlatform(platform), "linux/amd64")
+
+	for _, invalid := range []string{"", "linux", "linux/", "linux/arm64/v8/extra"} {
+		_, err = ParsePlatform(invalid)
+		assert.NotEqual(t, err, nil)
+	}
+}
+
+func TestSelectPlatformManifest(t *testing.T) {
+	index := v1.Index{
+		Manifests: []v1.Descriptor{
+			{Digest: "sha256:amd64", Platform: &v1.Platform{OS: "linux", Architecture: "amd64"}},
+			{Digest: "sha256:arm64v7", Platform: &v1.Platform{OS: "linux", Architecture: "arm64", Variant: "v7"}},
+			{Digest: "sha256:arm64v8", Platform: &v1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}},
+			{Digest: "sha256:unknown"},
+		},
+	}
+
+	manifest, err := SelectPlatformManifest(index, &v1.Platform{OS: "linux", Architecture: "amd64"})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, manifest.Digest.String(), "sha256:amd64")
+
+	manifest, err = SelectPlatformManifest(index, &v1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, manifest.Digest.String(), "sha256:arm64v8")
+
+	// The variant is not compared if it is not set.
+	manifest, err = SelectPlatformManifest(index, &v1.Platform{OS: "linux", Architecture: "arm64"})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, manifest.Digest.String(), "sha256:arm64v7")
+
+	_, err = SelectPlatformManifest(index, &v1.Platform{OS: "windows", Architecture: "amd64"})
+	assert.Equal(t, err.Error(), "the available platforms are [linux/amd64, linux/arm64/v7, linux/arm64/v8]")
+}
@@ -0,0 +1,263 @@
+package opt
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"golang.org/x/text/language"
+	"kcl-lang.io/kpm/pkg/env"
+)
+
+// vendorModeNames is the names of the vendor modes in the effective configuration.
+var vendorModeNames = map[VendorMode]string{
+	NoVendor:   "none",
+	FullVendor: "full",
+	DirectOnly: "direct_only",
+}
+
+// symlinkPolicyNames is the names of the symlink policies in the effective configuration.
+var symlinkPolicyNames = map[SymlinkPolicy]string{
+	FollowWithinRoot: "follow_within_root",
+	Reject:           "reject",
+	Preserve:         "preserve",
+}
+
+// EffectiveConfig is the snapshot of the settings which drive the compilation,
+// after the defaults, the settings files, the environment variables and the options are merged.
+// The relative paths are resolved into the absolute paths, and it can be serialized into json or yaml.
+type EffectiveConfig struct {
+	// PkgPath is the path of the kcl package to compile.
+	PkgPath string `json:"pkg_path" yaml:"pkg_path"`
+	// PkgCachePath is the path of the global cache of the kcl packages, which is $KCL_PKG_PATH by default.
+	PkgCachePath string `json:"pkg_cache_path,omitempty" yaml:"pkg_cache_path,omitempty"`
+	// KFilenames is the kcl files and directories compiled.
+	KFilenames []string `json:"k_filenames,omitempty" yaml:"k_filenames,omitempty"`
+	// Entries is the entries added by kpm, e.g. from the 'kcl.mod'.
+	Entries []string `json:"entries,omitempty" yaml:"entries,omitempty"`
+	// Args is the top-level arguments, the later one wins if an argument is set more than once.
+	Args map[string]string `json:"args,omitempty" yaml:"args,omitempty"`
+	// Overrides is the overrides of the fields, e.g. 'app.replicas=2'.
+	Overrides []string `json:"overrides,omitempty" yaml:"overrides,omitempty"`
+	// ExternalPkgs is the paths of the external packages, the key is the name of the package.
+	ExternalPkgs map[string]string `json:"external_pkgs,omitempty" yaml:"external_pkgs,omitempty"`
+	// PathSelector is the paths of the fields selected from the output.
+	PathSelector []string `json:"path_selector,omitempty" yaml:"path_selector,omitempty"`
+	// The flags of the kcl compiler.
+	DisableNone       bool `json:"disable_none" yaml:"disable_none"`
+	SortKeys          bool `json:"sort_keys" yaml:"sort_keys"`
+	StrictRangeCheck  bool `json:"strict_range_check" yaml:"strict_range_check"`
+	DisableYamlResult bool `json:"disable_yaml_result" yaml:"disable_yaml_result"`
+
+	VendorMode               string              `json:"vendor_mode" yaml:"vendor_mode"`
+	NoSumCheck               bool                `json:"no_sum_check" yaml:"no_sum_check"`
+	FailOnLockChange         bool                `json:"fail_on_lock_change" yaml:"fail_on_lock_change"`
+	FailFast                 bool                `json:"fail_fast" yaml:"fail_fast"`
+	AtomicLockWrite          bool                `json:"atomic_lock_write" yaml:"atomic_lock_write"`
+	SkipUnusedDeps           bool                `json:"skip_unused_deps" yaml:"skip_unused_deps"`
+	WarningsAsErrors         bool                `json:"warnings_as_errors" yaml:"warnings_as_errors"`
+	ImportAliases            map[string]string   `json:"import_aliases,omitempty" yaml:"import_aliases,omitempty"`
+	RegistryMirrors          map[string][]string `json:"registry_mirrors,omitempty" yaml:"registry_mirrors,omitempty"`
+	AllowedRegistries        []string            `json:"allowed_registries,omitempty" yaml:"allowed_registries,omitempty"`
+	PullThroughCache         string              `json:"pull_through_cache,omitempty" yaml:"pull_through_cache,omitempty"`
+	GitCloneDepth            int                 `json:"git_clone_depth,omitempty" yaml:"git_clone_depth,omitempty"`
+	VersionOverride          string              `json:"version_override,omitempty" yaml:"version_override,omitempty"`
+	StableDocumentOrder      string              `json:"stable_document_order,omitempty" yaml:"stable_document_order,omitempty"`
+	TargetPlatform           string              `json:"target_platform,omitempty" yaml:"target_platform,omitempty"`
+	CaseSensitivePaths       bool                `json:"case_sensitive_paths" yaml:"case_sensitive_paths"`
+	CaptureInput             bool                `json:"capture_input" yaml:"capture_input"`
+	PluginPath               string              `json:"plugin_path,omitempty" yaml:"plugin_path,omitempty"`
+	DiffBase                 string              `json:"diff_base,omitempty" yaml:"diff_base,omitempty"`
+	FailOnDiff               bool                `json:"fail_on_diff" yaml:"fail_on_diff"`
+	UserAgent                string              `json:"user_agent,omitempty" yaml:"user_agent,omitempty"`
+	MmapThreshold            int64               `json:"mmap_threshold,omitempty" yaml:"mmap_threshold,omitempty"`
+	OutputFormat             string              `json:"output_format" yaml:"output_format"`
+	SymlinkPolicy            string              `json:"symlink_policy" yaml:"symlink_policy"`
+	MutableRefTTL            string              `json:"mutable_ref_ttl,omitempty" yaml:"mutable_ref_ttl,omitempty"`
+	ContractCheck            bool                `json:"contract_check" yaml:"contract_check"`
+	RandSeed                 *int64              `json:"rand_seed,omitempty" yaml:"rand_seed,omitempty"`
+	EntryWorkDirs            map[string]string   `json:"entry_work_dirs,omitempty" yaml:"entry_work_dirs,omitempty"`
+	OutputTemplate           string              `json:"output_template,omitempty" yaml:"output_template,omitempty"`
+	RedactPaths              []string            `json:"redact_paths,omitempty" yaml:"redact_paths,omitempty"`
+	GlobalDefaults           string              `json:"global_defaults,omitempty" yaml:"global_defaults,omitempty"`
+	EntryConcurrency         int                 `json:"entry_concurrency,omitempty" yaml:"entry_concurrency,omitempty"`
+	DisabledBuiltins         []string            `json:"disabled_builtins,omitempty" yaml:"disabled_builtins,omitempty"`
+	ProvenanceAnnotation     string              `json:"provenance_annotation,omitempty" yaml:"provenance_annotation,omitempty"`
+	ModuleProxy              string              `json:"module_proxy,omitempty" yaml:"module_proxy,omitempty"`
+	OverrideFile             string              `json:"override_file,omitempty" yaml:"override_file,omitempty"`
+	IncludeDependencyOutput  []string            `json:"include_dependency_output,omitempty" yaml:"include_dependency_output,omitempty"`
+	EnvFile                  string              `json:"env_file,omitempty" yaml:"env_file,omitempty"`
+	EnvFileOverride          bool                `json:"env_file_override" yaml:"env_file_override"`
+	FileAccessRoot           string              `json:"file_access_root,omitempty" yaml:"file_access_root,omitempty"`
+	OutputSchema             string              `json:"output_schema,omitempty" yaml:"output_schema,omitempty"`
+	DumpArgs                 string              `json:"dump_args,omitempty" yaml:"dump_args,omitempty"`
+	SplitOutputDir           string              `json:"split_output_dir,omitempty" yaml:"split_output_dir,omitempty"`
+	SplitOutputNameTemplate  string              `json:"split_output_name_template,omitempty" yaml:"split_output_name_template,omitempty"`
+	IncrementalCacheDir      string              `json:"incremental_cache_dir,omitempty" yaml:"incremental_cache_dir,omitempty"`
+	Profile                  string              `json:"profile,omitempty" yaml:"profile,omitempty"`
+	MaxRecursionDepth        int                 `json:"max_recursion_depth,omitempty" yaml:"max_recursion_depth,omitempty"`
+	MaxDocuments             int                 `json:"max_documents,omitempty" yaml:"max_documents,omitempty"`
+	DocumentSeparatorComment bool                `json:"document_separator_comment" yaml:"document_separator_comment"`
+	PreserveComments         bool                `json:"preserve_comments" yaml:"preserve_comments"`
+	LogLevel                 string              `json:"log_level" yaml:"log_level"`
+	LogDependencyOrigins     bool                `json:"log_dependency_origins" yaml:"log_dependency_origins"`
+	ExposeDepPaths           bool                `json:"expose_dep_paths" yaml:"expose_dep_paths"`
+	Locale                   string              `json:"locale,omitempty" yaml:"locale,omitempty"`
+	OutputEncoding           string              `json:"output_encoding,omitempty" yaml:"output_encoding,omitempty"`
+	// The hooks can not be serialized, only whether they are set is recorded.
+	HasResultTransform    bool `json:"has_result_transform" yaml:"has_result_transform"`
+	HasCredentialProvider bool `json:"has_credential_provider" yaml:"has_credential_provider"`
+	HasErrorFormatter     bool `json:"has_error_formatter" yaml:"has_error_formatter"`
+	HasPreResolveHook     bool `json:"has_pre_resolve_hook" yaml:"has_pre_resolve_hook"`
+	HasOutputValidator    bool `json:"has_output_validator" yaml:"has_output_validator"`
+	HasNewChecksumHook    bool `json:"has_new_checksum_hook" yaml:"has_new_checksum_hook"`
+	HasImportResolver     bool `json:"has_import_resolver" yaml:"has_import_resolver"`
+	HasUnredactedSink     bool `json:"has_unredacted_sink" yaml:"has_unredacted_sink"`
+	HasDiagnosticHandler  bool `json:"has_diagnostic_handler" yaml:"has_diagnostic_handler"`
+}
+
+// Effective will return the snapshot of the settings which drive the compilation.
+// The relative kcl files and entries are resolved by the package path, and the other relative paths by the current directory.
+func (opts *CompileOptions) Effective() EffectiveConfig {
+	pkgPath := absPath(opts.PkgPath())
+	splitOutputDir, splitOutputNameTemplate := opts.SplitOutput()
+	config := EffectiveConfig{
+		PkgPath:                  pkgPath,
+		Entries:                  resolvePaths(pkgPath, opts.Entries()),
+		VendorMode:               vendorModeNames[opts.VendorMode()],
+		NoSumCheck:               opts.NoSumCheck(),
+		FailOnLockChange:         opts.FailOnLockChange(),
+		FailFast:                 opts.FailFast(),
+		AtomicLockWrite:          opts.AtomicLockWrite(),
+		SkipUnusedDeps:           opts.SkipUnusedDeps(),
+		WarningsAsErrors:         opts.WarningsAsErrors(),
+		ImportAliases:            opts.ImportAliases(),
+		RegistryMirrors:          opts.RegistryMirrors(),
+		AllowedRegistries:        opts.AllowedRegistries(),
+		PullThroughCache:         opts.PullThroughCache(),
+		GitCloneDepth:            opts.GitCloneDepth(),
+		VersionOverride:          opts.VersionOverride(),
+		StableDocumentOrder:      opts.StableDocumentOrder(),
+		TargetPlatform:           opts.TargetPlatform(),
+		CaseSensitivePaths:       opts.CaseSensitivePaths(),
+		CaptureInput:             opts.CaptureInput(),
+		PluginPath:               absPath(opts.PluginPath()),
+		DiffBase:                 absPath(opts.DiffBase()),
+		FailOnDiff:               opts.FailOnDiff(),
+		UserAgent:                opts.UserAgent(),
+		MmapThreshold:            opts.MmapThreshold(),
+		OutputFormat:             string(opts.OutputFormat()),
+		SymlinkPolicy:            symlinkPolicyNames[opts.SymlinkPolicy()],
+		ContractCheck:            opts.ContractCheck(),
+		EntryWorkDirs:            opts.EntryWorkDirs(),
+		OutputTemplate:           opts.OutputTemplate(),
+		RedactPaths:              opts.RedactPaths(),
+		GlobalDefaults:           absPath(opts.GlobalDefaults()),
+		EntryConcurrency:         opts.EntryConcurrency(),
+		DisabledBuiltins:         opts.DisabledBuiltins(),
+		ProvenanceAnnotation:     opts.ProvenanceAnnotation(),
+		ModuleProxy:              opts.ModuleProxy(),
+		OverrideFile:             absPath(opts.OverrideFile()),
+		IncludeDependencyOutput:  opts.IncludeDependencyOutput(),
+		EnvFile:                  absPath(opts.EnvFile()),
+		EnvFileOverride:          opts.EnvFileOverride(),
+		FileAccessRoot:           absPath(opts.FileAccessRoot()),
+		OutputSchema:             absPath(opts.OutputSchema()),
+		DumpArgs:                 absPath(opts.DumpArgs()),
+		SplitOutputDir:           absPath(splitOutputDir),
+		SplitOutputNameTemplate:  splitOutputNameTemplate,
+		IncrementalCacheDir:      absPath(opts.IncrementalCacheDir()),
+		Profile:                  absPath(opts.Profile()),
+		MaxRecursionDepth:        opts.MaxRecursionDepth(),
+		MaxDocuments:             opts.MaxDocuments(),
+		DocumentSeparatorComment: opts.DocumentSeparatorComment(),
+		PreserveComments:         opts.PreserveComments(),
+		LogLevel:                 opts.LogLevel().String(),
+		LogDependencyOrigins:     opts.LogDependencyOrigins(),
+		ExposeDepPaths:           opts.ExposeDepPaths(),
+		HasResultTransform:       opts.ResultTransform() != nil,
+		HasCredentialProvider:    opts.CredentialProvider() != nil,
+		HasErrorFormatter:        opts.ErrorFormatter() != nil,
+		HasPreResolveHook:        opts.PreResolveHook() != nil,
+		HasOutputValidator:       opts.OutputValidator() != nil,
+		HasNewChecksumHook:       opts.NewChecksumHook() != nil,
+		HasImportResolver:        opts.ImportResolver() != nil,
+		HasUnredactedSink:        opts.UnredactedSink() != nil,
+		HasDiagnosticHandler:     opts.DiagnosticHandler() != nil,
+	}
+	if cachePath, err := env.GetAbsPkgPath(); err == nil {
+		config.PkgCachePath = cachePath
+	}
+	if seed, ok := opts.RandSeed(); ok {
+		config.RandSeed = &seed
+	}
+	if opts.MutableRefTTL() > 0 {
+		config.MutableRefTTL = opts.MutableRefTTL().String()
+	}
+	if opts.Locale() != language.Und {
+		config.Locale = opts.Locale().String()
+	}
+	if enc := opts.OutputEncoding(); enc != nil {
+		if name, ok := enc.(fmt.Stringer); ok {
+			config.OutputEncoding = name.String()
+		} else {
+			config.OutputEncoding = fmt.Sprintf("%T", enc)
+		}
+	}
+
+	if opts.Option == nil || opts.ExecProgram_Args == nil {
+		return config
+	}
+	args := opts.ExecProgram_Args
+	config.KFilenames = resolvePaths(pkgPath, args.KFilenameList)
+	config.PathSelector = args.PathSelector
+	config.DisableNone = args.DisableNone
+	config.SortKeys = args.SortKeys
+	config.StrictRangeCheck = args.StrictRangeCheck
+	config.DisableYamlResult = args.DisableYamlResult
+	for _, arg := range args.Args {
+		if config.Args == nil {
+			config.Args = make(map[string]string)
+		}
+		config.Args[arg.Name] = arg.Value
+	}
+	for _, override := range args.Overrides {
+		field := override.FieldPath
+		if len(override.Pkgpath) != 0 {
+			field = override.Pkgpath + ":" + field
+		}
+		config.Overrides = append(config.Overrides, fmt.Sprintf("%s=%s", field, override.FieldValue))
+	}
+	for _, pkg := range args.ExternalPkgs {
+		if config.ExternalPkgs == nil {
+			config.ExternalPkgs = make(map[string]string)
+		}
+		config.ExternalPkgs[pkg.PkgName] = absPath(pkg.PkgPath)
+	}
+	return config
+}
+
+// absPath returns the absolute path of 'path', the empty path and the path which can not be resolved are returned as is.
+func absPath(path string) string {
+	if len(path) == 0 {
+		return path
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// resolvePaths returns the paths resolved by the directory 'dir'.
+func resolvePaths(dir string, paths []string) []string {
+	if len(paths) == 0 {
+		return nil
+	}
+	resolved := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		resolved = append(resolved, path)
+	}
+	return resolved
+}
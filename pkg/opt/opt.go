@@ -3,30 +3,279 @@
 package opt
 
 import (
+	"fmt"
 	"io"
+	"io/fs"
 	"net/url"
 	"os"
 	"path/filepath"
+	"time"
 
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/language"
 	"kcl-lang.io/kcl-go/pkg/kcl"
 	"kcl-lang.io/kpm/pkg/errors"
 	"kcl-lang.io/kpm/pkg/reporter"
 	"oras.land/oras-go/v2"
+	remoteauth "oras.land/oras-go/v2/registry/remote/auth"
 )
 
+// VendorMode is the mode of vendoring the dependencies.
+type VendorMode int
+
+const (
+	// NoVendor will not vendor the dependencies.
+	NoVendor VendorMode = iota
+	// FullVendor will vendor all the dependencies, including the transitive dependencies.
+	FullVendor
+	// DirectOnly will vendor only the direct dependencies,
+	// the transitive dependencies are left in the global cache.
+	DirectOnly
+)
+
+// OutputFormat is the format which the compile result is converted into in addition to yaml and json,
+// it is one of the built-in formats or the name of a serializer registered by 'WithSerializer'.
+type OutputFormat string
+
+const (
+	// YAML keeps the compile result in yaml and json only.
+	YAML OutputFormat = "yaml"
+	// JSON keeps the compile result in yaml and json only, the same as YAML.
+	JSON OutputFormat = "json"
+	// CUE converts the compile result into CUE.
+	CUE OutputFormat = "cue"
+	// HCL converts the compile result into the native syntax of HCL, e.g. the Terraform variables.
+	HCL OutputFormat = "hcl"
+)
+
+// SymlinkPolicy is the policy of the symlinks in the kcl packages.
+type SymlinkPolicy int
+
+const (
+	// FollowWithinRoot will follow the symlinks to the files in the root of the package,
+	// and reject the symlinks escaping the root to prevent the path traversal.
+	FollowWithinRoot SymlinkPolicy = iota
+	// Reject will reject all the symlinks.
+	Reject
+	// Preserve will keep the symlinks as they are, wherever they point to.
+	Preserve
+)
+
+// CheckSymlink returns an error if the symlink 'path' to 'target' is not allowed by the policy,
+// 'inRoot' is whether the target is in the root of the package.
+func (p SymlinkPolicy) CheckSymlink(path, target string, inRoot bool) error {
+	switch {
+	case p == Reject:
+		return reporter.NewErrorEvent(
+			reporter.SymlinkNotAllowed,
+			fmt.Errorf("'%s' is a symlink to '%s'", path, target),
+			"the symlinks are rejected by the symlink policy",
+		)
+	case p == FollowWithinRoot && !inRoot:
+		return reporter.NewErrorEvent(
+			reporter.SymlinkNotAllowed,
+			fmt.Errorf("'%s' is a symlink to '%s' out of the root of the package", path, target),
+			"the symlinks escaping the root of the package are rejected",
+		)
+	default:
+		return nil
+	}
+}
+
 // CompileOptions is the input options of 'kpm run'.
 type CompileOptions struct {
 	isVendor        bool
+	vendorMode      VendorMode
 	hasSettingsYaml bool
 	entries         []string
 	noSumCheck      bool
 	// Add a writer to control the output of the compiler.
 	writer io.Writer
+	// Whether to insert a '# source: <entry>' comment before each document.
+	documentSeparatorComment bool
+	// Whether to fail if the kcl.mod.lock would be created or modified.
+	failOnLockChange bool
+	// The import aliases, the key is the alias and the value is the name of the aliased package.
+	importAliases map[string]string
+	// The mirrors of the registries, the key is the primary registry.
+	registryMirrors map[string][]string
+	// The registries which the oci dependencies are allowed to come from.
+	allowedRegistries []string
+	// The path of the json schema to validate the compiled documents.
+	outputSchema string
+	// The path of the '.env' file to load the environment variables from.
+	envFile string
+	// Whether the environment variables from the '.env' file override the ones already set.
+	envFileOverride bool
+	// The names of the dependencies whose outputs are merged with the output of the root package.
+	includeDependencyOutput []string
+	// The path of the file to dump the resolved top-level arguments into.
+	dumpArgs string
+	// Whether to fail on the warnings, e.g. the deprecated dependencies.
+	warningsAsErrors bool
+	// The formatter to render the error messages.
+	errorFormatter reporter.ErrorFormatter
+	// The directory which the files read during the compilation must be in.
+	fileAccessRoot string
+	// Whether to skip resolving the dependencies which are not imported by the entries.
+	skipUnusedDeps bool
+	// The hook to transform each compiled document.
+	resultTransform ResultTransform
+	// The level of detail of the log written to the log writer.
+	logLevel reporter.LogLevel
+	// The directory to write each compiled document into a separate file.
+	splitOutputDir string
+	// The template of the file names of the documents written into the split output directory.
+	splitOutputNameTemplate string
+	// The directory to cache the input hashes and the outputs of the entries for the incremental builds.
+	incrementalCacheDir string
+	// The maximum depth of the recursion in the compilation, 0 is the default of the kcl compiler.
+	maxRecursionDepth int
+	// The path to write the profile of the compilation.
+	profile string
+	// The provider to resolve the credentials referenced by the dependencies.
+	credentialProvider CredentialProvider
+	// The flag of whether to carry the doc comments of the schemas into the yaml output.
+	preserveComments bool
+	// The flag of whether to stop downloading the dependencies on the first failure.
+	failFast bool
+	// The language to translate the messages of kpm into.
+	locale language.Tag
+	// The hook to inspect and modify the dependencies before they are resolved.
+	preResolveHook PreResolveHook
+	// The flag of whether to replace kcl.mod and kcl.mod.lock atomically when they are written.
+	atomicLockWrite bool
+	// The maximum number of the compiled documents, 0 means no limit.
+	maxDocuments int
+	// The flag of whether to log the origins of the resolved dependencies at the info level.
+	logDependencyOrigins bool
+	// The encoding of the serialized output, nil means utf-8.
+	outputEncoding encoding.Encoding
+	// The pull-through cache which the oci dependencies are pulled from instead of their registries.
+	pullThroughCache string
+	// The number of the commits cloned for the git dependencies, 0 means the full history.
+	gitCloneDepth int
+	// The hook to validate the serialized output.
+	outputValidator OutputValidator
+	// The version to compile the package as, instead of the version in kcl.mod.
+	versionOverride string
+	// The dot-separated field to sort the compiled documents by.
+	stableDocumentOrder string
+	// The hook to call with the checksums newly recorded in kcl.mod.lock.
+	newChecksumHook NewChecksumHook
+	// The platform of the variant pulled if an oci dependency is a manifest list.
+	targetPlatform string
+	// The flag of whether to check the entries and the imports match the case of the files exactly.
+	caseSensitivePaths bool
+	// The resolver consulted for the imports which kpm can not resolve.
+	importResolver ImportResolver
+	// The flag of whether to keep the resolved input values in the compile result.
+	captureInput bool
+	// The root directory of the kcl plugins, the plugins pinned in kcl.mod are verified in it.
+	pluginPath string
+	// The path of the yaml file which the compile result is diffed against.
+	diffBase string
+	// The flag of whether the compile result drifting from the diff base is a failure.
+	failOnDiff bool
+	// The user-agent of the requests to the oci registries.
+	userAgent string
+	// The size in bytes from which the files read by the compilation are memory-mapped, 0 means they are never memory-mapped.
+	mmapThreshold int64
+	// The format which the compile result is converted into.
+	outputFormat OutputFormat
+	// The time after which the cached dependencies of the mutable refs are fetched again.
+	mutableRefTTL time.Duration
+	// The flag of whether to validate the compile result against the contract declared in kcl.mod.
+	contractCheck bool
+	// The seed of the random number generator of the kcl runtime, nil means it is not seeded.
+	randSeed *int64
+	// The working directories of the entries compiled by 'RunEntries', the key is the entry.
+	entryWorkDirs map[string]string
+	// The go template to wrap the compiled documents into a single document.
+	outputTemplate string
+	// The JSONPaths of the fields to redact in the compile result.
+	redactPaths []string
+	// The writer to write the output into before it is redacted.
+	unredactedSink io.Writer
+	// The path of the defaults document merged beneath the compiled documents.
+	globalDefaults string
+	// The maximum number of the entries compiled at the same time by 'RunEntries'.
+	entryConcurrency int
+	// The handler to call with each diagnostic as it is reported.
+	diagnosticHandler DiagnosticHandler
+	// The names of the builtins which the compiled kcl files are not allowed to use.
+	disabledBuiltins []string
+	// The flag of whether to pass the resolved paths of the dependencies to the compilation as the top-level arguments.
+	exposeDepPaths bool
+	// The annotation key of the hash of the inputs injected into each kubernetes-style document.
+	provenanceAnnotation string
+	// The module proxy which the metadata and the packages of the oci dependencies are fetched from.
+	moduleProxy string
+	// The policy of the symlinks in the kcl packages extracted from the tars and compiled.
+	symlinkPolicy SymlinkPolicy
+	// The custom serializers of the output formats, the key is the name of the format.
+	serializers map[string]Serializer
+	// The file of the overrides of the dependencies applied to the resolution.
+	overrideFile string
 	*kcl.Option
 }
 
 type Option func(*CompileOptions)
 
+// CredentialProvider resolves the credential reference 'ref' of a dependency in 'kcl.mod' into the credential to pull it from 'host'.
+type CredentialProvider func(ref, host string) (*remoteauth.Credential, error)
+
+// ResultTransform transforms a compiled document, the document is dropped if nil is returned.
+type ResultTransform func(doc map[string]interface{}) (map[string]interface{}, error)
+
+// OutputValidator validates the serialized output, the compilation fails if an error is returned.
+type OutputValidator func(out []byte) error
+
+// DependencySpec is a dependency declared in 'kcl.mod', which is passed to the pre-resolution hook.
+// Only the fields of one source are set, i.e. the git fields, the oci fields, 'LocalPath' or 'LocalRegistry'.
+type DependencySpec struct {
+	// Name is the name of the dependency.
+	Name string
+	// Version is the version of the dependency, it is the tag for the oci dependencies
+	// and the version in the registry for the local registry dependencies.
+	Version string
+
+	GitUrl    string
+	GitBranch string
+	GitCommit string
+	GitTag    string
+	GitSubdir string
+
+	OciReg        string
+	OciRepo       string
+	OciCredential string
+
+	// LocalPath is the path of the local dependency.
+	LocalPath string
+	// LocalRegistry is the path of the local directory registry of the dependency.
+	LocalRegistry string
+}
+
+// PreResolveHook inspects and optionally modifies the dependencies declared in 'kcl.mod' before they are resolved.
+// The returned dependencies are resolved and recorded in 'kcl.mod.lock' instead, and the resolution is aborted if an error is returned.
+type PreResolveHook func(deps []DependencySpec) ([]DependencySpec, error)
+
+// ImportResolver resolves the import 'importPath' which kpm can not resolve, e.g. 'mock.sub'.
+// The returned filesystem is compiled as the package of the top-level name of the import if 'ok' is true,
+// and the import is left to the kcl compiler if 'ok' is false.
+type ImportResolver func(importPath string) (fsys fs.FS, ok bool, err error)
+
+// Serializer serializes the documents of the compile result into the output of a custom format.
+// The documents are the values decoded from the json of the documents in order, e.g. 'map[string]interface{}' for an object,
+// with the integers as 'int64' and the other numbers as 'float64', except the integers overflowing 'int64' which are 'json.Number'.
+type Serializer func(docs []interface{}) ([]byte, error)
+
+// DiagnosticHandler handles a diagnostic, i.e. an error or a warning, as soon as it is reported.
+type DiagnosticHandler func(diagnostic reporter.Diagnostic)
+
+// NewChecksumHook is called with the name and the checksum of a dependency when the checksum is first recorded in 'kcl.mod.lock'.
+type NewChecksumHook func(dep string, digest string)
+
 // WithKclOption will add a kcl option to the compiler.
 func WithKclOption(opt kcl.Option) Option {
 	return func(opts *CompileOptions) {
@@ -48,6 +297,15 @@ func WithVendor(isVendor bool) Option {
 	}
 }
 
+// WithVendorMode will set the mode of vendoring the dependencies.
+// 'DirectOnly' vendors only the direct dependencies and resolves the transitive ones from the global cache.
+func WithVendorMode(mode VendorMode) Option {
+	return func(opts *CompileOptions) {
+		opts.isVendor = mode != NoVendor
+		opts.vendorMode = mode
+	}
+}
+
 // WithNoSumCheck will set the 'no_sum_check' flag.
 func WithNoSumCheck(is bool) Option {
 	return func(opts *CompileOptions) {
@@ -62,14 +320,611 @@ func WithLogWriter(writer io.Writer) Option {
 	}
 }
 
+// WithDocumentSeparatorComment will insert a '# source: <entry>' comment before the '---' of each document,
+// so that the documents in one yaml stream can be routed by the entry they come from.
+// The output is still compiled from the entries together, each entry is also compiled separately only to find out
+// which documents it produces, and the compilation fails if the documents can not be attributed to the entries.
+func WithDocumentSeparatorComment(is bool) Option {
+	return func(opts *CompileOptions) {
+		opts.documentSeparatorComment = is
+	}
+}
+
+// WithFailOnLockChange will return an error instead of creating or modifying the kcl.mod.lock,
+// the error describes the change of the kcl.mod.lock.
+func WithFailOnLockChange(is bool) Option {
+	return func(opts *CompileOptions) {
+		opts.failOnLockChange = is
+	}
+}
+
+// WithImportAlias will make the import path 'from' resolved to the dependency 'to' for the whole package,
+// so that two dependencies exposing the same import path can be distinguished without editing the source.
+func WithImportAlias(from, to string) Option {
+	return func(opts *CompileOptions) {
+		if opts.importAliases == nil {
+			opts.importAliases = make(map[string]string)
+		}
+		opts.importAliases[from] = to
+	}
+}
+
+// WithAllowedRegistries will set the registries which the oci dependencies are allowed to come from.
+// Resolving an oci dependency from a registry whose host is not in 'hosts' will fail,
+// and the mirrors which are not in 'hosts' will be skipped.
+func WithAllowedRegistries(hosts []string) Option {
+	return func(opts *CompileOptions) {
+		opts.allowedRegistries = hosts
+	}
+}
+
+// WithRegistryMirrors will set the mirrors of the 'primary' registry.
+// If pulling a dependency from the 'primary' registry fails, the mirrors will be tried in order,
+// and the package from a mirror is accepted only if its checksum is the same as the locked one.
+// If the dependency is not locked in 'kcl.mod.lock', the package from a mirror is accepted only if
+// the digest of its manifest is the same as the one resolved from the 'primary' registry.
+func WithRegistryMirrors(primary string, mirrors []string) Option {
+	return func(opts *CompileOptions) {
+		if opts.registryMirrors == nil {
+			opts.registryMirrors = make(map[string][]string)
+		}
+		opts.registryMirrors[primary] = mirrors
+	}
+}
+
+// WithOutputSchema will validate each compiled document against the json schema in 'schemaPath',
+// and the compilation fails with the paths of the invalid values if any document is invalid.
+func WithOutputSchema(schemaPath string) Option {
+	return func(opts *CompileOptions) {
+		opts.outputSchema = schemaPath
+	}
+}
+
+// WithIncludeDependencyOutput will also compile the entries of the dependencies 'names',
+// and merge their documents with the documents of the root package.
+// The documents of the root package come first, then the documents of the dependencies in the order of 'names'.
+// It is an error if the same top-level key is defined by more than one document.
+func WithIncludeDependencyOutput(names []string) Option {
+	return func(opts *CompileOptions) {
+		opts.includeDependencyOutput = names
+	}
+}
+
+// WithFileAccessRoot will restrict the files read during the compilation to be in the directory 'dir',
+// the compilation fails if the entries or the imported modules escape 'dir' by '..' or symlinks.
+// Because the files read by the 'file' module at runtime can not be restricted by the kcl runtime,
+// the packages which import the 'file' module are rejected. The dependencies resolved by kpm are not restricted.
+func WithFileAccessRoot(dir string) Option {
+	return func(opts *CompileOptions) {
+		opts.fileAccessRoot = dir
+	}
+}
+
+// WithErrorFormatter will render the messages of the returned errors by the formatter 'f' from the structured diagnostics.
+// The built-in formatters are 'reporter.TextErrorFormatter', 'reporter.JsonErrorFormatter' and 'reporter.GitHubErrorFormatter'.
+// The returned errors still wrap the original errors, so 'reporter.GetErrorKind' can be used on them.
+func WithErrorFormatter(f reporter.ErrorFormatter) Option {
+	return func(opts *CompileOptions) {
+		opts.errorFormatter = f
+	}
+}
+
+// WithWarningsAsErrors will make the compilation fail on the warnings, e.g. the deprecated dependencies,
+// instead of only reporting them to the log writer.
+func WithWarningsAsErrors(warningsAsErrors bool) Option {
+	return func(opts *CompileOptions) {
+		opts.warningsAsErrors = warningsAsErrors
+	}
+}
+
+// WithDumpArgs will write the fully resolved top-level arguments into the json file in 'path' before compiling,
+// after merging the arguments from the defaults, the settings files, the profile in 'kcl.mod' and the '-D' arguments.
+func WithDumpArgs(path string) Option {
+	return func(opts *CompileOptions) {
+		opts.dumpArgs = path
+	}
+}
+
+// WithEnvFile will load the environment variables from the '.env' file in 'path' during the compilation,
+// the environment variables already set in the process will not be overridden unless 'WithEnvFileOverride' is set.
+func WithEnvFile(path string) Option {
+	return func(opts *CompileOptions) {
+		opts.envFile = path
+	}
+}
+
+// WithEnvFileOverride will set whether the environment variables from the '.env' file override the ones already set.
+func WithEnvFileOverride(override bool) Option {
+	return func(opts *CompileOptions) {
+		opts.envFileOverride = override
+	}
+}
+
+// WithSkipUnusedDeps will skip resolving the dependencies which are not imported by the entries,
+// so that compiling a subset of the entries does not download the dependencies only needed by the others.
+// The imports are found statically from the entries and the kcl files of the package they import,
+// and the dependencies of the imported dependencies are still resolved.
+func WithSkipUnusedDeps(skip bool) Option {
+	return func(opts *CompileOptions) {
+		opts.skipUnusedDeps = skip
+	}
+}
+
+// WithResultTransform will call 'transform' with each compiled document of the compile result,
+// e.g. to inject the standard labels into every kubernetes document.
+// The document can be changed, dropped by returning nil, or fail the compilation by returning an error,
+// and the documents returned are serialized into yaml and json again with the keys sorted.
+// The documents which are not objects are kept as they are.
+func WithResultTransform(transform ResultTransform) Option {
+	return func(opts *CompileOptions) {
+		opts.resultTransform = transform
+	}
+}
+
+// WithLogLevel will set the level of detail of the log written to the log writer,
+// e.g. 'reporter.DebugLevel' writes how each dependency is resolved, the cache hits and the checksums.
+// The default level is 'reporter.InfoLevel'.
+func WithLogLevel(level reporter.LogLevel) Option {
+	return func(opts *CompileOptions) {
+		opts.logLevel = level
+	}
+}
+
+// WithSplitOutput will write each compiled document into a separate file in the directory 'dir',
+// e.g. to keep one file per kubernetes resource in the GitOps repositories.
+// The file name is rendered from 'nameTemplate' whose fields like '{.metadata.name}' are replaced by the values in the document,
+// and '.yaml' is appended if the file name has no extension.
+// The default template is '{.metadata.name}'. The files are written by the run APIs returning '*kcl.KCLResultList' as well.
+func WithSplitOutput(dir string, nameTemplate string) Option {
+	return func(opts *CompileOptions) {
+		opts.splitOutputDir = dir
+		opts.splitOutputNameTemplate = nameTemplate
+	}
+}
+
+// WithIncremental will compile the entries incrementally with the cache in 'cacheDir'.
+// The hashes of the inputs of each entry, including the kcl files imported transitively and the dependencies,
+// are persisted with the outputs, and the entries whose inputs are unchanged since the last run return the cached outputs.
+// It is only applied by 'RunWithResult', the run APIs returning the '*kcl.KCLResultList' reject it.
+func WithIncremental(cacheDir string) Option {
+	return func(opts *CompileOptions) {
+		opts.incrementalCacheDir = cacheDir
+	}
+}
+
+// WithMaxRecursionDepth will bound the depth of the recursion in the compilation to 'n',
+// e.g. for the packages with deeply recursive schema references, where it is supported by the kcl compiler.
+// The compilation exceeding the depth fails with a descriptive error.
+// The default 0 keeps the behavior of the kcl compiler.
+func WithMaxRecursionDepth(n int) Option {
+	return func(opts *CompileOptions) {
+		opts.maxRecursionDepth = n
+	}
+}
+
+// WithProfile will write the profile of the compilation into 'path' after the compilation,
+// to find out the expensive entries of the slow packages.
+// The profile is in the trace event format, which can be viewed in 'chrome://tracing' or Perfetto,
+// with the spans of loading the package, resolving the dependencies and compiling the entries,
+// the profiles of the kcl runtime are not included until the kcl runtime supports them.
+func WithProfile(path string) Option {
+	return func(opts *CompileOptions) {
+		opts.profile = path
+	}
+}
+
+// WithCredentialProvider will resolve the credentials referenced by the dependencies in 'kcl.mod' by 'provider',
+// e.g. '{ version = "1.28", credential = "team-a" }', so that the dependencies from the same registry host can use different credentials.
+// The dependencies without the credential references use the credentials of the registry hosts.
+func WithCredentialProvider(provider CredentialProvider) Option {
+	return func(opts *CompileOptions) {
+		opts.credentialProvider = provider
+	}
+}
+
+// WithPreserveComments will carry the doc comments of the schemas into the yaml output, where it is supported by the kcl compiler.
+// The compilation fails if the kcl compiler does not support it, rather than dropping the comments silently.
+func WithPreserveComments(preserveComments bool) Option {
+	return func(opts *CompileOptions) {
+		opts.preserveComments = preserveComments
+	}
+}
+
+// WithFailFast will set whether to stop downloading the dependencies on the first failure, which is the default.
+// The dependencies are downloaded concurrently, and the other downloads are cancelled on the first failure.
+// If it is false, the other dependencies are still downloaded and the failures are reported together.
+func WithFailFast(failFast bool) Option {
+	return func(opts *CompileOptions) {
+		opts.failFast = failFast
+	}
+}
+
+// WithLocale will translate the error and log messages of kpm into the language 'tag' where the translations exist,
+// the catalogs of the languages are registered by 'reporter.RegisterCatalog'.
+// The messages of the kcl compiler are kept as they are.
+func WithLocale(tag language.Tag) Option {
+	return func(opts *CompileOptions) {
+		opts.locale = tag
+	}
+}
+
+// WithPreResolveHook will call the hook 'hook' with the dependencies declared in 'kcl.mod' after it is parsed
+// and before the dependencies are resolved. The 'kcl.mod' is not changed by the hook.
+func WithPreResolveHook(hook PreResolveHook) Option {
+	return func(opts *CompileOptions) {
+		opts.preResolveHook = hook
+	}
+}
+
+// WithAtomicLockWrite will set whether to write kcl.mod.lock and kcl.mod into temporary files and rename them,
+// so that they are never left partially written if kpm is killed, which is the default.
+func WithAtomicLockWrite(atomic bool) Option {
+	return func(opts *CompileOptions) {
+		opts.atomicLockWrite = atomic
+	}
+}
+
+// WithMaxDocuments will fail the compilation if more than 'n' documents are compiled, 0 means no limit.
+// The documents dropped by the result transform are not counted.
+func WithMaxDocuments(n int) Option {
+	return func(opts *CompileOptions) {
+		opts.maxDocuments = n
+	}
+}
+
+// WithLogDependencyOrigins will log whether each dependency is served from the cache, the vendor directory,
+// or freshly downloaded at the info level.
+func WithLogDependencyOrigins(logDependencyOrigins bool) Option {
+	return func(opts *CompileOptions) {
+		opts.logDependencyOrigins = logDependencyOrigins
+	}
+}
+
+// WithOutputEncoding will transcode the serialized output, e.g. the split output files, into the encoding 'enc'.
+// The compilation fails if the output has characters which can not be represented in 'enc'.
+func WithOutputEncoding(enc encoding.Encoding) Option {
+	return func(opts *CompileOptions) {
+		opts.outputEncoding = enc
+	}
+}
+
+// WithPullThroughCache will pull the oci dependencies from the pull-through cache 'host' instead of their registries.
+// 'host' can have a path, e.g. 'cache.example.com/ghcr', under which the repositories of the dependencies are served.
+// The dependencies are still verified by the checksums in 'kcl.mod.lock', which only depend on the content of the packages.
+func WithPullThroughCache(host string) Option {
+	return func(opts *CompileOptions) {
+		opts.pullThroughCache = host
+	}
+}
+
+// WithGitCloneDepth will clone only the latest 'n' commits of the git dependencies, 0 means the full history.
+// If the commit of a dependency is not in the shallow history, the history is deepened and the checkout is retried.
+func WithGitCloneDepth(n int) Option {
+	return func(opts *CompileOptions) {
+		opts.gitCloneDepth = n
+	}
+}
+
+// WithOutputValidator will call 'validator' with the serialized yaml output after the documents are transformed,
+// e.g. to run the policy checks of 'conftest' on the output, and the compilation fails if it returns an error.
+// The output is transcoded into the output encoding if it is set.
+func WithOutputValidator(validator OutputValidator) Option {
+	return func(opts *CompileOptions) {
+		opts.outputValidator = validator
+	}
+}
+
+// WithVersionOverride will compile the package as if its version in 'kcl.mod' were 'version', e.g. the git tag of the build,
+// without changing 'kcl.mod'. The version is also passed to the compiler as the top-level argument 'kcl_pkg_version',
+// so that the kcl code can embed it by 'option("kcl_pkg_version")'.
+func WithVersionOverride(version string) Option {
+	return func(opts *CompileOptions) {
+		opts.versionOverride = version
+	}
+}
+
+// WithStableDocumentOrder will sort the compiled documents by the value of the dot-separated field 'sortKey', e.g. 'metadata.name',
+// so that the order of the documents is the same across the runs. The numbers are compared by their values and the other values as strings.
+// The documents without the field are sorted last, and the documents with the same value are kept in the order they are compiled.
+// The documents streamed by 'RunPkgStream' are sorted within each entry.
+func WithStableDocumentOrder(sortKey string) Option {
+	return func(opts *CompileOptions) {
+		opts.stableDocumentOrder = sortKey
+	}
+}
+
+// WithNewChecksumHook will call the hook 'hook' for each dependency whose checksum is not in 'kcl.mod.lock' yet when it is written,
+// i.e. the dependencies newly added and the ones whose checksums are changed.
+func WithNewChecksumHook(hook NewChecksumHook) Option {
+	return func(opts *CompileOptions) {
+		opts.newChecksumHook = hook
+	}
+}
+
+// WithTargetPlatform will pull the variant for the platform 'platform' in the format 'os/arch[/variant]', e.g. 'linux/arm64',
+// if an oci dependency is a manifest list. The resolution fails if no variant in the manifest list matches the platform,
+// and the dependencies which are not manifest lists are pulled as they are.
+func WithTargetPlatform(platform string) Option {
+	return func(opts *CompileOptions) {
+		opts.targetPlatform = platform
+	}
+}
+
+// WithCaseSensitivePaths will set whether to check the entries and the modules of the package imported from them
+// match the case of the files and directories on the disk exactly, so that the package working on the case-insensitive
+// file systems, e.g. on macOS, does not fail on the case-sensitive ones.
+func WithCaseSensitivePaths(caseSensitive bool) Option {
+	return func(opts *CompileOptions) {
+		opts.caseSensitivePaths = caseSensitive
+	}
+}
+
+// WithImportResolver will consult the resolver 'resolver' for the imports which kpm can not resolve, i.e. the imports
+// which are not the system modules, the dependencies, the external packages or the modules of the package,
+// e.g. to substitute the stub packages for some imports in a sandbox or in the tests.
+// The resolver is called once for each top-level name imported, and the filesystem it returns is written into $KCL_PKG_PATH.
+func WithImportResolver(resolver ImportResolver) Option {
+	return func(opts *CompileOptions) {
+		opts.importResolver = resolver
+	}
+}
+
+// WithCaptureInput will set whether to keep the input values of the compilation in the compile result,
+// i.e. the top-level arguments and the overrides after the settings files, the profile and the options are merged.
+func WithCaptureInput(capture bool) Option {
+	return func(opts *CompileOptions) {
+		opts.captureInput = capture
+	}
+}
+
+// WithPluginPath will set the root directory of the kcl plugins used by the compilation, i.e. $KCL_PLUGINS_ROOT.
+// The plugins pinned in the plugins section of kcl.mod are verified against their checksums in the directory before compiling.
+func WithPluginPath(path string) Option {
+	return func(opts *CompileOptions) {
+		opts.pluginPath = path
+	}
+}
+
+// WithDiffBase will diff the compile result against the yaml documents in the file 'path', e.g. a committed baseline,
+// the documents are compared structurally by their indexes, and the changes are returned by 'Diff' of the compile result.
+func WithDiffBase(path string) Option {
+	return func(opts *CompileOptions) {
+		opts.diffBase = path
+	}
+}
+
+// WithFailOnDiff will set whether to fail the compilation if the compile result drifts from the diff base,
+// the run APIs returning '*kcl.KCLResultList' fail in the same way.
+func WithFailOnDiff(fail bool) Option {
+	return func(opts *CompileOptions) {
+		opts.failOnDiff = fail
+	}
+}
+
+// WithUserAgent will set the user-agent of the requests to the oci registries, e.g. to attribute the traffic in the registry logs.
+// The user-agent is 'kpm/<version>' by default.
+func WithUserAgent(userAgent string) Option {
+	return func(opts *CompileOptions) {
+		opts.userAgent = userAgent
+	}
+}
+
+// WithMmapThreshold will memory-map the files of at least 'bytes' bytes read by the compilation instead of reading them into memory,
+// e.g. for the packages embedding big datasets. The default 0 keeps the behavior of the kcl compiler.
+// The compilation fails if it is set, since the kcl compiler can not memory-map the files yet.
+func WithMmapThreshold(bytes int64) Option {
+	return func(opts *CompileOptions) {
+		opts.mmapThreshold = bytes
+	}
+}
+
+// WithOutputFormat will convert the compile result into the format 'format' after the compilation, e.g. 'CUE' or 'HCL',
+// the compilation fails if the result has the values which can not be represented in the format.
+// The converted result is returned by 'GetCueResult' or 'GetHclResult' of the compile result.
+// 'format' can also be the name of a serializer registered by 'WithSerializer', whose output is returned by 'SerializedResult'.
+func WithOutputFormat(format OutputFormat) Option {
+	return func(opts *CompileOptions) {
+		opts.outputFormat = format
+	}
+}
+
+// WithMutableRefTTL will fetch the cached dependencies of the mutable refs again after 'ttl', e.g. the git branches and the 'latest' oci tags,
+// while the dependencies of the immutable refs, e.g. the git tags and commits, are cached forever.
+// The default 0 caches all the dependencies forever.
+func WithMutableRefTTL(ttl time.Duration) Option {
+	return func(opts *CompileOptions) {
+		opts.mutableRefTTL = ttl
+	}
+}
+
+// WithContractCheck will set whether to validate the compile result against the json schema declared by 'contract' in the package section of kcl.mod,
+// which is the shape of the output the package promises, so that the refactors changing the shape accidentally are caught.
+// The packages declaring no contract are not validated.
+func WithContractCheck(check bool) Option {
+	return func(opts *CompileOptions) {
+		opts.contractCheck = check
+	}
+}
+
+// WithRandSeed will seed the random number generator of the kcl runtime with 'seed', so that the repeated compilations produce the same output,
+// where it is supported by the kcl compiler. The compilation fails if the kcl compiler can not be seeded.
+func WithRandSeed(seed int64) Option {
+	return func(opts *CompileOptions) {
+		opts.randSeed = &seed
+	}
+}
+
+// WithEntryWorkDir will set the working directory of the entry 'entry' to 'dir' during its compilation by 'RunEntries',
+// e.g. so that the relative file reads of each entry are from its own directory.
+// The entry is matched as it is passed to 'RunEntries', and the relative 'dir' is relative to the package path.
+// The entries without their own working directory are compiled in the working directory of the compile options.
+func WithEntryWorkDir(entry, dir string) Option {
+	return func(opts *CompileOptions) {
+		if opts.entryWorkDirs == nil {
+			opts.entryWorkDirs = make(map[string]string)
+		}
+		opts.entryWorkDirs[entry] = dir
+	}
+}
+
+// WithOutputTemplate will wrap the compiled documents into the single document rendered by the go template 'tmpl',
+// e.g. a Kustomization or a ConfigMap as the envelope of the output.
+// The compiled documents are injected at the placeholders '{{ .Output }}', the yaml stream of the documents,
+// and '{{ .Documents }}', the list of the documents, and the functions 'indent', 'toYaml' and 'toJson' are available in the template.
+// The template is validated before the compilation, and it must reference at least one of the placeholders.
+func WithOutputTemplate(tmpl string) Option {
+	return func(opts *CompileOptions) {
+		opts.outputTemplate = tmpl
+	}
+}
+
+// WithRedactPaths will replace the values of the fields in the JSONPaths 'paths' of each compiled document with '[REDACTED]'
+// in the compile result, e.g. '$.data.password' or 'spec.containers[*].env[0].value', so that the secrets are not leaked
+// into the logs or the cached artifacts. '*' matches all the fields of an object or all the items of a list,
+// and the paths missing in a document are skipped. The documents are redacted after they are validated and wrapped.
+func WithRedactPaths(paths []string) Option {
+	return func(opts *CompileOptions) {
+		opts.redactPaths = paths
+	}
+}
+
+// WithUnredactedSink will write the yaml output into 'w' before it is redacted by the paths set by 'WithRedactPaths',
+// e.g. a secure store, while the redacted one is returned.
+func WithUnredactedSink(w io.Writer) Option {
+	return func(opts *CompileOptions) {
+		opts.unredactedSink = w
+	}
+}
+
+// WithGlobalDefaults will merge the yaml or json defaults document in 'path', e.g. the org-wide conventions,
+// into each compiled document as the lowest-priority layer beneath the values of the package.
+// The objects are merged recursively, and the values of the package, including the lists, win over the defaults.
+// The kcl compiler takes no layer of values beneath the package, so the defaults are merged into the compiled documents,
+// and the schemas and the checks of the package are not applied to them.
+// The documents which are not objects are kept as they are.
+func WithGlobalDefaults(path string) Option {
+	return func(opts *CompileOptions) {
+		opts.globalDefaults = path
+	}
+}
+
+// WithEntryConcurrency will compile at most 'n' of the entries at the same time in 'RunEntries',
+// e.g. to speed up the packages with many independent entries. The entries are compiled one by one if 'n' is less than 2.
+// The dependencies are still resolved once, and the documents of the entries are finished one by one in their order,
+// so that the result transform and the output validator are not called concurrently.
+func WithEntryConcurrency(n int) Option {
+	return func(opts *CompileOptions) {
+		opts.entryConcurrency = n
+	}
+}
+
+// WithDiagnosticHandler will call the handler 'handler' with each diagnostic as it is reported,
+// e.g. to display the problems of a long compilation while it is still running.
+// The warnings are handled when they are reported during resolving and compiling,
+// and the diagnostics of the error are handled when the compilation fails, before the error is returned.
+// The returned error is not changed by the handler, it still has all the diagnostics of the failure.
+// The messages of the diagnostics are translated by the locale set by 'WithLocale'.
+func WithDiagnosticHandler(handler DiagnosticHandler) Option {
+	return func(opts *CompileOptions) {
+		opts.diagnosticHandler = handler
+	}
+}
+
+// WithDisabledBuiltins will fail the compilation if the kcl package uses one of the builtins 'names',
+// e.g. 'file.read' to compile the untrusted kcl packages in a multi-tenant playground.
+// The names are the builtin functions, e.g. 'print', or the functions of the system modules, e.g. 'file.read'.
+// The kcl compiler can not disable the builtins, so the uses are found statically from the entries
+// and the kcl files of the package imported by them before compiling, and the kcl files of the dependencies are not checked.
+func WithDisabledBuiltins(names []string) Option {
+	return func(opts *CompileOptions) {
+		opts.disabledBuiltins = names
+	}
+}
+
+// WithExposeDepPaths will set whether to pass the resolved path of each dependency to the compilation
+// as the top-level argument 'kcl_dep_path_<name>', where the name is the one the dependency is imported by, e.g. 'kcl_dep_path_k8s',
+// so that the kcl package can read the data files shipped in its dependencies by 'option("kcl_dep_path_k8s")'
+// without hardcoding the path of the cache or the vendor directory.
+func WithExposeDepPaths(expose bool) Option {
+	return func(opts *CompileOptions) {
+		opts.exposeDepPaths = expose
+	}
+}
+
+// WithProvenanceAnnotation will set the annotation 'key' of each kubernetes-style document, i.e. the object with 'apiVersion' and 'kind',
+// to the hash of the inputs which produce it, e.g. to trace a running object back to the exact state of its sources.
+// The hash is in the form of 'sha256:<hex>', which is computed from the kcl files and the kcl.mod of the package,
+// and the kcl.mod.lock resolved by the compilation.
+func WithProvenanceAnnotation(key string) Option {
+	return func(opts *CompileOptions) {
+		opts.provenanceAnnotation = key
+	}
+}
+
+// WithModuleProxy will fetch the versions, the packages and the checksums of the oci dependencies from the module proxy 'url',
+// e.g. 'https://proxy.example.com', instead of their registries, the mirrors and the pull-through cache.
+// The files of a dependency are served under '<url>/<registry>/<repository>/@v/' by the proxy:
+// 'list' is the versions separated by the newlines, '<version>.tar' is the package and '<version>.sum' is the checksum of the package.
+// The package is accepted only if it matches the checksum served by the proxy, which must be the same as the one in 'kcl.mod.lock'.
+// The git and the local dependencies are not fetched from the proxy.
+func WithModuleProxy(url string) Option {
+	return func(opts *CompileOptions) {
+		opts.moduleProxy = url
+	}
+}
+
+// WithSymlinkPolicy will apply the symlink policy 'policy' to the symlinks in the kcl packages,
+// when the packages and the dependencies are extracted from the tars, and when the files of the package are resolved to compile.
+// The default is 'FollowWithinRoot', which rejects the symlinks escaping the root of the package.
+func WithSymlinkPolicy(policy SymlinkPolicy) Option {
+	return func(opts *CompileOptions) {
+		opts.symlinkPolicy = policy
+	}
+}
+
+// WithSerializer will register the serializer 's' of the custom output format 'name', e.g. a proprietary format of an organization,
+// which is selected by 'WithOutputFormat(OutputFormat(name))'. The compilation fails if the serializer returns an error.
+// The built-in formats can not be replaced, so the serializers named by them are not used.
+func WithSerializer(name string, s Serializer) Option {
+	return func(opts *CompileOptions) {
+		if opts.serializers == nil {
+			opts.serializers = make(map[string]Serializer)
+		}
+		opts.serializers[name] = s
+	}
+}
+
+// WithOverrideFile will replace the dependencies declared in kcl.mod with the overrides in the file 'path' when they are resolved,
+// e.g. to substitute a fork or a pinned version of a dependency for all the builds of a CI.
+// The overrides are declared in the '[overrides]' section in the same way as the dependencies in kcl.mod, e.g. 'k8s = "1.29"',
+// and the relative paths of the local dependencies are relative to the directory of the file.
+// The dependencies not declared in kcl.mod are not added, and kcl.mod is not changed by the overrides.
+// The overridden dependencies are recorded in kcl.mod.lock with 'overridden_by' set to 'path'.
+func WithOverrideFile(path string) Option {
+	return func(opts *CompileOptions) {
+		opts.overrideFile = path
+	}
+}
+
 // DefaultCompileOptions returns a default CompileOptions.
 func DefaultCompileOptions() *CompileOptions {
 	return &CompileOptions{
-		writer: os.Stdout,
-		Option: kcl.NewOption(),
+		writer:          os.Stdout,
+		failFast:        true,
+		atomicLockWrite: true,
+		Option:          kcl.NewOption(),
 	}
 }
 
+// Clone will return a copy of the compile options, the kcl options are copied
+// so that merging kcl options into the copy does not change the original ones.
+func (opts *CompileOptions) Clone() *CompileOptions {
+	cloned := *opts
+	cloned.Option = kcl.NewOption()
+	cloned.Merge(*opts.Option)
+	return &cloned
+}
+
 // SetNoSumCheck will set the 'no_sum_check' flag.
 func (opts *CompileOptions) SetNoSumCheck(noSumCheck bool) {
 	opts.noSumCheck = noSumCheck
@@ -80,6 +935,317 @@ func (opts *CompileOptions) NoSumCheck() bool {
 	return opts.noSumCheck
 }
 
+// FailOnLockChange will return the 'failOnLockChange' flag.
+func (opts *CompileOptions) FailOnLockChange() bool {
+	return opts.failOnLockChange
+}
+
+// ImportAliases will return the import aliases.
+func (opts *CompileOptions) ImportAliases() map[string]string {
+	return opts.importAliases
+}
+
+// AllowedRegistries will return the registries which the oci dependencies are allowed to come from.
+func (opts *CompileOptions) AllowedRegistries() []string {
+	return opts.allowedRegistries
+}
+
+// RegistryMirrors will return the mirrors of the registries.
+func (opts *CompileOptions) RegistryMirrors() map[string][]string {
+	return opts.registryMirrors
+}
+
+// OutputSchema will return the path of the json schema to validate the compiled documents.
+func (opts *CompileOptions) OutputSchema() string {
+	return opts.outputSchema
+}
+
+// IncludeDependencyOutput will return the names of the dependencies whose outputs are merged with the root package.
+func (opts *CompileOptions) IncludeDependencyOutput() []string {
+	return opts.includeDependencyOutput
+}
+
+// FileAccessRoot will return the directory which the files read during the compilation must be in.
+func (opts *CompileOptions) FileAccessRoot() string {
+	return opts.fileAccessRoot
+}
+
+// SkipUnusedDeps will return whether to skip resolving the dependencies which are not imported by the entries.
+func (opts *CompileOptions) SkipUnusedDeps() bool {
+	return opts.skipUnusedDeps
+}
+
+// ResultTransform will return the hook to transform each compiled document.
+func (opts *CompileOptions) ResultTransform() ResultTransform {
+	return opts.resultTransform
+}
+
+// LogLevel will return the level of detail of the log written to the log writer.
+func (opts *CompileOptions) LogLevel() reporter.LogLevel {
+	return opts.logLevel
+}
+
+// SplitOutput will return the directory to write each compiled document into and the template of the file names.
+func (opts *CompileOptions) SplitOutput() (string, string) {
+	return opts.splitOutputDir, opts.splitOutputNameTemplate
+}
+
+// IncrementalCacheDir will return the directory to cache the entries for the incremental builds.
+func (opts *CompileOptions) IncrementalCacheDir() string {
+	return opts.incrementalCacheDir
+}
+
+// MaxRecursionDepth will return the maximum depth of the recursion in the compilation.
+func (opts *CompileOptions) MaxRecursionDepth() int {
+	return opts.maxRecursionDepth
+}
+
+// Profile will return the path to write the profile of the compilation.
+func (opts *CompileOptions) Profile() string {
+	return opts.profile
+}
+
+// CredentialProvider will return the provider to resolve the credentials referenced by the dependencies.
+func (opts *CompileOptions) CredentialProvider() CredentialProvider {
+	return opts.credentialProvider
+}
+
+// PreserveComments will return whether to carry the doc comments of the schemas into the yaml output.
+func (opts *CompileOptions) PreserveComments() bool {
+	return opts.preserveComments
+}
+
+// FailFast will return whether to stop downloading the dependencies on the first failure.
+func (opts *CompileOptions) FailFast() bool {
+	return opts.failFast
+}
+
+// Locale will return the language to translate the messages of kpm into.
+func (opts *CompileOptions) Locale() language.Tag {
+	return opts.locale
+}
+
+// PreResolveHook will return the hook to call before the dependencies are resolved.
+func (opts *CompileOptions) PreResolveHook() PreResolveHook {
+	return opts.preResolveHook
+}
+
+// AtomicLockWrite will return whether to replace kcl.mod.lock and kcl.mod atomically when they are written.
+func (opts *CompileOptions) AtomicLockWrite() bool {
+	return opts.atomicLockWrite
+}
+
+// MaxDocuments will return the maximum number of the compiled documents, 0 means no limit.
+func (opts *CompileOptions) MaxDocuments() int {
+	return opts.maxDocuments
+}
+
+// LogDependencyOrigins will return whether to log the origins of the resolved dependencies at the info level.
+func (opts *CompileOptions) LogDependencyOrigins() bool {
+	return opts.logDependencyOrigins
+}
+
+// OutputEncoding will return the encoding of the serialized output, nil means utf-8.
+func (opts *CompileOptions) OutputEncoding() encoding.Encoding {
+	return opts.outputEncoding
+}
+
+// PullThroughCache will return the pull-through cache which the oci dependencies are pulled from.
+func (opts *CompileOptions) PullThroughCache() string {
+	return opts.pullThroughCache
+}
+
+// GitCloneDepth will return the number of the commits cloned for the git dependencies, 0 means the full history.
+func (opts *CompileOptions) GitCloneDepth() int {
+	return opts.gitCloneDepth
+}
+
+// OutputValidator will return the hook to validate the serialized output.
+func (opts *CompileOptions) OutputValidator() OutputValidator {
+	return opts.outputValidator
+}
+
+// VersionOverride will return the version to compile the package as, empty means the version in kcl.mod.
+func (opts *CompileOptions) VersionOverride() string {
+	return opts.versionOverride
+}
+
+// StableDocumentOrder will return the dot-separated field to sort the compiled documents by, empty means no sorting.
+func (opts *CompileOptions) StableDocumentOrder() string {
+	return opts.stableDocumentOrder
+}
+
+// NewChecksumHook will return the hook to call with the checksums newly recorded in kcl.mod.lock.
+func (opts *CompileOptions) NewChecksumHook() NewChecksumHook {
+	return opts.newChecksumHook
+}
+
+// TargetPlatform will return the platform of the variant pulled if an oci dependency is a manifest list.
+func (opts *CompileOptions) TargetPlatform() string {
+	return opts.targetPlatform
+}
+
+// CaseSensitivePaths will return whether to check the entries and the imports match the case of the files exactly.
+func (opts *CompileOptions) CaseSensitivePaths() bool {
+	return opts.caseSensitivePaths
+}
+
+// ImportResolver will return the resolver consulted for the imports which kpm can not resolve.
+func (opts *CompileOptions) ImportResolver() ImportResolver {
+	return opts.importResolver
+}
+
+// CaptureInput will return whether to keep the input values of the compilation in the compile result.
+func (opts *CompileOptions) CaptureInput() bool {
+	return opts.captureInput
+}
+
+// PluginPath will return the root directory of the kcl plugins.
+func (opts *CompileOptions) PluginPath() string {
+	return opts.pluginPath
+}
+
+// DiffBase will return the path of the file which the compile result is diffed against.
+func (opts *CompileOptions) DiffBase() string {
+	return opts.diffBase
+}
+
+// FailOnDiff will return whether to fail the compilation if the compile result drifts from the diff base.
+func (opts *CompileOptions) FailOnDiff() bool {
+	return opts.failOnDiff
+}
+
+// UserAgent will return the user-agent of the requests to the oci registries, empty means the default one.
+func (opts *CompileOptions) UserAgent() string {
+	return opts.userAgent
+}
+
+// MmapThreshold will return the size in bytes from which the files read by the compilation are memory-mapped.
+func (opts *CompileOptions) MmapThreshold() int64 {
+	return opts.mmapThreshold
+}
+
+// OutputFormat will return the format which the compile result is converted into, it is 'YAML' by default.
+func (opts *CompileOptions) OutputFormat() OutputFormat {
+	if len(opts.outputFormat) == 0 {
+		return YAML
+	}
+	return opts.outputFormat
+}
+
+// MutableRefTTL will return the time after which the cached dependencies of the mutable refs are fetched again.
+func (opts *CompileOptions) MutableRefTTL() time.Duration {
+	return opts.mutableRefTTL
+}
+
+// ContractCheck will return whether to validate the compile result against the contract declared in kcl.mod.
+func (opts *CompileOptions) ContractCheck() bool {
+	return opts.contractCheck
+}
+
+// RandSeed will return the seed of the random number generator of the kcl runtime, and whether it is set.
+func (opts *CompileOptions) RandSeed() (int64, bool) {
+	if opts.randSeed == nil {
+		return 0, false
+	}
+	return *opts.randSeed, true
+}
+
+// EntryWorkDirs will return the working directories of the entries, the key is the entry.
+func (opts *CompileOptions) EntryWorkDirs() map[string]string {
+	return opts.entryWorkDirs
+}
+
+// OutputTemplate will return the go template to wrap the compiled documents.
+func (opts *CompileOptions) OutputTemplate() string {
+	return opts.outputTemplate
+}
+
+// RedactPaths will return the JSONPaths of the fields to redact in the compile result.
+func (opts *CompileOptions) RedactPaths() []string {
+	return opts.redactPaths
+}
+
+// UnredactedSink will return the writer to write the output into before it is redacted, nil means it is not written.
+func (opts *CompileOptions) UnredactedSink() io.Writer {
+	return opts.unredactedSink
+}
+
+// GlobalDefaults will return the path of the defaults document merged beneath the compiled documents.
+func (opts *CompileOptions) GlobalDefaults() string {
+	return opts.globalDefaults
+}
+
+// EntryConcurrency will return the maximum number of the entries compiled at the same time by 'RunEntries'.
+func (opts *CompileOptions) EntryConcurrency() int {
+	return opts.entryConcurrency
+}
+
+// DiagnosticHandler will return the handler to call with each diagnostic as it is reported.
+func (opts *CompileOptions) DiagnosticHandler() DiagnosticHandler {
+	return opts.diagnosticHandler
+}
+
+// DisabledBuiltins will return the names of the builtins which the compiled kcl files are not allowed to use.
+func (opts *CompileOptions) DisabledBuiltins() []string {
+	return opts.disabledBuiltins
+}
+
+// ExposeDepPaths will return whether the resolved paths of the dependencies are passed to the compilation.
+func (opts *CompileOptions) ExposeDepPaths() bool {
+	return opts.exposeDepPaths
+}
+
+// ProvenanceAnnotation will return the annotation key of the hash of the inputs injected into the documents.
+func (opts *CompileOptions) ProvenanceAnnotation() string {
+	return opts.provenanceAnnotation
+}
+
+// ModuleProxy will return the module proxy which the oci dependencies are fetched from.
+func (opts *CompileOptions) ModuleProxy() string {
+	return opts.moduleProxy
+}
+
+// SymlinkPolicy will return the policy of the symlinks in the kcl packages.
+func (opts *CompileOptions) SymlinkPolicy() SymlinkPolicy {
+	return opts.symlinkPolicy
+}
+
+// Serializer will return the custom serializer of the output format 'name', nil if it is not registered.
+func (opts *CompileOptions) Serializer(name string) Serializer {
+	return opts.serializers[name]
+}
+
+// OverrideFile will return the file of the overrides of the dependencies.
+func (opts *CompileOptions) OverrideFile() string {
+	return opts.overrideFile
+}
+
+// ErrorFormatter will return the formatter to render the error messages.
+func (opts *CompileOptions) ErrorFormatter() reporter.ErrorFormatter {
+	return opts.errorFormatter
+}
+
+// WarningsAsErrors will return whether to fail on the warnings.
+func (opts *CompileOptions) WarningsAsErrors() bool {
+	return opts.warningsAsErrors
+}
+
+// DumpArgs will return the path of the file to dump the resolved top-level arguments into.
+func (opts *CompileOptions) DumpArgs() string {
+	return opts.dumpArgs
+}
+
+// EnvFile will return the path of the '.env' file.
+func (opts *CompileOptions) EnvFile() string {
+	return opts.envFile
+}
+
+// EnvFileOverride will return whether the environment variables from the '.env' file override the ones already set.
+func (opts *CompileOptions) EnvFileOverride() bool {
+	return opts.envFileOverride
+}
+
 // AddEntry will add a compile entry file to the compiler.
 func (opts *CompileOptions) AddEntry(entry string) {
 	opts.entries = append(opts.entries, entry)
@@ -125,6 +1291,17 @@ func (opts *CompileOptions) IsVendor() bool {
 	return opts.isVendor
 }
 
+// VendorMode will return the mode of vendoring the dependencies.
+func (opts *CompileOptions) VendorMode() VendorMode {
+	if !opts.isVendor {
+		return NoVendor
+	}
+	if opts.vendorMode == NoVendor {
+		return FullVendor
+	}
+	return opts.vendorMode
+}
+
 // PkgPath will return the home path for a kcl package during compilation
 func (opts *CompileOptions) PkgPath() string {
 	return opts.WorkDir
@@ -140,6 +1317,11 @@ func (opts *CompileOptions) LogWriter() io.Writer {
 	return opts.writer
 }
 
+// DocumentSeparatorComment will return the 'documentSeparatorComment' flag.
+func (opts *CompileOptions) DocumentSeparatorComment() bool {
+	return opts.documentSeparatorComment
+}
+
 // Input options of 'kpm init'.
 type InitOptions struct {
 	Name     string
@@ -155,6 +1337,23 @@ func (opts *InitOptions) Validate() error {
 	return nil
 }
 
+// PackageOptions is the input options of the api to package a kcl package.
+type PackageOptions struct {
+	// Whether to vendor the dependencies into the package before packaging.
+	Vendor bool
+	// Whether to bundle the local path dependencies into the 'local_deps' directory of the tar,
+	// so that the tar is self-contained and can be compiled by 'RunTar' without the local dependencies.
+	IncludeLocalDeps bool
+}
+
+// UpdateOptions is the input options of the api to update the dependencies of a kcl package.
+type UpdateOptions struct {
+	// Only the dependencies in 'Only' will be updated, all the dependencies will be updated if it is empty.
+	Only []string
+	// Whether to update the dependencies to the new major versions.
+	AllowMajor bool
+}
+
 type AddOptions struct {
 	LocalPath    string
 	RegistryOpts RegistryOptions
@@ -3,10 +3,14 @@
 package opt
 
 import (
+	"encoding/json"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/language"
 	"kcl-lang.io/kcl-go/pkg/kcl"
+	"kcl-lang.io/kpm/pkg/reporter"
 )
 
 func TestWorkDirAsPkgPath(t *testing.T) {
@@ -20,3 +24,33 @@ func TestWorkDirAsPkgPath(t *testing.T) {
 	opts.SetEntries([]string{"override.k"})
 	assert.Equal(t, opts.Entries(), []string{"override.k"})
 }
+
+func TestEffective(t *testing.T) {
+	pkgPath := t.TempDir()
+	opts := DefaultCompileOptions()
+	for _, o := range []Option{
+		WithEntries([]string{"main.k"}),
+		WithFailFast(false),
+		WithLogLevel(reporter.DebugLevel),
+		WithLocale(language.German),
+		WithKclOption(kcl.WithKFilenames("main.k", filepath.Join(pkgPath, "sub.k"))),
+		WithKclOption(kcl.WithOptions("env=dev", "replicas=1", "env=prod")),
+		WithKclOption(kcl.WithWorkDir(pkgPath)),
+	} {
+		o(opts)
+	}
+
+	config := opts.Effective()
+	assert.Equal(t, config.PkgPath, pkgPath)
+	assert.Equal(t, config.Entries, []string{filepath.Join(pkgPath, "main.k")})
+	assert.Equal(t, config.KFilenames, []string{filepath.Join(pkgPath, "main.k"), filepath.Join(pkgPath, "sub.k")})
+	assert.Equal(t, config.Args, map[string]string{"env": "prod", "replicas": "1"})
+	assert.Equal(t, config.FailFast, false)
+	assert.Equal(t, config.LogLevel, "debug")
+	assert.Equal(t, config.Locale, "de")
+	assert.Equal(t, config.VendorMode, "none")
+
+	content, err := json.Marshal(config)
+	assert.Nil(t, err)
+	assert.Contains(t, string(content), `"pkg_path":`)
+}
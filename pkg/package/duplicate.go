@@ -0,0 +1,128 @@
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DependencyDeclaration is a declaration of a dependency in 'kcl.mod'.
+type DependencyDeclaration struct {
+	// Name is the name of the dependency as declared.
+	Name string
+	// Line is the line of the declaration in 'kcl.mod', starting from 1.
+	Line int
+	// Source is the source of the dependency as declared, e.g. '"1.27"' or '{ git = "https://github.com/kcl-lang/konfig", tag = "v0.4.0" }'.
+	Source string
+}
+
+// String returns the declaration as it is written in 'kcl.mod'.
+func (d DependencyDeclaration) String() string {
+	return fmt.Sprintf("line %d: %s = %s", d.Line, d.Name, d.Source)
+}
+
+// DuplicateDependencyError is the error of a dependency declared more than once in 'kcl.mod'.
+// The names which are the same after replacing '-' with '_' are also duplicated,
+// because they are imported by the same name.
+type DuplicateDependencyError struct {
+	// Path is the path of 'kcl.mod'.
+	Path string
+	// Name is the name of the duplicated dependency.
+	Name string
+	// Declarations is the conflicting declarations of the dependency.
+	Declarations []DependencyDeclaration
+}
+
+// Error returns the message with the conflicting declarations.
+func (e *DuplicateDependencyError) Error() string {
+	declarations := make([]string, 0, len(e.Declarations))
+	for _, d := range e.Declarations {
+		declarations = append(declarations, d.String())
+	}
+	return fmt.Sprintf("dependency '%s' is declared more than once in '%s':\n%s", e.Name, e.Path, strings.Join(declarations, "\n"))
+}
+
+// checkDuplicateDependencies will return a 'DuplicateDependencyError' if a dependency is declared more than once
+// in the content 'data' of the 'kcl.mod' in 'path'.
+// The dependencies are declared by the keys in the '[dependencies]' table or by the '[dependencies.<name>]' tables.
+func checkDuplicateDependencies(path string, data []byte) error {
+	var declarations []DependencyDeclaration
+	table := ""
+	// The declaration by the '[dependencies.<name>]' table whose source is being collected.
+	var tableDecl *DependencyDeclaration
+	var tableFields []string
+	flushTable := func() {
+		if tableDecl != nil {
+			tableDecl.Source = "{ " + strings.Join(tableFields, ", ") + " }"
+			declarations = append(declarations, *tableDecl)
+		}
+		tableDecl = nil
+		tableFields = nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) == 0 || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(text, "[") {
+			flushTable()
+			table = strings.TrimSpace(strings.Trim(text, "[]"))
+			if strings.HasPrefix(table, DEPS_FLAG+".") {
+				tableDecl = &DependencyDeclaration{Name: unquoteKey(strings.TrimPrefix(table, DEPS_FLAG+".")), Line: line}
+			}
+			continue
+		}
+
+		key, value, ok := strings.Cut(text, "=")
+		if !ok {
+			continue
+		}
+		if tableDecl != nil {
+			tableFields = append(tableFields, fmt.Sprintf("%s = %s", strings.TrimSpace(key), strings.TrimSpace(value)))
+			continue
+		}
+		if table == DEPS_FLAG {
+			declarations = append(declarations, DependencyDeclaration{
+				Name:   unquoteKey(strings.TrimSpace(key)),
+				Line:   line,
+				Source: strings.TrimSpace(value),
+			})
+		}
+	}
+	flushTable()
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	byName := make(map[string][]DependencyDeclaration)
+	for _, d := range declarations {
+		name := strings.ReplaceAll(d.Name, "-", "_")
+		byName[name] = append(byName[name], d)
+	}
+	names := make([]string, 0, len(byName))
+	for name, decls := range byName {
+		if len(decls) > 1 {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+
+	decls := byName[names[0]]
+	return &DuplicateDependencyError{Path: path, Name: decls[0].Name, Declarations: decls}
+}
+
+// unquoteKey returns the toml key without the quotes, e.g. '"k8s"' is 'k8s'.
+func unquoteKey(key string) string {
+	if len(key) >= 2 && (key[0] == '"' || key[0] == '\'') && key[len(key)-1] == key[0] {
+		return key[1 : len(key)-1]
+	}
+	return key
+}
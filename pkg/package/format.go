@@ -0,0 +1,277 @@
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"kcl-lang.io/kpm/pkg/reporter"
+	"kcl-lang.io/kpm/pkg/utils"
+)
+
+// modEntry is a key-value pair of a table in 'kcl.mod' with the comments above it.
+type modEntry struct {
+	comments []string
+	// key is empty for the comments at the end of the table.
+	key string
+	// lines is the lines of the key-value pair, the arrays can be written in multiple lines.
+	lines []string
+}
+
+// modTable is a table in 'kcl.mod' with the comments above its header.
+type modTable struct {
+	comments []string
+	// name is empty for the root table without header.
+	name    string
+	header  string
+	entries []modEntry
+}
+
+// FormatModFile will rewrite the 'kcl.mod' in 'path' in the canonical style without changing its semantics.
+// 'path' can be the path of 'kcl.mod' or the directory of the kcl package.
+// The tables are ordered as '[package]', '[dependencies]', '[dependencies.<name>]' and '[profile]',
+// the dependencies are sorted by names, and the comments are kept with the lines below them.
+// Formatting a formatted 'kcl.mod' changes nothing.
+func FormatModFile(path string) error {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = filepath.Join(path, MOD_FILE)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return reporter.NewErrorEvent(reporter.FailedLoadKclMod, err, fmt.Sprintf("failed to load '%s'", path))
+	}
+	formatted, err := FormatModFileContent(content)
+	if err != nil {
+		return reporter.NewErrorEvent(reporter.FailedLoadKclMod, err, fmt.Sprintf("failed to format '%s'", path))
+	}
+	if bytes.Equal(content, formatted) {
+		return nil
+	}
+
+	err = utils.StoreToFileAtomically(path, string(formatted))
+	if err != nil {
+		return reporter.NewErrorEvent(reporter.FailedCreateFile, err, fmt.Sprintf("failed to write '%s'", path))
+	}
+	return nil
+}
+
+// FormatModFileContent returns the content of 'kcl.mod' in the canonical style.
+// An error is returned if the content is not valid toml, or the formatted content would have different semantics.
+func FormatModFileContent(content []byte) ([]byte, error) {
+	var original map[string]interface{}
+	if err := toml.Unmarshal(content, &original); err != nil {
+		return nil, err
+	}
+
+	tables, err := parseModTables(content)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(tables, func(i, j int) bool {
+		ri, rj := tableRank(tables[i].name), tableRank(tables[j].name)
+		if ri != rj {
+			return ri < rj
+		}
+		// The '[dependencies.<name>]' tables are sorted by the names.
+		return ri == tableRank(DEPS_FLAG+".") && tables[i].name < tables[j].name
+	})
+
+	var sb strings.Builder
+	for _, table := range tables {
+		if table.name == DEPS_FLAG {
+			sortModEntries(table.entries)
+		}
+		if len(table.header) == 0 && len(table.entries) == 0 && len(table.comments) == 0 {
+			continue
+		}
+		if sb.Len() != 0 {
+			sb.WriteString(NEWLINE)
+		}
+		for _, comment := range table.comments {
+			sb.WriteString(comment + NEWLINE)
+		}
+		if len(table.header) != 0 {
+			sb.WriteString(table.header + NEWLINE)
+		}
+		for _, entry := range table.entries {
+			for _, comment := range entry.comments {
+				sb.WriteString(comment + NEWLINE)
+			}
+			for _, line := range entry.lines {
+				sb.WriteString(line + NEWLINE)
+			}
+		}
+	}
+	formatted := []byte(sb.String())
+
+	var result map[string]interface{}
+	if err := toml.Unmarshal(formatted, &result); err != nil || !reflect.DeepEqual(original, result) {
+		return nil, fmt.Errorf("the formatted 'kcl.mod' has different semantics from the original one")
+	}
+	return formatted, nil
+}
+
+// tableRank returns the rank of the table 'name' in the canonical order.
+func tableRank(name string) int {
+	switch {
+	case len(name) == 0:
+		return 0
+	case name == PACKAGE_FLAG:
+		return 1
+	case name == DEPS_FLAG:
+		return 2
+	case strings.HasPrefix(name, DEPS_FLAG+"."):
+		return 3
+	case name == PROFILES_FLAG:
+		return 4
+	default:
+		return 5
+	}
+}
+
+// sortModEntries sorts the key-value pairs by the keys, the comments at the end of the table are kept at the end.
+func sortModEntries(entries []modEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if len(entries[i].key) == 0 || len(entries[j].key) == 0 {
+			return len(entries[j].key) == 0 && len(entries[i].key) != 0
+		}
+		return unquoteKey(entries[i].key) < unquoteKey(entries[j].key)
+	})
+}
+
+// parseModTables splits the content of 'kcl.mod' into the tables.
+func parseModTables(content []byte) ([]modTable, error) {
+	tables := []modTable{{}}
+	var comments []string
+	var entry *modEntry
+	// depth is the depth of the brackets of the multi-line array being parsed.
+	depth := 0
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		text := strings.TrimSpace(scanner.Text())
+		if strings.Contains(text, `"""`) || strings.Contains(text, `'''`) {
+			return nil, fmt.Errorf("the multi-line strings are not supported")
+		}
+		code, comment := splitTomlComment(text)
+
+		if entry != nil {
+			// The lines of the multi-line array are indented by 4 spaces except the closing bracket.
+			line := joinTomlComment(code, comment)
+			if len(code) != 0 && code[0] != ']' && code[0] != '}' {
+				line = "    " + line
+			}
+			entry.lines = append(entry.lines, line)
+			depth += bracketDepth(code)
+			if depth <= 0 {
+				entry = nil
+			}
+			continue
+		}
+
+		table := &tables[len(tables)-1]
+		switch {
+		case len(text) == 0:
+			continue
+		case len(code) == 0:
+			comments = append(comments, comment)
+		case strings.HasPrefix(code, "["):
+			array := strings.HasPrefix(code, "[[")
+			name := strings.TrimSpace(strings.Trim(code, "[]"))
+			header := "[" + name + "]"
+			if array {
+				header = "[" + header + "]"
+			}
+			tables = append(tables, modTable{comments: comments, name: name, header: joinTomlComment(header, comment)})
+			comments = nil
+		default:
+			key, value, ok := strings.Cut(code, "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid line '%s'", text)
+			}
+			key = strings.TrimSpace(key)
+			table.entries = append(table.entries, modEntry{
+				comments: comments,
+				key:      key,
+				lines:    []string{joinTomlComment(fmt.Sprintf("%s = %s", key, strings.TrimSpace(value)), comment)},
+			})
+			comments = nil
+			if depth = bracketDepth(value); depth > 0 {
+				entry = &table.entries[len(table.entries)-1]
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(comments) != 0 {
+		table := &tables[len(tables)-1]
+		table.entries = append(table.entries, modEntry{comments: comments})
+	}
+	return tables, nil
+}
+
+// splitTomlComment splits the toml line into the code and the comment starting with '#' outside the strings.
+func splitTomlComment(line string) (string, string) {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return strings.TrimSpace(line[:i]), line[i:]
+		}
+	}
+	return strings.TrimSpace(line), ""
+}
+
+// joinTomlComment joins the code and the comment into a line.
+func joinTomlComment(code, comment string) string {
+	if len(comment) == 0 {
+		return code
+	}
+	if len(code) == 0 {
+		return comment
+	}
+	return code + " " + comment
+}
+
+// bracketDepth returns the number of the opening brackets minus the closing brackets outside the strings in the toml code.
+func bracketDepth(code string) int {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(code); i++ {
+		c := code[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		}
+	}
+	return depth
+}
@@ -19,6 +19,11 @@ import (
 const (
 	MOD_FILE      = "kcl.mod"
 	MOD_LOCK_FILE = "kcl.mod.lock"
+	// The version of the schema of kcl.mod.lock written by kpm,
+	// the kcl.mod.lock without 'version' is in the legacy schema, i.e. version 0.
+	LOCK_FILE_VERSION = 1
+	// The entry file compiled if the 'entry' in kcl.mod does not exist.
+	FALLBACK_ENTRY_FILE = "main.k"
 )
 
 // 'Package' is the kcl package section of 'kcl.mod'.
@@ -27,6 +32,11 @@ type Package struct {
 	Edition     string `toml:"edition,omitempty"`     // kcl compiler version
 	Version     string `toml:"version,omitempty"`     // kcl package version
 	Description string `toml:"description,omitempty"` // kcl package description
+	Deprecated  string `toml:"deprecated,omitempty"`  // the deprecation message if the kcl package is deprecated
+	ReplacedBy  string `toml:"replaced_by,omitempty"` // the kcl package suggested to replace the deprecated one
+	Entry       string `toml:"entry,omitempty"`       // the entry file compiled if no entries are provided, 'main.k' is the fallback
+	License     string `toml:"license,omitempty"`     // the SPDX license expression of the kcl package, e.g. 'Apache-2.0'
+	Contract    string `toml:"contract,omitempty"`    // the json schema which the output of the kcl package promises to satisfy
 }
 
 // 'ModFile' is kcl package file 'kcl.mod'.
@@ -38,7 +48,26 @@ type ModFile struct {
 	// in the current package directory.
 	VendorMode bool     `toml:"-"`
 	Profiles   *Profile `toml:"profile"`
+	// The kcl plugins pinned in kcl.mod, the key is the name of the plugin.
+	Plugins map[string]Plugin `toml:"plugins,omitempty"`
+	// Whether kcl.mod is written in place rather than replaced atomically.
+	NonAtomicWrite bool `toml:"-"`
 	Dependencies
+	// The dependencies declared in kcl.mod, which are stored instead of the overridden dependencies.
+	declaredDeps *Dependencies
+	// The package section declared in kcl.mod, which is stored instead of the overridden one.
+	declaredPkg *Package
+}
+
+// Plugin is a kcl plugin pinned in the plugins section of 'kcl.mod', e.g.
+//
+// [plugins]
+// hello = { version = "0.0.1", sum = "yNADGqn3jclWtfpwvWMHBsgkAKzOaMWg/VYxfcOJs64=" }
+//
+// The sum is the checksum of the plugin directory, which is computed in the same way as the checksum of a dependency.
+type Plugin struct {
+	Version string `toml:"version,omitempty"`
+	Sum     string `toml:"sum,omitempty"`
 }
 
 // Profile is the profile section of 'kcl.mod'.
@@ -156,6 +185,8 @@ type Dependency struct {
 	FullName string `json:"-" toml:"full_name,omitempty"`
 	Version  string `json:"-" toml:"version,omitempty"`
 	Sum      string `json:"-" toml:"sum,omitempty"`
+	// The override file which the dependency is replaced by, empty if it is declared in kcl.mod.
+	OverriddenBy string `json:"-" toml:"overridden_by,omitempty"`
 	// The actual local path of the package.
 	// In vendor mode is "current_kcl_package/vendor"
 	// In non-vendor mode is "$KCL_PKG_PATH"
@@ -178,7 +209,8 @@ func (d Dependency) WithTheSameVersion(other Dependency) bool {
 		sameGitSrc = d.Source.Git.Url == other.Source.Git.Url &&
 			(d.Source.Git.Branch == other.Source.Git.Branch ||
 				d.Source.Git.Commit == other.Source.Git.Commit ||
-				d.Source.Git.Tag == other.Source.Git.Tag)
+				d.Source.Git.Tag == other.Source.Git.Tag) &&
+			d.Source.Git.Subdir == other.Source.Git.Subdir
 	}
 
 	return sameNameAndVersion && sameGitSrc
@@ -199,6 +231,24 @@ func (dep *Dependency) IsFromLocal() bool {
 	return dep.Source.Oci == nil && dep.Source.Git == nil && dep.Source.Local != nil
 }
 
+// IsMutableRef will check whether the dependency references a mutable revision, whose content may change over time,
+// i.e. a git branch or the default branch of a git repository, or the 'latest' tag of an oci repository.
+// The git tags, the git commits and the other oci tags are taken as immutable.
+func (dep *Dependency) IsMutableRef() bool {
+	if dep.Source.Git != nil {
+		return len(dep.Source.Git.Commit) == 0 && len(dep.Source.Git.Tag) == 0
+	}
+	if dep.Source.Oci != nil {
+		return dep.Source.Oci.Tag == "latest"
+	}
+	return false
+}
+
+// IsFromLocalRegistry will check whether the dependency is from a local directory registry.
+func (dep *Dependency) IsFromLocalRegistry() bool {
+	return dep.Source.LocalRegistry != nil
+}
+
 // FillDepInfo will fill registry information for a dependency.
 func (dep *Dependency) FillDepInfo() error {
 	if dep.Source.Oci != nil {
@@ -206,7 +256,10 @@ func (dep *Dependency) FillDepInfo() error {
 		if settings.ErrorEvent != nil {
 			return settings.ErrorEvent
 		}
-		dep.Source.Oci.Reg = settings.DefaultOciRegistry()
+		// The registry declared in kcl.mod is kept.
+		if len(dep.Source.Oci.Reg) == 0 {
+			dep.Source.Oci.Reg = settings.DefaultOciRegistry()
+		}
 		urlpath := utils.JoinPath(settings.DefaultOciRepo(), dep.Name)
 		dep.Source.Oci.Repo = urlpath
 	}
@@ -225,16 +278,41 @@ type Source struct {
 	*Git
 	*Oci
 	*Local
+	*LocalRegistry
 }
 
 type Local struct {
 	Path string `toml:"path,omitempty"`
 }
 
+// LocalRegistry is the package source from a local directory registry,
+// in which the package tarballs are stored as '<registry>/<name>/<version>.tar'.
+type LocalRegistry struct {
+	// Path is the path of the registry directory, it can also be a 'file://' url.
+	Path    string `toml:"registry,omitempty"`
+	Version string `toml:"registry_version,omitempty"`
+}
+
+// GetRootPath returns the path of the registry directory without the 'file://' prefix.
+func (registry *LocalRegistry) GetRootPath() string {
+	return strings.TrimPrefix(registry.Path, LOCAL_REGISTRY_URL_PREFIX)
+}
+
+// GetTarPath returns the path of the tarball of the package 'name' in the local directory registry.
+func (registry *LocalRegistry) GetTarPath(name string) string {
+	return filepath.Join(registry.GetRootPath(), name, fmt.Sprintf("%s.tar", registry.Version))
+}
+
 type Oci struct {
 	Reg  string `toml:"reg,omitempty"`
 	Repo string `toml:"repo,omitempty"`
 	Tag  string `toml:"oci_tag,omitempty"`
+	// Credential is the reference of the credential to pull the dependency, which is resolved by the credential provider at runtime.
+	// The credential of the registry host is used if it is empty.
+	Credential string `toml:"credential,omitempty"`
+	// DeclaredReg is the registry written into kcl.mod, it is empty for the dependency from the default registry.
+	// It is kept as declared, while 'Reg' is filled with the default registry to pull the dependency.
+	DeclaredReg string `toml:"-"`
 }
 
 // Git is the package source from git registry.
@@ -243,6 +321,24 @@ type Git struct {
 	Branch string `toml:"branch,omitempty"`
 	Commit string `toml:"commit,omitempty"`
 	Tag    string `toml:"git_tag,omitempty"`
+	// Subdir is the path of the kcl package in the git repository, the root of the repository is used if it is empty.
+	Subdir string `toml:"git_subdir,omitempty"`
+}
+
+// GetValidSubdir will return the cleaned 'subdir' of the git source,
+// the 'subdir' must be a relative path in the git repository.
+func (git *Git) GetValidSubdir() (string, error) {
+	if len(git.Subdir) == 0 {
+		return "", nil
+	}
+	subdir := filepath.Clean(git.Subdir)
+	if filepath.IsAbs(subdir) || subdir == ".." || strings.HasPrefix(subdir, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("the subdir '%s' must be a relative path in the git repository", git.Subdir)
+	}
+	if subdir == "." {
+		return "", nil
+	}
+	return subdir, nil
 }
 
 // GetValidGitReference will get the valid git reference from git source.
@@ -301,7 +397,34 @@ func LoadLockDeps(homePath string) (*Dependencies, error) {
 // Write the contents of 'ModFile' to 'kcl.mod' file
 func (mfile *ModFile) StoreModFile() error {
 	fullPath := filepath.Join(mfile.HomePath, MOD_FILE)
-	return utils.StoreToFile(fullPath, mfile.MarshalTOML())
+	declared := *mfile
+	if mfile.declaredDeps != nil {
+		declared.Dependencies = *mfile.declaredDeps
+	}
+	if mfile.declaredPkg != nil {
+		declared.Pkg = *mfile.declaredPkg
+	}
+	return storeFile(fullPath, declared.MarshalTOML(), mfile.NonAtomicWrite)
+}
+
+// OverrideDependencies will replace the dependencies to resolve with 'deps',
+// the dependencies declared in kcl.mod are kept when the kcl.mod is stored.
+func (mfile *ModFile) OverrideDependencies(deps Dependencies) {
+	if mfile.declaredDeps == nil {
+		declared := mfile.Dependencies
+		mfile.declaredDeps = &declared
+	}
+	mfile.Dependencies = deps
+}
+
+// OverrideVersion will replace the version of the package with 'version',
+// the version declared in kcl.mod is kept when the kcl.mod is stored.
+func (mfile *ModFile) OverrideVersion(version string) {
+	if mfile.declaredPkg == nil {
+		declared := mfile.Pkg
+		mfile.declaredPkg = &declared
+	}
+	mfile.Pkg.Version = version
 }
 
 // Returns the path to the kcl.mod file
@@ -339,6 +462,11 @@ func (mod *ModFile) LoadModFile(filepath string) error {
 		return err
 	}
 
+	err = checkDuplicateDependencies(filepath, modData)
+	if err != nil {
+		return err
+	}
+
 	err = toml.Unmarshal(modData, &mod)
 
 	if err != nil {
@@ -369,6 +497,37 @@ func LoadModFile(homePath string) (*ModFile, error) {
 	return modFile, nil
 }
 
+// LoadOverrideFile will load the dependencies in the '[overrides]' section of the override file in 'path',
+// which are declared in the same way as the dependencies in kcl.mod, e.g. 'k8s = "1.29"'.
+// The relative paths of the local dependencies are taken as relative to the directory of the override file.
+func LoadOverrideFile(path string) (*Dependencies, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var meta map[string]interface{}
+	if err := toml.Unmarshal(data, &meta); err != nil {
+		return nil, err
+	}
+
+	deps := &Dependencies{Deps: make(map[string]Dependency)}
+	if v, ok := meta[OVERRIDES_FLAG]; ok {
+		if err := deps.UnmarshalModTOML(v); err != nil {
+			return nil, err
+		}
+	}
+	for name, d := range deps.Deps {
+		if d.Local != nil && !filepath.IsAbs(d.Local.Path) {
+			d.Local.Path = filepath.Join(filepath.Dir(path), d.Local.Path)
+		}
+		if err := d.FillDepInfo(); err != nil {
+			return nil, err
+		}
+		deps.Deps[name] = d
+	}
+	return deps, nil
+}
+
 // Load the kcl.mod.lock file.
 func (deps *Dependencies) loadLockFile(filepath string) error {
 	data, err := os.ReadFile(filepath)
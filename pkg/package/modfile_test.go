@@ -1,6 +1,8 @@
 package pkg
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
@@ -220,6 +222,27 @@ func TestStoreModFile(t *testing.T) {
 	assert.Equal(t, utils.RmNewline(string(got)), utils.RmNewline(string(expect)))
 }
 
+func TestStoreModFileWithVersionOverride(t *testing.T) {
+	testPath := t.TempDir()
+	mfile := ModFile{
+		HomePath: testPath,
+		Pkg: Package{
+			Name:    "test_name",
+			Edition: "0.0.1",
+			Version: "0.0.1",
+		},
+	}
+
+	mfile.OverrideVersion("1.2.3")
+	mfile.OverrideVersion("1.2.4")
+	assert.Equal(t, mfile.Pkg.Version, "1.2.4")
+	assert.Equal(t, mfile.StoreModFile(), nil)
+
+	stored, err := LoadModFile(testPath)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, stored.Pkg.Version, "0.0.1")
+}
+
 func TestGetFilePath(t *testing.T) {
 	testPath := getTestDir("store_mod_file")
 	mfile := ModFile{
@@ -228,3 +251,71 @@ func TestGetFilePath(t *testing.T) {
 	assert.Equal(t, mfile.GetModFilePath(), filepath.Join(testPath, MOD_FILE))
 	assert.Equal(t, mfile.GetModLockFilePath(), filepath.Join(testPath, MOD_LOCK_FILE))
 }
+
+func TestGetValidSubdir(t *testing.T) {
+	testCases := []struct {
+		subdir   string
+		expected string
+		isErr    bool
+	}{
+		{subdir: "", expected: ""},
+		{subdir: ".", expected: ""},
+		{subdir: "pkgs/helloworld/", expected: filepath.Join("pkgs", "helloworld")},
+		{subdir: "pkgs/../helloworld", expected: "helloworld"},
+		{subdir: "../helloworld", isErr: true},
+		{subdir: "/helloworld", isErr: true},
+	}
+
+	for _, tc := range testCases {
+		git := Git{Url: "https://github.com/kcl-lang/flask-demo-kcl-manifests.git", Subdir: tc.subdir}
+		subdir, err := git.GetValidSubdir()
+		assert.Equal(t, err != nil, tc.isErr)
+		assert.Equal(t, subdir, tc.expected)
+	}
+}
+
+func TestLoadModFileWithDuplicateDep(t *testing.T) {
+	testPath := getTestDir("test_duplicate_dep")
+	_, err := LoadModFile(testPath)
+	assert.NotEqual(t, err, nil)
+
+	var duplicateErr *DuplicateDependencyError
+	assert.True(t, errors.As(err, &duplicateErr))
+	assert.Equal(t, duplicateErr.Name, "k8s")
+	assert.Equal(t, duplicateErr.Declarations, []DependencyDeclaration{
+		{Name: "k8s", Line: 7, Source: `"1.27"`},
+		{Name: "k8s", Line: 10, Source: `{ git = "https://github.com/kcl-lang/modules", tag = "v0.1.0" }`},
+	})
+	assert.Equal(t, err.Error(), fmt.Sprintf(
+		"dependency 'k8s' is declared more than once in '%s':\nline 7: k8s = \"1.27\"\nline 10: k8s = { git = \"https://github.com/kcl-lang/modules\", tag = \"v0.1.0\" }",
+		filepath.Join(testPath, MOD_FILE),
+	))
+
+	err = checkDuplicateDependencies(MOD_FILE, []byte("[dependencies]\nmy-dep = \"0.0.1\"\nmy_dep = { path = \"../my_dep\" }\nother = \"0.0.1\"\n"))
+	assert.Equal(t, err.Error(), "dependency 'my-dep' is declared more than once in 'kcl.mod':\nline 2: my-dep = \"0.0.1\"\nline 3: my_dep = { path = \"../my_dep\" }")
+	assert.Equal(t, checkDuplicateDependencies(MOD_FILE, []byte("[dependencies]\nk8s = \"1.27\"\n\n[profile]\nentries = [\"main.k\"]\n")), nil)
+}
+
+func TestFormatModFile(t *testing.T) {
+	testDir := t.TempDir()
+	content, err := os.ReadFile(filepath.Join(getTestDir("test_format_mod_file"), MOD_FILE))
+	assert.Equal(t, err, nil)
+	modPath := filepath.Join(testDir, MOD_FILE)
+	assert.Equal(t, os.WriteFile(modPath, content, 0644), nil)
+	expected, err := os.ReadFile(filepath.Join(getTestDir("test_format_mod_file"), "expected.mod"))
+	assert.Equal(t, err, nil)
+
+	assert.Equal(t, FormatModFile(testDir), nil)
+	formatted, err := os.ReadFile(modPath)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, string(formatted), string(expected))
+
+	// Formatting the formatted 'kcl.mod' changes nothing.
+	assert.Equal(t, FormatModFile(modPath), nil)
+	formatted, err = os.ReadFile(modPath)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, string(formatted), string(expected))
+
+	_, err = FormatModFileContent([]byte("[package]\nname = \n"))
+	assert.NotEqual(t, err, nil)
+}
@@ -2,7 +2,9 @@ package pkg
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"kcl-lang.io/kcl-go/pkg/kcl"
@@ -21,6 +23,14 @@ type KclPkg struct {
 	Dependencies
 	// The flag 'NoSumCheck' is true if the checksum of the current kcl package is not checked.
 	NoSumCheck bool
+	// The flag 'FailOnLockChange' is true if kcl.mod.lock should not be created or modified.
+	FailOnLockChange bool
+	// The flag 'VendorDirectOnly' is true if only the direct dependencies are vendored in the vendor mode.
+	VendorDirectOnly bool
+	// The flag 'NonAtomicWrite' is true if kcl.mod.lock is written in place rather than replaced atomically.
+	NonAtomicWrite bool
+	// The hook 'NewChecksumHook' is called with the checksums which are not in kcl.mod.lock before it is written.
+	NewChecksumHook opt.NewChecksumHook
 }
 
 func (p *KclPkg) GetDepsMetadata() (*Dependencies, error) {
@@ -77,6 +87,41 @@ func (kclPkg *KclPkg) GetEntryKclFilesFromModFile() []string {
 	return kclPkg.ModFile.GetEntries()
 }
 
+// GetFallbackEntry will return the absolute path of the entry file compiled if no entries are provided.
+// It is the 'entry' in kcl.mod, or 'main.k' in the package if there is no 'entry' in kcl.mod.
+// An empty path is returned if the profile in kcl.mod has the entries,
+// and an error is returned if the 'entry' does not exist, or there is neither the 'entry' nor 'main.k'.
+func (kclPkg *KclPkg) GetFallbackEntry() (string, error) {
+	if len(kclPkg.GetEntryKclFilesFromModFile()) != 0 {
+		return "", nil
+	}
+
+	entry := kclPkg.ModFile.Pkg.Entry
+	if len(entry) != 0 {
+		if !filepath.IsAbs(entry) {
+			entry = filepath.Join(kclPkg.HomePath, entry)
+		}
+		if !utils.DirExists(entry) {
+			return "", reporter.NewErrorEvent(
+				reporter.LocalPathNotExist,
+				fmt.Errorf("the entry '%s' in kcl.mod does not exist", entry),
+				fmt.Sprintf("failed to find the entry file of the package '%s'", kclPkg.GetPkgName()),
+			)
+		}
+		return entry, nil
+	}
+
+	fallback := filepath.Join(kclPkg.HomePath, FALLBACK_ENTRY_FILE)
+	if !utils.DirExists(fallback) {
+		return "", reporter.NewErrorEvent(
+			reporter.LocalPathNotExist,
+			fmt.Errorf("neither the 'entry' in kcl.mod nor '%s' exists", fallback),
+			fmt.Sprintf("failed to find the entry file of the package '%s'", kclPkg.GetPkgName()),
+		)
+	}
+	return fallback, nil
+}
+
 // HasProfile will return true if the current kcl package has the profile.
 func (kclPkg *KclPkg) HasProfile() bool {
 	return kclPkg.ModFile.Profiles != nil
@@ -90,6 +135,26 @@ func (kclPkg *KclPkg) SetVendorMode(vendorMode bool) {
 	kclPkg.ModFile.VendorMode = vendorMode
 }
 
+// SetVendorModeWithOpts will set the vendor mode from the mode of vendoring in the compile options.
+func (kclPkg *KclPkg) SetVendorModeWithOpts(mode opt.VendorMode) {
+	kclPkg.SetVendorMode(mode != opt.NoVendor)
+	kclPkg.VendorDirectOnly = mode == opt.DirectOnly
+}
+
+// IsVendoredDep will return true if the dependency 'name' is vendored into the vendor subdirectory.
+// In the vendor mode, all the dependencies are vendored unless only the direct dependencies,
+// i.e. the dependencies in kcl.mod, are vendored.
+func (kclPkg *KclPkg) IsVendoredDep(name string) bool {
+	if !kclPkg.IsVendorMode() {
+		return false
+	}
+	if !kclPkg.VendorDirectOnly {
+		return true
+	}
+	_, ok := kclPkg.ModFile.Dependencies.Deps[name]
+	return ok
+}
+
 // Return the full vendor path.
 func (kclPkg *KclPkg) LocalVendorPath() string {
 	return filepath.Join(kclPkg.HomePath, "vendor")
@@ -122,7 +187,110 @@ func (kclPkg *KclPkg) LockDepsVersion() error {
 		return err
 	}
 
-	return utils.StoreToFile(fullPath, lockToml)
+	if kclPkg.FailOnLockChange {
+		err = kclPkg.checkLockChange(fullPath, lockToml)
+		if err != nil {
+			return err
+		}
+		// The locked dependencies are unchanged, and the kcl.mod.lock is left in its schema until it is migrated.
+		return nil
+	}
+
+	if kclPkg.NewChecksumHook == nil {
+		return storeFile(fullPath, lockToml, kclPkg.NonAtomicWrite)
+	}
+	lockedDeps, err := LoadLockDeps(kclPkg.HomePath)
+	if err != nil {
+		return err
+	}
+	err = storeFile(fullPath, lockToml, kclPkg.NonAtomicWrite)
+	if err != nil {
+		return err
+	}
+	kclPkg.reportNewChecksums(lockedDeps)
+	return nil
+}
+
+// reportNewChecksums will call the 'NewChecksumHook' in the order of the names
+// for each dependency whose checksum is not the same as the one in 'lockedDeps'.
+func (kclPkg *KclPkg) reportNewChecksums(lockedDeps *Dependencies) {
+	names := make([]string, 0, len(kclPkg.Dependencies.Deps))
+	for name := range kclPkg.Dependencies.Deps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sum := kclPkg.Dependencies.Deps[name].Sum
+		if len(sum) == 0 {
+			continue
+		}
+		if locked, ok := lockedDeps.Deps[name]; ok && locked.Sum == sum {
+			continue
+		}
+		kclPkg.NewChecksumHook(name, sum)
+	}
+}
+
+// storeFile will store 'content' into the file 'path', the file is replaced atomically unless 'nonAtomic' is true.
+func storeFile(path, content string, nonAtomic bool) error {
+	if nonAtomic {
+		return utils.StoreToFile(path, content)
+	}
+	return utils.StoreToFileAtomically(path, content)
+}
+
+// checkLockChange returns an error describing the change if the kcl.mod.lock would be created or modified,
+// except for only upgrading its schema.
+func (kclPkg *KclPkg) checkLockChange(lockPath, lockToml string) error {
+	if !utils.DirExists(lockPath) {
+		return reporter.NewErrorEvent(
+			reporter.LockFileChanged,
+			fmt.Errorf("'%s' would be created", lockPath),
+			"the kcl.mod.lock is not allowed to change",
+		)
+	}
+
+	oldLockToml, err := os.ReadFile(lockPath)
+	if err != nil {
+		return reporter.NewErrorEvent(reporter.FailedLoadKclModLock, err, fmt.Sprintf("failed to load '%s'", lockPath))
+	}
+	if string(oldLockToml) == lockToml {
+		return nil
+	}
+
+	oldDeps, err := LoadLockDeps(kclPkg.HomePath)
+	if err != nil {
+		return reporter.NewErrorEvent(reporter.FailedLoadKclModLock, err, fmt.Sprintf("failed to load '%s'", lockPath))
+	}
+
+	var changes []string
+	for name, dep := range kclPkg.Dependencies.Deps {
+		oldDep, ok := oldDeps.Deps[name]
+		if !ok {
+			changes = append(changes, fmt.Sprintf("adding '%s' with version '%s'", name, dep.Version))
+		} else if oldDep.Version != dep.Version || oldDep.Sum != dep.Sum {
+			changes = append(changes, fmt.Sprintf("updating '%s' from version '%s' to '%s'", name, oldDep.Version, dep.Version))
+		}
+	}
+	for name, dep := range oldDeps.Deps {
+		if _, ok := kclPkg.Dependencies.Deps[name]; !ok {
+			changes = append(changes, fmt.Sprintf("removing '%s' with version '%s'", name, dep.Version))
+		}
+	}
+	if len(changes) == 0 {
+		// Only upgrading the schema of the kcl.mod.lock in an older version does not change the locked dependencies.
+		if version, err := LockVersion(string(oldLockToml)); err == nil && version < LOCK_FILE_VERSION {
+			return nil
+		}
+		changes = append(changes, "reformatting the content")
+	}
+	sort.Strings(changes)
+
+	return reporter.NewErrorEvent(
+		reporter.LockFileChanged,
+		fmt.Errorf("'%s' would be modified:\n%s", lockPath, strings.Join(changes, "\n")),
+		"the kcl.mod.lock is not allowed to change",
+	)
 }
 
 // CreateDefauleMain will create a default main.k file in the current kcl package.
@@ -136,3 +136,187 @@ func TestLoadKclPkgFromTar(t *testing.T) {
 	err = os.RemoveAll(filepath.Join(testDir, "kcl1-v0.0.3"))
 	assert.Equal(t, err, nil)
 }
+
+func TestLockDepsVersionWithFailOnLockChange(t *testing.T) {
+	testDir := initTestDir("test_fail_on_lock_change")
+	defer func() {
+		_ = os.RemoveAll(testDir)
+	}()
+
+	kclPkg := NewKclPkg(&opt.InitOptions{Name: "test_fail_on_lock_change", InitPath: testDir})
+	kclPkg.FailOnLockChange = true
+
+	// The kcl.mod.lock would be created.
+	err := kclPkg.LockDepsVersion()
+	assert.NotEqual(t, err, nil)
+	assert.Equal(t, err.(*reporter.KpmEvent).Type(), reporter.LockFileChanged)
+	assert.Equal(t, utils.DirExists(filepath.Join(testDir, MOD_LOCK_FILE)), false)
+
+	kclPkg.FailOnLockChange = false
+	assert.Equal(t, kclPkg.LockDepsVersion(), nil)
+
+	// The kcl.mod.lock is not changed.
+	kclPkg.FailOnLockChange = true
+	assert.Equal(t, kclPkg.LockDepsVersion(), nil)
+
+	// The kcl.mod.lock would be modified.
+	kclPkg.Dependencies.Deps["test_dep"] = Dependency{
+		Name:     "test_dep",
+		FullName: "test_dep_0.0.1",
+		Version:  "0.0.1",
+		Source: Source{
+			Oci: &Oci{
+				Reg:  "ghcr.io",
+				Repo: "kcl-lang/test_dep",
+				Tag:  "0.0.1",
+			},
+		},
+	}
+	err = kclPkg.LockDepsVersion()
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "adding 'test_dep' with version '0.0.1'")
+}
+
+func TestLockDepsVersionWithFailOnLockChangeAndLegacyLock(t *testing.T) {
+	testDir := initTestDir("test_fail_on_legacy_lock_change")
+	defer func() {
+		_ = os.RemoveAll(testDir)
+	}()
+
+	kclPkg := NewKclPkg(&opt.InitOptions{Name: "test_fail_on_legacy_lock_change", InitPath: testDir})
+	kclPkg.Dependencies.Deps["test_dep"] = Dependency{
+		Name:     "test_dep",
+		FullName: "test_dep_0.0.1",
+		Version:  "0.0.1",
+		Sum:      "test_sum",
+		Source: Source{
+			Oci: &Oci{
+				Reg:  "ghcr.io",
+				Repo: "kcl-lang/test_dep",
+				Tag:  "0.0.1",
+			},
+		},
+	}
+
+	// The kcl.mod.lock in the legacy schema without 'version' and 'full_name'.
+	lockPath := filepath.Join(testDir, MOD_LOCK_FILE)
+	legacyLock := "[dependencies]\n  [dependencies.test_dep]\n    name = \"test_dep\"\n    version = \"0.0.1\"\n    sum = \"test_sum\"\n    reg = \"ghcr.io\"\n    repo = \"kcl-lang/test_dep\"\n    oci_tag = \"0.0.1\"\n"
+	assert.Equal(t, utils.StoreToFile(lockPath, legacyLock), nil)
+
+	kclPkg.FailOnLockChange = true
+	assert.Equal(t, kclPkg.LockDepsVersion(), nil)
+	content, err := os.ReadFile(lockPath)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, string(content), legacyLock)
+
+	// The locked dependency would be updated.
+	dep := kclPkg.Dependencies.Deps["test_dep"]
+	dep.Sum = "new_sum"
+	kclPkg.Dependencies.Deps["test_dep"] = dep
+	err = kclPkg.LockDepsVersion()
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "updating 'test_dep' from version '0.0.1' to '0.0.1'")
+}
+
+func TestLockDepsVersionWithNewChecksumHook(t *testing.T) {
+	testDir := initTestDir("test_new_checksum_hook")
+	defer func() {
+		_ = os.RemoveAll(testDir)
+	}()
+
+	newDep := func(name, sum string) Dependency {
+		return Dependency{
+			Name:     name,
+			FullName: name + "_0.0.1",
+			Version:  "0.0.1",
+			Sum:      sum,
+			Source: Source{
+				Oci: &Oci{
+					Reg:  "ghcr.io",
+					Repo: "kcl-lang/" + name,
+					Tag:  "0.0.1",
+				},
+			},
+		}
+	}
+
+	var reported []string
+	kclPkg := NewKclPkg(&opt.InitOptions{Name: "test_new_checksum_hook", InitPath: testDir})
+	kclPkg.NewChecksumHook = func(dep, digest string) {
+		reported = append(reported, dep+"@"+digest)
+	}
+	kclPkg.Dependencies.Deps["b"] = newDep("b", "sum_b")
+	kclPkg.Dependencies.Deps["a"] = newDep("a", "sum_a")
+	assert.Equal(t, kclPkg.LockDepsVersion(), nil)
+	assert.Equal(t, reported, []string{"a@sum_a", "b@sum_b"})
+
+	// The checksums already locked are not reported again.
+	reported = nil
+	assert.Equal(t, kclPkg.LockDepsVersion(), nil)
+	assert.Equal(t, len(reported), 0)
+
+	// The new dependencies and the changed checksums are reported.
+	reported = nil
+	kclPkg.Dependencies.Deps["a"] = newDep("a", "sum_a_changed")
+	kclPkg.Dependencies.Deps["c"] = newDep("c", "sum_c")
+	assert.Equal(t, kclPkg.LockDepsVersion(), nil)
+	assert.Equal(t, reported, []string{"a@sum_a_changed", "c@sum_c"})
+}
+
+func TestIsVendoredDep(t *testing.T) {
+	kclPkg := NewKclPkg(&opt.InitOptions{Name: "test_is_vendored_dep", InitPath: getTestDir("test_is_vendored_dep")})
+	kclPkg.ModFile.Dependencies.Deps["direct"] = Dependency{Name: "direct"}
+	kclPkg.Dependencies.Deps["direct"] = Dependency{Name: "direct"}
+	kclPkg.Dependencies.Deps["transitive"] = Dependency{Name: "transitive"}
+
+	kclPkg.SetVendorModeWithOpts(opt.NoVendor)
+	assert.Equal(t, kclPkg.IsVendoredDep("direct"), false)
+	assert.Equal(t, kclPkg.IsVendoredDep("transitive"), false)
+
+	kclPkg.SetVendorModeWithOpts(opt.FullVendor)
+	assert.Equal(t, kclPkg.IsVendoredDep("direct"), true)
+	assert.Equal(t, kclPkg.IsVendoredDep("transitive"), true)
+
+	kclPkg.SetVendorModeWithOpts(opt.DirectOnly)
+	assert.Equal(t, kclPkg.IsVendoredDep("direct"), true)
+	assert.Equal(t, kclPkg.IsVendoredDep("transitive"), false)
+}
+
+func TestGetFallbackEntry(t *testing.T) {
+	testDir := initTestDir("test_get_fallback_entry")
+	defer func() {
+		_ = os.RemoveAll(testDir)
+	}()
+
+	kclPkg := NewKclPkg(&opt.InitOptions{Name: "test_get_fallback_entry", InitPath: testDir})
+
+	// Neither the 'entry' nor 'main.k' exists.
+	_, err := kclPkg.GetFallbackEntry()
+	assert.NotEqual(t, err, nil)
+	assert.Equal(t, err.(*reporter.KpmEvent).Type(), reporter.LocalPathNotExist)
+
+	// Fall back to 'main.k' if there is no 'entry' in kcl.mod.
+	assert.Equal(t, os.WriteFile(filepath.Join(testDir, FALLBACK_ENTRY_FILE), []byte("a = 1"), 0644), nil)
+	entry, err := kclPkg.GetFallbackEntry()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, entry, filepath.Join(testDir, FALLBACK_ENTRY_FILE))
+
+	// The 'entry' does not exist.
+	kclPkg.ModFile.Pkg.Entry = "app.k"
+	_, err = kclPkg.GetFallbackEntry()
+	assert.NotEqual(t, err, nil)
+	assert.Equal(t, err.(*reporter.KpmEvent).Type(), reporter.LocalPathNotExist)
+	assert.Contains(t, err.Error(), "the entry '"+filepath.Join(testDir, "app.k")+"' in kcl.mod does not exist")
+
+	// The 'entry' exists.
+	assert.Equal(t, os.WriteFile(filepath.Join(testDir, "app.k"), []byte("a = 2"), 0644), nil)
+	entry, err = kclPkg.GetFallbackEntry()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, entry, filepath.Join(testDir, "app.k"))
+
+	// The entries in the profile take precedence.
+	kclPkg.ModFile.Profiles = &Profile{Entries: &[]string{"main.k"}}
+	entry, err = kclPkg.GetFallbackEntry()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, entry, "")
+}
@@ -0,0 +1,12 @@
+[package]
+name = "test_duplicate_dep"
+edition = "0.0.1"
+version = "0.0.1"
+
+[dependencies]
+k8s = "1.27"
+helloworld = "0.1.0"
+
+[dependencies.k8s]
+git = "https://github.com/kcl-lang/modules"
+tag = "v0.1.0"
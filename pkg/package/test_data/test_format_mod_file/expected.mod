@@ -0,0 +1,19 @@
+[package]
+name = "test_format_mod_file"
+edition = "0.0.1"
+version = "0.0.1"
+
+# The dependencies.
+[dependencies]
+# The k8s models.
+k8s = "1.28"
+konfig = { git = "https://github.com/kcl-lang/konfig", tag = "v0.4.0" } # pinned
+
+[dependencies.helloworld]
+version = "0.1.0"
+
+[profile]
+entries = [
+    "main.k",
+    "sub/main.k", # the sub entry
+]
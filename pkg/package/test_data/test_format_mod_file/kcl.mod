@@ -0,0 +1,21 @@
+[profile]
+entries = [
+  "main.k",
+      "sub/main.k", # the sub entry
+]
+
+# The dependencies.
+[ dependencies ]
+konfig={ git = "https://github.com/kcl-lang/konfig", tag = "v0.4.0" }   # pinned
+# The k8s models.
+k8s   =   "1.28"
+
+[dependencies.helloworld]
+version = "0.1.0"
+
+
+
+[package]
+name="test_format_mod_file"
+edition = "0.0.1"
+version = "0.0.1"
@@ -23,6 +23,7 @@ package pkg
 import (
 	"bytes"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/BurntSushi/toml"
@@ -36,6 +37,7 @@ func (mod *ModFile) MarshalTOML() string {
 	sb.WriteString(mod.Pkg.MarshalTOML())
 	sb.WriteString(mod.Dependencies.MarshalTOML())
 	sb.WriteString(mod.Profiles.MarshalTOML())
+	sb.WriteString(marshalPluginsTOML(mod.Plugins))
 	return sb.String()
 }
 
@@ -61,9 +63,10 @@ func (dep *Dependencies) MarshalTOML() string {
 	var sb strings.Builder
 	if len(dep.Deps) != 0 {
 		sb.WriteString(DEPS_PATTERN)
-		for _, dep := range dep.Deps {
+		for _, name := range dep.sortedNames() {
+			d := dep.Deps[name]
 			sb.WriteString(NEWLINE)
-			sb.WriteString(dep.MarshalTOML())
+			sb.WriteString(d.MarshalTOML())
 		}
 		sb.WriteString(NEWLINE)
 	}
@@ -106,12 +109,20 @@ func (source *Source) MarshalTOML() string {
 		}
 	}
 
+	if source.LocalRegistry != nil {
+		registryToml := source.LocalRegistry.MarshalTOML()
+		if len(registryToml) != 0 {
+			sb.WriteString(fmt.Sprintf(SOURCE_PATTERN, registryToml))
+		}
+	}
+
 	return sb.String()
 }
 
 const GTI_URL_PATTERN = "git = \"%s\""
 const GTI_TAG_PATTERN = "tag = \"%s\""
 const GTI_COMMIT_PATTERN = "commit = \"%s\""
+const GTI_SUBDIR_PATTERN = "subdir = \"%s\""
 const SEPARATOR = ", "
 
 func (git *Git) MarshalTOML() string {
@@ -127,11 +138,39 @@ func (git *Git) MarshalTOML() string {
 		sb.WriteString(SEPARATOR)
 		sb.WriteString(fmt.Sprintf(GTI_COMMIT_PATTERN, git.Commit))
 	}
+	if len(git.Subdir) != 0 {
+		sb.WriteString(SEPARATOR)
+		sb.WriteString(fmt.Sprintf(GTI_SUBDIR_PATTERN, git.Subdir))
+	}
 	return sb.String()
 }
 
+const OCI_VERSION_PATTERN = "version = \"%s\""
+const OCI_CREDENTIAL_PATTERN = "credential = \"%s\""
+const OCI_REG_PATTERN = "reg = \"%s\""
+
 func (oci *Oci) MarshalTOML() string {
 	var sb strings.Builder
+	// The registry is written only if it is declared, the dependencies from the default registry declare no registry.
+	reg := oci.DeclaredReg
+	if len(oci.Credential) != 0 || len(reg) != 0 {
+		// The dependency with the credential or the registry is in the table
+		// '{ version = "<tag>", reg = "<registry>", credential = "<ref>" }'.
+		fields := make([]string, 0, 3)
+		if len(oci.Tag) != 0 {
+			fields = append(fields, fmt.Sprintf(OCI_VERSION_PATTERN, oci.Tag))
+		}
+		if len(reg) != 0 {
+			fields = append(fields, fmt.Sprintf(OCI_REG_PATTERN, reg))
+		}
+		if len(oci.Credential) != 0 {
+			fields = append(fields, fmt.Sprintf(OCI_CREDENTIAL_PATTERN, oci.Credential))
+		}
+		sb.WriteString("{ ")
+		sb.WriteString(strings.Join(fields, SEPARATOR))
+		sb.WriteString(" }")
+		return sb.String()
+	}
 	if len(oci.Tag) != 0 {
 		sb.WriteString(fmt.Sprintf(`"%s"`, oci.Tag))
 	}
@@ -148,6 +187,21 @@ func (local *Local) MarshalTOML() string {
 	return sb.String()
 }
 
+const LOCAL_REGISTRY_PATTERN = "registry = %q"
+const LOCAL_REGISTRY_VERSION_PATTERN = "version = %q"
+
+func (registry *LocalRegistry) MarshalTOML() string {
+	var sb strings.Builder
+	if len(registry.Path) != 0 {
+		sb.WriteString(fmt.Sprintf(LOCAL_REGISTRY_PATTERN, registry.Path))
+	}
+	if len(registry.Version) != 0 {
+		sb.WriteString(SEPARATOR)
+		sb.WriteString(fmt.Sprintf(LOCAL_REGISTRY_VERSION_PATTERN, registry.Version))
+	}
+	return sb.String()
+}
+
 const PROFILE_PATTERN = "[profile]"
 
 func (p *Profile) MarshalTOML() string {
@@ -166,9 +220,41 @@ func (p *Profile) MarshalTOML() string {
 	return sb.String()
 }
 
+const PLUGINS_PATTERN = "[plugins]"
+const PLUGIN_PATTERN = "%s = { %s }"
+
+func marshalPluginsTOML(plugins map[string]Plugin) string {
+	var sb strings.Builder
+	if len(plugins) != 0 {
+		names := make([]string, 0, len(plugins))
+		for name := range plugins {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		sb.WriteString(PLUGINS_PATTERN)
+		for _, name := range names {
+			plugin := plugins[name]
+			var fields []string
+			if len(plugin.Version) != 0 {
+				fields = append(fields, fmt.Sprintf("version = %q", plugin.Version))
+			}
+			if len(plugin.Sum) != 0 {
+				fields = append(fields, fmt.Sprintf("sum = %q", plugin.Sum))
+			}
+			sb.WriteString(NEWLINE)
+			sb.WriteString(fmt.Sprintf(PLUGIN_PATTERN, name, strings.Join(fields, ", ")))
+		}
+		sb.WriteString(NEWLINE)
+	}
+	return sb.String()
+}
+
 const PACKAGE_FLAG = "package"
 const DEPS_FLAG = "dependencies"
 const PROFILES_FLAG = "profile"
+const PLUGINS_FLAG = "plugins"
+const OVERRIDES_FLAG = "overrides"
 
 func (mod *ModFile) UnmarshalTOML(data interface{}) error {
 	meta, ok := data.(map[string]interface{})
@@ -209,6 +295,18 @@ func (mod *ModFile) UnmarshalTOML(data interface{}) error {
 		}
 		mod.Profiles = &p
 	}
+
+	if v, ok := meta[PLUGINS_FLAG]; ok {
+		plugins := make(map[string]Plugin)
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(v); err != nil {
+			return err
+		}
+		if err := toml.Unmarshal(buf.Bytes(), &plugins); err != nil {
+			return err
+		}
+		mod.Plugins = plugins
+	}
 	return nil
 }
 
@@ -216,6 +314,11 @@ const NAME_FLAG = "name"
 const EDITION_FLAG = "edition"
 const VERSION_FLAG = "version"
 const DESCRIPTION_FLAG = "description"
+const DEPRECATED_FLAG = "deprecated"
+const REPLACED_BY_FLAG = "replaced_by"
+const ENTRY_FLAG = "entry"
+const LICENSE_FLAG = "license"
+const CONTRACT_FLAG = "contract"
 
 func (pkg *Package) UnmarshalTOML(data interface{}) error {
 	meta, ok := data.(map[string]interface{})
@@ -238,6 +341,26 @@ func (pkg *Package) UnmarshalTOML(data interface{}) error {
 	if v, ok := meta[DESCRIPTION_FLAG].(string); ok {
 		pkg.Description = v
 	}
+
+	if v, ok := meta[DEPRECATED_FLAG].(string); ok {
+		pkg.Deprecated = v
+	}
+
+	if v, ok := meta[REPLACED_BY_FLAG].(string); ok {
+		pkg.ReplacedBy = v
+	}
+
+	if v, ok := meta[ENTRY_FLAG].(string); ok {
+		pkg.Entry = v
+	}
+
+	if v, ok := meta[LICENSE_FLAG].(string); ok {
+		pkg.License = v
+	}
+
+	if v, ok := meta[CONTRACT_FLAG].(string); ok {
+		pkg.Contract = v
+	}
 	return nil
 }
 
@@ -279,6 +402,9 @@ func (dep *Dependency) UnmarshalModTOML(data interface{}) error {
 	if source.Oci != nil {
 		version = source.Oci.Tag
 	}
+	if source.LocalRegistry != nil {
+		version = source.LocalRegistry.Version
+	}
 
 	dep.FullName = fmt.Sprintf(PKG_NAME_PATTERN, dep.Name, version)
 	dep.Version = version
@@ -295,13 +421,32 @@ func (source *Source) UnmarshalModTOML(data interface{}) error {
 				return err
 			}
 			source.Local = &localPath
-		} else {
+		} else if _, ok := meta[LOCAL_REGISTRY_FLAG].(string); ok {
+			registry := LocalRegistry{}
+			err := registry.UnmarshalModTOML(data)
+			if err != nil {
+				return err
+			}
+			source.LocalRegistry = &registry
+		} else if _, ok := meta[GTI_URL_FLAG]; ok {
 			git := Git{}
 			err := git.UnmarshalModTOML(data)
 			if err != nil {
 				return err
 			}
 			source.Git = &git
+		} else if isOciTable(meta) {
+			oci := Oci{}
+			err := oci.UnmarshalModTOML(data)
+			if err != nil {
+				return err
+			}
+			source.Oci = &oci
+		} else {
+			return fmt.Errorf(
+				"unknown source of the dependency, one of '%s', '%s', '%s', '%s', '%s' or '%s' is expected",
+				GTI_URL_FLAG, LOCAL_PATH_FLAG, LOCAL_REGISTRY_FLAG, OCI_VERSION_FLAG, OCI_REG_FLAG, OCI_CREDENTIAL_FLAG,
+			)
 		}
 	}
 
@@ -321,6 +466,7 @@ func (source *Source) UnmarshalModTOML(data interface{}) error {
 const GTI_URL_FLAG = "git"
 const GTI_TAG_FLAG = "tag"
 const GTI_COMMIT_FLAG = "commit"
+const GTI_SUBDIR_FLAG = "subdir"
 
 func (git *Git) UnmarshalModTOML(data interface{}) error {
 	meta, ok := data.(map[string]interface{})
@@ -340,10 +486,42 @@ func (git *Git) UnmarshalModTOML(data interface{}) error {
 		git.Commit = v
 	}
 
+	if v, ok := meta[GTI_SUBDIR_FLAG].(string); ok {
+		git.Subdir = v
+	}
+
 	return nil
 }
 
+const OCI_VERSION_FLAG = "version"
+const OCI_CREDENTIAL_FLAG = "credential"
+const OCI_REG_FLAG = "reg"
+
+// isOciTable returns whether the table 'meta' is an oci dependency '{ version = "<tag>", reg = "<registry>", credential = "<ref>" }'.
+func isOciTable(meta map[string]interface{}) bool {
+	for _, flag := range []string{OCI_VERSION_FLAG, OCI_REG_FLAG, OCI_CREDENTIAL_FLAG} {
+		if _, ok := meta[flag]; ok {
+			return true
+		}
+	}
+	return false
+}
+
 func (oci *Oci) UnmarshalModTOML(data interface{}) error {
+	if table, ok := data.(map[string]interface{}); ok {
+		if v, ok := table[OCI_VERSION_FLAG].(string); ok {
+			oci.Tag = v
+		}
+		if v, ok := table[OCI_CREDENTIAL_FLAG].(string); ok {
+			oci.Credential = v
+		}
+		if v, ok := table[OCI_REG_FLAG].(string); ok {
+			oci.Reg = v
+			oci.DeclaredReg = v
+		}
+		return nil
+	}
+
 	meta, ok := data.(string)
 	if !ok {
 		return fmt.Errorf("expected string, got %T", data)
@@ -369,18 +547,108 @@ func (local *Local) UnmarshalModTOML(data interface{}) error {
 	return nil
 }
 
+const LOCAL_REGISTRY_FLAG = "registry"
+const LOCAL_REGISTRY_VERSION_FLAG = "version"
+const LOCAL_REGISTRY_URL_PREFIX = "file://"
+
+func (registry *LocalRegistry) UnmarshalModTOML(data interface{}) error {
+	meta, ok := data.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("expected map[string]interface{}, got %T", data)
+	}
+
+	if v, ok := meta[LOCAL_REGISTRY_FLAG].(string); ok {
+		registry.Path = v
+	}
+
+	if v, ok := meta[LOCAL_REGISTRY_VERSION_FLAG].(string); ok {
+		registry.Version = v
+	}
+
+	if len(registry.Version) == 0 {
+		return fmt.Errorf("the version of the dependency from the local registry '%s' is required", registry.Path)
+	}
+
+	return nil
+}
+
+// sortedNames returns the names of the dependencies sorted by name, then version,
+// so that the dependencies are always serialized in the same order regardless of the resolution order.
+func (dep *Dependencies) sortedNames() []string {
+	names := make([]string, 0, len(dep.Deps))
+	for name := range dep.Deps {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		di, dj := dep.Deps[names[i]], dep.Deps[names[j]]
+		if di.Name != dj.Name {
+			return di.Name < dj.Name
+		}
+		if di.Version != dj.Version {
+			return di.Version < dj.Version
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// lockFile is the content of kcl.mod.lock, which is the dependencies with the version of the schema.
+type lockFile struct {
+	Version int                   `toml:"version,omitempty"`
+	Deps    map[string]Dependency `toml:"dependencies,omitempty"`
+}
+
+// MarshalLockTOML serializes the dependencies into the content of kcl.mod.lock in the schema of 'LOCK_FILE_VERSION'.
+// The toml encoder writes the dependencies in the order of the sorted names,
+// so the same dependencies always produce the same kcl.mod.lock.
 func (dep *Dependencies) MarshalLockTOML() (string, error) {
 	buf := new(bytes.Buffer)
-	if err := toml.NewEncoder(buf).Encode(dep); err != nil {
+	if err := toml.NewEncoder(buf).Encode(lockFile{Version: LOCK_FILE_VERSION, Deps: dep.Deps}); err != nil {
 		return "", reporter.NewErrorEvent(reporter.FailedLoadKclModLock, err, "failed to lock dependencies version")
 	}
 	return buf.String(), nil
 }
 
+// UnmarshalLockTOML parses the content of kcl.mod.lock into the dependencies.
+// The kcl.mod.lock in a schema newer than 'LOCK_FILE_VERSION' is rejected,
+// since its fields may have a different meaning which is unknown to this version of kpm.
 func (dep *Dependencies) UnmarshalLockTOML(data string) error {
-	if _, err := toml.NewDecoder(strings.NewReader(data)).Decode(dep); err != nil {
+	version, err := LockVersion(data)
+	if err != nil {
+		return err
+	}
+	if version > LOCK_FILE_VERSION {
+		return reporter.NewErrorEvent(
+			reporter.UnsupportedLockVersion,
+			fmt.Errorf("the version %d of the kcl.mod.lock schema is newer than the version %d supported by this kpm", version, LOCK_FILE_VERSION),
+			"failed to load kcl.mod.lock, please upgrade kpm",
+		)
+	}
+
+	var lock lockFile
+	if _, err := toml.NewDecoder(strings.NewReader(data)).Decode(&lock); err != nil {
 		return reporter.NewErrorEvent(reporter.FailedLoadKclModLock, err, "failed to load kcl.mod.lock")
 	}
+	if dep.Deps == nil {
+		dep.Deps = make(map[string]Dependency, len(lock.Deps))
+	}
+	for name, d := range lock.Deps {
+		dep.Deps[name] = d
+	}
 
 	return nil
 }
+
+// LockVersion returns the version of the schema of the kcl.mod.lock content 'data', 0 if it is in the legacy schema.
+func LockVersion(data string) (int, error) {
+	var lock struct {
+		Version int `toml:"version"`
+	}
+	if _, err := toml.NewDecoder(strings.NewReader(data)).Decode(&lock); err != nil {
+		return 0, reporter.NewErrorEvent(reporter.FailedLoadKclModLock, err, "failed to load kcl.mod.lock")
+	}
+	if lock.Version < 0 {
+		return 0, reporter.NewErrorEvent(reporter.FailedLoadKclModLock, fmt.Errorf("invalid version %d", lock.Version), "failed to load kcl.mod.lock")
+	}
+	return lock.Version, nil
+}
@@ -4,10 +4,12 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/BurntSushi/toml"
 	"github.com/stretchr/testify/assert"
+	"kcl-lang.io/kpm/pkg/settings"
 	"kcl-lang.io/kpm/pkg/utils"
 )
 
@@ -169,3 +171,122 @@ func TestUnMarshalTOMLWithProfile(t *testing.T) {
 	assert.Equal(t, modfile.Pkg.Edition, "0.0.1")
 	assert.Equal(t, *modfile.Profiles.Entries, []string{"main.k", "xxx/xxx/dir", "test.yaml"})
 }
+
+func TestUnMarshalTOMLWithPlugins(t *testing.T) {
+	modfile := ModFile{}
+	data := `[package]
+name = "test_plugins"
+edition = "v0.0.1"
+version = "v0.0.1"
+
+[plugins]
+hello = { version = "0.0.1", sum = "yNADGqn3jclWtfpwvWMHBsgkAKzOaMWg/VYxfcOJs64=" }
+world = { version = "0.0.2" }
+`
+	err := toml.Unmarshal([]byte(data), &modfile)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, modfile.Plugins, map[string]Plugin{
+		"hello": {Version: "0.0.1", Sum: "yNADGqn3jclWtfpwvWMHBsgkAKzOaMWg/VYxfcOJs64="},
+		"world": {Version: "0.0.2"},
+	})
+	assert.Equal(t, strings.HasSuffix(modfile.MarshalTOML(), `[plugins]
+hello = { version = "0.0.1", sum = "yNADGqn3jclWtfpwvWMHBsgkAKzOaMWg/VYxfcOJs64=" }
+world = { version = "0.0.2" }
+`), true)
+}
+
+func TestUnMarshalTOMLWithLocalRegistry(t *testing.T) {
+	modfile := ModFile{}
+	data := `[package]
+name = "test_local_registry"
+edition = "v0.0.1"
+version = "v0.0.1"
+
+[dependencies]
+helloworld = { registry = "file:///mnt/kcl-registry", version = "0.1.0" }
+`
+	err := toml.Unmarshal([]byte(data), &modfile)
+	assert.Equal(t, err, nil)
+
+	dep := modfile.Dependencies.Deps["helloworld"]
+	assert.Equal(t, dep.FullName, "helloworld_0.1.0")
+	assert.Equal(t, dep.Version, "0.1.0")
+	assert.Equal(t, dep.IsFromLocalRegistry(), true)
+	assert.Equal(t, dep.Source.LocalRegistry.GetTarPath(dep.Name), filepath.Join("/mnt/kcl-registry", "helloworld", "0.1.0.tar"))
+	assert.Equal(t, dep.Source.MarshalTOML(), `{ registry = "file:///mnt/kcl-registry", version = "0.1.0" }`)
+}
+
+func TestUnMarshalTOMLWithGitSubdir(t *testing.T) {
+	modfile := ModFile{}
+	data := `[package]
+name = "test_git_subdir"
+edition = "v0.0.1"
+version = "v0.0.1"
+
+[dependencies]
+helloworld = { git = "https://github.com/kcl-lang/modules.git", tag = "v0.1.0", subdir = "helloworld" }
+`
+	err := toml.Unmarshal([]byte(data), &modfile)
+	assert.Equal(t, err, nil)
+
+	dep := modfile.Dependencies.Deps["helloworld"]
+	assert.Equal(t, dep.FullName, "helloworld_v0.1.0")
+	assert.Equal(t, dep.Source.Git.Subdir, "helloworld")
+	assert.Equal(t, dep.Source.MarshalTOML(), `{ git = "https://github.com/kcl-lang/modules.git", tag = "v0.1.0", subdir = "helloworld" }`)
+
+	lockDeps := Dependencies{Deps: map[string]Dependency{"helloworld": dep}}
+	lockToml, err := lockDeps.MarshalLockTOML()
+	assert.Equal(t, err, nil)
+	assert.Contains(t, lockToml, `git_subdir = "helloworld"`)
+}
+
+func TestOciDependencyWithCredential(t *testing.T) {
+	modfile := ModFile{}
+	err := toml.Unmarshal([]byte(`[dependencies]
+k8s = { version = "1.28", credential = "team-a" }
+helloworld = "0.1.0"
+`), &modfile)
+	assert.Equal(t, err, nil)
+
+	k8s := modfile.Dependencies.Deps["k8s"]
+	assert.NotEqual(t, k8s.Source.Oci, nil)
+	assert.Equal(t, k8s.Source.Oci.Tag, "1.28")
+	assert.Equal(t, k8s.Source.Oci.Credential, "team-a")
+	assert.Equal(t, k8s.FullName, "k8s_1.28")
+	assert.Equal(t, k8s.MarshalTOML(), `k8s = { version = "1.28", credential = "team-a" }`)
+
+	helloworld := modfile.Dependencies.Deps["helloworld"]
+	assert.Equal(t, helloworld.Source.Oci.Credential, "")
+	assert.Equal(t, helloworld.MarshalTOML(), `helloworld = "0.1.0"`)
+}
+
+func TestOciDependencyWithReg(t *testing.T) {
+	modfile := ModFile{}
+	err := toml.Unmarshal([]byte(`[dependencies]
+k8s = { version = "1.28", reg = "registry.example.com" }
+`), &modfile)
+	assert.Equal(t, err, nil)
+
+	k8s := modfile.Dependencies.Deps["k8s"]
+	assert.Equal(t, k8s.Source.Oci.Reg, "registry.example.com")
+	assert.Equal(t, k8s.Source.Oci.Tag, "1.28")
+	assert.Equal(t, k8s.MarshalTOML(), `k8s = { version = "1.28", reg = "registry.example.com" }`)
+
+	assert.Equal(t, k8s.FillDepInfo(), nil)
+	assert.Equal(t, k8s.Source.Oci.Reg, "registry.example.com")
+
+	// The registry filled by default is not written into kcl.mod.
+	helloworld := Dependency{Name: "helloworld", Source: Source{Oci: &Oci{Tag: "0.1.0"}}}
+	assert.Equal(t, helloworld.FillDepInfo(), nil)
+	assert.Equal(t, helloworld.Source.Oci.Reg, settings.GetSettings().DefaultOciRegistry())
+	assert.Equal(t, helloworld.MarshalTOML(), `helloworld = "0.1.0"`)
+}
+
+func TestUnknownDependencySource(t *testing.T) {
+	modfile := ModFile{}
+	err := toml.Unmarshal([]byte(`[dependencies]
+k8s = { url = "https://github.com/kcl-lang/modules.git" }
+`), &modfile)
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "unknown source of the dependency")
+}
@@ -0,0 +1,197 @@
+package reporter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Location is the position in a kcl file which a diagnostic points to.
+type Location struct {
+	File   string `json:"file"`
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+}
+
+// Severity is the severity of a diagnostic.
+type Severity int
+
+const (
+	// SeverityError is the severity of the diagnostics of the errors, which is the default one.
+	SeverityError Severity = iota
+	// SeverityWarning is the severity of the diagnostics of the warnings, e.g. the deprecated dependencies.
+	SeverityWarning
+)
+
+// String returns the name of the severity.
+func (s Severity) String() string {
+	if s == SeverityWarning {
+		return "warning"
+	}
+	return "error"
+}
+
+// Diagnostic is the structured information of an error used by the error formatters.
+type Diagnostic struct {
+	// Kind is the kind of the error.
+	Kind ErrorKind `json:"-"`
+	// Severity is the severity of the diagnostic, the diagnostics of the errors are 'SeverityError'.
+	Severity Severity `json:"-"`
+	// Message is the message of the error reported by kpm, e.g. 'failed to compile the kcl package'.
+	Message string `json:"message,omitempty"`
+	// Detail is the message of the cause of the error, e.g. the error message of the kcl compiler.
+	Detail string `json:"detail,omitempty"`
+	// Locations is the positions in the kcl files found in the detail.
+	Locations []Location `json:"locations,omitempty"`
+}
+
+// ErrorFormatter renders the diagnostics of an error into the error message.
+type ErrorFormatter func(diagnostics []Diagnostic) string
+
+// locationPattern matches the positions in the kcl compiler errors, e.g. ' --> /path/to/main.k:1:5'.
+var locationPattern = regexp.MustCompile(`-->\s*(\S+?):(\d+)(?::(\d+))?\s*$`)
+
+// NewDiagnostics returns the diagnostics of the error 'err'.
+func NewDiagnostics(err error) []Diagnostic {
+	if err == nil {
+		return nil
+	}
+
+	diagnostic := Diagnostic{Kind: GetErrorKind(err)}
+	var event *KpmEvent
+	if errors.As(err, &event) && event != nil {
+		diagnostic.Message = strings.TrimSpace(event.msg)
+		if event.err != nil {
+			diagnostic.Detail = strings.TrimSpace(event.err.Error())
+		}
+	} else {
+		diagnostic.Detail = strings.TrimSpace(err.Error())
+	}
+
+	for _, line := range strings.Split(diagnostic.Detail, "\n") {
+		matches := locationPattern.FindStringSubmatch(strings.TrimSpace(line))
+		if matches == nil {
+			continue
+		}
+		location := Location{File: matches[1]}
+		location.Line, _ = strconv.Atoi(matches[2])
+		if len(matches[3]) != 0 {
+			location.Column, _ = strconv.Atoi(matches[3])
+		}
+		diagnostic.Locations = append(diagnostic.Locations, location)
+	}
+
+	return []Diagnostic{diagnostic}
+}
+
+// NewWarningDiagnostic returns the diagnostic of the warning 'warning'.
+func NewWarningDiagnostic(warning *KpmEvent) Diagnostic {
+	diagnostic := NewDiagnostics(warning)[0]
+	diagnostic.Severity = SeverityWarning
+	return diagnostic
+}
+
+// TextErrorFormatter renders the diagnostics as plain text, which is the default error message of kpm.
+func TextErrorFormatter(diagnostics []Diagnostic) string {
+	var sb strings.Builder
+	for _, d := range diagnostics {
+		if len(d.Message) != 0 {
+			sb.WriteString(d.Message + "\n")
+		}
+		if len(d.Detail) != 0 {
+			sb.WriteString(d.Detail + "\n")
+		}
+	}
+	return sb.String()
+}
+
+// JsonErrorFormatter renders the diagnostics as a json array.
+func JsonErrorFormatter(diagnostics []Diagnostic) string {
+	type jsonDiagnostic struct {
+		Kind string `json:"kind"`
+		Diagnostic
+	}
+	jsonDiagnostics := make([]jsonDiagnostic, 0, len(diagnostics))
+	for _, d := range diagnostics {
+		jsonDiagnostics = append(jsonDiagnostics, jsonDiagnostic{Kind: d.Kind.String(), Diagnostic: d})
+	}
+	content, err := json.Marshal(jsonDiagnostics)
+	if err != nil {
+		return TextErrorFormatter(diagnostics)
+	}
+	return string(content)
+}
+
+// GitHubErrorFormatter renders the diagnostics as the GitHub Actions error annotations,
+// e.g. '::error file=main.k,line=1,col=5::failed to compile the kcl package', and the warnings as the warning annotations.
+func GitHubErrorFormatter(diagnostics []Diagnostic) string {
+	var sb strings.Builder
+	for _, d := range diagnostics {
+		msg := d.Message
+		if len(d.Detail) != 0 {
+			if len(msg) != 0 {
+				msg += ": "
+			}
+			msg += d.Detail
+		}
+		msg = escapeGitHubData(msg)
+
+		if len(d.Locations) == 0 {
+			sb.WriteString(fmt.Sprintf("::%s::%s\n", d.Severity, msg))
+			continue
+		}
+		for _, l := range d.Locations {
+			props := fmt.Sprintf("file=%s", escapeGitHubProperty(l.File))
+			if l.Line != 0 {
+				props += fmt.Sprintf(",line=%d", l.Line)
+			}
+			if l.Column != 0 {
+				props += fmt.Sprintf(",col=%d", l.Column)
+			}
+			sb.WriteString(fmt.Sprintf("::%s %s::%s\n", d.Severity, props, msg))
+		}
+	}
+	return sb.String()
+}
+
+// escapeGitHubData escapes the message of the GitHub Actions workflow command.
+func escapeGitHubData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// escapeGitHubProperty escapes the property value of the GitHub Actions workflow command.
+func escapeGitHubProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
+
+// FormattedError is the error whose message is rendered by an error formatter.
+type FormattedError struct {
+	err error
+	msg string
+}
+
+// NewFormattedError returns the error 'err' with the message rendered by 'formatter' from its diagnostics.
+// 'err' is returned as is if 'formatter' is nil.
+func NewFormattedError(err error, formatter ErrorFormatter) error {
+	if err == nil || formatter == nil {
+		return err
+	}
+	var event *KpmEvent
+	if errors.As(err, &event) && event == nil {
+		return err
+	}
+	return &FormattedError{err: err, msg: formatter(NewDiagnostics(err))}
+}
+
+// Error returns the formatted message.
+func (e *FormattedError) Error() string {
+	return e.msg
+}
+
+// Unwrap returns the original error.
+func (e *FormattedError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,46 @@
+package reporter
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorFormatters(t *testing.T) {
+	err := NewErrorEvent(
+		CompileFailed,
+		errors.New("error[E2G22]: TypeError\n --> /pkg/main.k:2:5\n  |\n2 | a: int = \"1\"\n  |     ^ expected int, got str(1)"),
+		"failed to compile the kcl package",
+	)
+
+	diagnostics := NewDiagnostics(err)
+	assert.Equal(t, len(diagnostics), 1)
+	assert.Equal(t, diagnostics[0].Kind, KindCompile)
+	assert.Equal(t, diagnostics[0].Message, "failed to compile the kcl package")
+	assert.Equal(t, diagnostics[0].Locations, []Location{{File: "/pkg/main.k", Line: 2, Column: 5}})
+
+	assert.Equal(t, TextErrorFormatter(diagnostics), err.Error())
+	assert.Equal(t, GitHubErrorFormatter(diagnostics),
+		"::error file=/pkg/main.k,line=2,col=5::failed to compile the kcl package: error[E2G22]: TypeError%0A --> /pkg/main.k:2:5%0A  |%0A2 | a: int = \"1\"%0A  |     ^ expected int, got str(1)\n")
+	assert.Equal(t, JsonErrorFormatter(NewDiagnostics(NewErrorEvent(FailedCreateFile, errors.New("permission denied"), "failed to create 'a.k'"))),
+		`[{"kind":"io","message":"failed to create 'a.k'","detail":"permission denied"}]`)
+	assert.Equal(t, GitHubErrorFormatter(NewDiagnostics(errors.New("100% failed"))), "::error::100%25 failed\n")
+
+	warning := NewWarningDiagnostic(NewEvent(DependencyDeprecated, "the dependency 'k8s' is deprecated"))
+	assert.Equal(t, warning.Severity, SeverityWarning)
+	assert.Equal(t, warning.Message, "the dependency 'k8s' is deprecated")
+	assert.Equal(t, GitHubErrorFormatter([]Diagnostic{warning}), "::warning::the dependency 'k8s' is deprecated\n")
+}
+
+func TestNewFormattedError(t *testing.T) {
+	assert.Equal(t, NewFormattedError(nil, JsonErrorFormatter), nil)
+
+	err := NewErrorEvent(DependencyNotFound, errors.New("dependency 'k8s' not found"), "failed to resolve")
+	assert.Equal(t, NewFormattedError(err, nil), err)
+
+	formatted := NewFormattedError(err, JsonErrorFormatter)
+	assert.Equal(t, formatted.Error(), `[{"kind":"resolve","message":"failed to resolve","detail":"dependency 'k8s' not found"}]`)
+	assert.Equal(t, GetErrorKind(formatted), KindResolve)
+	assert.True(t, errors.Is(formatted, err))
+}
@@ -0,0 +1,176 @@
+package reporter
+
+import (
+	"errors"
+	"net"
+	"net/url"
+)
+
+// ErrorKind is the kind of the failure, which can be used to branch on the failure type
+// rather than matching the error message.
+type ErrorKind int
+
+const (
+	// KindNone means there is no error.
+	KindNone ErrorKind = iota
+	// KindUnknown means the error is not produced by kpm or its kind is unknown.
+	KindUnknown
+	// KindResolve means the kcl package or its dependencies failed to be resolved.
+	KindResolve
+	// KindCompile means the kcl package failed to be compiled, or the compile result is invalid.
+	KindCompile
+	// KindIO means the failure of accessing the local files.
+	KindIO
+	// KindNetwork means the failure of accessing the remote registries or repositories.
+	KindNetwork
+)
+
+// String returns the name of the error kind.
+func (k ErrorKind) String() string {
+	switch k {
+	case KindNone:
+		return "none"
+	case KindResolve:
+		return "resolve"
+	case KindCompile:
+		return "compile"
+	case KindIO:
+		return "io"
+	case KindNetwork:
+		return "network"
+	default:
+		return "unknown"
+	}
+}
+
+// ExitCode returns the exit code for the error kind, 0 means success.
+func (k ErrorKind) ExitCode() int {
+	switch k {
+	case KindNone:
+		return 0
+	case KindCompile:
+		return 2
+	case KindResolve:
+		return 3
+	case KindIO:
+		return 4
+	case KindNetwork:
+		return 5
+	default:
+		return 1
+	}
+}
+
+// eventKinds is the error kinds of the error event types, the event types not in it are of 'KindUnknown'.
+var eventKinds = map[EventType]ErrorKind{
+	InvalidRepo:                KindResolve,
+	RepoNotFound:               KindResolve,
+	FailedSelectLatestVersion:  KindResolve,
+	FailedGetPackageVersions:   KindResolve,
+	FailedGetPkg:               KindResolve,
+	FailedVendor:               KindResolve,
+	InvalidKclPkg:              KindResolve,
+	FailedLoadKclMod:           KindResolve,
+	FailedLoadKclModLock:       KindResolve,
+	UnsupportedLockVersion:     KindResolve,
+	CheckSumMismatch:           KindResolve,
+	InvalidKpmHomeInCurrentPkg: KindResolve,
+	InvalidPkgRef:              KindResolve,
+	InvalidGitUrl:              KindResolve,
+	WithoutGitTag:              KindResolve,
+	LockFileChanged:            KindResolve,
+	InvalidImportAlias:         KindResolve,
+	RegistryNotAllowed:         KindResolve,
+	ConflictPkgName:            KindResolve,
+	AddItselfAsDep:             KindResolve,
+	DependencyNotFound:         KindResolve,
+	KclModNotFound:             KindResolve,
+	FailedParseVersion:         KindResolve,
+	DependencyRejected:         KindResolve,
+	PlatformNotMatched:         KindResolve,
+	FailedResolveImport:        KindResolve,
+	LicenseNotAllowed:          KindResolve,
+	PluginNotMatched:           KindResolve,
+
+	CompileFailed:         KindCompile,
+	InvalidOutput:         KindCompile,
+	FailedConvertResult:   KindCompile,
+	UnsupportedFeature:    KindCompile,
+	InvalidOutputTemplate: KindCompile,
+	InvalidRedactPath:     KindCompile,
+	DisabledBuiltin:       KindCompile,
+
+	FailedLoadSettings:     KindIO,
+	FailedLoadCredential:   KindIO,
+	FailedCreateStorePath:  KindIO,
+	FailedAccessPkgPath:    KindIO,
+	FailedUntarKclPkg:      KindIO,
+	FailedCreateFile:       KindIO,
+	FailedPackage:          KindIO,
+	FileExists:             KindIO,
+	CalSumFailed:           KindIO,
+	FailedHashPkg:          KindIO,
+	FailedLoadSchema:       KindIO,
+	FailedLoadEnvFile:      KindIO,
+	FileAccessDenied:       KindIO,
+	LocalPathNotExist:      KindIO,
+	PathIsEmpty:            KindIO,
+	PathCaseMismatch:       KindIO,
+	FailedLoadDiffBase:     KindIO,
+	FailedLoadDefaults:     KindIO,
+	FailedExportCache:      KindIO,
+	FailedImportCache:      KindIO,
+	SymlinkNotAllowed:      KindIO,
+	FailedLoadOverrideFile: KindIO,
+
+	FailedNewOciClient:    KindNetwork,
+	FailedCreateOciClient: KindNetwork,
+	FailedPush:            KindNetwork,
+	FailedLogin:           KindNetwork,
+	FailedLogout:          KindNetwork,
+	FailedCloneFromGit:    KindNetwork,
+}
+
+// Kind returns the error kind of the event.
+func (e *KpmEvent) Kind() ErrorKind {
+	if kind, ok := eventKinds[e.errType]; ok {
+		return kind
+	}
+	return KindUnknown
+}
+
+// GetErrorKind returns the error kind of 'err'.
+// The errors wrapped by kpm events are checked, and the kind of the innermost known event is returned,
+// because it is closer to the cause, e.g. a resolution failure reported as a compile failure is of 'KindResolve'.
+// The failures of the network requests are of 'KindNetwork', even if they are wrapped by the events of other kinds,
+// e.g. pulling from an unreachable registry reported by 'FailedGetPkg'.
+func GetErrorKind(err error) ErrorKind {
+	if err == nil {
+		return KindNone
+	}
+
+	var event *KpmEvent
+	if errors.As(err, &event) && event == nil {
+		// The nil event returned as an error.
+		return KindNone
+	}
+
+	var netErr net.Error
+	var urlErr *url.Error
+	if errors.As(err, &netErr) || errors.As(err, &urlErr) {
+		return KindNetwork
+	}
+
+	kind := KindUnknown
+	for err != nil {
+		var event *KpmEvent
+		if !errors.As(err, &event) || event == nil {
+			break
+		}
+		if k := event.Kind(); k != KindUnknown {
+			kind = k
+		}
+		err = event.err
+	}
+	return kind
+}
@@ -0,0 +1,50 @@
+package reporter
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetErrorKind(t *testing.T) {
+	assert.Equal(t, GetErrorKind(nil), KindNone)
+	assert.Equal(t, GetErrorKind((*KpmEvent)(nil)), KindNone)
+	assert.Equal(t, GetErrorKind(errors.New("unknown")), KindUnknown)
+	assert.Equal(t, GetErrorKind(NewErrorEvent(Bug, errors.New("bug"))), KindUnknown)
+	assert.Equal(t, GetErrorKind(NewErrorEvent(CompileFailed, errors.New("compile error"))), KindCompile)
+	assert.Equal(t, GetErrorKind(NewErrorEvent(FailedCreateFile, errors.New("permission denied"))), KindIO)
+
+	// The innermost known kind is returned.
+	resolveErr := NewErrorEvent(CompileFailed, NewErrorEvent(DependencyNotFound, errors.New("not found")))
+	assert.Equal(t, GetErrorKind(resolveErr), KindResolve)
+	networkErr := fmt.Errorf("wrapped: %w", NewErrorEvent(FailedGetPkg, NewErrorEvent(FailedCloneFromGit, errors.New("timeout"))))
+	assert.Equal(t, GetErrorKind(networkErr), KindNetwork)
+	assert.Equal(t, GetErrorKind(NewErrorEvent(FailedVendor, NewErrorEvent(Bug, errors.New("bug")))), KindResolve)
+}
+
+func TestGetErrorKindOfUnreachableRegistry(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Equal(t, err, nil)
+	addr := listener.Addr().String()
+	assert.Equal(t, listener.Close(), nil)
+
+	_, err = http.Get("http://" + addr + "/v2/")
+	assert.NotEqual(t, err, nil)
+	pullErr := NewErrorEvent(FailedGetPkg, err, fmt.Sprintf("failed to get package from '%s'", addr))
+	assert.Equal(t, GetErrorKind(pullErr), KindNetwork)
+	assert.Equal(t, GetErrorKind(NewErrorEvent(CompileFailed, pullErr)), KindNetwork)
+}
+
+func TestErrorKindExitCode(t *testing.T) {
+	assert.Equal(t, KindNone.ExitCode(), 0)
+	assert.Equal(t, KindUnknown.ExitCode(), 1)
+	assert.Equal(t, KindCompile.ExitCode(), 2)
+	assert.Equal(t, KindResolve.ExitCode(), 3)
+	assert.Equal(t, KindIO.ExitCode(), 4)
+	assert.Equal(t, KindNetwork.ExitCode(), 5)
+	assert.Equal(t, KindNetwork.String(), "network")
+}
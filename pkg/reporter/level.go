@@ -0,0 +1,55 @@
+package reporter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LogLevel is the level of detail of the logs written to the log writer.
+type LogLevel int
+
+const (
+	// ErrorLevel writes no logs, the errors are returned to the caller.
+	ErrorLevel LogLevel = iota + 1
+	// WarnLevel writes the warnings, e.g. the deprecated dependencies.
+	WarnLevel
+	// InfoLevel writes the progress, e.g. downloading the dependencies, it is the default level.
+	InfoLevel
+	// DebugLevel writes the details to diagnose the resolution, e.g. how each dependency is resolved, the cache hits and the checksums.
+	DebugLevel
+)
+
+// logLevelNames is the names of the log levels.
+var logLevelNames = map[LogLevel]string{
+	ErrorLevel: "error",
+	WarnLevel:  "warn",
+	InfoLevel:  "info",
+	DebugLevel: "debug",
+}
+
+// String returns the name of the log level.
+func (l LogLevel) String() string {
+	if name, ok := logLevelNames[l]; ok {
+		return name
+	}
+	return logLevelNames[InfoLevel]
+}
+
+// Enabled will check whether the logs at 'level' are written under the log level 'l'.
+// The zero value of the log level is 'InfoLevel'.
+func (l LogLevel) Enabled(level LogLevel) bool {
+	if l == 0 {
+		l = InfoLevel
+	}
+	return level <= l
+}
+
+// ParseLogLevel returns the log level named 'name', e.g. 'debug'.
+func ParseLogLevel(name string) (LogLevel, error) {
+	for level, levelName := range logLevelNames {
+		if strings.EqualFold(name, levelName) {
+			return level, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid log level '%s', expected one of 'error', 'warn', 'info' and 'debug'", name)
+}
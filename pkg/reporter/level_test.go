@@ -0,0 +1,23 @@
+package reporter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogLevel(t *testing.T) {
+	assert.Equal(t, LogLevel(0).Enabled(InfoLevel), true)
+	assert.Equal(t, LogLevel(0).Enabled(DebugLevel), false)
+	assert.Equal(t, WarnLevel.Enabled(WarnLevel), true)
+	assert.Equal(t, WarnLevel.Enabled(InfoLevel), false)
+	assert.Equal(t, ErrorLevel.Enabled(WarnLevel), false)
+	assert.Equal(t, DebugLevel.Enabled(InfoLevel), true)
+	assert.Equal(t, DebugLevel.String(), "debug")
+
+	level, err := ParseLogLevel("WARN")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, level, WarnLevel)
+	_, err = ParseLogLevel("trace")
+	assert.Equal(t, err.Error(), "invalid log level 'trace', expected one of 'error', 'warn', 'info' and 'debug'")
+}
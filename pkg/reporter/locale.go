@@ -0,0 +1,207 @@
+package reporter
+
+import (
+	"errors"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/text/language"
+)
+
+// Catalog is the translations of the kpm messages in a language.
+// The keys are the English messages in which '%s' is the placeholder of an argument, e.g. "failed to pull '%s' from '%s' and its mirrors",
+// and the values are the translations with the same placeholders in the same order.
+type Catalog map[string]string
+
+// EnglishCatalog is the catalog of the messages which can be translated, it is also the reference for the other catalogs.
+var EnglishCatalog = Catalog{
+	"adding dependency '%s'":                                         "adding dependency '%s'",
+	"downloading '%s:%s' from '%s/%s:%s'":                            "downloading '%s:%s' from '%s/%s:%s'",
+	"pulling '%s:%s' from '%s'":                                      "pulling '%s:%s' from '%s'",
+	"pulled '%s' in '%s' successfully":                               "pulled '%s' in '%s' successfully",
+	"pulled '%s' from the mirror '%s'":                               "pulled '%s' from the mirror '%s'",
+	"start to pull '%s'":                                             "start to pull '%s'",
+	"start to pull '%s' with tag '%s'":                               "start to pull '%s' with tag '%s'",
+	"removing '%s' with version '%s'":                                "removing '%s' with version '%s'",
+	"warning: %s":                                                    "warning: %s",
+	"the dependency '%s' is deprecated: %s":                          "the dependency '%s' is deprecated: %s",
+	"the dependency '%s' comes from a registry which is not allowed": "the dependency '%s' comes from a registry which is not allowed",
+	"failed to pull '%s' from '%s', trying the mirror '%s'":          "failed to pull '%s' from '%s', trying the mirror '%s'",
+	"failed to pull '%s' from '%s' and its mirrors":                  "failed to pull '%s' from '%s' and its mirrors",
+	"failed to clone from '%s' into '%s'.":                           "failed to clone from '%s' into '%s'.",
+	"failed to resolve the credential '%s' for '%s'":                 "failed to resolve the credential '%s' for '%s'",
+	"failed to download the dependencies":                            "failed to download the dependencies",
+	"failed to compile the kcl package":                              "failed to compile the kcl package",
+	"the origin of '%s' is '%s'":                                     "the origin of '%s' is '%s'",
+	"could not load 'kcl.mod' in '%s'":                               "could not load 'kcl.mod' in '%s'",
+}
+
+var (
+	catalogsMu sync.RWMutex
+	// catalogTags is the languages of the registered catalogs in the order of registration.
+	catalogTags = []language.Tag{language.English}
+	catalogs    = map[language.Tag]Catalog{language.English: EnglishCatalog}
+	// templatePatterns is the compiled patterns of the messages in the catalogs.
+	templatePatterns = map[string]*regexp.Regexp{}
+)
+
+// RegisterCatalog will register the catalog of the messages in the language 'tag'.
+// The catalog registered before for 'tag' is replaced.
+func RegisterCatalog(tag language.Tag, catalog Catalog) {
+	catalogsMu.Lock()
+	defer catalogsMu.Unlock()
+	if _, ok := catalogs[tag]; !ok {
+		catalogTags = append(catalogTags, tag)
+	}
+	catalogs[tag] = catalog
+}
+
+// lookupCatalog returns the catalog which matches the language 'tag' best,
+// nil is returned if no catalog matches or the English catalog matches.
+func lookupCatalog(tag language.Tag) Catalog {
+	if tag == language.Und {
+		return nil
+	}
+	catalogsMu.RLock()
+	defer catalogsMu.RUnlock()
+	_, index, confidence := language.NewMatcher(catalogTags).Match(tag)
+	if confidence == language.No || catalogTags[index] == language.English {
+		return nil
+	}
+	return catalogs[catalogTags[index]]
+}
+
+// Localize returns the message 'msg' translated into the language 'tag'.
+// Each line of the message is translated by the catalog registered for the language,
+// and the lines without translations are kept as they are, e.g. the messages of the kcl compiler.
+func Localize(msg string, tag language.Tag) string {
+	catalog := lookupCatalog(tag)
+	if catalog == nil {
+		return msg
+	}
+	lines := strings.Split(msg, "\n")
+	for i, line := range lines {
+		lines[i] = localizeLine(line, catalog)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// localizeLine returns the line translated by the catalog, the line is returned as is if it matches no message in the catalog.
+func localizeLine(line string, catalog Catalog) string {
+	if len(line) == 0 {
+		return line
+	}
+	if translation, ok := catalog[line]; ok {
+		return translation
+	}
+	// The templates with more literal text are more specific, e.g. "start to pull '%s' with tag '%s'" is tried before "start to pull '%s'".
+	templates := make([]string, 0, len(catalog))
+	for template := range catalog {
+		if strings.Contains(template, "%s") {
+			templates = append(templates, template)
+		}
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		li, lj := len(strings.ReplaceAll(templates[i], "%s", "")), len(strings.ReplaceAll(templates[j], "%s", ""))
+		if li != lj {
+			return li > lj
+		}
+		return templates[i] < templates[j]
+	})
+	for _, template := range templates {
+		translation := catalog[template]
+		matches := templatePattern(template).FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+		parts := strings.Split(translation, "%s")
+		var sb strings.Builder
+		for i, part := range parts {
+			sb.WriteString(part)
+			if i+1 < len(parts) && i+1 < len(matches) {
+				sb.WriteString(matches[i+1])
+			}
+		}
+		return sb.String()
+	}
+	return line
+}
+
+// templatePattern returns the pattern matching the messages of the template, in which each '%s' matches an argument.
+func templatePattern(template string) *regexp.Regexp {
+	catalogsMu.RLock()
+	pattern, ok := templatePatterns[template]
+	catalogsMu.RUnlock()
+	if ok {
+		return pattern
+	}
+
+	parts := strings.Split(template, "%s")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	pattern = regexp.MustCompile("^" + strings.Join(parts, "(.*)") + "$")
+
+	catalogsMu.Lock()
+	templatePatterns[template] = pattern
+	catalogsMu.Unlock()
+	return pattern
+}
+
+// localizedWriter translates the messages written into the writer.
+type localizedWriter struct {
+	w       io.Writer
+	catalog Catalog
+}
+
+// NewLocalizedWriter returns the writer which translates the messages written into 'w' into the language 'tag'.
+// 'w' is returned as is if it is nil or there is no catalog for the language.
+func NewLocalizedWriter(w io.Writer, tag language.Tag) io.Writer {
+	if w == nil {
+		return nil
+	}
+	catalog := lookupCatalog(tag)
+	if catalog == nil {
+		return w
+	}
+	return &localizedWriter{w: w, catalog: catalog}
+}
+
+// Write translates the lines in 'p' and writes them into the underlying writer.
+func (w *localizedWriter) Write(p []byte) (int, error) {
+	lines := strings.Split(string(p), "\n")
+	for i, line := range lines {
+		lines[i] = localizeLine(line, w.catalog)
+	}
+	if _, err := io.WriteString(w.w, strings.Join(lines, "\n")); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// NewLocalizedFormattedError returns the error 'err' with the message rendered by 'formatter'
+// from its diagnostics translated into the language 'tag'.
+// The message is rendered by 'TextErrorFormatter' if 'formatter' is nil and there is a catalog for the language.
+func NewLocalizedFormattedError(err error, formatter ErrorFormatter, tag language.Tag) error {
+	catalog := lookupCatalog(tag)
+	if err == nil || catalog == nil {
+		return NewFormattedError(err, formatter)
+	}
+	var event *KpmEvent
+	if errors.As(err, &event) && event == nil {
+		return err
+	}
+	if formatter == nil {
+		formatter = TextErrorFormatter
+	}
+
+	diagnostics := NewDiagnostics(err)
+	for i := range diagnostics {
+		diagnostics[i].Message = Localize(diagnostics[i].Message, tag)
+		diagnostics[i].Detail = Localize(diagnostics[i].Detail, tag)
+	}
+	return &FormattedError{err: err, msg: formatter(diagnostics)}
+}
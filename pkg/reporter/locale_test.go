@@ -0,0 +1,38 @@
+package reporter
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/language"
+)
+
+func TestLocalize(t *testing.T) {
+	RegisterCatalog(language.German, Catalog{
+		"failed to compile the kcl package":   "das kcl-Paket konnte nicht kompiliert werden",
+		"start to pull '%s'":                  "'%s' wird abgerufen",
+		"start to pull '%s' with tag '%s'":    "'%s' mit dem Tag '%s' wird abgerufen",
+		"failed to download the dependencies": "die Abhängigkeiten konnten nicht heruntergeladen werden",
+	})
+
+	assert.Equal(t, Localize("start to pull 'k8s'", language.German), "'k8s' wird abgerufen")
+	assert.Equal(t, Localize("start to pull 'k8s' with tag '1.28'", language.MustParse("de-AT")), "'k8s' mit dem Tag '1.28' wird abgerufen")
+	assert.Equal(t, Localize("start to pull 'k8s'\nunknown message", language.German), "'k8s' wird abgerufen\nunknown message")
+	assert.Equal(t, Localize("start to pull 'k8s'", language.English), "start to pull 'k8s'")
+	assert.Equal(t, Localize("start to pull 'k8s'", language.Japanese), "start to pull 'k8s'")
+	assert.Equal(t, Localize("start to pull 'k8s'", language.Und), "start to pull 'k8s'")
+
+	var buf bytes.Buffer
+	w := NewLocalizedWriter(&buf, language.German)
+	ReportMsgTo("start to pull 'k8s'", w)
+	assert.Equal(t, buf.String(), "'k8s' wird abgerufen\n")
+	assert.Equal(t, NewLocalizedWriter(&buf, language.English), &buf)
+
+	err := NewErrorEvent(CompileFailed, errors.New("error[E2G22]: TypeError"), "failed to compile the kcl package")
+	localized := NewLocalizedFormattedError(err, nil, language.German)
+	assert.Equal(t, localized.Error(), "das kcl-Paket konnte nicht kompiliert werden\nerror[E2G22]: TypeError\n")
+	assert.True(t, errors.Is(localized, err))
+	assert.Equal(t, NewLocalizedFormattedError(err, nil, language.English), err)
+}
@@ -108,6 +108,35 @@ const (
 	KclModNotFound
 	CompileFailed
 	FailedParseVersion
+	DependencyDeprecated
+
+	// the event types added later are appended here to keep the values of the existing ones.
+	UnsupportedSBOMFormat
+	LockFileChanged
+	InvalidImportAlias
+	FailedConvertResult
+	FailedLoadSchema
+	InvalidOutput
+	FailedLoadEnvFile
+	RegistryNotAllowed
+	FileAccessDenied
+	UnsupportedFeature
+	DependencyRejected
+	PlatformNotMatched
+	PathCaseMismatch
+	FailedResolveImport
+	LicenseNotAllowed
+	PluginNotMatched
+	FailedLoadDiffBase
+	InvalidOutputTemplate
+	InvalidRedactPath
+	FailedLoadDefaults
+	UnsupportedLockVersion
+	DisabledBuiltin
+	FailedExportCache
+	FailedImportCache
+	SymlinkNotAllowed
+	FailedLoadOverrideFile
 )
 
 // KpmEvent is the event used to show kpm logs to users.
@@ -135,6 +164,11 @@ func (e *KpmEvent) Error() string {
 	return result
 }
 
+// Unwrap returns the error wrapped by the event.
+func (e *KpmEvent) Unwrap() error {
+	return e.err
+}
+
 // Event returns the msg of the event without error message.
 func (e *KpmEvent) Event() string {
 	if e.msg != "" {
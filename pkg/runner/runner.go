@@ -2,14 +2,23 @@ package runner
 
 import (
 	"fmt"
+	"strings"
 
 	"kcl-lang.io/kcl-go/pkg/kcl"
 	"kcl-lang.io/kpm/pkg/opt"
+	"kcl-lang.io/kpm/pkg/reporter"
 )
 
 // The pattern of the external package argument.
 const EXTERNAL_PKGS_ARG_PATTERN = "%s=%s"
 
+// recursionErrorMessages are the messages of the errors reported by the kcl compiler when the recursion is too deep.
+var recursionErrorMessages = []string{
+	"maximum recursion depth exceeded",
+	"RecursionError",
+	"stack overflow",
+}
+
 // Compiler is a wrapper of kcl compiler.
 type Compiler struct {
 	opts *opt.CompileOptions
@@ -46,7 +55,69 @@ func (compiler *Compiler) AddDepPath(depName string, depPath string) *Compiler {
 	return compiler
 }
 
+// KFilenames will return the kcl files compiled by the compiler.
+func (compiler *Compiler) KFilenames() []string {
+	return compiler.opts.KFilenameList
+}
+
+// ImportAliases will return the import aliases of the compiler.
+func (compiler *Compiler) ImportAliases() map[string]string {
+	return compiler.opts.ImportAliases()
+}
+
 // Call KCL Compiler and return the result.
 func (compiler *Compiler) Run() (*kcl.KCLResultList, error) {
-	return kcl.RunWithOpts(*compiler.opts.Option)
+	if compiler.opts.PreserveComments() {
+		return nil, reporter.NewErrorEvent(
+			reporter.UnsupportedFeature,
+			fmt.Errorf("preserving the comments in the output is not supported by the kcl compiler"),
+			"compile without preserving the comments",
+		)
+	}
+
+	if seed, ok := compiler.opts.RandSeed(); ok {
+		return nil, reporter.NewErrorEvent(
+			reporter.UnsupportedFeature,
+			fmt.Errorf("seeding the random number generator with %d is not supported by the kcl compiler", seed),
+			"compile without the random seed",
+		)
+	}
+
+	maxDepth := compiler.opts.MaxRecursionDepth()
+	if maxDepth > 0 && compiler.opts.LogLevel().Enabled(reporter.WarnLevel) {
+		// The kcl compiler does not take the maximum recursion depth yet, so it is only used to report the recursion errors.
+		reporter.ReportMsgTo(
+			fmt.Sprintf("WARNING: the maximum recursion depth %d is not supported by the kcl compiler and only reported on the recursion errors", maxDepth),
+			compiler.opts.LogWriter(),
+		)
+	}
+
+	if threshold := compiler.opts.MmapThreshold(); threshold > 0 {
+		// The files are read by the file functions of the kcl compiler, which does not memory-map them yet.
+		return nil, reporter.NewErrorEvent(
+			reporter.UnsupportedFeature,
+			fmt.Errorf("memory-mapping the files of at least %d bytes is not supported by the kcl compiler", threshold),
+			"compile without the mmap threshold",
+		)
+	}
+
+	result, err := kcl.RunWithOpts(*compiler.opts.Option)
+	if err != nil && maxDepth > 0 && IsRecursionError(err) {
+		return nil, reporter.NewErrorEvent(
+			reporter.CompileFailed,
+			err,
+			fmt.Sprintf("the compilation exceeds the maximum recursion depth %d, check the self-referential schemas", maxDepth),
+		)
+	}
+	return result, err
+}
+
+// IsRecursionError returns true if the error is reported by the kcl compiler because the recursion is too deep.
+func IsRecursionError(err error) bool {
+	for _, msg := range recursionErrorMessages {
+		if strings.Contains(err.Error(), msg) {
+			return true
+		}
+	}
+	return false
 }
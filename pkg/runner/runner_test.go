@@ -1,11 +1,14 @@
 package runner
 
 import (
+	"errors"
 	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"kcl-lang.io/kcl-go/pkg/kcl"
+	"kcl-lang.io/kpm/pkg/opt"
+	"kcl-lang.io/kpm/pkg/reporter"
 )
 
 func TestKclRun(t *testing.T) {
@@ -21,3 +24,42 @@ func TestKclRun(t *testing.T) {
 	assert.Equal(t, "[{\"a\": \"Hello External World!\", \"a1\": \"Hello External_1 World!\"}]", result.GetRawJsonResult())
 	assert.Equal(t, "a: Hello External World!\na1: Hello External_1 World!", result.GetRawYamlResult())
 }
+
+func TestIsRecursionError(t *testing.T) {
+	assert.True(t, IsRecursionError(errors.New("RecursionError: maximum recursion depth exceeded")))
+	assert.True(t, IsRecursionError(errors.New("thread 'main' has overflowed its stack\nfatal runtime error: stack overflow")))
+	assert.False(t, IsRecursionError(errors.New("EvaluationError: attribute 'a' not found")))
+}
+
+func TestRunWithPreserveComments(t *testing.T) {
+	opts := opt.DefaultCompileOptions()
+	opts.Merge(kcl.WithKFilenames("./testdata/import_external.k"))
+	opt.WithPreserveComments(true)(opts)
+
+	_, err := NewCompilerWithOpts(opts).Run()
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "preserving the comments in the output is not supported by the kcl compiler")
+	assert.Equal(t, reporter.GetErrorKind(err), reporter.KindCompile)
+}
+
+func TestRunWithMmapThreshold(t *testing.T) {
+	opts := opt.DefaultCompileOptions()
+	opts.Merge(kcl.WithKFilenames("./testdata/import_external.k"))
+	opt.WithMmapThreshold(1 << 20)(opts)
+
+	_, err := NewCompilerWithOpts(opts).Run()
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "memory-mapping the files of at least 1048576 bytes is not supported by the kcl compiler")
+	assert.Equal(t, reporter.GetErrorKind(err), reporter.KindCompile)
+}
+
+func TestRunWithRandSeed(t *testing.T) {
+	opts := opt.DefaultCompileOptions()
+	opts.Merge(kcl.WithKFilenames("./testdata/import_external.k"))
+	opt.WithRandSeed(0)(opts)
+
+	_, err := NewCompilerWithOpts(opts).Run()
+	assert.NotEqual(t, err, nil)
+	assert.Contains(t, err.Error(), "seeding the random number generator with 0 is not supported by the kcl compiler")
+	assert.Equal(t, reporter.GetErrorKind(err), reporter.KindCompile)
+}
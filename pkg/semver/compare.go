@@ -0,0 +1,156 @@
+package semver
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"kcl-lang.io/kpm/pkg/reporter"
+)
+
+const (
+	// PrereleaseBump means only the pre-release of the version is changed.
+	PrereleaseBump BumpKind = "prerelease"
+	// NoBump means the versions have the same precedence.
+	NoBump BumpKind = ""
+)
+
+// Relation is the relation between two versions compared by 'CompareVersions'.
+type Relation struct {
+	// Order is -1, 0 or 1 if the first version has lower, the same or higher precedence than the second one.
+	Order int
+	// Bump is the most significant part changed between the two versions.
+	Bump BumpKind
+	// Compatible is whether changing from the first version to the second one is backward compatible by semver rules,
+	// which means the second version is not older, has the same major version which is not 0,
+	// and is not a pre-release unless the versions have the same precedence.
+	Compatible bool
+}
+
+// semverPattern is the regular expression of the semantic version 2.0.0, with an optional 'v' prefix.
+var semverPattern = regexp.MustCompile(`^v?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)` +
+	`(?:-((?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*)(?:\.(?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*))*))?` +
+	`(?:\+([0-9a-zA-Z-]+(?:\.[0-9a-zA-Z-]+)*))?$`)
+
+// semanticVersion is the parsed semantic version, the build metadata is dropped because it does not affect the precedence.
+type semanticVersion struct {
+	core       [3]uint64
+	prerelease []string
+}
+
+// parseSemanticVersion parses the semantic version 'v' strictly by semver 2.0.0.
+func parseSemanticVersion(v string) (*semanticVersion, error) {
+	matches := semverPattern.FindStringSubmatch(v)
+	if matches == nil {
+		return nil, reporter.NewErrorEvent(reporter.FailedParseVersion, fmt.Errorf("'%s' is not a semantic version", v), fmt.Sprintf("failed to parse version %s", v))
+	}
+
+	ver := &semanticVersion{}
+	for i := 0; i < 3; i++ {
+		n, err := strconv.ParseUint(matches[i+1], 10, 64)
+		if err != nil {
+			return nil, reporter.NewErrorEvent(reporter.FailedParseVersion, err, fmt.Sprintf("failed to parse version %s", v))
+		}
+		ver.core[i] = n
+	}
+	if len(matches[4]) != 0 {
+		ver.prerelease = strings.Split(matches[4], ".")
+	}
+	return ver, nil
+}
+
+// CompareVersions compares the version 'a' and the version 'b' by the precedence of semver 2.0.0,
+// and returns whether changing the version from 'a' to 'b' is a major, minor, patch or pre-release change,
+// and whether the change is backward compatible.
+func CompareVersions(a, b string) (Relation, error) {
+	verA, err := parseSemanticVersion(a)
+	if err != nil {
+		return Relation{}, err
+	}
+	verB, err := parseSemanticVersion(b)
+	if err != nil {
+		return Relation{}, err
+	}
+
+	relation := Relation{Order: compareSemanticVersions(verA, verB)}
+	switch {
+	case verA.core[0] != verB.core[0]:
+		relation.Bump = MajorBump
+	case verA.core[1] != verB.core[1]:
+		relation.Bump = MinorBump
+	case verA.core[2] != verB.core[2]:
+		relation.Bump = PatchBump
+	case relation.Order != 0:
+		relation.Bump = PrereleaseBump
+	default:
+		relation.Bump = NoBump
+	}
+
+	relation.Compatible = relation.Order == 0 ||
+		(relation.Order < 0 && verA.core[0] == verB.core[0] && verB.core[0] != 0 && len(verB.prerelease) == 0)
+	return relation, nil
+}
+
+// compareSemanticVersions returns -1, 0 or 1 if 'a' has lower, the same or higher precedence than 'b'.
+func compareSemanticVersions(a, b *semanticVersion) int {
+	for i := 0; i < 3; i++ {
+		if a.core[i] != b.core[i] {
+			if a.core[i] < b.core[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	// A version without pre-release has higher precedence than the one with pre-release.
+	if len(a.prerelease) == 0 || len(b.prerelease) == 0 {
+		switch {
+		case len(a.prerelease) == len(b.prerelease):
+			return 0
+		case len(a.prerelease) == 0:
+			return 1
+		default:
+			return -1
+		}
+	}
+
+	for i := 0; i < len(a.prerelease) && i < len(b.prerelease); i++ {
+		if c := comparePrereleaseIdentifiers(a.prerelease[i], b.prerelease[i]); c != 0 {
+			return c
+		}
+	}
+	// A larger set of pre-release fields has higher precedence if all the preceding identifiers are equal.
+	switch {
+	case len(a.prerelease) < len(b.prerelease):
+		return -1
+	case len(a.prerelease) > len(b.prerelease):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// comparePrereleaseIdentifiers compares two pre-release identifiers,
+// the numeric identifiers are compared numerically and have lower precedence than the alphanumeric ones,
+// which are compared lexically in ASCII sort order.
+func comparePrereleaseIdentifiers(a, b string) int {
+	numA, errA := strconv.ParseUint(a, 10, 64)
+	numB, errB := strconv.ParseUint(b, 10, 64)
+	switch {
+	case errA == nil && errB == nil:
+		if numA == numB {
+			return 0
+		}
+		if numA < numB {
+			return -1
+		}
+		return 1
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	default:
+		return strings.Compare(a, b)
+	}
+}
@@ -26,3 +26,60 @@ func LatestVersion(versions []string) (string, error) {
 
 	return latest.Original(), nil
 }
+
+// BumpKind is the kind of the version bump.
+type BumpKind string
+
+const (
+	MajorBump BumpKind = "major"
+	MinorBump BumpKind = "minor"
+	PatchBump BumpKind = "patch"
+)
+
+// LatestCompatibleVersion returns the latest version in 'versions' which is newer than and compatible with 'current'.
+// The versions with the same major version are compatible, if 'allowMajor' is true, all the versions are compatible.
+// The versions which can not be parsed and the pre-release versions are skipped.
+// If there is no newer compatible version, 'current' will be returned.
+func LatestCompatibleVersion(current string, versions []string, allowMajor bool) (string, error) {
+	currentVer, err := version.NewVersion(current)
+	if err != nil {
+		return "", reporter.NewErrorEvent(reporter.FailedParseVersion, err, fmt.Sprintf("failed to parse version %s", current))
+	}
+
+	latest := currentVer
+	for _, v := range versions {
+		ver, err := version.NewVersion(v)
+		if err != nil || len(ver.Prerelease()) != 0 {
+			continue
+		}
+		if !allowMajor && ver.Segments()[0] != currentVer.Segments()[0] {
+			continue
+		}
+		if ver.GreaterThan(latest) {
+			latest = ver
+		}
+	}
+
+	return latest.Original(), nil
+}
+
+// GetBumpKind returns the kind of the version bump from version 'from' to version 'to'.
+func GetBumpKind(from, to string) (BumpKind, error) {
+	fromVer, err := version.NewVersion(from)
+	if err != nil {
+		return "", reporter.NewErrorEvent(reporter.FailedParseVersion, err, fmt.Sprintf("failed to parse version %s", from))
+	}
+	toVer, err := version.NewVersion(to)
+	if err != nil {
+		return "", reporter.NewErrorEvent(reporter.FailedParseVersion, err, fmt.Sprintf("failed to parse version %s", to))
+	}
+
+	fromSegments, toSegments := fromVer.Segments(), toVer.Segments()
+	if fromSegments[0] != toSegments[0] {
+		return MajorBump, nil
+	}
+	if fromSegments[1] != toSegments[1] {
+		return MinorBump, nil
+	}
+	return PatchBump, nil
+}
@@ -38,3 +38,75 @@ func TestTheLatestTagWithMissingVersion(t *testing.T) {
 	assert.Equal(t, err, nil)
 	assert.Equal(t, latest, "5.5")
 }
+
+func TestLatestCompatibleVersion(t *testing.T) {
+	versions := []string{"1.2.3", "1.4.0", "1.5.0-rc.1", "2.0.0", "latest"}
+
+	latest, err := LatestCompatibleVersion("1.2.0", versions, false)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, latest, "1.4.0")
+
+	latest, err = LatestCompatibleVersion("1.2.0", versions, true)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, latest, "2.0.0")
+
+	latest, err = LatestCompatibleVersion("2.0.0", versions, false)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, latest, "2.0.0")
+
+	_, err = LatestCompatibleVersion("invalid_version", versions, false)
+	assert.Equal(t, err.Error(), "failed to parse version invalid_version\nMalformed version: invalid_version\n")
+}
+
+func TestGetBumpKind(t *testing.T) {
+	kind, err := GetBumpKind("1.2.3", "2.0.0")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, kind, MajorBump)
+
+	kind, err = GetBumpKind("1.2.3", "1.4.0")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, kind, MinorBump)
+
+	kind, err = GetBumpKind("1.2", "1.2.1")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, kind, PatchBump)
+}
+
+func TestCompareVersions(t *testing.T) {
+	testCases := []struct {
+		a, b     string
+		expected Relation
+	}{
+		{"1.2.3", "1.2.3", Relation{Order: 0, Bump: NoBump, Compatible: true}},
+		{"1.2.3", "1.2.4", Relation{Order: -1, Bump: PatchBump, Compatible: true}},
+		{"1.2.3", "1.3.0", Relation{Order: -1, Bump: MinorBump, Compatible: true}},
+		{"1.2.3", "2.0.0", Relation{Order: -1, Bump: MajorBump, Compatible: false}},
+		{"1.3.0", "1.2.3", Relation{Order: 1, Bump: MinorBump, Compatible: false}},
+		{"0.1.0", "0.1.1", Relation{Order: -1, Bump: PatchBump, Compatible: false}},
+		{"1.2.3", "1.3.0-alpha", Relation{Order: -1, Bump: MinorBump, Compatible: false}},
+		{"1.0.0-alpha", "1.0.0", Relation{Order: -1, Bump: PrereleaseBump, Compatible: true}},
+		{"1.0.0", "1.0.1-rc.1", Relation{Order: -1, Bump: PatchBump, Compatible: false}},
+		{"1.0.0+build.1", "v1.0.0+build.2", Relation{Order: 0, Bump: NoBump, Compatible: true}},
+	}
+	for _, tc := range testCases {
+		relation, err := CompareVersions(tc.a, tc.b)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, relation, tc.expected)
+	}
+
+	// The precedence example in semver 2.0.0.
+	ordered := []string{"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta", "1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0"}
+	for i := 0; i+1 < len(ordered); i++ {
+		relation, err := CompareVersions(ordered[i], ordered[i+1])
+		assert.NilError(t, err)
+		assert.Equal(t, relation.Order, -1)
+		relation, err = CompareVersions(ordered[i+1], ordered[i])
+		assert.NilError(t, err)
+		assert.Equal(t, relation.Order, 1)
+	}
+
+	for _, invalid := range []string{"1.2", "01.2.3", "1.2.3-01", "1.2.3-", "1.2.3+"} {
+		_, err := CompareVersions(invalid, "1.2.3")
+		assert.ErrorContains(t, err, "is not a semantic version")
+	}
+}
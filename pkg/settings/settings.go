@@ -76,6 +76,12 @@ func (settings *Settings) AcquirePackageCacheLock(logWriter io.Writer) error {
 		return errors.InternalBug
 	}
 
+	// the directory of the 'package-cache' file may be removed after the settings are loaded, e.g. by cleaning the cache.
+	err := os.MkdirAll(filepath.Dir(settings.PackageCacheLock.Path()), 0755)
+	if err != nil {
+		return err
+	}
+
 	// try to lock the 'package-cache' file
 	locked, err := settings.PackageCacheLock.TryLock()
 	if err != nil {
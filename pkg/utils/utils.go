@@ -10,8 +10,10 @@ import (
 	"log"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
 	goerrors "errors"
 
@@ -64,6 +66,21 @@ func HashDir(dir string) (string, error) {
 	return base64.StdEncoding.EncodeToString(hasher.Sum(nil)), nil
 }
 
+// DirSize returns the total size of the regular files in the directory 'dir' in bytes.
+func DirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
 // StoreToFile will store 'data' into toml file under 'filePath'.
 func StoreToFile(filePath string, dataStr string) error {
 	file, err := os.Create(filePath)
@@ -86,6 +103,39 @@ func StoreToFile(filePath string, dataStr string) error {
 	return nil
 }
 
+// StoreToFileAtomically will store 'data' into the file under 'filePath' atomically,
+// 'data' is written into a temporary file in the same directory, which is then renamed to 'filePath',
+// so that the file is never left partially written.
+func StoreToFileAtomically(filePath string, dataStr string) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(filePath); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(filePath), "."+filepath.Base(filePath)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmpFile.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := io.WriteString(tmpFile, dataStr); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, mode); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, filePath)
+}
+
 // ParseRepoNameFromGitUrl get the repo name from git url,
 // the repo name in 'https://github.com/xxx/kcl1.git' is 'kcl1'.
 func ParseRepoNameFromGitUrl(gitUrl string) string {
@@ -132,10 +182,23 @@ func TarDir(srcDir string, tarPath string) error {
 	}
 	defer fw.Close()
 
-	tw := tar.NewWriter(fw)
-	defer tw.Close()
+	ignorePatterns, err := LoadIgnoreFile(filepath.Join(srcDir, constants.KPM_IGNORE_FILE))
+	if err != nil {
+		return err
+	}
+
+	return TarDirToWriter(srcDir, fw, ignorePatterns)
+}
 
-	err = filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
+// TarDirToWriter will tar the directory 'srcDir' and write the tar to 'w'.
+// The files matching 'ignorePatterns' will not be included in the tar.
+// The tar entries are sorted by path and the metadata of entries are normalized,
+// so that the same directory always produces the same tar bytes.
+func TarDirToWriter(srcDir string, w io.Writer, ignorePatterns []string) error {
+	tw := tar.NewWriter(w)
+
+	// 'filepath.Walk' walks the files in lexical order, which keeps the order of the tar entries stable.
+	err := filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -149,11 +212,25 @@ func TarDir(srcDir string, tarPath string) error {
 		relPath, _ := filepath.Rel(srcDir, path)
 		relPath = filepath.ToSlash(relPath)
 
-		hdr, err := tar.FileInfoHeader(info, "")
+		if MatchIgnorePatterns(relPath, info.IsDir(), ignorePatterns) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			link, err = os.Readlink(path)
+			if err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
 		if err != nil {
 			return err
 		}
-		hdr.Name = relPath
+		normalizeTarHeader(hdr, relPath, info)
 
 		if err := tw.WriteHeader(hdr); err != nil {
 			return err
@@ -176,11 +253,94 @@ func TarDir(srcDir string, tarPath string) error {
 		return nil
 	})
 
-	return err
+	if err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
+// normalizeTarHeader will normalize the metadata of the tar header to make the tar reproducible.
+// The timestamps are zeroed, the owners are dropped,
+// and the permissions are fixed to 0755 for directories and executable files, and 0644 for other files.
+func normalizeTarHeader(hdr *tar.Header, relPath string, info os.FileInfo) {
+	hdr.Name = relPath
+	hdr.ModTime = time.Unix(0, 0)
+	hdr.AccessTime = time.Time{}
+	hdr.ChangeTime = time.Time{}
+	hdr.Uid = 0
+	hdr.Gid = 0
+	hdr.Uname = ""
+	hdr.Gname = ""
+	hdr.Format = tar.FormatPAX
+
+	if info.IsDir() || info.Mode().Perm()&0111 != 0 {
+		hdr.Mode = 0755
+	} else {
+		hdr.Mode = 0644
+	}
 }
 
-// UnTarDir will extract tar from 'tarPath' to 'destDir'.
+// LoadIgnoreFile will load the ignore patterns from the ignore file, e.g. '.kpmignore'.
+// The empty lines and the lines starting with '#' are skipped.
+// If the ignore file does not exist, no patterns will be returned.
+func LoadIgnoreFile(ignoreFilePath string) ([]string, error) {
+	content, err := os.ReadFile(ignoreFilePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, reporter.NewErrorEvent(reporter.FailedPackage, err, fmt.Sprintf("failed to load '%s'", ignoreFilePath))
+	}
+
+	var patterns []string
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns, nil
+}
+
+// MatchIgnorePatterns will return true if the slash-separated relative path matches one of the ignore patterns.
+// A pattern without '/' matches the name of the file or directory at any level,
+// a pattern with '/' matches the path relative to the root, and a pattern ending with '/' only matches directories.
+func MatchIgnorePatterns(relPath string, isDir bool, patterns []string) bool {
+	if relPath == "." {
+		return false
+	}
+	for _, pattern := range patterns {
+		if strings.HasSuffix(pattern, "/") {
+			if !isDir {
+				continue
+			}
+			pattern = strings.TrimSuffix(pattern, "/")
+		}
+		target := relPath
+		if strings.Contains(pattern, "/") {
+			pattern = strings.TrimPrefix(pattern, "/")
+		} else {
+			target = path.Base(relPath)
+		}
+		if matched, err := path.Match(pattern, target); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// UnTarDir will extract tar from 'tarPath' to 'destDir', the symlinks in the tar are not supported.
 func UnTarDir(tarPath string, destDir string) error {
+	return UnTarDirWithSymlinks(tarPath, destDir, nil)
+}
+
+// UnTarDirWithSymlinks will extract tar from 'tarPath' to 'destDir' with the symlinks in the tar.
+// 'checkSymlink' is called with the name of each symlink in the tar, its target and whether the target is in 'destDir',
+// and the symlink is created if it returns nil. The symlinks are not supported if 'checkSymlink' is nil.
+// The files out of 'destDir', including the ones written through the symlinks, are rejected to prevent the path traversal.
+func UnTarDirWithSymlinks(tarPath string, destDir string, checkSymlink func(name, target string, inRoot bool) error) error {
 	file, err := os.Open(tarPath)
 	if err != nil {
 		return reporter.NewErrorEvent(reporter.FailedCreateFile, err, fmt.Sprintf("failed to open '%s'", tarPath))
@@ -199,6 +359,13 @@ func UnTarDir(tarPath string, destDir string) error {
 		}
 
 		destFilePath := filepath.Join(destDir, header.Name)
+		if !PathInDir(destDir, destFilePath) {
+			return reporter.NewErrorEvent(
+				reporter.FailedUntarKclPkg,
+				fmt.Errorf("'%s' is out of '%s'", header.Name, destDir),
+				fmt.Sprintf("failed to untar '%s'", tarPath),
+			)
+		}
 		switch header.Typeflag {
 		case tar.TypeDir:
 			if err := os.MkdirAll(destFilePath, 0755); err != nil {
@@ -218,6 +385,23 @@ func UnTarDir(tarPath string, destDir string) error {
 			if _, err := io.Copy(outFile, tarReader); err != nil {
 				return reporter.NewErrorEvent(reporter.FailedCreateFile, err, fmt.Sprintf("failed to open '%s'", tarPath))
 			}
+		case tar.TypeSymlink:
+			if checkSymlink == nil {
+				return errors.UnknownTarFormat
+			}
+			target := header.Linkname
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(filepath.Dir(destFilePath), target)
+			}
+			if err := checkSymlink(header.Name, header.Linkname, PathInDir(destDir, target)); err != nil {
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(destFilePath), 0755); err != nil {
+				return err
+			}
+			if err := os.Symlink(header.Linkname, destFilePath); err != nil {
+				return reporter.NewErrorEvent(reporter.FailedCreateFile, err, fmt.Sprintf("failed to create the symlink '%s'", destFilePath))
+			}
 		default:
 			return errors.UnknownTarFormat
 		}
@@ -225,6 +409,56 @@ func UnTarDir(tarPath string, destDir string) error {
 	return nil
 }
 
+// PathInDir returns whether 'path' is in 'dir' after resolving the symlinks of both of them.
+func PathInDir(dir, path string) bool {
+	realDir, err := resolveExistingPath(dir)
+	if err != nil {
+		return false
+	}
+	realPath, err := resolveExistingPath(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(realDir, realPath)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// resolveExistingPath returns the absolute path of 'path' with the symlinks resolved.
+// If 'path' does not exist, the symlinks of its nearest existing parent are resolved,
+// and the dangling symlinks are resolved to where they point to.
+func resolveExistingPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err == nil {
+		return resolved, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+	if info, err := os.Lstat(abs); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(abs)
+		if err != nil {
+			return "", err
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(abs), target)
+		}
+		return resolveExistingPath(target)
+	}
+	parent := filepath.Dir(abs)
+	if parent == abs {
+		return abs, nil
+	}
+	realParent, err := resolveExistingPath(parent)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(realParent, filepath.Base(abs)), nil
+}
+
 // DirExists will check whether the directory 'path' exists.
 func DirExists(path string) bool {
 	_, err := os.Stat(path)
@@ -1,11 +1,17 @@
 package utils
 
 import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"kcl-lang.io/kpm/pkg/errors"
 )
 
 const testDataDir = "test_data"
@@ -54,6 +60,26 @@ func TestCreateFileIfNotExist(t *testing.T) {
 	assert.Equal(t, isExist, false)
 }
 
+func TestStoreToFileAtomically(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "kcl.mod.lock")
+	assert.Equal(t, StoreToFileAtomically(filePath, "v1"), nil)
+	assert.Equal(t, os.Chmod(filePath, 0600), nil)
+	assert.Equal(t, StoreToFileAtomically(filePath, "v2"), nil)
+
+	content, err := os.ReadFile(filePath)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, string(content), "v2")
+	info, err := os.Stat(filePath)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, info.Mode().Perm(), os.FileMode(0600))
+
+	// No temporary files are left.
+	entries, err := os.ReadDir(dir)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(entries), 1)
+}
+
 func TestHashDir(t *testing.T) {
 	test_path := filepath.Join(getTestDir("test_hash"), "test_hash.txt")
 	tp := TestPath{
@@ -66,6 +92,20 @@ func TestHashDir(t *testing.T) {
 	assert.Equal(t, res, "n4bQgYhMfWWaL+qgxVrQFaO/TxsrC4Is0V1sFbDwCgg=")
 }
 
+func TestDirSize(t *testing.T) {
+	dir := t.TempDir()
+	assert.Equal(t, os.WriteFile(filepath.Join(dir, "a.k"), []byte("a = 1\n"), 0644), nil)
+	assert.Equal(t, os.MkdirAll(filepath.Join(dir, "sub"), 0755), nil)
+	assert.Equal(t, os.WriteFile(filepath.Join(dir, "sub", "b.k"), []byte("b = 22\n"), 0644), nil)
+
+	size, err := DirSize(dir)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, size, int64(13))
+
+	_, err = DirSize(filepath.Join(dir, "not_exist"))
+	assert.NotEqual(t, err, nil)
+}
+
 func TestTarDir(t *testing.T) {
 	testDir := getTestDir("test_tar")
 	tarPath := filepath.Join(testDir, "test.tar")
@@ -172,3 +212,124 @@ func TestAbsTarPath(t *testing.T) {
 	assert.NotEqual(t, err, nil)
 	assert.Equal(t, abs, "")
 }
+
+func TestTarDirToWriterWithIgnore(t *testing.T) {
+	testDir := getTestDir("test_tar_with_ignore")
+
+	ignorePatterns, err := LoadIgnoreFile(filepath.Join(testDir, ".kpmignore"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, ignorePatterns, []string{"*.log", "ignored/"})
+
+	var buf bytes.Buffer
+	err = TarDirToWriter(testDir, &buf, ignorePatterns)
+	assert.Equal(t, err, nil)
+
+	var names []string
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.Equal(t, err, nil)
+		assert.Equal(t, hdr.ModTime.Unix(), int64(0))
+		names = append(names, hdr.Name)
+	}
+	assert.Equal(t, names, []string{".", ".kpmignore", "main.k", "sub", "sub/sub.k"})
+}
+
+func TestTarDirReproducible(t *testing.T) {
+	testDir := getTestDir("test_tar")
+	srcDir := filepath.Join(testDir, "test_src")
+	tarPath := filepath.Join(testDir, "test_reproducible.tar")
+	defer func() {
+		_ = os.Remove(tarPath)
+	}()
+
+	err := TarDir(srcDir, tarPath)
+	assert.Equal(t, err, nil)
+	firstTar, err := os.ReadFile(tarPath)
+	assert.Equal(t, err, nil)
+
+	// Touch the source files, the tar should still be the same.
+	now := time.Now()
+	err = os.Chtimes(filepath.Join(srcDir, "test_src.txt"), now, now)
+	assert.Equal(t, err, nil)
+
+	err = TarDir(srcDir, tarPath)
+	assert.Equal(t, err, nil)
+	secondTar, err := os.ReadFile(tarPath)
+	assert.Equal(t, err, nil)
+
+	assert.Equal(t, firstTar, secondTar)
+
+	tr := tar.NewReader(bytes.NewReader(secondTar))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.Equal(t, err, nil)
+		assert.Equal(t, hdr.Uid, 0)
+		assert.Equal(t, hdr.Gid, 0)
+		assert.Equal(t, hdr.Uname, "")
+		if hdr.Typeflag == tar.TypeDir {
+			assert.Equal(t, hdr.Mode, int64(0755))
+		} else {
+			assert.Equal(t, hdr.Mode, int64(0644))
+		}
+	}
+}
+
+func TestUnTarDirWithSymlinks(t *testing.T) {
+	writeTar := func(headers ...*tar.Header) string {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for _, hdr := range headers {
+			assert.Equal(t, tw.WriteHeader(hdr), nil)
+			if hdr.Typeflag == tar.TypeReg {
+				_, err := tw.Write(make([]byte, hdr.Size))
+				assert.Equal(t, err, nil)
+			}
+		}
+		assert.Equal(t, tw.Close(), nil)
+		tarPath := filepath.Join(t.TempDir(), "test.tar")
+		assert.Equal(t, os.WriteFile(tarPath, buf.Bytes(), 0644), nil)
+		return tarPath
+	}
+	followWithinRoot := func(name, target string, inRoot bool) error {
+		if !inRoot {
+			return fmt.Errorf("'%s' escapes the root", name)
+		}
+		return nil
+	}
+
+	mainFile := &tar.Header{Name: "main.k", Typeflag: tar.TypeReg, Mode: 0644, Size: 1}
+	inRootLink := &tar.Header{Name: "sub/alias.k", Typeflag: tar.TypeSymlink, Linkname: "../main.k"}
+	tarPath := writeTar(mainFile, inRootLink)
+	destDir := filepath.Join(t.TempDir(), "dest")
+	assert.Equal(t, UnTarDirWithSymlinks(tarPath, destDir, followWithinRoot), nil)
+	target, err := os.Readlink(filepath.Join(destDir, "sub", "alias.k"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, target, "../main.k")
+	// The symlinks are not supported without the check.
+	assert.Equal(t, UnTarDir(tarPath, filepath.Join(t.TempDir(), "dest")), errors.UnknownTarFormat)
+
+	escapingLink := &tar.Header{Name: "evil", Typeflag: tar.TypeSymlink, Linkname: "../../outside"}
+	err = UnTarDirWithSymlinks(writeTar(escapingLink), filepath.Join(t.TempDir(), "dest"), followWithinRoot)
+	assert.EqualError(t, err, "'evil' escapes the root")
+
+	// The files can not be written out of the root, even through the preserved symlinks.
+	outside := t.TempDir()
+	preserve := func(name, target string, inRoot bool) error { return nil }
+	destDir = filepath.Join(t.TempDir(), "dest")
+	err = UnTarDirWithSymlinks(writeTar(
+		&tar.Header{Name: "evil", Typeflag: tar.TypeSymlink, Linkname: outside},
+		&tar.Header{Name: "evil/passwd", Typeflag: tar.TypeReg, Mode: 0644, Size: 1},
+	), destDir, preserve)
+	assert.Contains(t, err.Error(), fmt.Sprintf("'evil/passwd' is out of '%s'", destDir))
+	_, err = os.Stat(filepath.Join(outside, "passwd"))
+	assert.True(t, os.IsNotExist(err))
+	err = UnTarDirWithSymlinks(writeTar(&tar.Header{Name: "../escaped.k", Typeflag: tar.TypeReg, Mode: 0644, Size: 1}), destDir, preserve)
+	assert.Contains(t, err.Error(), "'../escaped.k' is out of")
+}